@@ -0,0 +1,262 @@
+package aoi
+
+import (
+	"errors"
+)
+
+// 视野(AOI)管理:
+// 地图按边长为cell的格子划分, 实体能看到所在格子及周围8个格子中的实体, cell即视野半径.
+// 实体进入, 离开, 移动时只检查新旧九宫格, 计算需要通知的观察者:
+// 离开旧九宫格的互相通知LEAVE, 进入新九宫格的互相通知ENTER, 两者共有的收到MOVE.
+// Owner不为0的实体是观察者(玩家), 事件按Owner缓存, Flush时批量发出, 通常在房间tick时调用.
+// Map不加锁, 只能在一个goroutine(如房间)中使用.
+const (
+	EVENT_ENTER = int32(1) // 实体进入视野, 带位置和状态
+	EVENT_LEAVE = int32(2) // 实体离开视野
+	EVENT_MOVE  = int32(3) // 视野内的实体移动
+	EVENT_STATE = int32(4) // 视野内的实体状态变化
+)
+
+var (
+	ERROR_ENTITY_EXISTS    = errors.New("entity already in map")
+	ERROR_ENTITY_NOT_FOUND = errors.New("entity not in map")
+	ERROR_OUT_OF_MAP       = errors.New("position out of map")
+)
+
+// 地图中的实体
+type Entity struct {
+	Id     int64
+	Owner  int32 // 接收事件的玩家, 0为不接收(NPC等)
+	X, Y   float32
+	State  []byte // 外观等状态, 进入视野时一起发送
+	cx, cy int
+	slot   int // 在格子中的下标
+}
+
+// 推送给观察者的事件
+type Event struct {
+	Type  int32
+	Id    int64
+	X, Y  float32
+	State []byte // EVENT_ENTER和EVENT_STATE时有效
+}
+
+type Map struct {
+	width, height float32
+	cell          float32
+	cols, rows    int
+	cells         [][]*Entity
+	entities      map[int64]*Entity
+	pending       map[int32][]Event // Owner -> 待发送的事件, 发送后复用
+}
+
+// NewMap 创建width*height的地图, cell为格子边长(视野半径)
+func NewMap(width, height, cell float32) *Map {
+	m := &Map{
+		width:    width,
+		height:   height,
+		cell:     cell,
+		cols:     int(width/cell) + 1,
+		rows:     int(height/cell) + 1,
+		entities: make(map[int64]*Entity),
+		pending:  make(map[int32][]Event),
+	}
+	m.cells = make([][]*Entity, m.cols*m.rows)
+	return m
+}
+
+func (m *Map) insert(e *Entity) {
+	c := e.cy*m.cols + e.cx
+	e.slot = len(m.cells[c])
+	m.cells[c] = append(m.cells[c], e)
+}
+
+func (m *Map) remove(e *Entity) {
+	c := e.cy*m.cols + e.cx
+	cell := m.cells[c]
+	last := len(cell) - 1
+	cell[e.slot] = cell[last]
+	cell[e.slot].slot = e.slot
+	cell[last] = nil
+	m.cells[c] = cell[:last]
+}
+
+// 坐标来自客户端, 写成取反的形式, NaN的比较都为false, 也视为超出地图(Inf超出范围)
+func (m *Map) locate(x, y float32) (cx, cy int, err error) {
+	if !(x >= 0 && y >= 0 && x <= m.width && y <= m.height) {
+		return 0, 0, ERROR_OUT_OF_MAP
+	}
+	return int(x / m.cell), int(y / m.cell), nil
+}
+
+// 遍历以(cx, cy)为中心的九宫格
+func (m *Map) around(cx, cy int, fn func(e *Entity)) {
+	for y := cy - 1; y <= cy+1; y++ {
+		if y < 0 || y >= m.rows {
+			continue
+		}
+		for x := cx - 1; x <= cx+1; x++ {
+			if x < 0 || x >= m.cols {
+				continue
+			}
+			for _, e := range m.cells[y*m.cols+x] {
+				fn(e)
+			}
+		}
+	}
+}
+
+func near(ax, ay, bx, by int) bool {
+	dx, dy := ax-bx, ay-by
+	return dx >= -1 && dx <= 1 && dy >= -1 && dy <= 1
+}
+
+func (m *Map) push(owner int32, ev Event) {
+	if owner != 0 {
+		m.pending[owner] = append(m.pending[owner], ev)
+	}
+}
+
+// 互相通知a和b进入视野
+func (m *Map) meet(a, b *Entity) {
+	m.push(a.Owner, Event{Type: EVENT_ENTER, Id: b.Id, X: b.X, Y: b.Y, State: b.State})
+	m.push(b.Owner, Event{Type: EVENT_ENTER, Id: a.Id, X: a.X, Y: a.Y, State: a.State})
+}
+
+// 互相通知a和b离开视野
+func (m *Map) part(a, b *Entity) {
+	m.push(a.Owner, Event{Type: EVENT_LEAVE, Id: b.Id})
+	m.push(b.Owner, Event{Type: EVENT_LEAVE, Id: a.Id})
+}
+
+// Enter 实体进入地图
+func (m *Map) Enter(id int64, owner int32, x, y float32, state []byte) error {
+	if _, ok := m.entities[id]; ok {
+		return ERROR_ENTITY_EXISTS
+	}
+	cx, cy, err := m.locate(x, y)
+	if err != nil {
+		return err
+	}
+
+	e := &Entity{Id: id, Owner: owner, X: x, Y: y, State: state, cx: cx, cy: cy}
+	m.around(cx, cy, func(n *Entity) { m.meet(e, n) })
+	m.entities[id] = e
+	m.insert(e)
+	return nil
+}
+
+// Leave 实体离开地图, 已缓存的发给其Owner的事件被丢弃(一个玩家只拥有一个实体)
+func (m *Map) Leave(id int64) error {
+	e, ok := m.entities[id]
+	if !ok {
+		return ERROR_ENTITY_NOT_FOUND
+	}
+	delete(m.entities, id)
+	m.remove(e)
+	m.around(e.cx, e.cy, func(n *Entity) { m.push(n.Owner, Event{Type: EVENT_LEAVE, Id: id}) })
+	if e.Owner != 0 {
+		m.pending[e.Owner] = m.pending[e.Owner][:0]
+	}
+	return nil
+}
+
+// Move 实体移动到(x, y)
+func (m *Map) Move(id int64, x, y float32) error {
+	e, ok := m.entities[id]
+	if !ok {
+		return ERROR_ENTITY_NOT_FOUND
+	}
+	cx, cy, err := m.locate(x, y)
+	if err != nil {
+		return err
+	}
+
+	e.X, e.Y = x, y
+	move := Event{Type: EVENT_MOVE, Id: id, X: x, Y: y}
+	if cx == e.cx && cy == e.cy {
+		m.around(cx, cy, func(n *Entity) {
+			if n != e {
+				m.push(n.Owner, move)
+			}
+		})
+		return nil
+	}
+
+	// 跨格子: 先移出旧格子, 再按新旧九宫格的差异通知
+	ox, oy := e.cx, e.cy
+	m.remove(e)
+	m.around(ox, oy, func(n *Entity) {
+		if !near(n.cx, n.cy, cx, cy) {
+			m.part(e, n)
+		}
+	})
+	m.around(cx, cy, func(n *Entity) {
+		if near(n.cx, n.cy, ox, oy) {
+			m.push(n.Owner, move)
+		} else {
+			m.meet(e, n)
+		}
+	})
+	e.cx, e.cy = cx, cy
+	m.insert(e)
+	return nil
+}
+
+// SetState 修改实体状态, 通知视野内的观察者
+func (m *Map) SetState(id int64, state []byte) error {
+	e, ok := m.entities[id]
+	if !ok {
+		return ERROR_ENTITY_NOT_FOUND
+	}
+	e.State = state
+	ev := Event{Type: EVENT_STATE, Id: id, X: e.X, Y: e.Y, State: state}
+	m.around(e.cx, e.cy, func(n *Entity) {
+		if n != e {
+			m.push(n.Owner, ev)
+		}
+	})
+	return nil
+}
+
+// Get 地图中的实体, 不存在时返回nil, 不可修改
+func (m *Map) Get(id int64) *Entity {
+	return m.entities[id]
+}
+
+// Count 地图中的实体数
+func (m *Map) Count() int {
+	return len(m.entities)
+}
+
+// Observers 能看到实体的玩家
+func (m *Map) Observers(id int64) []int32 {
+	e, ok := m.entities[id]
+	if !ok {
+		return nil
+	}
+	var ret []int32
+	seen := make(map[int32]bool)
+	m.around(e.cx, e.cy, func(n *Entity) {
+		if n != e && n.Owner != 0 && !seen[n.Owner] {
+			seen[n.Owner] = true
+			ret = append(ret, n.Owner)
+		}
+	})
+	return ret
+}
+
+// Flush 发送并清空缓存的事件, events在send返回后被复用, send中需要完成打包
+func (m *Map) Flush(send func(owner int32, events []Event)) {
+	for owner, events := range m.pending {
+		if len(events) == 0 {
+			delete(m.pending, owner) // 上次tick以来没有事件, 释放缓存
+			continue
+		}
+		send(owner, events)
+		for k := range events {
+			events[k].State = nil
+		}
+		m.pending[owner] = events[:0]
+	}
+}
@@ -0,0 +1,209 @@
+package aoi
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func collect(m *Map) map[int32][]Event {
+	ret := make(map[int32][]Event)
+	m.Flush(func(owner int32, events []Event) { ret[owner] = append([]Event(nil), events...) })
+	return ret
+}
+
+func expect(t *testing.T, events []Event, typ int32, ids ...int64) {
+	var got []int64
+	for _, ev := range events {
+		if ev.Type == typ {
+			got = append(got, ev.Id)
+		}
+	}
+	sort.Slice(got, func(i, k int) bool { return got[i] < got[k] })
+	if len(got) != len(ids) {
+		t.Fatalf("unexpected events, type:%v got:%v expect:%v", typ, got, ids)
+	}
+	for k := range ids {
+		if got[k] != ids[k] {
+			t.Fatalf("unexpected events, type:%v got:%v expect:%v", typ, got, ids)
+		}
+	}
+}
+
+func TestGrid(t *testing.T) {
+	m := NewMap(1000, 1000, 100)
+	m.Enter(1, 1, 50, 50, []byte("a"))
+	m.Enter(2, 2, 150, 150, nil)
+	m.Enter(3, 3, 550, 550, nil)
+	m.Enter(100, 0, 560, 560, nil) // NPC
+	if err := m.Enter(1, 1, 0, 0, nil); err != ERROR_ENTITY_EXISTS {
+		t.Fatal("entered twice:", err)
+	}
+	if err := m.Enter(4, 4, 1001, 0, nil); err != ERROR_OUT_OF_MAP {
+		t.Fatal("out of map:", err)
+	}
+	nan, inf := float32(math.NaN()), float32(math.Inf(1))
+	for _, p := range [][2]float32{{nan, 0}, {0, nan}, {inf, 0}, {0, -inf}} {
+		if err := m.Enter(4, 4, p[0], p[1], nil); err != ERROR_OUT_OF_MAP {
+			t.Fatal("invalid position accepted:", p, err)
+		}
+	}
+	if err := m.Move(1, nan, 50); err != ERROR_OUT_OF_MAP {
+		t.Fatal("moved to NaN:", err)
+	}
+
+	evs := collect(m)
+	expect(t, evs[1], EVENT_ENTER, 2)
+	expect(t, evs[2], EVENT_ENTER, 1)
+	expect(t, evs[3], EVENT_ENTER, 100)
+	if evs[2][0].State == nil || string(evs[2][0].State) != "a" {
+		t.Fatal("state not sent on enter:", evs[2])
+	}
+
+	// 跨格子移动, 离开1的视野, 进入3的视野
+	m.Move(2, 450, 450)
+	evs = collect(m)
+	expect(t, evs[1], EVENT_LEAVE, 2)
+	expect(t, evs[2], EVENT_LEAVE, 1)
+	expect(t, evs[2], EVENT_ENTER, 3, 100)
+	expect(t, evs[3], EVENT_ENTER, 2)
+
+	// 格子内移动和状态变化只通知视野内的观察者
+	m.Move(3, 590, 590)
+	m.SetState(100, []byte("angry"))
+	evs = collect(m)
+	expect(t, evs[2], EVENT_MOVE, 3)
+	expect(t, evs[2], EVENT_STATE, 100)
+	expect(t, evs[3], EVENT_STATE, 100)
+	if _, ok := evs[1]; ok {
+		t.Fatal("far observer notified:", evs[1])
+	}
+
+	obs := m.Observers(100)
+	sort.Slice(obs, func(i, k int) bool { return obs[i] < obs[k] })
+	if len(obs) != 2 || obs[0] != 2 || obs[1] != 3 {
+		t.Fatal("unexpected observers:", obs)
+	}
+
+	m.Leave(2)
+	evs = collect(m)
+	expect(t, evs[3], EVENT_LEAVE, 2)
+	if _, ok := evs[2]; ok || m.Count() != 3 {
+		t.Fatal("left entity notified:", evs[2])
+	}
+}
+
+// 5000个实体, 平均每个九宫格约18个
+const (
+	bench_entities = 5000
+	bench_size     = 5000
+	bench_cell     = 100
+)
+
+func bench_map() *Map {
+	rnd := rand.New(rand.NewSource(1))
+	m := NewMap(bench_size, bench_size, bench_cell)
+	for i := 0; i < bench_entities; i++ {
+		m.Enter(int64(i+1), int32(i+1), rnd.Float32()*bench_size, rnd.Float32()*bench_size, nil)
+	}
+	m.Flush(func(int32, []Event) {})
+	return m
+}
+
+func BenchmarkMove(b *testing.B) {
+	m := bench_map()
+	rnd := rand.New(rand.NewSource(2))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		id := int64(i%bench_entities + 1)
+		e := m.Get(id)
+		x, y := e.X+rnd.Float32()*20-10, e.Y+rnd.Float32()*20-10
+		if x < 0 || x > bench_size {
+			x = e.X
+		}
+		if y < 0 || y > bench_size {
+			y = e.Y
+		}
+		m.Move(id, x, y)
+		if id == bench_entities { // 全部实体移动一次后发送, 相当于一次tick
+			m.Flush(func(int32, []Event) {})
+		}
+	}
+}
+
+func BenchmarkEnterLeave(b *testing.B) {
+	m := bench_map()
+	rnd := rand.New(rand.NewSource(3))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		id := int64(bench_entities + 1)
+		m.Enter(id, int32(id), rnd.Float32()*bench_size, rnd.Float32()*bench_size, nil)
+		m.Leave(id)
+		if i%bench_entities == 0 {
+			m.Flush(func(int32, []Event) {})
+		}
+	}
+}
+
+func BenchmarkTick(b *testing.B) {
+	m := bench_map()
+	rnd := rand.New(rand.NewSource(4))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for id := int64(1); id <= bench_entities; id++ {
+			e := m.Get(id)
+			x, y := e.X+rnd.Float32()*20-10, e.Y+rnd.Float32()*20-10
+			if x >= 0 && x <= bench_size && y >= 0 && y <= bench_size {
+				m.Move(id, x, y)
+			}
+		}
+		m.Flush(func(int32, []Event) {})
+	}
+}
+
+func TestMoveSpeed(t *testing.T) {
+	w := New(1000, 1000, 100, nil)
+	w.MaxSpeed = 100 // tick rate 10, 每tick 10
+	w.Map.Enter(1, 1, 500, 500, nil)
+	move := func(x, y float32, frame uint32) bool {
+		if !w.allow_move(1, x, y, frame, 10) {
+			return false
+		}
+		w.Map.Move(1, x, y)
+		return true
+	}
+
+	if move(900, 500, 0) {
+		t.Fatal("teleport accepted")
+	}
+	if !move(510, 500, 0) {
+		t.Fatal("move within one tick rejected")
+	}
+	if move(511, 500, 0) {
+		t.Fatal("overdrawn in the same tick")
+	}
+	// 输入堆积: 3个tick后连续到达
+	if !move(530, 500, 3) || !move(540, 500, 3) {
+		t.Fatal("delayed moves rejected")
+	}
+	if move(541, 500, 3) {
+		t.Fatal("budget exceeded")
+	}
+	// 长时间静止最多累积MOVE_BURST个tick
+	if move(610, 500, 1000) {
+		t.Fatal("idle budget not capped")
+	}
+	if !move(600, 500, 1000) {
+		t.Fatal("burst rejected")
+	}
+	nan := float32(math.NaN())
+	if move(nan, 500, 2000) {
+		t.Fatal("NaN accepted")
+	}
+
+	w.MaxSpeed = 0
+	if !move(900, 900, 2000) {
+		t.Fatal("unlimited speed rejected")
+	}
+}
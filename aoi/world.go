@@ -0,0 +1,120 @@
+package aoi
+
+import (
+	"encoding/binary"
+	"math"
+
+	"game/rooms"
+)
+
+// 开放世界地图实例:
+// 作为rooms的房间逻辑运行, 每个加入的玩家是一个以userid为id的实体, 在出生点进入地图.
+// NPC等实体由服务器逻辑通过Room.Do访问Map添加, id需要大于int32的范围以免与玩家冲突.
+// 每次tick把视野事件批量打包, 通过ipc推送给各玩家.
+// MaxSpeed大于0时校验移动距离: 每个tick给玩家累积MaxSpeed/TickRate的移动额度(最多MOVE_BURST个tick),
+// 超出额度的移动被丢弃, 玩家停留在原位置.
+//
+// 玩家输入的第一个字节为操作:
+//
+//	INPUT_MOVE   x, y(float32, 小端)
+//	INPUT_STATE  之后的全部字节为新状态
+const (
+	INPUT_MOVE  = byte(1)
+	INPUT_STATE = byte(2)
+)
+
+const (
+	MOVE_BURST = 5 // 最多累积的tick数, 容忍网络抖动造成的输入堆积
+)
+
+type World struct {
+	Map            *Map
+	SpawnX, SpawnY float32
+	Encode         func(events []Event) []byte // 打包推送给一个玩家的事件
+	MaxSpeed       float32                     // 每秒最大移动距离, 0为不限制
+	movers         map[int32]*mover
+}
+
+// 玩家的移动额度
+type mover struct {
+	frame  uint32  // 上次结算额度的帧
+	budget float32 // 可移动的距离, 可为负(透支当前tick)
+}
+
+// New 创建地图实例, cell为视野半径
+func New(width, height, cell float32, encode func(events []Event) []byte) *World {
+	return &World{Map: NewMap(width, height, cell), SpawnX: width / 2, SpawnY: height / 2, Encode: encode, movers: make(map[int32]*mover)}
+}
+
+func (w *World) OnJoin(r *rooms.Room, userid int32) error {
+	// 重连时已在地图中, 保留原位置
+	if w.Map.Get(int64(userid)) != nil {
+		return nil
+	}
+	return w.Map.Enter(int64(userid), userid, w.SpawnX, w.SpawnY, nil)
+}
+
+func (w *World) OnLeave(r *rooms.Room, userid int32) {
+	w.Map.Leave(int64(userid))
+	delete(w.movers, userid)
+}
+
+func (w *World) OnInput(r *rooms.Room, userid int32, data []byte) {
+	if len(data) == 0 {
+		return
+	}
+	switch data[0] {
+	case INPUT_MOVE:
+		if len(data) != 9 {
+			return
+		}
+		x := math.Float32frombits(binary.LittleEndian.Uint32(data[1:]))
+		y := math.Float32frombits(binary.LittleEndian.Uint32(data[5:]))
+		if !w.allow_move(userid, x, y, r.Frame(), r.TickRate()) {
+			return
+		}
+		w.Map.Move(int64(userid), x, y)
+	case INPUT_STATE:
+		state := make([]byte, len(data)-1)
+		copy(state, data[1:])
+		w.Map.SetState(int64(userid), state)
+	}
+}
+
+// 结算到frame为止的额度, 当前tick的额度可以预支
+func (w *World) allow_move(userid int32, x, y float32, frame uint32, rate int) bool {
+	if w.MaxSpeed <= 0 {
+		return true
+	}
+	e := w.Map.Get(int64(userid))
+	if e == nil || rate <= 0 {
+		return false
+	}
+	m := w.movers[userid]
+	if m == nil {
+		m = &mover{frame: frame}
+		w.movers[userid] = m
+	}
+
+	step := w.MaxSpeed / float32(rate)
+	m.budget += step * float32(frame-m.frame)
+	if m.budget > step*MOVE_BURST {
+		m.budget = step * MOVE_BURST
+	}
+	m.frame = frame
+
+	dist := float32(math.Hypot(float64(x-e.X), float64(y-e.Y)))
+	if !(dist <= m.budget+step) { // NaN同样拒绝
+		return false
+	}
+	m.budget -= dist
+	return true
+}
+
+func (w *World) OnTick(r *rooms.Room, frame uint32) {
+	w.Map.Flush(func(owner int32, events []Event) {
+		r.Send(owner, w.Encode(events))
+	})
+}
+
+func (w *World) OnClose(r *rooms.Room, reason int) {}
@@ -0,0 +1,166 @@
+package auction
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"game/db"
+	"game/kafka"
+	"game/mail"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// 拍卖行:
+// 卖家上架时道具从背包扣除进入托管, 买家购买时先扣除货币, 再以比较并交换(CAS)把挂单从ACTIVE改为SOLD,
+// 只有一个买家能成功, 失败的买家退款; 之后道具通过邮件发给买家, 扣税后的货款给卖家, 再SOLD -> SETTLED.
+// 卖家下架或过期时ACTIVE -> CANCELLING/EXPIRING, 道具通过邮件退回后再改为CANCELLED/EXPIRED.
+// 发放道具和货币都以挂单id和步骤为幂等键, 先发放再进入终态, 中途失败或崩溃时停留在中间状态, 重试是安全的.
+// 状态保存在mongodb中, 所有状态变化都是CAS, 多个game实例同时操作同一挂单是安全的.
+// 每一步都把挂单写入WAL, 并写入trace, 用于审计和回滚.
+// 后台定期处理过期的挂单, 以及停留在中间状态(SOLD, CANCELLING, EXPIRING)的挂单.
+const (
+	COLLECTION_AUCTIONS = "auctions"
+
+	SWEEP_INTERVAL = time.Minute
+	SETTLE_TIMEOUT = time.Minute // 停留在中间状态超过该时间时由后台处理
+	MAX_SWEEP      = 100         // 每次后台处理的最大挂单数
+	MAX_SEARCH     = 50          // 单次查询的最大挂单数
+)
+
+// 挂单状态
+const (
+	STATE_ACTIVE     = int32(1) // 在售, 道具已托管
+	STATE_SOLD       = int32(2) // 已售出, 买家已付款, 待结算
+	STATE_SETTLED    = int32(3) // 已结算
+	STATE_CANCELLED  = int32(4) // 卖家下架, 道具已退回
+	STATE_EXPIRED    = int32(5) // 过期, 道具已退回
+	STATE_CANCELLING = int32(6) // 卖家下架, 道具待退回
+	STATE_EXPIRING   = int32(7) // 过期, 道具待退回
+)
+
+// 道具发放原因
+const (
+	DELIVER_BOUGHT   = int32(1) // 购买的道具
+	DELIVER_RETURNED = int32(2) // 下架或过期退回的道具
+)
+
+var (
+	ERROR_LISTING_NOT_FOUND = errors.New("listing not found")
+	ERROR_NOT_AVAILABLE     = errors.New("listing sold, cancelled or expired")
+	ERROR_OWN_LISTING       = errors.New("cannot buy own listing")
+	ERROR_NOT_SELLER        = errors.New("not the seller of listing")
+	ERROR_INVALID_ITEM      = errors.New("invalid auction item")
+	ERROR_INVALID_PRICE     = errors.New("invalid auction price")
+	ERROR_TOO_MANY_LISTINGS = errors.New("too many listings")
+)
+
+// 挂单
+type Listing struct {
+	Id        string          `bson:"_id"`
+	Seller    int32           `bson:"seller"`
+	Item      mail.Attachment `bson:"item"`
+	Currency  int32           `bson:"currency"`
+	Price     int64           `bson:"price"`
+	Tax       int64           `bson:"tax"` // 成交时按税率计算, 从货款中扣除
+	State     int32           `bson:"state"`
+	Buyer     int32           `bson:"buyer,omitempty"`
+	CreatedAt int64           `bson:"created_at"`
+	ExpireAt  int64           `bson:"expire_at"`
+	UpdatedAt int64           `bson:"updated_at"`
+}
+
+// 拍卖行参数, 来自数值表
+type Config struct {
+	TaxRate     int64         // 税率, 千分比
+	Duration    time.Duration // 挂单有效期
+	MaxListings int           // 每个卖家同时在售的最大挂单数
+}
+
+func DefaultConfig() Config {
+	return Config{TaxRate: 50, Duration: 48 * time.Hour, MaxListings: 10}
+}
+
+var (
+	_store  store
+	_config = DefaultConfig()
+	_mu     sync.RWMutex
+
+	// Escrow 从卖家背包扣除道具, 由上层设置
+	Escrow func(userid int32, item mail.Attachment) error
+
+	// Deliver 通过邮件发放道具, reason为DELIVER_XXX, key为幂等键, 由上层设置
+	Deliver func(userid int32, item mail.Attachment, reason int32, key string) error
+
+	// Debit 扣除买家货币, key为幂等键, 由上层设置
+	Debit func(userid, currency int32, amount int64, key string) error
+
+	// Credit 增加货币(退款和货款), key为幂等键, 由上层设置
+	Credit func(userid, currency int32, amount int64, key string) error
+)
+
+func Init(database *db.Database) {
+	if database.IsLocal() {
+		_store = new_memory_store(database)
+	} else {
+		_store = new_mongo_store(database)
+	}
+	go sweeper()
+}
+
+// SetConfig 设置参数, 数值表热更新时调用
+func SetConfig(cfg Config) {
+	_mu.Lock()
+	_config = cfg
+	_mu.Unlock()
+}
+
+func config() Config {
+	_mu.RLock()
+	defer _mu.RUnlock()
+	return _config
+}
+
+// 写入WAL和trace
+func commit(l *Listing, step string, userid int32) {
+	kafka.CommitUpdate(l.Id, l, COLLECTION_AUCTIONS)
+	kafka.TraceEvent("auction_"+step, userid, map[string]interface{}{
+		"listing":  l.Id,
+		"state":    l.State,
+		"seller":   l.Seller,
+		"buyer":    l.Buyer,
+		"item":     l.Item,
+		"currency": l.Currency,
+		"price":    l.Price,
+		"tax":      l.Tax,
+	})
+}
+
+func sweeper() {
+	for range time.Tick(SWEEP_INTERVAL) {
+		sweep(time.Now())
+	}
+}
+
+// 处理过期和未结算的挂单, 多个实例同时处理时由CAS保证只处理一次
+func sweep(now time.Time) {
+	listings, err := _store.due(now.Unix(), now.Add(-SETTLE_TIMEOUT).Unix(), MAX_SWEEP)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	for k := range listings {
+		l := &listings[k]
+		switch l.State {
+		case STATE_ACTIVE:
+			if err := close_listing(l, STATE_EXPIRED, now); err != nil && err != ERROR_NOT_AVAILABLE {
+				log.Error("auction: expire failed:", l.Id, err)
+			}
+		case STATE_SOLD:
+			settle(l, now)
+		case STATE_CANCELLING, STATE_EXPIRING:
+			finish_close(l, now)
+		}
+	}
+}
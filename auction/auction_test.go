@@ -0,0 +1,252 @@
+package auction
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"game/db"
+	"game/kafka"
+	"game/mail"
+)
+
+func init() {
+	kafka.InitDiscard()
+}
+
+type wallet struct {
+	gold  map[int32]int64
+	items map[int32]int32 // userid -> 道具数量(只有一种道具)
+	keys  map[string]bool
+	mails []int32 // DELIVER_XXX
+	fail  int     // 接下来失败的Deliver次数
+	dir   string
+}
+
+// 重新打开dir上的本地存储, 相当于standalone实例重启
+func reopen(dir string) {
+	var database db.Database
+	database.InitLocal(dir)
+	_store = new_memory_store(&database)
+}
+
+func setup(t *testing.T) *wallet {
+	dir, err := ioutil.TempDir("", "auction")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := &wallet{gold: map[int32]int64{1: 0, 2: 1000, 3: 1000}, items: map[int32]int32{1: 5}, keys: make(map[string]bool), dir: dir}
+	reopen(dir)
+	SetConfig(Config{TaxRate: 100, Duration: time.Hour, MaxListings: 2})
+	Escrow = func(userid int32, item mail.Attachment) error {
+		if w.items[userid] < item.Count {
+			return errors.New("not enough")
+		}
+		w.items[userid] -= item.Count
+		return nil
+	}
+	Deliver = func(userid int32, item mail.Attachment, reason int32, key string) error {
+		if w.fail > 0 {
+			w.fail--
+			return errors.New("mail unavailable")
+		}
+		if w.keys[key] {
+			return nil
+		}
+		w.keys[key] = true
+		w.items[userid] += item.Count
+		w.mails = append(w.mails, reason)
+		return nil
+	}
+	Debit = func(userid, currency int32, amount int64, key string) error {
+		if w.gold[userid] < amount {
+			return errors.New("not enough")
+		}
+		w.gold[userid] -= amount
+		return nil
+	}
+	Credit = func(userid, currency int32, amount int64, key string) error {
+		if w.keys[key] {
+			return nil
+		}
+		w.keys[key] = true
+		w.gold[userid] += amount
+		return nil
+	}
+	return w
+}
+
+func TestTrade(t *testing.T) {
+	w := setup(t)
+	defer os.RemoveAll(w.dir)
+	now := time.Now()
+	item := mail.Attachment{Type: mail.ATTACH_ITEM, Id: 100, Count: 2}
+
+	l, err := Sell(1, item, 1, 500, now)
+	if err != nil || w.items[1] != 3 {
+		t.Fatal("sell failed:", err, w.items)
+	}
+	if _, err := Sell(1, mail.Attachment{Type: mail.ATTACH_CURRENCY, Id: 1, Count: 1}, 1, 1, now); err != ERROR_INVALID_ITEM {
+		t.Fatal("currency listed:", err)
+	}
+	if _, err := Buy(1, l.Id, now); err != ERROR_OWN_LISTING {
+		t.Fatal("bought own listing:", err)
+	}
+	if found, _ := Search(100, now); len(found) != 1 {
+		t.Fatal("listing not found:", found)
+	}
+
+	sold, err := Buy(2, l.Id, now)
+	if err != nil || sold.Tax != 50 {
+		t.Fatal("buy failed:", err, sold)
+	}
+	if w.gold[2] != 500 || w.items[2] != 2 || w.gold[1] != 450 {
+		t.Fatal("not settled:", w.gold, w.items)
+	}
+	if got, _ := _store.get(l.Id); got.State != STATE_SETTLED {
+		t.Fatal("unexpected state:", got.State)
+	}
+
+	// 已售出, 第二个买家不扣款
+	if _, err := Buy(3, l.Id, now); err != ERROR_NOT_AVAILABLE || w.gold[3] != 1000 {
+		t.Fatal("bought twice:", err, w.gold)
+	}
+}
+
+// 返回旧的挂单, 模拟其他实例上同时读到ACTIVE的买家
+type stale_store struct {
+	*memory_store
+	stale Listing
+}
+
+func (s *stale_store) get(id string) (*Listing, error) {
+	l := s.stale
+	return &l, nil
+}
+
+func TestRace(t *testing.T) {
+	w := setup(t)
+	defer os.RemoveAll(w.dir)
+	now := time.Now()
+	l, _ := Sell(1, mail.Attachment{Type: mail.ATTACH_ITEM, Id: 100, Count: 1}, 1, 100, now)
+	if _, err := Buy(2, l.Id, now); err != nil {
+		t.Fatal(err)
+	}
+
+	// 后到的买家CAS失败, 退款
+	_store = &stale_store{memory_store: _store.(*memory_store), stale: *l}
+	if _, err := Buy(3, l.Id, now); err != ERROR_NOT_AVAILABLE || w.gold[3] != 1000 {
+		t.Fatal("lost race not refunded:", err, w.gold)
+	}
+	if w.items[3] != 0 || w.gold[1] != 90 {
+		t.Fatal("settled twice:", w.items, w.gold)
+	}
+}
+
+func TestExpire(t *testing.T) {
+	w := setup(t)
+	defer os.RemoveAll(w.dir)
+	now := time.Now()
+	item := mail.Attachment{Type: mail.ATTACH_ITEM, Id: 100, Count: 1}
+	a, _ := Sell(1, item, 1, 100, now)
+	b, _ := Sell(1, item, 1, 100, now)
+	if _, err := Sell(1, item, 1, 100, now); err != ERROR_TOO_MANY_LISTINGS {
+		t.Fatal("listing limit:", err)
+	}
+
+	if err := Cancel(2, a.Id, now); err != ERROR_NOT_SELLER {
+		t.Fatal("cancelled by others:", err)
+	}
+	if err := Cancel(1, a.Id, now); err != nil || w.items[1] != 4 {
+		t.Fatal("cancel failed:", err, w.items)
+	}
+
+	// 崩溃后停留在SOLD状态, 由后台结算
+	sold := *b
+	sold.State, sold.Buyer, sold.UpdatedAt = STATE_SOLD, 2, now.Unix()
+	_store.transit(&sold, STATE_ACTIVE)
+	sweep(now)
+	if w.items[2] != 0 {
+		t.Fatal("settled too early")
+	}
+	sweep(now.Add(SETTLE_TIMEOUT))
+	if w.items[2] != 1 || w.gold[1] != 100 {
+		t.Fatal("not recovered:", w.items, w.gold)
+	}
+
+	c, _ := Sell(1, item, 1, 100, now)
+	sweep(now.Add(2 * time.Hour))
+	if got, _ := _store.get(c.Id); got.State != STATE_EXPIRED || w.items[1] != 4 {
+		t.Fatal("not expired:", got.State, w.items)
+	}
+	if _, err := Buy(2, c.Id, now); err != ERROR_NOT_AVAILABLE {
+		t.Fatal("bought expired:", err)
+	}
+}
+
+func TestRetry(t *testing.T) {
+	w := setup(t)
+	defer os.RemoveAll(w.dir)
+	now := time.Now()
+	item := mail.Attachment{Type: mail.ATTACH_ITEM, Id: 100, Count: 1}
+
+	// 发放失败时停留在SOLD, 由后台重试, 不重复发放
+	a, _ := Sell(1, item, 1, 100, now)
+	w.fail = 1
+	if _, err := Buy(2, a.Id, now); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := _store.get(a.Id); got.State != STATE_SOLD || w.items[2] != 0 || w.gold[1] != 0 {
+		t.Fatal("settled without delivery:", got.State, w.items, w.gold)
+	}
+	sweep(now.Add(SETTLE_TIMEOUT))
+	sweep(now.Add(SETTLE_TIMEOUT))
+	if got, _ := _store.get(a.Id); got.State != STATE_SETTLED || w.items[2] != 1 || w.gold[1] != 90 {
+		t.Fatal("not recovered:", got.State, w.items, w.gold)
+	}
+
+	// 退回失败时停留在CANCELLING, 由后台重试
+	b, _ := Sell(1, item, 1, 100, now)
+	w.fail = 1
+	if err := Cancel(1, b.Id, now); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := _store.get(b.Id); got.State != STATE_CANCELLING || w.items[1] != 3 {
+		t.Fatal("cancelled without return:", got.State, w.items)
+	}
+	sweep(now.Add(SETTLE_TIMEOUT))
+	if got, _ := _store.get(b.Id); got.State != STATE_CANCELLED || w.items[1] != 4 {
+		t.Fatal("not returned:", got.State, w.items)
+	}
+}
+
+func TestRestart(t *testing.T) {
+	w := setup(t)
+	defer os.RemoveAll(w.dir)
+	now := time.Now()
+	item := mail.Attachment{Type: mail.ATTACH_ITEM, Id: 100, Count: 1}
+
+	a, _ := Sell(1, item, 1, 100, now)
+	b, _ := Sell(1, item, 1, 200, now)
+	w.fail = 1
+	if _, err := Buy(2, a.Id, now); err != nil {
+		t.Fatal(err)
+	}
+
+	// 重启后在售的挂单仍可购买, 停留在SOLD的挂单由后台结算
+	reopen(w.dir)
+	if found, _ := Search(100, now); len(found) != 1 || found[0].Id != b.Id {
+		t.Fatal("listings lost after restart:", found)
+	}
+	sweep(now.Add(SETTLE_TIMEOUT))
+	if w.items[2] != 1 || w.gold[1] != 90 {
+		t.Fatal("not settled after restart:", w.items, w.gold)
+	}
+
+	reopen(w.dir)
+	if got, err := _store.get(a.Id); err != nil || got.State != STATE_SETTLED || got.Buyer != 2 {
+		t.Fatal("settlement not persisted:", got, err)
+	}
+}
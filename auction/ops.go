@@ -0,0 +1,185 @@
+package auction
+
+import (
+	"time"
+
+	"game/mail"
+
+	log "github.com/Sirupsen/logrus"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// 挂单每一步的幂等键, 用于货币交易和邮件
+func step_key(l *Listing, step string) string {
+	return "auction:" + l.Id + ":" + step
+}
+
+// 等待发放完成的中间状态
+func pending(state int32) bool {
+	return state == STATE_SOLD || state == STATE_CANCELLING || state == STATE_EXPIRING
+}
+
+// Sell 上架道具, 道具进入托管
+func Sell(seller int32, item mail.Attachment, currency int32, price int64, now time.Time) (*Listing, error) {
+	if item.Type != mail.ATTACH_ITEM || item.Count <= 0 {
+		return nil, ERROR_INVALID_ITEM
+	}
+	if price <= 0 {
+		return nil, ERROR_INVALID_PRICE
+	}
+	cfg := config()
+	if listings, err := _store.by_seller(seller); err != nil {
+		return nil, err
+	} else if len(listings) >= cfg.MaxListings {
+		return nil, ERROR_TOO_MANY_LISTINGS
+	}
+
+	l := &Listing{
+		Id:        bson.NewObjectId().Hex(),
+		Seller:    seller,
+		Item:      item,
+		Currency:  currency,
+		Price:     price,
+		State:     STATE_ACTIVE,
+		CreatedAt: now.Unix(),
+		ExpireAt:  now.Add(cfg.Duration).Unix(),
+		UpdatedAt: now.Unix(),
+	}
+	if err := Escrow(seller, item); err != nil {
+		return nil, err
+	}
+	if err := _store.insert(l); err != nil {
+		// 道具已扣除, 退回
+		if err := Deliver(seller, item, DELIVER_RETURNED, step_key(l, "return")); err != nil {
+			log.Errorf("auction: return escrow failed, seller:%v item:%+v err:%v", seller, item, err)
+		}
+		return nil, err
+	}
+	commit(l, "sell", seller)
+	return l, nil
+}
+
+// Buy 购买挂单: 扣款, CAS为SOLD, 失败时退款; 成功后立即结算
+func Buy(buyer int32, id string, now time.Time) (*Listing, error) {
+	l, err := _store.get(id)
+	if err != nil {
+		return nil, err
+	}
+	if l.State != STATE_ACTIVE || l.ExpireAt <= now.Unix() {
+		return nil, ERROR_NOT_AVAILABLE
+	}
+	if l.Seller == buyer {
+		return nil, ERROR_OWN_LISTING
+	}
+
+	if err := Debit(buyer, l.Currency, l.Price, step_key(l, "buy")); err != nil {
+		return nil, err
+	}
+	sold := *l
+	sold.State = STATE_SOLD
+	sold.Buyer = buyer
+	sold.Tax = l.Price * config().TaxRate / 1000
+	sold.UpdatedAt = now.Unix()
+	ok, err := _store.transit(&sold, STATE_ACTIVE)
+	if !ok {
+		// 已被其他买家买走, 下架或过期
+		if err := Credit(buyer, l.Currency, l.Price, step_key(l, "refund")); err != nil {
+			log.Errorf("auction: refund failed, listing:%v buyer:%v err:%v", l.Id, buyer, err)
+		}
+		if err == nil {
+			err = ERROR_NOT_AVAILABLE
+		}
+		return nil, err
+	}
+	commit(&sold, "buy", buyer)
+	settle(&sold, now)
+	return &sold, nil
+}
+
+// 结算已售出的挂单: 发放道具和货款(幂等), 再CAS为SETTLED; 失败时停留在SOLD, 由后台重试
+func settle(l *Listing, now time.Time) {
+	if err := Deliver(l.Buyer, l.Item, DELIVER_BOUGHT, step_key(l, "deliver")); err != nil {
+		log.Errorf("auction: deliver failed, listing:%v buyer:%v err:%v", l.Id, l.Buyer, err)
+		commit(l, "deliver_failed", l.Buyer)
+		return
+	}
+	if proceeds := l.Price - l.Tax; proceeds > 0 {
+		if err := Credit(l.Seller, l.Currency, proceeds, step_key(l, "proceeds")); err != nil {
+			log.Errorf("auction: pay seller failed, listing:%v seller:%v err:%v", l.Id, l.Seller, err)
+			commit(l, "proceeds_failed", l.Seller)
+			return
+		}
+	}
+
+	settled := *l
+	settled.State = STATE_SETTLED
+	settled.UpdatedAt = now.Unix()
+	if ok, err := _store.transit(&settled, STATE_SOLD); ok {
+		commit(&settled, "settle", l.Buyer)
+	} else if err != nil {
+		log.Error("auction: settle failed:", l.Id, err)
+	}
+}
+
+// Cancel 卖家下架, 道具通过邮件退回
+func Cancel(seller int32, id string, now time.Time) error {
+	l, err := _store.get(id)
+	if err != nil {
+		return err
+	}
+	if l.Seller != seller {
+		return ERROR_NOT_SELLER
+	}
+	return close_listing(l, STATE_CANCELLED, now)
+}
+
+// 下架或过期: CAS为CANCELLING/EXPIRING, 成功的一方退回道具
+func close_listing(l *Listing, state int32, now time.Time) error {
+	closing := *l
+	closing.State = STATE_CANCELLING
+	step := "cancel"
+	if state == STATE_EXPIRED {
+		closing.State = STATE_EXPIRING
+		step = "expire"
+	}
+	closing.UpdatedAt = now.Unix()
+	if ok, err := _store.transit(&closing, STATE_ACTIVE); err != nil {
+		return err
+	} else if !ok {
+		return ERROR_NOT_AVAILABLE
+	}
+	commit(&closing, step, l.Seller)
+	finish_close(&closing, now)
+	return nil
+}
+
+// 退回道具(幂等), 再CAS为CANCELLED/EXPIRED; 失败时停留在中间状态, 由后台重试
+func finish_close(l *Listing, now time.Time) {
+	if err := Deliver(l.Seller, l.Item, DELIVER_RETURNED, step_key(l, "return")); err != nil {
+		log.Errorf("auction: return failed, listing:%v seller:%v err:%v", l.Id, l.Seller, err)
+		commit(l, "return_failed", l.Seller)
+		return
+	}
+
+	closed := *l
+	closed.State = STATE_CANCELLED
+	if l.State == STATE_EXPIRING {
+		closed.State = STATE_EXPIRED
+	}
+	closed.UpdatedAt = now.Unix()
+	if ok, err := _store.transit(&closed, l.State); ok {
+		commit(&closed, "close", l.Seller)
+	} else if err != nil {
+		log.Error("auction: close failed:", l.Id, err)
+	}
+}
+
+// Search 在售的道具, 按价格升序, item为0时不限道具
+func Search(item int32, now time.Time) ([]Listing, error) {
+	return _store.search(item, now.Unix(), MAX_SEARCH)
+}
+
+// Mine 卖家在售的挂单
+func Mine(seller int32) ([]Listing, error) {
+	return _store.by_seller(seller)
+}
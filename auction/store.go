@@ -0,0 +1,162 @@
+package auction
+
+import (
+	"sort"
+
+	"game/db"
+
+	log "github.com/Sirupsen/logrus"
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// 挂单存储, transit是以state为条件的比较并交换
+type store interface {
+	insert(l *Listing) error
+	get(id string) (*Listing, error)
+	transit(l *Listing, from int32) (bool, error)               // 只在当前状态为from时用l替换, 返回是否成功
+	search(item int32, now int64, limit int) ([]Listing, error) // 在售的道具, 按价格升序, item为0时不限
+	by_seller(seller int32) ([]Listing, error)                  // 卖家在售的挂单
+	due(now, settle_before int64, limit int) ([]Listing, error) // 已过期的在售挂单和超时未结算的挂单
+}
+
+// mongodb存储
+type mongo_store struct {
+	db *db.Database
+}
+
+func new_mongo_store(database *db.Database) *mongo_store {
+	err := database.Execute(func(sess *mgo.Session) error {
+		c := sess.DB("").C(COLLECTION_AUCTIONS)
+		for _, key := range [][]string{{"state", "item.id", "price"}, {"seller", "state"}, {"state", "expire_at"}} {
+			if err := c.EnsureIndex(mgo.Index{Key: key}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Error(err)
+	}
+	return &mongo_store{db: database}
+}
+
+func (s *mongo_store) insert(l *Listing) error {
+	return s.db.Execute(func(sess *mgo.Session) error {
+		return sess.DB("").C(COLLECTION_AUCTIONS).Insert(l)
+	})
+}
+
+func (s *mongo_store) get(id string) (*Listing, error) {
+	l := &Listing{}
+	if err := s.db.Load(COLLECTION_AUCTIONS, id, l); err == db.ERROR_NOT_FOUND {
+		return nil, ERROR_LISTING_NOT_FOUND
+	} else if err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (s *mongo_store) transit(l *Listing, from int32) (bool, error) {
+	err := s.db.Execute(func(sess *mgo.Session) error {
+		return sess.DB("").C(COLLECTION_AUCTIONS).Update(bson.M{"_id": l.Id, "state": from}, l)
+	})
+	if err == mgo.ErrNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (s *mongo_store) search(item int32, now int64, limit int) (listings []Listing, err error) {
+	q := bson.M{"state": STATE_ACTIVE, "expire_at": bson.M{"$gt": now}}
+	if item != 0 {
+		q["item.id"] = item
+	}
+	err = s.db.Execute(func(sess *mgo.Session) error {
+		return sess.DB("").C(COLLECTION_AUCTIONS).Find(q).Sort("price").Limit(limit).All(&listings)
+	})
+	return
+}
+
+func (s *mongo_store) by_seller(seller int32) (listings []Listing, err error) {
+	err = s.db.Execute(func(sess *mgo.Session) error {
+		return sess.DB("").C(COLLECTION_AUCTIONS).Find(bson.M{"seller": seller, "state": STATE_ACTIVE}).All(&listings)
+	})
+	return
+}
+
+func (s *mongo_store) due(now, settle_before int64, limit int) (listings []Listing, err error) {
+	q := bson.M{"$or": []bson.M{
+		{"state": STATE_ACTIVE, "expire_at": bson.M{"$lte": now}},
+		{"state": bson.M{"$in": []int32{STATE_SOLD, STATE_CANCELLING, STATE_EXPIRING}}, "updated_at": bson.M{"$lte": settle_before}},
+	}}
+	err = s.db.Execute(func(sess *mgo.Session) error {
+		return sess.DB("").C(COLLECTION_AUCTIONS).Find(q).Limit(limit).All(&listings)
+	})
+	return
+}
+
+// 基于db.Table的存储, standalone模式下写入data-dir, 重启后未结算的挂单由sweep继续处理
+// 查询时遍历全部挂单, transit在表锁内比较状态
+type memory_store struct {
+	listings *db.Table
+}
+
+func new_memory_store(database *db.Database) *memory_store {
+	return &memory_store{listings: database.Table(COLLECTION_AUCTIONS, func() interface{} { return &Listing{} })}
+}
+
+func (s *memory_store) insert(l *Listing) error {
+	return s.listings.Insert(l.Id, *l)
+}
+
+func (s *memory_store) get(id string) (*Listing, error) {
+	doc := s.listings.Get(id)
+	if doc == nil {
+		return nil, ERROR_LISTING_NOT_FOUND
+	}
+	l := doc.(Listing)
+	return &l, nil
+}
+
+func (s *memory_store) transit(l *Listing, from int32) (ok bool, err error) {
+	err = s.listings.Modify(l.Id, func(cur interface{}) (interface{}, error) {
+		if cur == nil || cur.(Listing).State != from {
+			return cur, nil
+		}
+		ok = true
+		return *l, nil
+	})
+	return
+}
+
+func (s *memory_store) filter(limit int, match func(l *Listing) bool) []Listing {
+	var ret []Listing
+	s.listings.Scan(func(doc interface{}) {
+		if l := doc.(Listing); match(&l) {
+			ret = append(ret, l)
+		}
+	})
+	sort.Slice(ret, func(i, k int) bool { return ret[i].Price < ret[k].Price })
+	if limit > 0 && len(ret) > limit {
+		ret = ret[:limit]
+	}
+	return ret
+}
+func (s *memory_store) search(item int32, now int64, limit int) ([]Listing, error) {
+	return s.filter(limit, func(l *Listing) bool {
+		return l.State == STATE_ACTIVE && l.ExpireAt > now && (item == 0 || l.Item.Id == item)
+	}), nil
+}
+
+func (s *memory_store) by_seller(seller int32) ([]Listing, error) {
+	return s.filter(0, func(l *Listing) bool {
+		return l.Seller == seller && l.State == STATE_ACTIVE
+	}), nil
+}
+
+func (s *memory_store) due(now, settle_before int64, limit int) ([]Listing, error) {
+	return s.filter(limit, func(l *Listing) bool {
+		return (l.State == STATE_ACTIVE && l.ExpireAt <= now) || (pending(l.State) && l.UpdatedAt <= settle_before)
+	}), nil
+}
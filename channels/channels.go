@@ -0,0 +1,365 @@
+package channels
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"sync/atomic"
+
+	"game/ipc"
+	"game/kafka"
+	"game/registry"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// 频道:
+// 玩家可以加入或离开的具名频道(世界, 公会, 房间...), 消息广播给频道内全部成员.
+// 成员是本实例上的在线会话, 会话结束时自动离开所有频道.
+//
+// 跨实例频道(global)的消息同时发布到kafka, 其他实例收到后广播给各自的本地成员,
+// 因此每个实例都需要创建同名的global频道.
+var (
+	ERROR_CHANNEL_EXISTS    = errors.New("channel already exists")
+	ERROR_CHANNEL_NOT_FOUND = errors.New("channel not found")
+)
+
+type Channel struct {
+	Name    string
+	Global  bool           // 是否跨实例
+	members map[int32]bool // 本实例上的成员
+	dropped uint64         // 因成员队列满而丢弃的消息数
+	sync.RWMutex
+}
+
+// 跨实例广播的消息
+type remote_message struct {
+	InstanceId string `json:"instance"`
+	Channel    string `json:"channel,omitempty"`
+	UserId     int32  `json:"userid,omitempty"` // 非0时为发给单个玩家的消息
+	Message    []byte `json:"message"`
+	Op         int    `json:"op,omitempty"` // 非0时为让玩家加入或离开Channel
+}
+
+const (
+	op_join = iota + 1
+	op_leave
+)
+
+type channels struct {
+	channels   map[string]*Channel
+	joined     map[int32]map[string]bool // userid -> 已加入的频道
+	topic      string
+	instanceId string
+	sync.RWMutex
+}
+
+var (
+	_default_channels channels
+)
+
+func init() {
+	_default_channels.init()
+}
+
+func (cs *channels) init() {
+	cs.channels = make(map[string]*Channel)
+	cs.joined = make(map[int32]map[string]bool)
+}
+
+// Init 开启跨实例频道, 通过kafka topic在实例间转发消息
+func Init(topic, instanceId string) {
+	_default_channels.topic = topic
+	_default_channels.instanceId = instanceId
+	ch, err := kafka.Subscribe(topic)
+	if err != nil {
+		log.Error("channels: cross-instance disabled:", err)
+		_default_channels.topic = ""
+		return
+	}
+	go _default_channels.receiver(ch)
+}
+
+// 接收其他实例发来的频道消息
+func (cs *channels) receiver(ch <-chan []byte) {
+	for bts := range ch {
+		msg := &remote_message{}
+		if err := json.Unmarshal(bts, msg); err != nil {
+			log.Error(err)
+			continue
+		}
+		if msg.InstanceId == cs.instanceId {
+			continue
+		}
+		if msg.Op != 0 {
+			if registry.Query(msg.UserId) != nil {
+				cs.apply(msg.Op, msg.Channel, msg.UserId)
+			}
+			continue
+		}
+		if msg.UserId != 0 {
+			if registry.Query(msg.UserId) != nil {
+				ipc.SendMessage(msg.UserId, msg.Message)
+			}
+			continue
+		}
+		if c := cs.get(msg.Channel); c != nil && c.Global {
+			c.fanout(msg.Message)
+		}
+	}
+}
+
+func (cs *channels) create(name string, global bool) (*Channel, error) {
+	cs.Lock()
+	defer cs.Unlock()
+	if _, ok := cs.channels[name]; ok {
+		return nil, ERROR_CHANNEL_EXISTS
+	}
+	c := &Channel{Name: name, Global: global, members: make(map[int32]bool)}
+	cs.channels[name] = c
+	return c, nil
+}
+
+func (cs *channels) destroy(name string) {
+	cs.Lock()
+	defer cs.Unlock()
+	c, ok := cs.channels[name]
+	if !ok {
+		return
+	}
+	delete(cs.channels, name)
+
+	c.RLock()
+	for userid := range c.members {
+		cs.unmark(userid, name)
+	}
+	c.RUnlock()
+}
+
+func (cs *channels) get(name string) *Channel {
+	cs.RLock()
+	defer cs.RUnlock()
+	return cs.channels[name]
+}
+
+func (cs *channels) join(name string, userid int32) error {
+	cs.Lock()
+	defer cs.Unlock()
+	c, ok := cs.channels[name]
+	if !ok {
+		return ERROR_CHANNEL_NOT_FOUND
+	}
+
+	c.Lock()
+	c.members[userid] = true
+	c.Unlock()
+
+	if cs.joined[userid] == nil {
+		cs.joined[userid] = make(map[string]bool)
+	}
+	cs.joined[userid][name] = true
+	return nil
+}
+
+func (cs *channels) leave(name string, userid int32) {
+	cs.Lock()
+	defer cs.Unlock()
+	if c, ok := cs.channels[name]; ok {
+		c.Lock()
+		delete(c.members, userid)
+		c.Unlock()
+	}
+	cs.unmark(userid, name)
+}
+
+func (cs *channels) leave_all(userid int32) {
+	cs.Lock()
+	defer cs.Unlock()
+	for name := range cs.joined[userid] {
+		if c, ok := cs.channels[name]; ok {
+			c.Lock()
+			delete(c.members, userid)
+			c.Unlock()
+		}
+	}
+	delete(cs.joined, userid)
+}
+
+// 需要持有cs的写锁
+func (cs *channels) unmark(userid int32, name string) {
+	if m := cs.joined[userid]; m != nil {
+		delete(m, name)
+		if len(m) == 0 {
+			delete(cs.joined, userid)
+		}
+	}
+}
+
+func (cs *channels) joined_channels(userid int32) (names []string) {
+	cs.RLock()
+	defer cs.RUnlock()
+	for name := range cs.joined[userid] {
+		names = append(names, name)
+	}
+	return
+}
+
+func (cs *channels) broadcast(name string, msg []byte) error {
+	c := cs.get(name)
+	if c == nil {
+		return ERROR_CHANNEL_NOT_FOUND
+	}
+	c.fanout(msg)
+
+	if c.Global && cs.topic != "" {
+		bts, err := json.Marshal(&remote_message{InstanceId: cs.instanceId, Channel: name, Message: msg})
+		if err != nil {
+			return err
+		}
+		kafka.Publish(cs.topic, bts)
+	}
+	return nil
+}
+
+// 发给单个玩家, 玩家不在本实例时通过kafka转发给其他实例
+func (cs *channels) send_to(userid int32, msg []byte) bool {
+	if registry.Query(userid) != nil {
+		return ipc.SendMessage(userid, msg)
+	}
+
+	if cs.topic == "" {
+		return false
+	}
+	bts, err := json.Marshal(&remote_message{InstanceId: cs.instanceId, UserId: userid, Message: msg})
+	if err != nil {
+		log.Error(err)
+		return false
+	}
+	kafka.Publish(cs.topic, bts)
+	return true
+}
+
+// 加入或离开global频道, 频道不存在时创建
+func (cs *channels) apply(op int, name string, userid int32) {
+	switch op {
+	case op_join:
+		cs.create(name, true)
+		cs.join(name, userid)
+	case op_leave:
+		cs.leave(name, userid)
+	}
+}
+
+// 玩家在本实例时直接执行, 否则通过kafka让玩家所在的实例执行
+func (cs *channels) apply_anywhere(op int, name string, userid int32) {
+	if registry.Query(userid) != nil {
+		cs.apply(op, name, userid)
+		return
+	}
+
+	if cs.topic == "" {
+		return
+	}
+	bts, err := json.Marshal(&remote_message{InstanceId: cs.instanceId, Channel: name, UserId: userid, Op: op})
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	kafka.Publish(cs.topic, bts)
+}
+
+// 广播给本实例上的全部成员, 成员队列满时丢弃, 不阻塞
+func (c *Channel) fanout(msg []byte) {
+	c.RLock()
+	defer c.RUnlock()
+	for userid := range c.members {
+		if !ipc.SendMessage(userid, msg) {
+			atomic.AddUint64(&c.dropped, 1)
+		}
+	}
+}
+
+// Members 本实例上的成员
+func (c *Channel) Members() (ids []int32) {
+	c.RLock()
+	defer c.RUnlock()
+	for userid := range c.members {
+		ids = append(ids, userid)
+	}
+	return
+}
+
+// IsMember 是否是本实例上的成员
+func (c *Channel) IsMember(userid int32) bool {
+	c.RLock()
+	defer c.RUnlock()
+	return c.members[userid]
+}
+
+// Count 本实例上的成员数
+func (c *Channel) Count() int {
+	c.RLock()
+	defer c.RUnlock()
+	return len(c.members)
+}
+
+// Dropped 因成员队列满而丢弃的消息数
+func (c *Channel) Dropped() uint64 {
+	return atomic.LoadUint64(&c.dropped)
+}
+
+// Create 创建频道, global为true时消息跨实例广播
+func Create(name string, global bool) (*Channel, error) {
+	return _default_channels.create(name, global)
+}
+
+// Destroy 销毁频道, 成员自动离开
+func Destroy(name string) {
+	_default_channels.destroy(name)
+}
+
+// Get 查找频道, 不存在返回nil
+func Get(name string) *Channel {
+	return _default_channels.get(name)
+}
+
+// Join 加入频道
+func Join(name string, userid int32) error {
+	return _default_channels.join(name, userid)
+}
+
+// Leave 离开频道
+func Leave(name string, userid int32) {
+	_default_channels.leave(name, userid)
+}
+
+// JoinGlobal 让玩家加入global频道, 玩家可以在任意实例上, 频道不存在时创建
+func JoinGlobal(name string, userid int32) {
+	_default_channels.apply_anywhere(op_join, name, userid)
+}
+
+// LeaveGlobal 让玩家离开global频道, 玩家可以在任意实例上
+func LeaveGlobal(name string, userid int32) {
+	_default_channels.apply_anywhere(op_leave, name, userid)
+}
+
+// LeaveAll 离开全部频道, 会话结束时调用
+func LeaveAll(userid int32) {
+	_default_channels.leave_all(userid)
+}
+
+// Joined 玩家已加入的频道
+func Joined(userid int32) []string {
+	return _default_channels.joined_channels(userid)
+}
+
+// Broadcast 向频道广播消息(协议号+数据)
+func Broadcast(name string, msg []byte) error {
+	return _default_channels.broadcast(name, msg)
+}
+
+// SendTo 发送消息给单个玩家, 支持跨实例
+// 玩家在本实例时直接投递, 否则开启跨实例时经kafka转发(尽力而为)
+func SendTo(userid int32, msg []byte) bool {
+	return _default_channels.send_to(userid, msg)
+}
@@ -0,0 +1,76 @@
+package channels
+
+import (
+	"testing"
+
+	. "game/proto"
+	"game/registry"
+)
+
+func TestChannel(t *testing.T) {
+	ch1 := make(chan *Game_Frame, 1)
+	ch2 := make(chan *Game_Frame, 1)
+	registry.Register(1, ch1)
+	registry.Register(2, ch2)
+	defer registry.Unregister(1, ch1)
+	defer registry.Unregister(2, ch2)
+
+	c, err := Create("room-1", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Create("room-1", false); err != ERROR_CHANNEL_EXISTS {
+		t.Fatal("expect exists, got:", err)
+	}
+	Join("room-1", 1)
+	Join("room-1", 2)
+	if c.Count() != 2 {
+		t.Fatal("expect 2 members, got:", c.Count())
+	}
+
+	// 第二次广播时ch2已满, 不应阻塞
+	Broadcast("room-1", []byte{1})
+	<-ch1
+	Broadcast("room-1", []byte{2})
+	if f := <-ch1; f.Message[0] != 2 {
+		t.Fatal("unexpected message:", f.Message)
+	}
+	if c.Dropped() != 1 {
+		t.Fatal("expect 1 dropped, got:", c.Dropped())
+	}
+
+	LeaveAll(2)
+	if c.IsMember(2) || len(Joined(2)) != 0 {
+		t.Fatal("leave all failed")
+	}
+
+	Destroy("room-1")
+	if Get("room-1") != nil || len(Joined(1)) != 0 {
+		t.Fatal("destroy failed")
+	}
+	if err := Broadcast("room-1", nil); err != ERROR_CHANNEL_NOT_FOUND {
+		t.Fatal("expect not found, got:", err)
+	}
+}
+
+func TestJoinGlobal(t *testing.T) {
+	ch := make(chan *Game_Frame, 1)
+	registry.Register(3, ch)
+	defer registry.Unregister(3, ch)
+
+	JoinGlobal("guild-1", 3)
+	c := Get("guild-1")
+	if c == nil || !c.Global || !c.IsMember(3) {
+		t.Fatal("join global failed")
+	}
+	LeaveGlobal("guild-1", 3)
+	if c.IsMember(3) {
+		t.Fatal("leave global failed")
+	}
+
+	// 不在本实例且未开启跨实例时忽略
+	JoinGlobal("guild-2", 4)
+	if Get("guild-2") != nil {
+		t.Fatal("unexpected channel")
+	}
+}
@@ -0,0 +1,320 @@
+package chat
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"game/channels"
+	"game/db"
+	"game/kafka"
+
+	log "github.com/Sirupsen/logrus"
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// 聊天:
+// 世界, 私聊, 频道三种聊天, 发言前检查禁言, 频率和长度, 并过滤敏感词.
+// 最近的聊天记录保存在mongodb中, 每条消息都写入trace供审核.
+const (
+	CHAT_WORLD   = int32(1) // 世界
+	CHAT_PRIVATE = int32(2) // 私聊
+	CHAT_CHANNEL = int32(3) // 频道
+
+	WORLD_CHANNEL = "world" // 世界频道名
+
+	COLLECTION_HISTORY = "chat_history"
+	COLLECTION_MUTES   = "chat_mutes"
+
+	DEFAULT_RATE_LIMIT   = 5                  // 每个周期最多发言次数
+	DEFAULT_RATE_WINDOW  = 10 * time.Second   // 频率限制周期
+	DEFAULT_HISTORY_SIZE = 50                 // 历史记录返回条数
+	DEFAULT_MAX_LENGTH   = 256                // 单条消息最大字符数
+	HISTORY_EXPIRE       = 7 * 24 * time.Hour // 历史记录保存时间
+	MUTE_CACHE_TTL       = 30 * time.Second   // 禁言状态缓存时间
+)
+
+var (
+	ERROR_EMPTY      = errors.New("empty message")
+	ERROR_TOO_LONG   = errors.New("message too long")
+	ERROR_MUTED      = errors.New("user muted")
+	ERROR_TOO_FAST   = errors.New("message too fast")
+	ERROR_NOT_MEMBER = errors.New("not a member of channel")
+)
+
+// 一条聊天消息, 同时也是历史记录的文档格式
+type Message struct {
+	Type      int32     `bson:"type"`
+	Key       string    `bson:"key"` // 历史记录分组, 见WorldKey, PrivateKey, ChannelKey
+	Channel   string    `bson:"channel,omitempty"`
+	From      int32     `bson:"from"`
+	To        int32     `bson:"to,omitempty"`
+	Content   string    `bson:"content"`
+	CreatedAt time.Time `bson:"created_at"`
+}
+
+// 可由数值表配置的参数
+type Config struct {
+	Words       []string      // 敏感词
+	RateLimit   int           // 每个周期最多发言次数
+	RateWindow  time.Duration // 频率限制周期
+	HistorySize int           // 历史记录返回条数
+	MaxLength   int           // 单条消息最大字符数
+}
+
+// 禁言记录
+type mute struct {
+	UserId int32  `bson:"_id"`
+	Until  int64  `bson:"until"` // unix时间, 到期自动解除
+	Reason string `bson:"reason"`
+}
+
+type mute_entry struct {
+	until  int64
+	expire time.Time
+}
+
+type chat struct {
+	db          *db.Database
+	filter      filter
+	limiter     *limiter
+	historySize int
+	maxLength   int
+	mutes       map[int32]mute_entry // 禁言缓存
+	sync.Mutex
+}
+
+var (
+	_default_chat chat
+)
+
+func init() {
+	_default_chat.limiter = new_limiter(DEFAULT_RATE_LIMIT, DEFAULT_RATE_WINDOW)
+	_default_chat.historySize = DEFAULT_HISTORY_SIZE
+	_default_chat.maxLength = DEFAULT_MAX_LENGTH
+	_default_chat.mutes = make(map[int32]mute_entry)
+}
+
+func Init(database *db.Database) {
+	_default_chat.db = database
+	if _, err := channels.Create(WORLD_CHANNEL, true); err != nil {
+		log.Error(err)
+	}
+
+	if database.IsLocal() {
+		return
+	}
+	err := database.Execute(func(sess *mgo.Session) error {
+		c := sess.DB("").C(COLLECTION_HISTORY)
+		if err := c.EnsureIndex(mgo.Index{Key: []string{"key", "-created_at"}}); err != nil {
+			return err
+		}
+		return c.EnsureIndex(mgo.Index{Key: []string{"created_at"}, ExpireAfter: HISTORY_EXPIRE})
+	})
+	if err != nil {
+		log.Error(err)
+	}
+}
+
+// 发言前检查, 返回过滤后的内容
+func (c *chat) prepare(userid int32, content string, now time.Time) (string, error) {
+	if content == "" {
+		return "", ERROR_EMPTY
+	}
+
+	c.Lock()
+	maxLength := c.maxLength
+	c.Unlock()
+	if utf8.RuneCountInString(content) > maxLength {
+		return "", ERROR_TOO_LONG
+	}
+
+	if c.is_muted(userid, now) {
+		return "", ERROR_MUTED
+	}
+
+	if !c.limiter.allow(userid, now) {
+		return "", ERROR_TOO_FAST
+	}
+
+	filtered, _ := c.filter.replace(content)
+	return filtered, nil
+}
+
+// 读取禁言状态失败时不缓存, 沿用之前缓存的状态, 没有缓存时视为禁言
+func (c *chat) is_muted(userid int32, now time.Time) bool {
+	c.Lock()
+	e, ok := c.mutes[userid]
+	c.Unlock()
+
+	if !ok || now.After(e.expire) {
+		m := &mute{}
+		if c.db != nil {
+			if err := c.db.Load(COLLECTION_MUTES, userid, m); err != nil && err != db.ERROR_NOT_FOUND {
+				log.Error(err)
+				return !ok || e.until > now.Unix()
+			}
+		}
+		e = mute_entry{until: m.Until, expire: now.Add(MUTE_CACHE_TTL)}
+		c.Lock()
+		c.mutes[userid] = e
+		c.Unlock()
+	}
+	return e.until > now.Unix()
+}
+
+func (c *chat) mute(userid int32, until time.Time, reason string) error {
+	if c.db != nil {
+		if err := c.db.Save(COLLECTION_MUTES, userid, &mute{UserId: userid, Until: until.Unix(), Reason: reason}); err != nil {
+			return err
+		}
+	}
+	c.Lock()
+	c.mutes[userid] = mute_entry{until: until.Unix(), expire: time.Now().Add(MUTE_CACHE_TTL)}
+	c.Unlock()
+
+	kafka.TraceEvent("chat_mute", userid, map[string]interface{}{"until": until.Unix(), "reason": reason})
+	return nil
+}
+
+// 保存历史并写入trace
+func (c *chat) record(msg *Message, original string) {
+	kafka.TraceEvent("chat", msg.From, map[string]interface{}{
+		"type":     msg.Type,
+		"channel":  msg.Channel,
+		"to":       msg.To,
+		"content":  msg.Content,
+		"original": original,
+	})
+
+	if c.db == nil || c.db.IsLocal() {
+		return
+	}
+	err := c.db.Execute(func(sess *mgo.Session) error {
+		return sess.DB("").C(COLLECTION_HISTORY).Insert(msg)
+	})
+	if err != nil {
+		log.Error(err)
+	}
+}
+
+// 最近的历史记录, 按时间从旧到新
+func (c *chat) history(key string) ([]Message, error) {
+	if c.db == nil || c.db.IsLocal() {
+		return nil, nil
+	}
+
+	c.Lock()
+	n := c.historySize
+	c.Unlock()
+
+	var msgs []Message
+	err := c.db.Execute(func(sess *mgo.Session) error {
+		return sess.DB("").C(COLLECTION_HISTORY).Find(bson.M{"key": key}).Sort("-created_at").Limit(n).All(&msgs)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for i, j := 0, len(msgs)-1; i < j; i, j = i+1, j-1 {
+		msgs[i], msgs[j] = msgs[j], msgs[i]
+	}
+	return msgs, nil
+}
+
+func (c *chat) set_config(cfg *Config) {
+	c.filter.reset(cfg.Words)
+	if cfg.RateLimit > 0 && cfg.RateWindow > 0 {
+		c.limiter.set(cfg.RateLimit, cfg.RateWindow)
+	}
+
+	c.Lock()
+	if cfg.HistorySize > 0 {
+		c.historySize = cfg.HistorySize
+	}
+	if cfg.MaxLength > 0 {
+		c.maxLength = cfg.MaxLength
+	}
+	c.Unlock()
+}
+
+// WorldKey 世界聊天的历史分组
+func WorldKey() string {
+	return WORLD_CHANNEL
+}
+
+// PrivateKey 私聊的历史分组, 与双方顺序无关
+func PrivateKey(a, b int32) string {
+	if a > b {
+		a, b = b, a
+	}
+	return fmt.Sprintf("private:%v:%v", a, b)
+}
+
+// ChannelKey 频道聊天的历史分组
+func ChannelKey(name string) string {
+	return "channel:" + name
+}
+
+// Prepare 发言前检查禁言, 频率和长度, 返回过滤敏感词后的内容
+func Prepare(userid int32, content string) (string, error) {
+	return _default_chat.prepare(userid, content, time.Now())
+}
+
+// Allow 检查禁言和频率, 邮件等其他发言途径与聊天共用频率限制
+func Allow(userid int32) error {
+	now := time.Now()
+	if _default_chat.is_muted(userid, now) {
+		return ERROR_MUTED
+	}
+	if !_default_chat.limiter.allow(userid, now) {
+		return ERROR_TOO_FAST
+	}
+	return nil
+}
+
+// Filter 只过滤敏感词, 供邮件等其他文本使用
+func Filter(content string) string {
+	filtered, _ := _default_chat.filter.replace(content)
+	return filtered
+}
+
+// Record 保存历史记录并写入trace, original为过滤前的原文
+func Record(msg *Message, original string) {
+	_default_chat.record(msg, original)
+}
+
+// History 读取最近的历史记录
+func History(key string) ([]Message, error) {
+	return _default_chat.history(key)
+}
+
+// Mute 禁言到指定时间
+func Mute(userid int32, until time.Time, reason string) error {
+	return _default_chat.mute(userid, until, reason)
+}
+
+// Unmute 解除禁言
+func Unmute(userid int32) error {
+	return _default_chat.mute(userid, time.Unix(0, 0), "unmute")
+}
+
+// IsMuted 是否被禁言
+func IsMuted(userid int32) bool {
+	return _default_chat.is_muted(userid, time.Now())
+}
+
+// SetConfig 更新配置(敏感词, 频率限制等), 数值表热更新时调用
+func SetConfig(cfg *Config) {
+	_default_chat.set_config(cfg)
+}
+
+// Logout 会话结束时清理禁言缓存, 频率限制不清理, 避免重新登陆绕过
+func Logout(userid int32) {
+	_default_chat.Lock()
+	delete(_default_chat.mutes, userid)
+	_default_chat.Unlock()
+}
@@ -0,0 +1,111 @@
+package chat
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"game/db"
+)
+
+func TestFilter(t *testing.T) {
+	var f filter
+	f.reset([]string{"bad", "badword", "坏蛋"})
+
+	cases := []struct {
+		in, out string
+		hit     bool
+	}{
+		{"hello", "hello", false},
+		{"a bad day", "a *** day", true},
+		{"BadWord!", "*******!", true},
+		{"你是坏蛋吗", "你是**吗", true},
+	}
+	for _, c := range cases {
+		out, hit := f.replace(c.in)
+		if out != c.out || hit != c.hit {
+			t.Fatalf("replace(%q) = %q,%v, want %q,%v", c.in, out, hit, c.out, c.hit)
+		}
+	}
+}
+
+func TestLimiter(t *testing.T) {
+	l := new_limiter(2, 10*time.Second)
+	now := time.Now()
+	if !l.allow(1, now) || !l.allow(1, now) {
+		t.Fatal("should allow within rate")
+	}
+	if l.allow(1, now) {
+		t.Fatal("should deny over rate")
+	}
+	if !l.allow(2, now) {
+		t.Fatal("users should not share bucket")
+	}
+	if !l.allow(1, now.Add(5*time.Second)) {
+		t.Fatal("should refill")
+	}
+
+	// 闲置超过window的桶被清除, 未闲置的保留
+	l.allow(2, now.Add(15*time.Second))
+	if _, ok := l.buckets[1]; ok || len(l.buckets) != 1 {
+		t.Fatal("idle bucket not purged:", l.buckets)
+	}
+}
+
+func TestMuteLoadError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "chat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var c chat
+	c.db = &db.Database{}
+	c.db.InitLocal(dir)
+	c.mutes = make(map[int32]mute_entry)
+	now := time.Now()
+	if c.is_muted(1, now) {
+		t.Fatal("not muted user muted")
+	}
+
+	// 读取失败时视为禁言, 且不缓存
+	os.MkdirAll(filepath.Join(dir, COLLECTION_MUTES, "2"+db.LOCAL_DOC_EXT), 0755)
+	if !c.is_muted(2, now) {
+		t.Fatal("load error treated as not muted")
+	}
+	if _, ok := c.mutes[2]; ok {
+		t.Fatal("load error cached")
+	}
+
+	// 有缓存时沿用缓存的状态
+	c.mutes[2] = mute_entry{until: now.Add(time.Hour).Unix(), expire: now}
+	if !c.is_muted(2, now.Add(time.Minute)) {
+		t.Fatal("cached mute lost on load error")
+	}
+}
+
+func TestPrepare(t *testing.T) {
+	var c chat
+	c.limiter = new_limiter(DEFAULT_RATE_LIMIT, DEFAULT_RATE_WINDOW)
+	c.maxLength = 4
+	c.mutes = make(map[int32]mute_entry)
+	c.filter.reset([]string{"bad"})
+
+	now := time.Now()
+	if _, err := c.prepare(1, "", now); err != ERROR_EMPTY {
+		t.Fatal("expect empty, got:", err)
+	}
+	if _, err := c.prepare(1, "12345", now); err != ERROR_TOO_LONG {
+		t.Fatal("expect too long, got:", err)
+	}
+	if s, err := c.prepare(1, "bad!", now); err != nil || s != "***!" {
+		t.Fatal("unexpected:", s, err)
+	}
+
+	c.mutes[1] = mute_entry{until: now.Add(time.Hour).Unix(), expire: now.Add(time.Minute)}
+	if _, err := c.prepare(1, "hi", now); err != ERROR_MUTED {
+		t.Fatal("expect muted, got:", err)
+	}
+}
@@ -0,0 +1,91 @@
+package chat
+
+import (
+	"strings"
+	"sync"
+)
+
+const (
+	MASK_RUNE = '*'
+)
+
+// 敏感词过滤, 使用字典树做最长匹配, 命中部分替换为MASK_RUNE
+type trie_node struct {
+	children map[rune]*trie_node
+	end      bool
+}
+
+type filter struct {
+	root *trie_node
+	sync.RWMutex
+}
+
+func new_trie(words []string) *trie_node {
+	root := &trie_node{children: make(map[rune]*trie_node)}
+	for _, word := range words {
+		word = strings.ToLower(strings.TrimSpace(word))
+		if word == "" {
+			continue
+		}
+		node := root
+		for _, r := range word {
+			next, ok := node.children[r]
+			if !ok {
+				next = &trie_node{children: make(map[rune]*trie_node)}
+				node.children[r] = next
+			}
+			node = next
+		}
+		node.end = true
+	}
+	return root
+}
+
+// 替换词库, 数值表热更新时调用
+func (f *filter) reset(words []string) {
+	root := new_trie(words)
+	f.Lock()
+	f.root = root
+	f.Unlock()
+}
+
+// 替换敏感词, 返回替换后的内容以及是否命中
+func (f *filter) replace(content string) (string, bool) {
+	f.RLock()
+	root := f.root
+	f.RUnlock()
+	if root == nil || len(root.children) == 0 {
+		return content, false
+	}
+
+	runes := []rune(content)
+	lower := []rune(strings.ToLower(content))
+	if len(lower) != len(runes) { // 大小写转换改变了长度, 按原文匹配
+		lower = runes
+	}
+
+	hit := false
+	for i := 0; i < len(lower); i++ {
+		node := root
+		matched := 0
+		for j := i; j < len(lower); j++ {
+			next, ok := node.children[lower[j]]
+			if !ok {
+				break
+			}
+			node = next
+			if node.end {
+				matched = j - i + 1
+			}
+		}
+
+		if matched > 0 {
+			for k := i; k < i+matched; k++ {
+				runes[k] = MASK_RUNE
+			}
+			i += matched - 1
+			hit = true
+		}
+	}
+	return string(runes), hit
+}
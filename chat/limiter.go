@@ -0,0 +1,78 @@
+package chat
+
+import (
+	"sync"
+	"time"
+)
+
+// 每个玩家的发言频率限制, 令牌桶:
+// 桶容量为rate, 每window时间补满.
+// 桶按userid保存, 与会话无关, 重新登陆不会重置; 闲置超过window的桶已经补满, 与新建的相同, 定期清除.
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+type limiter struct {
+	rate    int
+	window  time.Duration
+	buckets map[int32]*bucket
+	purged  time.Time // 上次清除闲置桶的时间
+	sync.Mutex
+}
+
+func new_limiter(rate int, window time.Duration) *limiter {
+	return &limiter{rate: rate, window: window, buckets: make(map[int32]*bucket)}
+}
+
+func (l *limiter) set(rate int, window time.Duration) {
+	l.Lock()
+	l.rate = rate
+	l.window = window
+	l.Unlock()
+}
+
+// 消耗一个令牌, 令牌不足时返回false
+func (l *limiter) allow(userid int32, now time.Time) bool {
+	l.Lock()
+	defer l.Unlock()
+	if l.rate <= 0 || l.window <= 0 {
+		return true
+	}
+
+	if now.Sub(l.purged) >= l.window {
+		l.purge(now)
+	}
+
+	b, ok := l.buckets[userid]
+	if !ok {
+		b = &bucket{tokens: float64(l.rate), last: now}
+		l.buckets[userid] = b
+	}
+
+	// 补充令牌
+	elapsed := now.Sub(b.last)
+	if elapsed > 0 {
+		b.tokens += float64(l.rate) * float64(elapsed) / float64(l.window)
+		if b.tokens > float64(l.rate) {
+			b.tokens = float64(l.rate)
+		}
+		b.last = now
+	}
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// 清除闲置超过window的桶
+func (l *limiter) purge(now time.Time) {
+	for userid, b := range l.buckets {
+		if now.Sub(b.last) >= l.window {
+			delete(l.buckets, userid)
+		}
+	}
+	l.purged = now
+}
@@ -4,35 +4,348 @@ import "game/misc/packet"
 import . "game/types"
 
 var Code = map[string]int16{
-	"heart_beat_req":         0,    // 心跳包..
-	"heart_beat_ack":         1,    // 心跳包回复
-	"user_login_req":         10,   // 登陆
-	"user_login_succeed_ack": 11,   // 登陆成功
-	"user_login_faild_ack":   12,   // 登陆失败
-	"client_error_ack":       13,   // 客户端错误
-	"get_seed_req":           30,   // socket通信加密使用
-	"get_seed_ack":           31,   // socket通信加密使用
-	"proto_ping_req":         1001, //  ping
-	"proto_ping_ack":         1002, //  ping回复
+	"heart_beat_req":          0,    // 心跳包..
+	"heart_beat_ack":          1,    // 心跳包回复
+	"user_login_req":          10,   // 登陆
+	"user_login_succeed_ack":  11,   // 登陆成功
+	"user_login_faild_ack":    12,   // 登陆失败
+	"client_error_ack":        13,   // 客户端错误
+	"get_seed_req":            30,   // socket通信加密使用
+	"get_seed_ack":            31,   // socket通信加密使用
+	"proto_ping_req":          1001, //  ping
+	"proto_ping_ack":          1002, //  ping回复
+	"chat_world_req":          2001, // 世界聊天
+	"chat_private_req":        2002, // 私聊
+	"chat_channel_req":        2003, // 频道聊天
+	"chat_ack":                2004, // 聊天发言结果
+	"chat_notify":             2005, // 聊天消息推送
+	"chat_history_req":        2006, // 聊天历史
+	"chat_history_ack":        2007, // 聊天历史回复
+	"mail_list_req":           2101, // 邮件列表
+	"mail_list_ack":           2102, // 邮件列表回复
+	"mail_read_req":           2103, // 读邮件
+	"mail_claim_req":          2104, // 领取附件
+	"mail_delete_req":         2105, // 删除邮件
+	"mail_send_req":           2106, // 发送玩家邮件
+	"mail_ack":                2107, // 邮件操作结果
+	"mail_claim_ack":          2108, // 领取附件成功
+	"mail_unread_notify":      2109, // 未读邮件数推送
+	"friend_list_req":         2201, // 好友列表
+	"friend_list_ack":         2202, // 好友列表回复
+	"friend_request_req":      2203, // 好友申请
+	"friend_accept_req":       2204, // 接受好友申请
+	"friend_reject_req":       2205, // 拒绝好友申请
+	"friend_remove_req":       2206, // 删除好友
+	"friend_block_req":        2207, // 加入黑名单
+	"friend_unblock_req":      2208, // 移出黑名单
+	"friend_ack":              2209, // 好友操作结果
+	"friend_request_notify":   2210, // 收到好友申请推送
+	"friend_status_notify":    2211, // 好友状态变化推送
+	"rank_top_req":            2301, // 排行榜前N名
+	"rank_self_req":           2302, // 自己的排名
+	"rank_around_req":         2303, // 自己前后的排名
+	"rank_list_ack":           2304, // 排行榜回复
+	"match_join_req":          2401, // 开始匹配
+	"match_cancel_req":        2402, // 取消匹配
+	"match_ack":               2403, // 匹配操作结果
+	"match_found_notify":      2404, // 匹配成功推送
+	"match_timeout_notify":    2405, // 匹配超时推送
+	"room_join_req":           2501, // 加入房间
+	"room_leave_req":          2502, // 离开房间
+	"room_input_req":          2503, // 房间内输入
+	"room_ack":                2504, // 房间操作结果
+	"room_state_notify":       2505, // 房间状态推送
+	"room_closed_notify":      2506, // 房间关闭推送
+	"lockstep_frame_notify":   2601, // 帧同步逻辑帧推送
+	"lockstep_frames_req":     2602, // 断线重连补帧
+	"lockstep_frames_ack":     2603, // 补帧回复
+	"guild_create_req":        2701, // 创建公会
+	"guild_disband_req":       2702, // 解散公会
+	"guild_info_req":          2703, // 公会信息
+	"guild_info_ack":          2704, // 公会信息回复
+	"guild_apply_req":         2705, // 申请加入公会
+	"guild_accept_req":        2706, // 同意入会申请
+	"guild_reject_req":        2707, // 拒绝入会申请
+	"guild_invite_req":        2708, // 邀请加入公会
+	"guild_join_req":          2709, // 接受公会邀请
+	"guild_leave_req":         2710, // 退出公会
+	"guild_kick_req":          2711, // 踢出成员
+	"guild_role_req":          2712, // 任命职位
+	"guild_notice_req":        2713, // 修改公告
+	"guild_donate_req":        2714, // 捐献
+	"guild_records_req":       2715, // 捐献记录
+	"guild_records_ack":       2716, // 捐献记录回复
+	"guild_ack":               2717, // 公会操作结果
+	"guild_event_notify":      2718, // 公会事件推送
+	"guild_invite_notify":     2719, // 公会邀请推送
+	"item_list_req":           2801, // 背包列表
+	"item_list_ack":           2802, // 背包列表回复
+	"item_use_req":            2803, // 使用道具
+	"item_ack":                2804, // 道具操作结果
+	"item_changes_notify":     2805, // 背包变化推送
+	"quest_list_req":          2901, // 任务列表
+	"quest_list_ack":          2902, // 任务列表回复
+	"quest_claim_req":         2903, // 领取任务奖励
+	"quest_ack":               2904, // 任务操作结果
+	"quest_progress_notify":   2905, // 任务进度推送
+	"gacha_pull_req":          3001, // 抽卡
+	"gacha_pull_ack":          3002, // 抽卡结果
+	"gacha_info_req":          3003, // 保底计数
+	"gacha_info_ack":          3004, // 保底计数回复
+	"gacha_ack":               3005, // 抽卡操作结果
+	"currency_list_req":       3101, // 货币余额
+	"currency_list_ack":       3102, // 货币余额回复
+	"currency_changes_notify": 3103, // 货币变化推送
+	"currency_ack":            3104, // 货币操作结果
+	"shop_list_req":           3201, // 商店商品列表
+	"shop_list_ack":           3202, // 商店商品列表回复
+	"shop_buy_req":            3203, // 购买商品
+	"shop_buy_ack":            3204, // 购买结果
+	"shop_ack":                3205, // 商店操作结果
+	"world_enter_req":         3301, // 进入开放世界地图
+	"world_enter_ack":         3302, // 进入地图回复
+	"aoi_events_notify":       3303, // 视野事件推送
+	"auction_sell_req":        3401, // 上架道具
+	"auction_buy_req":         3402, // 购买挂单
+	"auction_cancel_req":      3403, // 下架
+	"auction_search_req":      3404, // 查询在售道具
+	"auction_mine_req":        3405, // 我的挂单
+	"auction_listing_ack":     3406, // 挂单回复
+	"auction_list_ack":        3407, // 挂单列表回复
+	"auction_ack":             3408, // 拍卖行操作结果
+	"party_create_req":        3501, // 创建队伍
+	"party_info_req":          3502, // 队伍信息
+	"party_info_ack":          3503, // 队伍信息回复
+	"party_invite_req":        3504, // 邀请加入队伍
+	"party_join_req":          3505, // 接受队伍邀请
+	"party_leave_req":         3506, // 离开队伍
+	"party_kick_req":          3507, // 踢出队员
+	"party_transfer_req":      3508, // 转让队长
+	"party_target_req":        3509, // 设置队伍目标
+	"party_ready_req":         3510, // 设置准备状态
+	"party_match_req":         3511, // 队伍开始匹配
+	"party_room_req":          3512, // 队伍加入房间
+	"party_ack":               3513, // 队伍操作结果
+	"party_notify":            3514, // 队伍状态推送
+	"party_invite_notify":     3515, // 队伍邀请推送
+	"user_rename_req":         3601, // 改名, 首次取名免费
+	"user_rename_ack":         3602, // 改名回复
+	"name_ack":                3603, // 改名失败
+	"level_info_req":          3701, // 查询等级和经验
+	"level_info_ack":          3702, // 等级和经验
+	"exp_notify":              3703, // 经验变化推送
+	"level_up_notify":         3704, // 升级推送
+	"level_ack":               3705, // 等级查询失败
 }
 
 var RCode = map[int16]string{
-	0:    "heart_beat_req",         // 心跳包..
-	1:    "heart_beat_ack",         // 心跳包回复
-	10:   "user_login_req",         // 登陆
-	11:   "user_login_succeed_ack", // 登陆成功
-	12:   "user_login_faild_ack",   // 登陆失败
-	13:   "client_error_ack",       // 客户端错误
-	30:   "get_seed_req",           // socket通信加密使用
-	31:   "get_seed_ack",           // socket通信加密使用
-	1001: "proto_ping_req",         //  ping
-	1002: "proto_ping_ack",         //  ping回复
+	0:    "heart_beat_req",          // 心跳包..
+	1:    "heart_beat_ack",          // 心跳包回复
+	10:   "user_login_req",          // 登陆
+	11:   "user_login_succeed_ack",  // 登陆成功
+	12:   "user_login_faild_ack",    // 登陆失败
+	13:   "client_error_ack",        // 客户端错误
+	30:   "get_seed_req",            // socket通信加密使用
+	31:   "get_seed_ack",            // socket通信加密使用
+	1001: "proto_ping_req",          //  ping
+	1002: "proto_ping_ack",          //  ping回复
+	2001: "chat_world_req",          // 世界聊天
+	2002: "chat_private_req",        // 私聊
+	2003: "chat_channel_req",        // 频道聊天
+	2004: "chat_ack",                // 聊天发言结果
+	2005: "chat_notify",             // 聊天消息推送
+	2006: "chat_history_req",        // 聊天历史
+	2007: "chat_history_ack",        // 聊天历史回复
+	2101: "mail_list_req",           // 邮件列表
+	2102: "mail_list_ack",           // 邮件列表回复
+	2103: "mail_read_req",           // 读邮件
+	2104: "mail_claim_req",          // 领取附件
+	2105: "mail_delete_req",         // 删除邮件
+	2106: "mail_send_req",           // 发送玩家邮件
+	2107: "mail_ack",                // 邮件操作结果
+	2108: "mail_claim_ack",          // 领取附件成功
+	2109: "mail_unread_notify",      // 未读邮件数推送
+	2201: "friend_list_req",         // 好友列表
+	2202: "friend_list_ack",         // 好友列表回复
+	2203: "friend_request_req",      // 好友申请
+	2204: "friend_accept_req",       // 接受好友申请
+	2205: "friend_reject_req",       // 拒绝好友申请
+	2206: "friend_remove_req",       // 删除好友
+	2207: "friend_block_req",        // 加入黑名单
+	2208: "friend_unblock_req",      // 移出黑名单
+	2209: "friend_ack",              // 好友操作结果
+	2210: "friend_request_notify",   // 收到好友申请推送
+	2211: "friend_status_notify",    // 好友状态变化推送
+	2301: "rank_top_req",            // 排行榜前N名
+	2302: "rank_self_req",           // 自己的排名
+	2303: "rank_around_req",         // 自己前后的排名
+	2304: "rank_list_ack",           // 排行榜回复
+	2401: "match_join_req",          // 开始匹配
+	2402: "match_cancel_req",        // 取消匹配
+	2403: "match_ack",               // 匹配操作结果
+	2404: "match_found_notify",      // 匹配成功推送
+	2405: "match_timeout_notify",    // 匹配超时推送
+	2501: "room_join_req",           // 加入房间
+	2502: "room_leave_req",          // 离开房间
+	2503: "room_input_req",          // 房间内输入
+	2504: "room_ack",                // 房间操作结果
+	2505: "room_state_notify",       // 房间状态推送
+	2506: "room_closed_notify",      // 房间关闭推送
+	2601: "lockstep_frame_notify",   // 帧同步逻辑帧推送
+	2602: "lockstep_frames_req",     // 断线重连补帧
+	2603: "lockstep_frames_ack",     // 补帧回复
+	2701: "guild_create_req",        // 创建公会
+	2702: "guild_disband_req",       // 解散公会
+	2703: "guild_info_req",          // 公会信息
+	2704: "guild_info_ack",          // 公会信息回复
+	2705: "guild_apply_req",         // 申请加入公会
+	2706: "guild_accept_req",        // 同意入会申请
+	2707: "guild_reject_req",        // 拒绝入会申请
+	2708: "guild_invite_req",        // 邀请加入公会
+	2709: "guild_join_req",          // 接受公会邀请
+	2710: "guild_leave_req",         // 退出公会
+	2711: "guild_kick_req",          // 踢出成员
+	2712: "guild_role_req",          // 任命职位
+	2713: "guild_notice_req",        // 修改公告
+	2714: "guild_donate_req",        // 捐献
+	2715: "guild_records_req",       // 捐献记录
+	2716: "guild_records_ack",       // 捐献记录回复
+	2717: "guild_ack",               // 公会操作结果
+	2718: "guild_event_notify",      // 公会事件推送
+	2719: "guild_invite_notify",     // 公会邀请推送
+	2801: "item_list_req",           // 背包列表
+	2802: "item_list_ack",           // 背包列表回复
+	2803: "item_use_req",            // 使用道具
+	2804: "item_ack",                // 道具操作结果
+	2805: "item_changes_notify",     // 背包变化推送
+	2901: "quest_list_req",          // 任务列表
+	2902: "quest_list_ack",          // 任务列表回复
+	2903: "quest_claim_req",         // 领取任务奖励
+	2904: "quest_ack",               // 任务操作结果
+	2905: "quest_progress_notify",   // 任务进度推送
+	3001: "gacha_pull_req",          // 抽卡
+	3002: "gacha_pull_ack",          // 抽卡结果
+	3003: "gacha_info_req",          // 保底计数
+	3004: "gacha_info_ack",          // 保底计数回复
+	3005: "gacha_ack",               // 抽卡操作结果
+	3101: "currency_list_req",       // 货币余额
+	3102: "currency_list_ack",       // 货币余额回复
+	3103: "currency_changes_notify", // 货币变化推送
+	3104: "currency_ack",            // 货币操作结果
+	3201: "shop_list_req",           // 商店商品列表
+	3202: "shop_list_ack",           // 商店商品列表回复
+	3203: "shop_buy_req",            // 购买商品
+	3204: "shop_buy_ack",            // 购买结果
+	3205: "shop_ack",                // 商店操作结果
+	3301: "world_enter_req",         // 进入开放世界地图
+	3302: "world_enter_ack",         // 进入地图回复
+	3303: "aoi_events_notify",       // 视野事件推送
+	3401: "auction_sell_req",        // 上架道具
+	3402: "auction_buy_req",         // 购买挂单
+	3403: "auction_cancel_req",      // 下架
+	3404: "auction_search_req",      // 查询在售道具
+	3405: "auction_mine_req",        // 我的挂单
+	3406: "auction_listing_ack",     // 挂单回复
+	3407: "auction_list_ack",        // 挂单列表回复
+	3408: "auction_ack",             // 拍卖行操作结果
+	3501: "party_create_req",        // 创建队伍
+	3502: "party_info_req",          // 队伍信息
+	3503: "party_info_ack",          // 队伍信息回复
+	3504: "party_invite_req",        // 邀请加入队伍
+	3505: "party_join_req",          // 接受队伍邀请
+	3506: "party_leave_req",         // 离开队伍
+	3507: "party_kick_req",          // 踢出队员
+	3508: "party_transfer_req",      // 转让队长
+	3509: "party_target_req",        // 设置队伍目标
+	3510: "party_ready_req",         // 设置准备状态
+	3511: "party_match_req",         // 队伍开始匹配
+	3512: "party_room_req",          // 队伍加入房间
+	3513: "party_ack",               // 队伍操作结果
+	3514: "party_notify",            // 队伍状态推送
+	3515: "party_invite_notify",     // 队伍邀请推送
+	3601: "user_rename_req",         // 改名, 首次取名免费
+	3602: "user_rename_ack",         // 改名回复
+	3603: "name_ack",                // 改名失败
+	3701: "level_info_req",          // 查询等级和经验
+	3702: "level_info_ack",          // 等级和经验
+	3703: "exp_notify",              // 经验变化推送
+	3704: "level_up_notify",         // 升级推送
+	3705: "level_ack",               // 等级查询失败
 }
 
 var Handlers map[int16]func(*Session, *packet.Packet) []byte
 
 func init() {
 	Handlers = map[int16]func(*Session, *packet.Packet) []byte{
+		10:   P_user_login_req,
+		30:   P_get_seed_req,
 		1001: P_proto_ping_req,
+		2001: P_chat_world_req,
+		2002: P_chat_private_req,
+		2003: P_chat_channel_req,
+		2006: P_chat_history_req,
+		2101: P_mail_list_req,
+		2103: P_mail_read_req,
+		2104: P_mail_claim_req,
+		2105: P_mail_delete_req,
+		2106: P_mail_send_req,
+		2201: P_friend_list_req,
+		2203: P_friend_request_req,
+		2204: P_friend_accept_req,
+		2205: P_friend_reject_req,
+		2206: P_friend_remove_req,
+		2207: P_friend_block_req,
+		2208: P_friend_unblock_req,
+		2301: P_rank_top_req,
+		2302: P_rank_self_req,
+		2303: P_rank_around_req,
+		2401: P_match_join_req,
+		2402: P_match_cancel_req,
+		2501: P_room_join_req,
+		2502: P_room_leave_req,
+		2503: P_room_input_req,
+		2602: P_lockstep_frames_req,
+		2701: P_guild_create_req,
+		2702: P_guild_disband_req,
+		2703: P_guild_info_req,
+		2705: P_guild_apply_req,
+		2706: P_guild_accept_req,
+		2707: P_guild_reject_req,
+		2708: P_guild_invite_req,
+		2709: P_guild_join_req,
+		2710: P_guild_leave_req,
+		2711: P_guild_kick_req,
+		2712: P_guild_role_req,
+		2713: P_guild_notice_req,
+		2714: P_guild_donate_req,
+		2715: P_guild_records_req,
+		2801: P_item_list_req,
+		2803: P_item_use_req,
+		2901: P_quest_list_req,
+		2903: P_quest_claim_req,
+		3001: P_gacha_pull_req,
+		3003: P_gacha_info_req,
+		3101: P_currency_list_req,
+		3201: P_shop_list_req,
+		3203: P_shop_buy_req,
+		3301: P_world_enter_req,
+		3401: P_auction_sell_req,
+		3402: P_auction_buy_req,
+		3403: P_auction_cancel_req,
+		3404: P_auction_search_req,
+		3405: P_auction_mine_req,
+		3501: P_party_create_req,
+		3502: P_party_info_req,
+		3504: P_party_invite_req,
+		3505: P_party_join_req,
+		3506: P_party_leave_req,
+		3507: P_party_kick_req,
+		3508: P_party_transfer_req,
+		3509: P_party_target_req,
+		3510: P_party_ready_req,
+		3511: P_party_match_req,
+		3512: P_party_room_req,
+		3601: P_user_rename_req,
+		3701: P_level_info_req,
 	}
 }
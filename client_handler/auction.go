@@ -0,0 +1,188 @@
+package client_handler
+
+import (
+	"time"
+
+	"game/auction"
+	"game/currency"
+	"game/inventory"
+	"game/mail"
+	"game/misc/packet"
+	"game/numbers"
+	. "game/types"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// 拍卖行数值表(AuctionCfg):
+// Params tax_rate(千分比) duration(挂单有效期, 小时) max_listings 的Value列, 缺省时使用默认值
+const (
+	NUMBERS_AUCTION  = "AuctionCfg"
+	AUCTION_BOUGHT   = "拍卖行购买"
+	AUCTION_RETURNED = "拍卖行退回"
+	AUCTION_CONTENT  = "请领取附件中的道具"
+)
+
+func init() {
+	register_numbers(NUMBERS_AUCTION, load_auction_config)
+}
+
+func init_auction() {
+	auction.Init(&DefaultDatabase)
+	auction.Escrow = escrow_auction
+	auction.Deliver = deliver_auction
+	auction.Debit = debit_auction
+	auction.Credit = credit_auction
+}
+
+func load_auction_config(ns numbers.NumbersOp) {
+	cfg := auction.DefaultConfig()
+	if ns.IsFieldExists("Params", "tax_rate", "Value") {
+		cfg.TaxRate = int64(ns.GetInt("Params", "tax_rate", "Value"))
+	}
+	if ns.IsFieldExists("Params", "duration", "Value") {
+		cfg.Duration = time.Duration(ns.GetInt("Params", "duration", "Value")) * time.Hour
+	}
+	if ns.IsFieldExists("Params", "max_listings", "Value") {
+		cfg.MaxListings = int(ns.GetInt("Params", "max_listings", "Value"))
+	}
+	if cfg.TaxRate < 0 || cfg.TaxRate > 1000 || cfg.Duration <= 0 {
+		log.Error("auction config: invalid tax_rate or duration")
+		return
+	}
+	auction.SetConfig(cfg)
+	log.Infof("auction config loaded, tax:%v duration:%v", cfg.TaxRate, cfg.Duration)
+}
+
+// 限时道具不能上架: 扣除时不保留到期时间, 交付时会按获得时间重新计算
+func escrow_auction(userid int32, item mail.Attachment) error {
+	if item.Type == mail.ATTACH_ITEM {
+		if def := inventory.Def(item.Id); def == nil || def.Expire > 0 {
+			return auction.ERROR_INVALID_ITEM
+		}
+	}
+	return pay(userid, item, inventory.REASON_AUCTION)
+}
+
+// 道具都通过邮件发放, 收件人可能不在线或在其他实例上; 以key为邮件id, 重试时不会重复发放
+func deliver_auction(userid int32, item mail.Attachment, reason int32, key string) error {
+	title := AUCTION_BOUGHT
+	if reason == auction.DELIVER_RETURNED {
+		title = AUCTION_RETURNED
+	}
+	return mail.SendOnce(key, userid, title, AUCTION_CONTENT, []mail.Attachment{item})
+}
+
+func debit_auction(userid, id int32, amount int64, key string) error {
+	_, err := currency.Debit(userid, id, amount, reason_name(inventory.REASON_AUCTION), key)
+	return err
+}
+
+func credit_auction(userid, id int32, amount int64, key string) error {
+	_, err := currency.Credit(userid, id, amount, reason_name(inventory.REASON_AUCTION), key)
+	return err
+}
+
+func auction_listing(l *auction.Listing) S_auction_listing {
+	return S_auction_listing{
+		F_id:       l.Id,
+		F_seller:   l.Seller,
+		F_item:     l.Item.Id,
+		F_count:    l.Item.Count,
+		F_currency: l.Currency,
+		F_price:    l.Price,
+		F_state:    l.State,
+		F_expire:   l.ExpireAt,
+	}
+}
+
+func auction_list(listings []auction.Listing) []byte {
+	ret := S_auction_list{F_listings: make([]S_auction_listing, len(listings))}
+	for k := range listings {
+		ret.F_listings[k] = auction_listing(&listings[k])
+	}
+	return packet.Pack(Code["auction_list_ack"], ret, nil)
+}
+
+func auction_errcode(err error) int32 {
+	switch err {
+	case auction.ERROR_LISTING_NOT_FOUND:
+		return ERRCODE_AUCTION_NOT_FOUND
+	case auction.ERROR_NOT_AVAILABLE:
+		return ERRCODE_AUCTION_NOT_AVAILABLE
+	case auction.ERROR_OWN_LISTING:
+		return ERRCODE_AUCTION_OWN
+	case auction.ERROR_NOT_SELLER:
+		return ERRCODE_AUCTION_NOT_SELLER
+	case auction.ERROR_TOO_MANY_LISTINGS:
+		return ERRCODE_AUCTION_LIMIT
+	case auction.ERROR_INVALID_ITEM, auction.ERROR_INVALID_PRICE, mail.ERROR_INVALID_ATTACH:
+		return ERRCODE_INVALID_PARAM
+	case currency.ERROR_NOT_ENOUGH:
+		return ERRCODE_CURRENCY_NOT_ENOUGH
+	}
+	return item_errcode(err)
+}
+
+func auction_ack(err error) []byte {
+	if err != nil {
+		return error_ack("auction_ack", auction_errcode(err), err)
+	}
+	return error_ack("auction_ack", ERRCODE_SUCCEED, nil)
+}
+
+//----------------------------------- 上架道具
+func P_auction_sell_req(sess *Session, reader *packet.Packet) []byte {
+	tbl, _ := PKT_auction_sell(reader)
+	item := mail.Attachment{Type: mail.ATTACH_ITEM, Id: tbl.F_item, Count: tbl.F_count}
+	price := mail.Attachment{Type: mail.ATTACH_CURRENCY, Id: tbl.F_currency, Count: 1}
+	if err := validate_attachment(&item); err != nil {
+		return auction_ack(err)
+	}
+	if err := validate_attachment(&price); err != nil {
+		return auction_ack(err)
+	}
+
+	l, err := auction.Sell(sess.UserId, item, tbl.F_currency, tbl.F_price, time.Now())
+	if err != nil {
+		return auction_ack(err)
+	}
+	return packet.Pack(Code["auction_listing_ack"], auction_listing(l), nil)
+}
+
+//----------------------------------- 购买挂单
+func P_auction_buy_req(sess *Session, reader *packet.Packet) []byte {
+	tbl, _ := PKT_auction_id(reader)
+	l, err := auction.Buy(sess.UserId, tbl.F_id, time.Now())
+	if err != nil {
+		return auction_ack(err)
+	}
+	return packet.Pack(Code["auction_listing_ack"], auction_listing(l), nil)
+}
+
+//----------------------------------- 下架
+func P_auction_cancel_req(sess *Session, reader *packet.Packet) []byte {
+	tbl, _ := PKT_auction_id(reader)
+	return auction_ack(auction.Cancel(sess.UserId, tbl.F_id, time.Now()))
+}
+
+//----------------------------------- 查询在售道具
+func P_auction_search_req(sess *Session, reader *packet.Packet) []byte {
+	tbl, _ := PKT_auction_search(reader)
+	listings, err := auction.Search(tbl.F_item, time.Now())
+	if err != nil {
+		log.Error(err)
+		return auction_ack(err)
+	}
+	return auction_list(listings)
+}
+
+//----------------------------------- 我的挂单
+func P_auction_mine_req(sess *Session, reader *packet.Packet) []byte {
+	listings, err := auction.Mine(sess.UserId)
+	if err != nil {
+		log.Error(err)
+		return auction_ack(err)
+	}
+	return auction_list(listings)
+}
@@ -0,0 +1,37 @@
+package client_handler
+
+import (
+	"testing"
+	"time"
+
+	"game/auction"
+	"game/inventory"
+	"game/mail"
+)
+
+func TestEscrowExpire(t *testing.T) {
+	setup(t)
+	inventory.SetDefs(map[int32]*inventory.ItemDef{
+		1: {Id: 1, MaxStack: 10},
+		2: {Id: 2, MaxStack: 10, Expire: time.Hour},
+	})
+	defer inventory.SetDefs(nil)
+	defer inventory.Release(2002)
+
+	m, _ := inventory.Get(2002)
+	m.AddItems(map[int32]int32{1: 2, 2: 2}, inventory.REASON_GM)
+
+	// 限时道具交付时会重新计算到期时间, 不能上架
+	if err := escrow_auction(2002, mail.Attachment{Type: mail.ATTACH_ITEM, Id: 2, Count: 1}); err != auction.ERROR_INVALID_ITEM {
+		t.Fatal("expiring item escrowed:", err)
+	}
+	if n := m.Count(2); n != 2 {
+		t.Fatal("expiring item removed:", n)
+	}
+	if err := escrow_auction(2002, mail.Attachment{Type: mail.ATTACH_ITEM, Id: 1, Count: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if n := m.Count(1); n != 1 {
+		t.Fatal("item not escrowed:", n)
+	}
+}
@@ -0,0 +1,190 @@
+package client_handler
+
+import (
+	"time"
+
+	"game/channels"
+	"game/chat"
+	"game/friends"
+	"game/misc/packet"
+	"game/numbers"
+	"game/presence"
+	. "game/types"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// 聊天数值表:
+// Words  第一列为敏感词
+// Params rate_limit, rate_window(秒), history_size, max_length 的Value列
+const (
+	NUMBERS_CHAT = "ChatConfig"
+)
+
+func init() {
+	register_numbers(NUMBERS_CHAT, load_chat_config)
+}
+
+func load_chat_config(ns numbers.NumbersOp) {
+	cfg := &chat.Config{}
+	if ns.IsTableExists("Words") {
+		cfg.Words = ns.GetKeys("Words")
+	}
+	if ns.IsTableExists("Params") {
+		param := func(name string) int32 {
+			if ns.IsFieldExists("Params", name, "Value") {
+				return ns.GetInt("Params", name, "Value")
+			}
+			return 0
+		}
+		cfg.RateLimit = int(param("rate_limit"))
+		cfg.RateWindow = time.Duration(param("rate_window")) * time.Second
+		cfg.HistorySize = int(param("history_size"))
+		cfg.MaxLength = int(param("max_length"))
+	}
+	chat.SetConfig(cfg)
+	log.Info("chat config loaded, words:", len(cfg.Words))
+}
+
+func chat_errcode(err error) int32 {
+	switch err {
+	case chat.ERROR_EMPTY:
+		return ERRCODE_CHAT_EMPTY
+	case chat.ERROR_TOO_LONG:
+		return ERRCODE_CHAT_TOO_LONG
+	case chat.ERROR_MUTED:
+		return ERRCODE_CHAT_MUTED
+	case chat.ERROR_TOO_FAST:
+		return ERRCODE_CHAT_TOO_FAST
+	case chat.ERROR_NOT_MEMBER:
+		return ERRCODE_CHAT_NOT_JOIN
+	}
+	return ERRCODE_INTERNAL
+}
+
+// 检查, 记录并打包聊天消息
+func chat_post(sess *Session, typ int32, tbl *S_chat_msg) ([]byte, error) {
+	content, err := chat.Prepare(sess.UserId, tbl.F_content)
+	if err != nil {
+		return nil, err
+	}
+
+	msg := &chat.Message{Type: typ, From: sess.UserId, Content: content, CreatedAt: time.Now()}
+	switch typ {
+	case chat.CHAT_WORLD:
+		msg.Key = chat.WorldKey()
+	case chat.CHAT_PRIVATE:
+		msg.To = tbl.F_to
+		msg.Key = chat.PrivateKey(sess.UserId, tbl.F_to)
+	case chat.CHAT_CHANNEL:
+		msg.Channel = tbl.F_channel
+		msg.Key = chat.ChannelKey(tbl.F_channel)
+	}
+	chat.Record(msg, tbl.F_content)
+	return packet.Pack(Code["chat_notify"], chat_info(msg), nil), nil
+}
+
+func chat_info(msg *chat.Message) S_chat_info {
+	return S_chat_info{
+		F_type:    msg.Type,
+		F_channel: msg.Channel,
+		F_from:    msg.From,
+		F_to:      msg.To,
+		F_content: msg.Content,
+		F_time:    msg.CreatedAt.Unix(),
+	}
+}
+
+//----------------------------------- 世界聊天
+func P_chat_world_req(sess *Session, reader *packet.Packet) []byte {
+	tbl, _ := PKT_chat_msg(reader)
+	notify, err := chat_post(sess, chat.CHAT_WORLD, &tbl)
+	if err != nil {
+		return error_ack("chat_ack", chat_errcode(err), err)
+	}
+
+	if err := channels.Broadcast(chat.WORLD_CHANNEL, notify); err != nil {
+		log.Error(err)
+		return error_ack("chat_ack", ERRCODE_INTERNAL, err)
+	}
+	return error_ack("chat_ack", ERRCODE_SUCCEED, nil)
+}
+
+//----------------------------------- 私聊
+func P_chat_private_req(sess *Session, reader *packet.Packet) []byte {
+	tbl, _ := PKT_chat_msg(reader)
+	if tbl.F_to == sess.UserId {
+		return error_ack("chat_ack", ERRCODE_INVALID_PARAM, nil)
+	}
+	if !presence.IsOnline(tbl.F_to) {
+		return error_ack("chat_ack", ERRCODE_TARGET_OFFLINE, nil)
+	}
+	blocked, err := friends.IsBlocked(sess.UserId, tbl.F_to)
+	if err != nil {
+		return error_ack("chat_ack", ERRCODE_INTERNAL, err)
+	} else if blocked {
+		return error_ack("chat_ack", ERRCODE_FRIEND_BLOCKED, friends.ERROR_BLOCKED)
+	}
+
+	notify, err := chat_post(sess, chat.CHAT_PRIVATE, &tbl)
+	if err != nil {
+		return error_ack("chat_ack", chat_errcode(err), err)
+	}
+
+	if !channels.SendTo(tbl.F_to, notify) {
+		return error_ack("chat_ack", ERRCODE_TARGET_OFFLINE, nil)
+	}
+	return error_ack("chat_ack", ERRCODE_SUCCEED, nil)
+}
+
+//----------------------------------- 频道聊天
+func P_chat_channel_req(sess *Session, reader *packet.Packet) []byte {
+	tbl, _ := PKT_chat_msg(reader)
+	c := channels.Get(tbl.F_channel)
+	if c == nil || !c.IsMember(sess.UserId) {
+		return error_ack("chat_ack", ERRCODE_CHAT_NOT_JOIN, chat.ERROR_NOT_MEMBER)
+	}
+
+	notify, err := chat_post(sess, chat.CHAT_CHANNEL, &tbl)
+	if err != nil {
+		return error_ack("chat_ack", chat_errcode(err), err)
+	}
+
+	if err := channels.Broadcast(tbl.F_channel, notify); err != nil {
+		log.Error(err)
+		return error_ack("chat_ack", ERRCODE_INTERNAL, err)
+	}
+	return error_ack("chat_ack", ERRCODE_SUCCEED, nil)
+}
+
+//----------------------------------- 聊天历史
+func P_chat_history_req(sess *Session, reader *packet.Packet) []byte {
+	tbl, _ := PKT_chat_msg(reader)
+	var key string
+	switch tbl.F_type {
+	case chat.CHAT_WORLD:
+		key = chat.WorldKey()
+	case chat.CHAT_PRIVATE:
+		key = chat.PrivateKey(sess.UserId, tbl.F_to)
+	case chat.CHAT_CHANNEL:
+		c := channels.Get(tbl.F_channel)
+		if c == nil || !c.IsMember(sess.UserId) {
+			return error_ack("chat_ack", ERRCODE_CHAT_NOT_JOIN, chat.ERROR_NOT_MEMBER)
+		}
+		key = chat.ChannelKey(tbl.F_channel)
+	default:
+		return error_ack("chat_ack", ERRCODE_INVALID_PARAM, nil)
+	}
+
+	msgs, err := chat.History(key)
+	if err != nil {
+		log.Error(err)
+		return error_ack("chat_ack", ERRCODE_INTERNAL, err)
+	}
+
+	ret := S_chat_history{F_msgs: make([]S_chat_info, len(msgs))}
+	for k := range msgs {
+		ret.F_msgs[k] = chat_info(&msgs[k])
+	}
+	return packet.Pack(Code["chat_history_ack"], ret, nil)
+}
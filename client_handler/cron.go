@@ -0,0 +1,69 @@
+package client_handler
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"game/cron"
+	"game/leaderboard"
+	"game/numbers"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// 定时任务数值表(CronCfg):
+// KEY_Jobs 第一列为任务名, Spec(cron表达式) Timezone CatchUp(1补执行) Action Param
+// Action为cron_actions中注册的动作, 数值表热更新时重新添加全部任务
+const (
+	NUMBERS_CRON = "CronCfg"
+)
+
+var (
+	ERROR_CRON_ACTION = errors.New("unknown cron action")
+)
+
+// 定时任务动作, param为数值表中的Param
+var cron_actions = map[string]func(param string) error{
+	"leaderboard_season": leaderboard.NewSeason,
+}
+
+var (
+	_cron_jobs   []string // 由数值表添加的任务
+	_cron_jobs_m sync.Mutex
+)
+
+func init() {
+	register_numbers(NUMBERS_CRON, load_cron_config)
+}
+
+func load_cron_config(ns numbers.NumbersOp) {
+	const jobs = "KEY_Jobs"
+	if !ns.IsTableExists(jobs) {
+		log.Error("cron config: missing KEY_Jobs")
+		return
+	}
+
+	_cron_jobs_m.Lock()
+	defer _cron_jobs_m.Unlock()
+	for _, name := range _cron_jobs {
+		cron.Remove(name)
+	}
+	_cron_jobs = nil
+
+	for _, name := range ns.GetKeys(jobs) {
+		action, param := ns.GetString(jobs, name, "Action"), ns.GetString(jobs, name, "Param")
+		f, ok := cron_actions[action]
+		if !ok {
+			log.Errorf("cron config: job:%v err:%v %v", name, ERROR_CRON_ACTION, action)
+			continue
+		}
+		run := func(time.Time) error { return f(param) }
+		err := cron.Add(name, ns.GetString(jobs, name, "Spec"), ns.GetString(jobs, name, "Timezone"), ns.GetInt(jobs, name, "CatchUp") == 1, run)
+		if err != nil {
+			log.Errorf("cron config: job:%v err:%v", name, err)
+			continue
+		}
+		_cron_jobs = append(_cron_jobs, name)
+	}
+}
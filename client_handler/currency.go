@@ -0,0 +1,95 @@
+package client_handler
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"game/channels"
+	"game/currency"
+	"game/events"
+	"game/inventory"
+	"game/misc/packet"
+	. "game/types"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// 货币:
+// 余额和流水由currency维护, 这里负责推送变化, 触发消费事件
+func init() {
+	cron_actions["currency_reconcile"] = reconcile_currency
+}
+
+func init_currency() {
+	currency.Init(&DefaultDatabase)
+	currency.OnChange = on_currency_change
+}
+
+// 变化原因写入流水
+var _reason_names = map[int32]string{
+	inventory.REASON_MAIL:    "mail",
+	inventory.REASON_USE:     "use",
+	inventory.REASON_GM:      "gm",
+	inventory.REASON_QUEST:   "quest",
+	inventory.REASON_GACHA:   "gacha",
+	inventory.REASON_SHOP:    "shop",
+	inventory.REASON_AUCTION: "auction",
+	inventory.REASON_RENAME:  "rename",
+	inventory.REASON_LEVEL:   "level",
+}
+
+func reason_name(reason int32) string {
+	if name, ok := _reason_names[reason]; ok {
+		return name
+	}
+	return fmt.Sprint(reason)
+}
+
+// 推送余额变化, 支出时触发消费事件; 玩家可能在其他实例上
+func on_currency_change(r *currency.Record) {
+	ret := S_currency_change{F_id: r.Currency, F_amount: r.Amount, F_balance: r.Balance, F_reason: r.Reason}
+	channels.SendTo(r.UserId, packet.Pack(Code["currency_changes_notify"], ret, nil))
+	if r.Amount < 0 {
+		events.Fire(events.EVENT_SPEND, r.UserId, r.Currency, -r.Amount)
+	}
+}
+
+// 定时对账全部玩家
+func reconcile_currency(param string) error {
+	start := time.Now()
+	mismatches, err := currency.ReconcileAll()
+	if err != nil {
+		return err
+	}
+	log.Infof("currency reconciled, mismatches:%v cost:%v", len(mismatches), time.Since(start))
+	return nil
+}
+
+func currency_errcode(err error) int32 {
+	switch err {
+	case currency.ERROR_NOT_ENOUGH:
+		return ERRCODE_CURRENCY_NOT_ENOUGH
+	case currency.ERROR_KEY_CONFLICT:
+		return ERRCODE_CURRENCY_KEY
+	case currency.ERROR_INVALID_AMOUNT:
+		return ERRCODE_INVALID_PARAM
+	}
+	return ERRCODE_INTERNAL
+}
+
+// ----------------------------------- 货币余额
+func P_currency_list_req(sess *Session, reader *packet.Packet) []byte {
+	balances, err := currency.Balances(sess.UserId)
+	if err != nil {
+		log.Error(err)
+		return error_ack("currency_ack", currency_errcode(err), err)
+	}
+
+	ret := S_currency_list{F_currencies: make([]S_currency, 0, len(balances))}
+	for id, balance := range balances {
+		ret.F_currencies = append(ret.F_currencies, S_currency{F_id: id, F_balance: balance})
+	}
+	sort.Slice(ret.F_currencies, func(i, j int) bool { return ret.F_currencies[i].F_id < ret.F_currencies[j].F_id })
+	return packet.Pack(Code["currency_list_ack"], ret, nil)
+}
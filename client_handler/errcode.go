@@ -0,0 +1,97 @@
+package client_handler
+
+import "game/misc/packet"
+
+// S_error_info中的错误码, 0代表成功
+const (
+	ERRCODE_SUCCEED               = 0
+	ERRCODE_INTERNAL              = 1 // 服务器内部错误
+	ERRCODE_INVALID_PARAM         = 2 // 参数错误
+	ERRCODE_TARGET_OFFLINE        = 3 // 目标玩家不在线
+	ERRCODE_CHAT_EMPTY            = 100
+	ERRCODE_CHAT_TOO_LONG         = 101
+	ERRCODE_CHAT_MUTED            = 102
+	ERRCODE_CHAT_TOO_FAST         = 103
+	ERRCODE_CHAT_NOT_JOIN         = 104
+	ERRCODE_MAIL_NOT_FOUND        = 200
+	ERRCODE_MAIL_CLAIMED          = 201
+	ERRCODE_MAIL_NO_ATTACH        = 202
+	ERRCODE_MAIL_TOO_LONG         = 203
+	ERRCODE_MAIL_INVALID          = 204
+	ERRCODE_MAIL_NO_TARGET        = 205 // 收件人不存在
+	ERRCODE_FRIEND_SELF           = 300
+	ERRCODE_FRIEND_ALREADY        = 301
+	ERRCODE_FRIEND_PENDING        = 302
+	ERRCODE_FRIEND_NO_REQ         = 303
+	ERRCODE_FRIEND_FULL           = 304
+	ERRCODE_FRIEND_T_FULL         = 305
+	ERRCODE_FRIEND_BLOCKED        = 306
+	ERRCODE_BLOCK_FULL            = 307
+	ERRCODE_RANK_NO_BOARD         = 400
+	ERRCODE_MATCH_QUEUED          = 500
+	ERRCODE_MATCH_NOT_IN          = 501
+	ERRCODE_ROOM_NOT_FOUND        = 600
+	ERRCODE_ROOM_FULL             = 601
+	ERRCODE_ROOM_OTHER            = 602
+	ERRCODE_ROOM_NOT_IN           = 603
+	ERRCODE_ROOM_BUSY             = 604
+	ERRCODE_GUILD_NONE            = 700 // 公会不存在
+	ERRCODE_GUILD_IN              = 701 // 已在公会中
+	ERRCODE_GUILD_NOT_IN          = 702 // 不在公会中
+	ERRCODE_GUILD_NAME            = 703 // 名字已存在
+	ERRCODE_GUILD_INVALID         = 704 // 名字或公告不合法
+	ERRCODE_GUILD_PERM            = 705 // 没有权限
+	ERRCODE_GUILD_FULL            = 706
+	ERRCODE_GUILD_NO_REQ          = 707 // 申请或邀请不存在
+	ERRCODE_GUILD_LEADER          = 708 // 会长不能退出
+	ERRCODE_GUILD_DONATE          = 709 // 捐献失败
+	ERRCODE_GUILD_BUSY            = 710 // 并发修改冲突
+	ERRCODE_ITEM_NOT_FOUND        = 800 // 道具不存在或已过期
+	ERRCODE_ITEM_NOT_ENOUGH       = 801
+	ERRCODE_ITEM_NOT_USABLE       = 802
+	ERRCODE_ITEM_FULL             = 803 // 背包已满
+	ERRCODE_QUEST_NOT_FOUND       = 900
+	ERRCODE_QUEST_NOT_DONE        = 901  // 任务未完成
+	ERRCODE_QUEST_CLAIMED         = 902  // 奖励已领取
+	ERRCODE_GACHA_POOL            = 1000 // 卡池不存在
+	ERRCODE_GACHA_TIMES           = 1001
+	ERRCODE_GACHA_PAY             = 1002 // 消耗不足
+	ERRCODE_LOGIN_WAY             = 1100 // 登陆方式或凭证错误
+	ERRCODE_LOGIN_CERT            = 1101 // 证书无效或已过期
+	ERRCODE_CURRENCY_NOT_ENOUGH   = 1200 // 货币不足
+	ERRCODE_CURRENCY_KEY          = 1201 // 订单号已被其他交易使用
+	ERRCODE_SHOP_GOODS            = 1300 // 商品不存在
+	ERRCODE_SHOP_LIMIT            = 1301 // 超过限购数量
+	ERRCODE_SHOP_CLOSED           = 1302 // 商品不在销售时间内
+	ERRCODE_SHOP_PAY              = 1303 // 价格不足
+	ERRCODE_AUCTION_NOT_FOUND     = 1400
+	ERRCODE_AUCTION_NOT_AVAILABLE = 1401 // 已售出, 下架或过期
+	ERRCODE_AUCTION_OWN           = 1402 // 不能购买自己的挂单
+	ERRCODE_AUCTION_NOT_SELLER    = 1403
+	ERRCODE_AUCTION_LIMIT         = 1404 // 在售挂单数已达上限
+	ERRCODE_PARTY_NONE            = 1500 // 队伍不存在
+	ERRCODE_PARTY_IN              = 1501 // 已在队伍中
+	ERRCODE_PARTY_NOT_IN          = 1502 // 不在队伍中
+	ERRCODE_PARTY_LEADER          = 1503 // 不是队长
+	ERRCODE_PARTY_MEMBER          = 1504 // 目标不是队伍成员
+	ERRCODE_PARTY_FULL            = 1505
+	ERRCODE_PARTY_NO_INVITE       = 1506 // 邀请不存在或已过期
+	ERRCODE_PARTY_BUSY            = 1507 // 并发修改冲突
+	ERRCODE_PARTY_REMOTE          = 1508 // 有队员离线或不在同一实例上
+	ERRCODE_PARTY_NOT_READY       = 1509 // 有队员未准备
+	ERRCODE_NAME_INVALID          = 1600 // 长度或字符不合法
+	ERRCODE_NAME_FORBIDDEN        = 1601 // 包含屏蔽词
+	ERRCODE_NAME_TAKEN            = 1602 // 名字已被使用
+	ERRCODE_NAME_SAME             = 1603 // 与当前名字相同
+	ERRCODE_NAME_COOLDOWN         = 1604 // 改名冷却中
+	ERRCODE_NAME_BUSY             = 1605 // 预留被抢占, 费用已退还
+)
+
+// 错误回复
+func error_ack(code string, errcode int32, err error) []byte {
+	tbl := S_error_info{F_code: errcode}
+	if err != nil {
+		tbl.F_msg = err.Error()
+	}
+	return packet.Pack(Code[code], tbl, nil)
+}
@@ -0,0 +1,152 @@
+package client_handler
+
+import (
+	"game/channels"
+	"game/friends"
+	"game/misc/packet"
+	"game/numbers"
+	"game/presence"
+	. "game/types"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// 社交数值表:
+// Params max_friends 的Value列
+const (
+	NUMBERS_SOCIAL = "SocialConfig"
+)
+
+func init() {
+	register_numbers(NUMBERS_SOCIAL, load_social_config)
+}
+
+func load_social_config(ns numbers.NumbersOp) {
+	if ns.IsFieldExists("Params", "max_friends", "Value") {
+		friends.SetMaxFriends(int(ns.GetInt("Params", "max_friends", "Value")))
+	}
+}
+
+func friend_errcode(err error) int32 {
+	switch err {
+	case friends.ERROR_SELF:
+		return ERRCODE_FRIEND_SELF
+	case friends.ERROR_ALREADY_FRIEND:
+		return ERRCODE_FRIEND_ALREADY
+	case friends.ERROR_ALREADY_REQUESTED:
+		return ERRCODE_FRIEND_PENDING
+	case friends.ERROR_REQUEST_NOT_FOUND:
+		return ERRCODE_FRIEND_NO_REQ
+	case friends.ERROR_FRIENDS_FULL:
+		return ERRCODE_FRIEND_FULL
+	case friends.ERROR_TARGET_FULL:
+		return ERRCODE_FRIEND_T_FULL
+	case friends.ERROR_BLOCKED:
+		return ERRCODE_FRIEND_BLOCKED
+	case friends.ERROR_BLOCKED_FULL:
+		return ERRCODE_BLOCK_FULL
+	}
+	return ERRCODE_INTERNAL
+}
+
+func friend_ack(err error) []byte {
+	if err != nil {
+		return error_ack("friend_ack", friend_errcode(err), err)
+	}
+	return error_ack("friend_ack", ERRCODE_SUCCEED, nil)
+}
+
+// 通知在线好友自己上线或下线, 由会话开始和结束驱动
+func friends_notify_status(userid int32, online bool) {
+	r, err := friends.Get(userid)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	if len(r.Friends) == 0 {
+		return
+	}
+
+	notify := packet.Pack(Code["friend_status_notify"], S_friend_info{F_id: userid, F_online: online}, nil)
+	for id := range presence.QueryMulti(r.Friends) {
+		channels.SendTo(id, notify)
+	}
+}
+
+//----------------------------------- 好友列表
+func P_friend_list_req(sess *Session, reader *packet.Packet) []byte {
+	r, err := friends.Get(sess.UserId)
+	if err != nil {
+		log.Error(err)
+		return friend_ack(err)
+	}
+	reqs, err := friends.Requests(sess.UserId)
+	if err != nil {
+		log.Error(err)
+		return friend_ack(err)
+	}
+
+	online := presence.QueryMulti(r.Friends)
+	ret := S_friend_list{}
+	for _, id := range r.Friends {
+		info := S_friend_info{F_id: id}
+		if p, ok := online[id]; ok {
+			info.F_online = true
+			info.F_status = p.Status
+		}
+		ret.F_friends = append(ret.F_friends, info)
+	}
+	for k := range reqs {
+		ret.F_requests = append(ret.F_requests, S_auto_id{F_id: reqs[k].From})
+	}
+	for _, id := range r.Blocked {
+		ret.F_blocked = append(ret.F_blocked, S_auto_id{F_id: id})
+	}
+	return packet.Pack(Code["friend_list_ack"], ret, nil)
+}
+
+//----------------------------------- 好友申请
+func P_friend_request_req(sess *Session, reader *packet.Packet) []byte {
+	tbl, _ := PKT_auto_id(reader)
+	if err := friends.SendRequest(sess.UserId, tbl.F_id); err != nil {
+		return friend_ack(err)
+	}
+	channels.SendTo(tbl.F_id, packet.Pack(Code["friend_request_notify"], S_auto_id{F_id: sess.UserId}, nil))
+	return friend_ack(nil)
+}
+
+//----------------------------------- 接受好友申请
+func P_friend_accept_req(sess *Session, reader *packet.Packet) []byte {
+	tbl, _ := PKT_auto_id(reader)
+	if err := friends.Accept(sess.UserId, tbl.F_id); err != nil {
+		return friend_ack(err)
+	}
+
+	// 通知申请者, 新好友当前在线
+	channels.SendTo(tbl.F_id, packet.Pack(Code["friend_status_notify"], S_friend_info{F_id: sess.UserId, F_online: true}, nil))
+	return friend_ack(nil)
+}
+
+//----------------------------------- 拒绝好友申请
+func P_friend_reject_req(sess *Session, reader *packet.Packet) []byte {
+	tbl, _ := PKT_auto_id(reader)
+	return friend_ack(friends.Reject(sess.UserId, tbl.F_id))
+}
+
+//----------------------------------- 删除好友
+func P_friend_remove_req(sess *Session, reader *packet.Packet) []byte {
+	tbl, _ := PKT_auto_id(reader)
+	return friend_ack(friends.Remove(sess.UserId, tbl.F_id))
+}
+
+//----------------------------------- 加入黑名单
+func P_friend_block_req(sess *Session, reader *packet.Packet) []byte {
+	tbl, _ := PKT_auto_id(reader)
+	return friend_ack(friends.Block(sess.UserId, tbl.F_id))
+}
+
+//----------------------------------- 移出黑名单
+func P_friend_unblock_req(sess *Session, reader *packet.Packet) []byte {
+	tbl, _ := PKT_auto_id(reader)
+	return friend_ack(friends.Unblock(sess.UserId, tbl.F_id))
+}
@@ -0,0 +1,177 @@
+package client_handler
+
+import (
+	"strconv"
+
+	"game/currency"
+	"game/gacha"
+	"game/inventory"
+	"game/mail"
+	"game/misc/packet"
+	"game/numbers"
+	. "game/types"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// 抽卡数值表(GachaCfg):
+// KEY_Data   第一列为卡池id, CostType CostId Cost TenCostType TenCostId TenCost PityRarity PityCount TenRarity
+// KEY_Rarity 第一列为任意编号, Pool Rarity Weight
+// KEY_Items  第一列为任意编号, Pool Rarity Type Id Count Weight
+// 十连消耗为空时为单抽的10倍
+const (
+	NUMBERS_GACHA = "GachaCfg"
+)
+
+func init() {
+	register_numbers(NUMBERS_GACHA, load_gacha_config)
+}
+
+func init_gacha() {
+	gacha.Init(&DefaultDatabase)
+	gacha.Pay = pay_gacha
+	gacha.Refund = refund_gacha
+	gacha.Grant = grant_gacha
+}
+
+func load_gacha_config(ns numbers.NumbersOp) {
+	const data, rarities, items = "KEY_Data", "KEY_Rarity", "KEY_Items"
+	if !ns.IsTableExists(data) || !ns.IsTableExists(rarities) || !ns.IsTableExists(items) {
+		log.Error("gacha config: missing KEY_Data, KEY_Rarity or KEY_Items")
+		return
+	}
+
+	pools := make(map[int32]*gacha.Pool)
+	var ids []int32
+	for _, key := range ns.GetKeys(data) {
+		id, err := strconv.Atoi(key)
+		if err != nil {
+			log.Error("gacha config: invalid pool:", key)
+			continue
+		}
+		p := &gacha.Pool{
+			Id:         int32(id),
+			Cost:       mail.Attachment{Type: ns.GetInt(data, key, "CostType"), Id: ns.GetInt(data, key, "CostId"), Count: ns.GetInt(data, key, "Cost")},
+			PityRarity: ns.GetInt(data, key, "PityRarity"),
+			PityCount:  ns.GetInt(data, key, "PityCount"),
+			TenRarity:  ns.GetInt(data, key, "TenRarity"),
+		}
+		if ns.IsFieldExists(data, key, "TenCost") {
+			p.TenCost = mail.Attachment{Type: ns.GetInt(data, key, "TenCostType"), Id: ns.GetInt(data, key, "TenCostId"), Count: ns.GetInt(data, key, "TenCost")}
+		}
+		pools[p.Id] = p
+		ids = append(ids, p.Id)
+	}
+
+	// 稀有度按从低到高插入
+	for _, key := range ns.GetKeys(rarities) {
+		p := pools[ns.GetInt(rarities, key, "Pool")]
+		if p == nil {
+			log.Error("gacha config: rarity of unknown pool, row:", key)
+			continue
+		}
+		r := gacha.Rarity{Rarity: ns.GetInt(rarities, key, "Rarity"), Weight: ns.GetInt(rarities, key, "Weight")}
+		k := len(p.Rarities)
+		for k > 0 && p.Rarities[k-1].Rarity > r.Rarity {
+			k--
+		}
+		p.Rarities = append(p.Rarities, gacha.Rarity{})
+		copy(p.Rarities[k+1:], p.Rarities[k:])
+		p.Rarities[k] = r
+	}
+
+	for _, key := range ns.GetKeys(items) {
+		p := pools[ns.GetInt(items, key, "Pool")]
+		if p == nil {
+			log.Error("gacha config: item of unknown pool, row:", key)
+			continue
+		}
+		e := gacha.Entry{
+			Item:   mail.Attachment{Type: ns.GetInt(items, key, "Type"), Id: ns.GetInt(items, key, "Id"), Count: ns.GetInt(items, key, "Count")},
+			Weight: ns.GetInt(items, key, "Weight"),
+		}
+		if err := validate_attachment(&e.Item); err != nil {
+			log.Error("gacha config: invalid item, row:", key)
+			continue
+		}
+		rarity := ns.GetInt(items, key, "Rarity")
+		found := false
+		for k := range p.Rarities {
+			if p.Rarities[k].Rarity == rarity {
+				p.Rarities[k].Items = append(p.Rarities[k].Items, e)
+				found = true
+				break
+			}
+		}
+		if !found {
+			log.Error("gacha config: item of unknown rarity, row:", key)
+		}
+	}
+
+	list := make([]*gacha.Pool, 0, len(ids))
+	for _, id := range ids {
+		list = append(list, pools[id])
+	}
+	gacha.SetPools(list)
+	log.Infof("gacha config loaded, pools:%v", len(list))
+}
+
+func pay_gacha(userid int32, cost mail.Attachment) error {
+	return pay(userid, cost, inventory.REASON_GACHA)
+}
+
+func refund_gacha(userid int32, cost mail.Attachment) error {
+	return grant(userid, []mail.Attachment{cost}, inventory.REASON_GACHA, "")
+}
+
+// 发放失败(如背包已满)时由gacha通过邮件补发
+func grant_gacha(userid int32, results []gacha.Result) error {
+	attachments := make([]mail.Attachment, len(results))
+	for k := range results {
+		attachments[k] = results[k].Item
+	}
+	return grant(userid, attachments, inventory.REASON_GACHA, "")
+}
+
+func gacha_errcode(err error) int32 {
+	switch err {
+	case gacha.ERROR_POOL_NOT_FOUND:
+		return ERRCODE_GACHA_POOL
+	case gacha.ERROR_INVALID_TIMES:
+		return ERRCODE_GACHA_TIMES
+	case gacha.ERROR_PAY, inventory.ERROR_NOT_ENOUGH, currency.ERROR_NOT_ENOUGH, mail.ERROR_INVALID_ATTACH:
+		return ERRCODE_GACHA_PAY
+	}
+	return ERRCODE_INTERNAL
+}
+
+//----------------------------------- 抽卡
+func P_gacha_pull_req(sess *Session, reader *packet.Packet) []byte {
+	tbl, _ := PKT_gacha_pull(reader)
+	results, counter, err := gacha.Pull(sess.UserId, tbl.F_pool, int(tbl.F_times))
+	if err != nil && results == nil {
+		return error_ack("gacha_ack", gacha_errcode(err), err)
+	}
+
+	// 发放失败时结果已记录在trace中, 仍然返回抽取结果
+	ret := S_gacha_result{F_pool: tbl.F_pool, F_pity: counter.Pity, F_items: make([]S_gacha_item, len(results))}
+	for k, r := range results {
+		ret.F_items[k] = S_gacha_item{F_rarity: r.Rarity, F_type: r.Item.Type, F_id: r.Item.Id, F_count: r.Item.Count}
+	}
+	return packet.Pack(Code["gacha_pull_ack"], ret, nil)
+}
+
+//----------------------------------- 保底计数
+func P_gacha_info_req(sess *Session, reader *packet.Packet) []byte {
+	counters, err := gacha.Counters(sess.UserId)
+	if err != nil {
+		log.Error(err)
+		return error_ack("gacha_ack", ERRCODE_INTERNAL, err)
+	}
+
+	ret := S_gacha_counters{F_counters: make([]S_gacha_counter, len(counters))}
+	for k, c := range counters {
+		ret.F_counters[k] = S_gacha_counter{F_pool: c.Pool, F_pity: c.Pity, F_total: c.Total}
+	}
+	return packet.Pack(Code["gacha_info_ack"], ret, nil)
+}
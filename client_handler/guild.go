@@ -0,0 +1,309 @@
+package client_handler
+
+import (
+	"strconv"
+
+	"game/channels"
+	"game/currency"
+	"game/guild"
+	"game/misc/packet"
+	"game/numbers"
+	"game/presence"
+	. "game/types"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// 公会数值表:
+// Levels    第一列为等级, Exp(升到下一级需要的经验, 满级为0) MaxMembers
+// Donations 第一列为捐献档位, Currency Cost Contribution Exp
+// Params    create_currency create_cost 的Value列
+const (
+	NUMBERS_GUILD = "GuildConfig"
+)
+
+func init() {
+	register_numbers(NUMBERS_GUILD, load_guild_config)
+}
+
+func init_guild() {
+	guild.Init(&DefaultDatabase)
+	guild.Notify = on_guild_event
+	guild.Charge = charge_guild
+}
+
+// 公会扣费, amount为负时为返还
+func charge_guild(userid int32, id int32, amount int64, reason string) error {
+	var err error
+	if amount > 0 {
+		_, err = currency.Debit(userid, id, amount, reason, "")
+	} else if amount < 0 {
+		_, err = currency.Credit(userid, id, -amount, reason, "")
+	}
+	return err
+}
+
+func load_guild_config(ns numbers.NumbersOp) {
+	if !ns.IsTableExists("Levels") {
+		log.Error("guild config: missing Levels")
+		return
+	}
+
+	cfg := &guild.Config{Donations: make(map[int32]guild.Donation)}
+	for level := 1; ns.IsRecordExists("Levels", level); level++ {
+		cfg.Levels = append(cfg.Levels, guild.Level{
+			Exp:        int64(ns.GetInt("Levels", level, "Exp")),
+			MaxMembers: int(ns.GetInt("Levels", level, "MaxMembers")),
+		})
+	}
+	if ns.IsTableExists("Donations") {
+		for _, key := range ns.GetKeys("Donations") {
+			id, err := strconv.Atoi(key)
+			if err != nil {
+				log.Error("guild config: invalid donation:", key)
+				continue
+			}
+			cfg.Donations[int32(id)] = guild.Donation{
+				Currency:     ns.GetInt("Donations", key, "Currency"),
+				Cost:         int64(ns.GetInt("Donations", key, "Cost")),
+				Contribution: int64(ns.GetInt("Donations", key, "Contribution")),
+				Exp:          int64(ns.GetInt("Donations", key, "Exp")),
+			}
+		}
+	}
+	if ns.IsFieldExists("Params", "create_cost", "Value") {
+		cfg.CreateCurrency = ns.GetInt("Params", "create_currency", "Value")
+		cfg.CreateCost = int64(ns.GetInt("Params", "create_cost", "Value"))
+	}
+
+	if len(cfg.Levels) == 0 {
+		log.Error("guild config: empty Levels")
+		return
+	}
+	guild.SetConfig(cfg)
+	log.Infof("guild config loaded, levels:%v donations:%v", len(cfg.Levels), len(cfg.Donations))
+}
+
+// 公会频道, 用于公会聊天和事件推送
+func guild_channel(id string) string {
+	return "guild:" + id
+}
+
+// 广播到公会频道, 本实例上没有成员时也需要创建频道才能转发给其他实例
+func guild_broadcast(id string, msg []byte) {
+	name := guild_channel(id)
+	channels.Create(name, true)
+	if err := channels.Broadcast(name, msg); err != nil {
+		log.Error(err)
+	}
+}
+
+// 公会事件: 维护公会频道的成员, 并推送给全部成员
+func on_guild_event(g *guild.Guild, event int32, userid int32) {
+	name := guild_channel(g.Id)
+	msg := packet.Pack(Code["guild_event_notify"], S_guild_event{F_guild: g.Id, F_event: event, F_id: userid}, nil)
+	switch event {
+	case guild.EVENT_JOIN:
+		channels.JoinGlobal(name, userid)
+	case guild.EVENT_LEAVE, guild.EVENT_KICK:
+		channels.LeaveGlobal(name, userid)
+		channels.SendTo(userid, msg)
+	case guild.EVENT_DISBAND:
+		guild_broadcast(g.Id, msg)
+		for _, id := range g.MemberIds() {
+			channels.LeaveGlobal(name, id)
+		}
+		channels.Destroy(name)
+		return
+	}
+	guild_broadcast(g.Id, msg)
+}
+
+// 登陆时加入公会频道
+func guild_login(userid int32) {
+	id, err := guild.Of(userid)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	if id != "" {
+		name := guild_channel(id)
+		channels.Create(name, true)
+		channels.Join(name, userid)
+	}
+}
+
+func guild_errcode(err error) int32 {
+	switch err {
+	case guild.ERROR_GUILD_NOT_FOUND:
+		return ERRCODE_GUILD_NONE
+	case guild.ERROR_IN_GUILD:
+		return ERRCODE_GUILD_IN
+	case guild.ERROR_NOT_IN_GUILD:
+		return ERRCODE_GUILD_NOT_IN
+	case guild.ERROR_NAME_EXISTS:
+		return ERRCODE_GUILD_NAME
+	case guild.ERROR_NAME_INVALID:
+		return ERRCODE_GUILD_INVALID
+	case guild.ERROR_NO_PERMISSION:
+		return ERRCODE_GUILD_PERM
+	case guild.ERROR_GUILD_FULL:
+		return ERRCODE_GUILD_FULL
+	case guild.ERROR_REQUEST_NOT_FOUND, guild.ERROR_INVITE_NOT_FOUND:
+		return ERRCODE_GUILD_NO_REQ
+	case guild.ERROR_LEADER_LEAVE:
+		return ERRCODE_GUILD_LEADER
+	case guild.ERROR_DONATION_INVALID:
+		return ERRCODE_GUILD_DONATE
+	case guild.ERROR_CONFLICT:
+		return ERRCODE_GUILD_BUSY
+	case currency.ERROR_NOT_ENOUGH:
+		return ERRCODE_CURRENCY_NOT_ENOUGH
+	}
+	return ERRCODE_INTERNAL
+}
+
+func guild_ack(err error) []byte {
+	if err != nil {
+		return error_ack("guild_ack", guild_errcode(err), err)
+	}
+	return error_ack("guild_ack", ERRCODE_SUCCEED, nil)
+}
+
+func guild_info(g *guild.Guild, userid int32) S_guild_info {
+	ret := S_guild_info{
+		F_id:          g.Id,
+		F_name:        g.Name,
+		F_notice:      g.Notice,
+		F_level:       g.Level,
+		F_exp:         g.Exp,
+		F_max_members: int32(g.MaxMembers()),
+	}
+	online := presence.QueryMulti(g.MemberIds())
+	for _, m := range g.Members {
+		_, ok := online[m.UserId]
+		ret.F_members = append(ret.F_members, S_guild_member{F_id: m.UserId, F_role: m.Role, F_contribution: m.Contribution, F_online: ok})
+	}
+	if g.Can(userid, guild.PERM_APPROVE) {
+		for _, r := range g.Requests {
+			ret.F_requests = append(ret.F_requests, S_auto_id{F_id: r.UserId})
+		}
+	}
+	return ret
+}
+
+//----------------------------------- 创建公会
+func P_guild_create_req(sess *Session, reader *packet.Packet) []byte {
+	tbl, _ := PKT_guild_text(reader)
+	g, err := guild.Create(sess.UserId, tbl.F_text)
+	if err != nil {
+		return guild_ack(err)
+	}
+	return packet.Pack(Code["guild_info_ack"], guild_info(g, sess.UserId), nil)
+}
+
+//----------------------------------- 解散公会
+func P_guild_disband_req(sess *Session, reader *packet.Packet) []byte {
+	return guild_ack(guild.Disband(sess.UserId))
+}
+
+//----------------------------------- 公会信息
+func P_guild_info_req(sess *Session, reader *packet.Packet) []byte {
+	tbl, _ := PKT_guild_id(reader)
+	var g *guild.Guild
+	var err error
+	if tbl.F_id == "" {
+		g, err = guild.Mine(sess.UserId)
+	} else {
+		g, err = guild.Get(tbl.F_id)
+	}
+	if err != nil {
+		return guild_ack(err)
+	}
+	return packet.Pack(Code["guild_info_ack"], guild_info(g, sess.UserId), nil)
+}
+
+//----------------------------------- 申请加入公会
+func P_guild_apply_req(sess *Session, reader *packet.Packet) []byte {
+	tbl, _ := PKT_guild_id(reader)
+	return guild_ack(guild.Apply(sess.UserId, tbl.F_id))
+}
+
+//----------------------------------- 同意入会申请
+func P_guild_accept_req(sess *Session, reader *packet.Packet) []byte {
+	tbl, _ := PKT_auto_id(reader)
+	return guild_ack(guild.Accept(sess.UserId, tbl.F_id))
+}
+
+//----------------------------------- 拒绝入会申请
+func P_guild_reject_req(sess *Session, reader *packet.Packet) []byte {
+	tbl, _ := PKT_auto_id(reader)
+	return guild_ack(guild.Reject(sess.UserId, tbl.F_id))
+}
+
+//----------------------------------- 邀请加入公会
+func P_guild_invite_req(sess *Session, reader *packet.Packet) []byte {
+	tbl, _ := PKT_auto_id(reader)
+	g, err := guild.Invite(sess.UserId, tbl.F_id)
+	if err != nil {
+		return guild_ack(err)
+	}
+	channels.SendTo(tbl.F_id, packet.Pack(Code["guild_invite_notify"], S_guild_invite{F_guild: g.Id, F_name: g.Name, F_from: sess.UserId}, nil))
+	return guild_ack(nil)
+}
+
+//----------------------------------- 接受公会邀请
+func P_guild_join_req(sess *Session, reader *packet.Packet) []byte {
+	tbl, _ := PKT_guild_id(reader)
+	return guild_ack(guild.AcceptInvite(sess.UserId, tbl.F_id))
+}
+
+//----------------------------------- 退出公会
+func P_guild_leave_req(sess *Session, reader *packet.Packet) []byte {
+	return guild_ack(guild.Leave(sess.UserId))
+}
+
+//----------------------------------- 踢出成员
+func P_guild_kick_req(sess *Session, reader *packet.Packet) []byte {
+	tbl, _ := PKT_auto_id(reader)
+	return guild_ack(guild.Kick(sess.UserId, tbl.F_id))
+}
+
+//----------------------------------- 任命职位
+func P_guild_role_req(sess *Session, reader *packet.Packet) []byte {
+	tbl, _ := PKT_guild_role(reader)
+	return guild_ack(guild.SetRole(sess.UserId, tbl.F_id, tbl.F_role))
+}
+
+//----------------------------------- 修改公告
+func P_guild_notice_req(sess *Session, reader *packet.Packet) []byte {
+	tbl, _ := PKT_guild_text(reader)
+	return guild_ack(guild.SetNotice(sess.UserId, tbl.F_text))
+}
+
+//----------------------------------- 捐献, F_id为捐献档位
+func P_guild_donate_req(sess *Session, reader *packet.Packet) []byte {
+	tbl, _ := PKT_auto_id(reader)
+	return guild_ack(guild.Donate(sess.UserId, tbl.F_id))
+}
+
+//----------------------------------- 捐献记录
+func P_guild_records_req(sess *Session, reader *packet.Packet) []byte {
+	id, err := guild.Of(sess.UserId)
+	if err != nil {
+		return guild_ack(err)
+	} else if id == "" {
+		return guild_ack(guild.ERROR_NOT_IN_GUILD)
+	}
+	records, err := guild.Records(id)
+	if err != nil {
+		log.Error(err)
+		return guild_ack(err)
+	}
+
+	ret := S_guild_records{}
+	for _, r := range records {
+		ret.F_records = append(ret.F_records, S_guild_record{F_id: r.UserId, F_donation: r.Donation, F_contribution: r.Contribution, F_time: r.CreatedAt.Unix()})
+	}
+	return packet.Pack(Code["guild_records_ack"], ret, nil)
+}
@@ -1,14 +1,54 @@
 package client_handler
 
 import (
-	"game/db"
 	"time"
+
+	"game/chat"
+	"game/db"
+	"game/friends"
+	"game/leaderboard"
+	"game/repository"
 )
 
 var (
 	DefaultDatabase db.Database
+	_flush_interval = repository.DEFAULT_INTERVAL
 )
 
+// SetFlushInterval 设置玩家数据的后台写入间隔
+func SetFlushInterval(interval time.Duration) {
+	_flush_interval = interval
+}
+
 func Init(mongodb string, concurrent int, timeout time.Duration) {
 	DefaultDatabase.Init(mongodb, concurrent, timeout)
+	init_modules()
+}
+
+// InitLocal 使用本地存储, 用于standalone模式
+func InitLocal(dir string) {
+	DefaultDatabase.InitLocal(dir)
+	init_modules()
+}
+
+// 初始化依赖数据库和数值表的各模块
+func init_modules() {
+	repository.Init(&DefaultDatabase, _flush_interval)
+	chat.Init(&DefaultDatabase)
+	init_mail()
+	friends.Init(&DefaultDatabase)
+	leaderboard.Init(&DefaultDatabase, []string{leaderboard.BOARD_SCORE})
+	init_matchmaking()
+	init_rooms()
+	init_currency()
+	init_guild()
+	init_inventory()
+	init_quest()
+	init_gacha()
+	init_shop()
+	init_auction()
+	init_party()
+	init_names()
+	init_level()
+	go numbers_watcher()
 }
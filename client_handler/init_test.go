@@ -0,0 +1,23 @@
+package client_handler
+
+import (
+	"io/ioutil"
+	"sync"
+	"testing"
+
+	"game/kafka"
+)
+
+var _setup sync.Once
+
+// 以临时目录作为本地存储初始化全部模块, 整个测试进程只初始化一次
+func setup(t *testing.T) {
+	_setup.Do(func() {
+		dir, err := ioutil.TempDir("", "client_handler")
+		if err != nil {
+			t.Fatal(err)
+		}
+		kafka.InitDiscard()
+		InitLocal(dir)
+	})
+}
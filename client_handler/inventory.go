@@ -0,0 +1,271 @@
+package client_handler
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"game/channels"
+	"game/currency"
+	"game/events"
+	"game/inventory"
+	"game/leaderboard"
+	"game/level"
+	"game/mail"
+	"game/misc/packet"
+	"game/numbers"
+	"game/repository"
+	. "game/types"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// 道具数值表(ItemConfig):
+// Items  第一列为道具id, MaxStack(堆叠上限, 空或1为唯一道具) Expire(有效期秒数, 空为永久) Usable(1为可使用)
+//        Type1 Id1 Count1 ... Type3 Id3 Count3(使用一个获得的奖励, 可使用的道具至少配置一个)
+// Params capacity 的Value列为背包格子数
+const (
+	MAX_ITEM_EFFECTS = 3
+)
+
+func init() {
+	register_numbers(NUMBERS_ITEM, load_item_config)
+}
+
+func init_inventory() {
+	inventory.Init(&DefaultDatabase)
+	inventory.OnChange = on_item_changes
+	inventory.OnUse = use_item
+	mail.Grant = grant_attachments
+}
+
+func load_item_config(ns numbers.NumbersOp) {
+	if !ns.IsTableExists(NUMBERS_ITEM_TABLE) {
+		log.Error("item config: missing Items")
+		return
+	}
+
+	defs := make(map[int32]*inventory.ItemDef)
+	for _, key := range ns.GetKeys(NUMBERS_ITEM_TABLE) {
+		id, err := strconv.Atoi(key)
+		if err != nil {
+			log.Error("item config: invalid item:", key)
+			continue
+		}
+		def := &inventory.ItemDef{Id: int32(id)}
+		if ns.IsFieldExists(NUMBERS_ITEM_TABLE, key, "MaxStack") {
+			def.MaxStack = ns.GetInt(NUMBERS_ITEM_TABLE, key, "MaxStack")
+		}
+		if ns.IsFieldExists(NUMBERS_ITEM_TABLE, key, "Expire") {
+			def.Expire = time.Duration(ns.GetInt(NUMBERS_ITEM_TABLE, key, "Expire")) * time.Second
+		}
+		if ns.IsFieldExists(NUMBERS_ITEM_TABLE, key, "Usable") {
+			def.Usable = ns.GetInt(NUMBERS_ITEM_TABLE, key, "Usable") == 1
+		}
+		if def.Effects, err = load_item_effects(ns, key); err != nil {
+			log.Errorf("item config: %v, item:%v", err, key)
+			continue
+		}
+		if def.Usable && len(def.Effects) == 0 {
+			log.Error("item config: usable item without effects:", key)
+			def.Usable = false
+		}
+		defs[def.Id] = def
+	}
+	if ns.IsFieldExists("Params", "capacity", "Value") {
+		inventory.SetCapacity(int(ns.GetInt("Params", "capacity", "Value")))
+	}
+
+	inventory.SetDefs(defs)
+	log.Infof("item config loaded, items:%v", len(defs))
+}
+
+// 使用效果, 附件必须在本数值表中存在(加载时全局的数值表可能还是旧版本)
+func load_item_effects(ns numbers.NumbersOp, key string) ([]mail.Attachment, error) {
+	var effects []mail.Attachment
+	for i := 1; i <= MAX_ITEM_EFFECTS; i++ {
+		field := fmt.Sprint("Type", i)
+		if !ns.IsFieldExists(NUMBERS_ITEM_TABLE, key, field) || ns.GetInt(NUMBERS_ITEM_TABLE, key, field) == 0 {
+			continue
+		}
+		a := mail.Attachment{
+			Type:  ns.GetInt(NUMBERS_ITEM_TABLE, key, field),
+			Id:    ns.GetInt(NUMBERS_ITEM_TABLE, key, fmt.Sprint("Id", i)),
+			Count: ns.GetInt(NUMBERS_ITEM_TABLE, key, fmt.Sprint("Count", i)),
+		}
+		ok := a.Count > 0
+		switch a.Type {
+		case mail.ATTACH_ITEM:
+			ok = ok && ns.IsRecordExists(NUMBERS_ITEM_TABLE, a.Id)
+		case mail.ATTACH_CURRENCY:
+			ok = ok && ns.IsRecordExists(NUMBERS_CURRENCY_TABLE, a.Id)
+		case mail.ATTACH_EXP, mail.ATTACH_SCORE:
+			ok = ok && a.Id == 0
+		default:
+			ok = false
+		}
+		if !ok {
+			return nil, fmt.Errorf("invalid effect %v", i)
+		}
+		effects = append(effects, a)
+	}
+	return effects, nil
+}
+
+// 使用道具, 按使用数量发放道具配置的奖励
+func use_item(userid int32, def *inventory.ItemDef, count int32) error {
+	if len(def.Effects) == 0 {
+		return inventory.ERROR_NOT_USABLE
+	}
+	attachments := make([]mail.Attachment, len(def.Effects))
+	for k, a := range def.Effects {
+		if a.Count > math.MaxInt32/count {
+			return inventory.ERROR_INVALID_COUNT
+		}
+		a.Count *= count
+		attachments[k] = a
+	}
+	return grant(userid, attachments, inventory.REASON_USE, "")
+}
+
+// 发放邮件附件, 以邮件id作为货币的幂等键
+func grant_attachments(userid int32, mailid string, attachments []mail.Attachment) error {
+	return grant(userid, attachments, inventory.REASON_MAIL, "mail:"+mailid)
+}
+
+// 发放奖励, 全部成功或全部失败; key不为空时作为货币交易的幂等键前缀
+// 先发放道具(背包满是常见的失败), 货币发放失败时撤销已发放的道具, 货币的撤销见currency.CreditAll
+// 经验和分数只能发给本实例上的在线玩家, 在发放前检查, 最后发放
+func grant(userid int32, attachments []mail.Attachment, reason int32, key string) error {
+	items := make(map[int32]int32)
+	var currencies []currency.Amount
+	var exp int64
+	var score int32
+	for _, a := range attachments {
+		switch a.Type {
+		case mail.ATTACH_ITEM:
+			items[a.Id] += a.Count
+		case mail.ATTACH_CURRENCY:
+			currencies = append(currencies, currency.Amount{Currency: a.Id, Amount: int64(a.Count)})
+		case mail.ATTACH_EXP:
+			exp += int64(a.Count)
+		case mail.ATTACH_SCORE:
+			score += a.Count
+		default:
+			return mail.ERROR_INVALID_ATTACH
+		}
+	}
+	if (exp > 0 || score > 0) && repository.Get(userid) == nil {
+		return level.ERROR_NOT_ONLINE
+	}
+
+	var m *inventory.ItemManager
+	if len(items) > 0 {
+		var err error
+		if m, err = inventory.Get(userid); err != nil {
+			return err
+		}
+		if err := m.AddItems(items, reason); err != nil {
+			return err
+		}
+	}
+
+	if err := currency.CreditAll(userid, currencies, reason_name(reason), key); err != nil {
+		for id, count := range items {
+			if err := m.Remove(id, count, reason); err != nil {
+				log.Error("grant: revert item failed:", userid, id, count, err)
+			}
+		}
+		return err
+	}
+
+	if exp > 0 {
+		if _, err := level.Add(userid, exp, reason_name(reason)); err != nil {
+			log.Error("grant: add exp failed:", userid, exp, err)
+		}
+	}
+	if score > 0 {
+		if _, err := leaderboard.AddScore(userid, score, reason_name(reason)); err != nil {
+			log.Error("grant: add score failed:", userid, score, err)
+		}
+	}
+	return nil
+}
+
+// 扣除消耗
+func pay(userid int32, cost mail.Attachment, reason int32) error {
+	switch cost.Type {
+	case mail.ATTACH_ITEM:
+		m, err := inventory.Get(userid)
+		if err != nil {
+			return err
+		}
+		return m.Remove(cost.Id, cost.Count, reason)
+	case mail.ATTACH_CURRENCY:
+		_, err := currency.Debit(userid, cost.Id, int64(cost.Count), reason_name(reason), "")
+		return err
+	}
+	return mail.ERROR_INVALID_ATTACH
+}
+
+func item_info(it inventory.Item) S_item {
+	return S_item{F_uid: it.Uid, F_id: it.Id, F_count: it.Count, F_expire: it.ExpireAt}
+}
+
+// 增量同步背包变化, 获得道具时触发事件
+func on_item_changes(userid int32, changes []inventory.Change) {
+	ret := S_item_changes{F_changes: make([]S_item_change, len(changes))}
+	for k, c := range changes {
+		ret.F_changes[k] = S_item_change{F_item: item_info(c.Item), F_delta: c.Delta, F_reason: c.Reason}
+		if c.Delta > 0 {
+			events.Fire(events.EVENT_ITEM, userid, c.Id, int64(c.Delta))
+		}
+	}
+	channels.SendTo(userid, packet.Pack(Code["item_changes_notify"], ret, nil))
+}
+
+func item_errcode(err error) int32 {
+	switch err {
+	case inventory.ERROR_ITEM_NOT_FOUND:
+		return ERRCODE_ITEM_NOT_FOUND
+	case inventory.ERROR_NOT_ENOUGH:
+		return ERRCODE_ITEM_NOT_ENOUGH
+	case inventory.ERROR_NOT_USABLE:
+		return ERRCODE_ITEM_NOT_USABLE
+	case inventory.ERROR_FULL:
+		return ERRCODE_ITEM_FULL
+	case inventory.ERROR_INVALID_COUNT, inventory.ERROR_UNKNOWN_ITEM:
+		return ERRCODE_INVALID_PARAM
+	}
+	return ERRCODE_INTERNAL
+}
+
+//----------------------------------- 背包列表
+func P_item_list_req(sess *Session, reader *packet.Packet) []byte {
+	m, err := inventory.Get(sess.UserId)
+	if err != nil {
+		log.Error(err)
+		return error_ack("item_ack", ERRCODE_INTERNAL, err)
+	}
+
+	items := m.List()
+	ret := S_item_list{F_capacity: int32(m.Capacity), F_items: make([]S_item, len(items))}
+	for k := range items {
+		ret.F_items[k] = item_info(items[k])
+	}
+	return packet.Pack(Code["item_list_ack"], ret, nil)
+}
+
+//----------------------------------- 使用道具
+func P_item_use_req(sess *Session, reader *packet.Packet) []byte {
+	tbl, _ := PKT_item_use(reader)
+	m, err := inventory.Get(sess.UserId)
+	if err == nil {
+		err = m.Use(tbl.F_uid, tbl.F_count)
+	}
+	if err != nil {
+		return error_ack("item_ack", item_errcode(err), err)
+	}
+	return error_ack("item_ack", ERRCODE_SUCCEED, nil)
+}
@@ -0,0 +1,59 @@
+package client_handler
+
+import (
+	"testing"
+
+	"game/currency"
+	"game/inventory"
+	"game/level"
+	"game/mail"
+)
+
+func TestGrant(t *testing.T) {
+	setup(t)
+	inventory.SetDefs(map[int32]*inventory.ItemDef{1: {Id: 1, MaxStack: 10}})
+	defer inventory.SetDefs(nil)
+	defer inventory.Release(2001)
+
+	rewards := []mail.Attachment{
+		{Type: mail.ATTACH_ITEM, Id: 1, Count: 5},
+		{Type: mail.ATTACH_CURRENCY, Id: 1, Count: 100},
+	}
+	if err := grant(2001, rewards, inventory.REASON_GM, "test:1"); err != nil {
+		t.Fatal(err)
+	}
+	m, _ := inventory.Get(2001)
+	if n := m.Count(1); n != 5 {
+		t.Fatal("unexpected items:", n)
+	}
+	if b, _ := currency.Balance(2001, 1); b != 100 {
+		t.Fatal("unexpected balance:", b)
+	}
+
+	// 货币发放失败时撤销已发放的道具
+	failed := []mail.Attachment{
+		{Type: mail.ATTACH_ITEM, Id: 1, Count: 3},
+		{Type: mail.ATTACH_CURRENCY, Id: 1, Count: -1},
+	}
+	if err := grant(2001, failed, inventory.REASON_GM, ""); err != currency.ERROR_INVALID_AMOUNT {
+		t.Fatal("expect invalid amount, got:", err)
+	}
+	if n := m.Count(1); n != 5 {
+		t.Fatal("items not reverted:", n)
+	}
+
+	// 经验只能发给在线玩家, 不在线时什么都不发放
+	offline := []mail.Attachment{
+		{Type: mail.ATTACH_ITEM, Id: 1, Count: 1},
+		{Type: mail.ATTACH_EXP, Count: 10},
+	}
+	if err := grant(2001, offline, inventory.REASON_GM, ""); err != level.ERROR_NOT_ONLINE {
+		t.Fatal("expect not online, got:", err)
+	}
+	if err := grant(2001, []mail.Attachment{{Type: 100, Id: 1, Count: 1}}, inventory.REASON_GM, ""); err != mail.ERROR_INVALID_ATTACH {
+		t.Fatal("expect invalid attachment, got:", err)
+	}
+	if n := m.Count(1); n != 5 {
+		t.Fatal("unexpected items:", n)
+	}
+}
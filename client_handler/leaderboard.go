@@ -0,0 +1,124 @@
+package client_handler
+
+import (
+	"fmt"
+
+	"game/leaderboard"
+	"game/mail"
+	"game/misc/packet"
+	"game/numbers"
+	. "game/types"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// 排行榜数值表:
+// SeasonRewards 第一列为任意编号, Board RankMin RankMax Type Id Count
+// 同一榜单同一名次区间的多行合并为一封邮件的多个附件
+const (
+	NUMBERS_LEADERBOARD = "LeaderboardConfig"
+	MAX_RANK_COUNT      = 100 // 单次查询的最大条目数
+)
+
+func init() {
+	register_numbers(NUMBERS_LEADERBOARD, load_leaderboard_config)
+}
+
+func load_leaderboard_config(ns numbers.NumbersOp) {
+	const tbl = "SeasonRewards"
+	if !ns.IsTableExists(tbl) {
+		return
+	}
+
+	rewards := make(map[string][]leaderboard.Reward)
+	index := make(map[string]int)
+	for _, key := range ns.GetKeys(tbl) {
+		board := ns.GetString(tbl, key, "Board")
+		r := leaderboard.Reward{
+			RankMin: int(ns.GetInt(tbl, key, "RankMin")),
+			RankMax: int(ns.GetInt(tbl, key, "RankMax")),
+		}
+		a := mail.Attachment{
+			Type:  ns.GetInt(tbl, key, "Type"),
+			Id:    ns.GetInt(tbl, key, "Id"),
+			Count: ns.GetInt(tbl, key, "Count"),
+		}
+		if r.RankMin <= 0 || r.RankMax < r.RankMin {
+			log.Errorf("leaderboard config: invalid rank range, row:%v", key)
+			continue
+		}
+		if err := validate_attachment(&a); err != nil {
+			log.Errorf("leaderboard config: invalid reward, row:%v", key)
+			continue
+		}
+
+		k := fmt.Sprintf("%v:%v:%v", board, r.RankMin, r.RankMax)
+		if i, ok := index[k]; ok {
+			rewards[board][i].Attachments = append(rewards[board][i].Attachments, a)
+			continue
+		}
+		r.Attachments = []mail.Attachment{a}
+		index[k] = len(rewards[board])
+		rewards[board] = append(rewards[board], r)
+	}
+
+	for board, rs := range rewards {
+		leaderboard.SetRewards(board, rs)
+	}
+	log.Info("leaderboard config loaded, boards:", len(rewards))
+}
+
+func rank_count(n int32) int {
+	if n <= 0 || n > MAX_RANK_COUNT {
+		return MAX_RANK_COUNT
+	}
+	return int(n)
+}
+
+func rank_list(b *leaderboard.Board, start int, entries []leaderboard.Entry) []byte {
+	ret := S_rank_list{F_board: b.Name, F_season: b.Season()}
+	for k := range entries {
+		ret.F_entries = append(ret.F_entries, S_rank_entry{F_rank: int32(start + k), F_id: entries[k].Id, F_score: entries[k].Score})
+	}
+	return packet.Pack(Code["rank_list_ack"], ret, nil)
+}
+
+func rank_no_board(name string) []byte {
+	return error_ack("rank_list_ack", ERRCODE_RANK_NO_BOARD, fmt.Errorf("leaderboard not exists: %v", name))
+}
+
+//----------------------------------- 排行榜前N名
+func P_rank_top_req(sess *Session, reader *packet.Packet) []byte {
+	tbl, _ := PKT_rank_query(reader)
+	b := leaderboard.Get(tbl.F_board)
+	if b == nil {
+		return rank_no_board(tbl.F_board)
+	}
+	return rank_list(b, 1, b.Top(rank_count(tbl.F_count)))
+}
+
+//----------------------------------- 自己的排名, 不在榜上时列表为空
+func P_rank_self_req(sess *Session, reader *packet.Packet) []byte {
+	tbl, _ := PKT_rank_query(reader)
+	b := leaderboard.Get(tbl.F_board)
+	if b == nil {
+		return rank_no_board(tbl.F_board)
+	}
+	ret := S_rank_list{F_board: b.Name, F_season: b.Season()}
+	if rank, score := b.Rank(sess.UserId); rank > 0 {
+		ret.F_entries = []S_rank_entry{{F_rank: int32(rank), F_id: sess.UserId, F_score: score}}
+	}
+	return packet.Pack(Code["rank_list_ack"], ret, nil)
+}
+
+//----------------------------------- 自己前后的排名
+func P_rank_around_req(sess *Session, reader *packet.Packet) []byte {
+	tbl, _ := PKT_rank_query(reader)
+	b := leaderboard.Get(tbl.F_board)
+	if b == nil {
+		return rank_no_board(tbl.F_board)
+	}
+	n := rank_count(tbl.F_count) / 2
+	start, entries := b.Around(sess.UserId, n)
+	return rank_list(b, start, entries)
+}
@@ -0,0 +1,149 @@
+package client_handler
+
+import (
+	"fmt"
+	"strconv"
+
+	"game/channels"
+	"game/inventory"
+	"game/level"
+	"game/mail"
+	"game/misc/packet"
+	"game/numbers"
+	"game/repository"
+	. "game/types"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// 等级数值表(LevelCfg):
+// Levels 第一列为等级(从1开始连续), Exp(升到下一级需要的经验, 满级为0) Type1 Id1 Count1 ... Type3 Id3 Count3(升到该级的奖励)
+const (
+	NUMBERS_LEVEL       = "LevelCfg"
+	NUMBERS_LEVEL_TABLE = "Levels"
+	MAX_LEVEL_REWARDS   = 3
+
+	LEVEL_TITLE   = "升级奖励"
+	LEVEL_CONTENT = "背包已满, 升到%v级的奖励通过邮件发放"
+)
+
+func init() {
+	register_numbers(NUMBERS_LEVEL, load_level_config)
+}
+
+func init_level() {
+	level.Grant = grant_level
+	level.OnChange = push_exp_change
+}
+
+func load_level_config(ns numbers.NumbersOp) {
+	if !ns.IsTableExists(NUMBERS_LEVEL_TABLE) {
+		return
+	}
+	rows := make(map[int]string)
+	for _, key := range ns.GetKeys(NUMBERS_LEVEL_TABLE) {
+		lv, err := strconv.Atoi(key)
+		if err != nil || lv <= 0 || lv > level.MAX_LEVEL {
+			log.Errorf("level config: invalid level, row:%v", key)
+			return
+		}
+		rows[lv] = key
+	}
+
+	levels := make([]level.Level, len(rows))
+	for k := range levels {
+		key, ok := rows[k+1]
+		if !ok {
+			log.Errorf("level config: missing level %v", k+1)
+			return
+		}
+		l, err := load_level(ns, key)
+		if err != nil {
+			log.Errorf("level config: %v, row:%v", err, key)
+			return
+		}
+		levels[k] = l
+	}
+	if len(levels) == 0 {
+		return
+	}
+
+	level.SetLevels(levels)
+	log.Infof("level config loaded, max level:%v", len(levels))
+}
+
+func load_level(ns numbers.NumbersOp, key string) (level.Level, error) {
+	l := level.Level{Exp: int64(ns.GetInt(NUMBERS_LEVEL_TABLE, key, "Exp"))}
+	if l.Exp < 0 {
+		return l, fmt.Errorf("invalid exp %v", l.Exp)
+	}
+	for i := 1; i <= MAX_LEVEL_REWARDS; i++ {
+		field := fmt.Sprint("Type", i)
+		if !ns.IsFieldExists(NUMBERS_LEVEL_TABLE, key, field) || ns.GetInt(NUMBERS_LEVEL_TABLE, key, field) == 0 {
+			continue
+		}
+		a := mail.Attachment{
+			Type:  ns.GetInt(NUMBERS_LEVEL_TABLE, key, field),
+			Id:    ns.GetInt(NUMBERS_LEVEL_TABLE, key, fmt.Sprint("Id", i)),
+			Count: ns.GetInt(NUMBERS_LEVEL_TABLE, key, fmt.Sprint("Count", i)),
+		}
+		// 升级奖励中的经验会导致连续升级, 不允许
+		if a.Type == mail.ATTACH_EXP {
+			return l, fmt.Errorf("exp reward not allowed")
+		}
+		if err := validate_attachment(&a); err != nil {
+			return l, err
+		}
+		l.Rewards = append(l.Rewards, a)
+	}
+	return l, nil
+}
+
+// 发放升级奖励, 背包已满时通过邮件发放
+func grant_level(userid int32, lv uint8, rewards []mail.Attachment) {
+	err := grant(userid, rewards, inventory.REASON_LEVEL, fmt.Sprintf("level:%v:%v", userid, lv))
+	if err == inventory.ERROR_FULL {
+		_, err = mail.Send(userid, 0, LEVEL_TITLE, fmt.Sprintf(LEVEL_CONTENT, lv), rewards, 0)
+	}
+	if err != nil {
+		log.Errorf("grant level rewards failed, userid:%v level:%v err:%v", userid, lv, err)
+	}
+}
+
+// 推送经验变化, 升级时同时推送升级和奖励
+func push_exp_change(c *level.Change) {
+	channels.SendTo(c.UserId, packet.Pack(Code["exp_notify"], S_exp_change{
+		F_amount: c.Amount,
+		F_reason: c.Reason,
+		F_level:  int32(c.To),
+		F_exp:    c.Exp,
+		F_next:   level.Next(c.To),
+	}, nil))
+	if c.To <= c.From {
+		return
+	}
+	ret := S_level_up{F_from: int32(c.From), F_level: int32(c.To)}
+	for lv := int(c.From) + 1; lv <= int(c.To); lv++ {
+		ret.F_rewards = append(ret.F_rewards, mail_attachments(level.Rewards(uint8(lv)))...)
+	}
+	channels.SendTo(c.UserId, packet.Pack(Code["level_up_notify"], ret, nil))
+}
+
+//----------------------------------- 查询等级和经验
+func P_level_info_req(sess *Session, reader *packet.Packet) []byte {
+	entry := repository.Get(sess.UserId)
+	if entry == nil {
+		return error_ack("level_ack", ERRCODE_INTERNAL, nil)
+	}
+	u := entry.User()
+	lv := u.Level
+	if lv == 0 {
+		lv = 1
+	}
+	return packet.Pack(Code["level_info_ack"], S_level_info{
+		F_level: int32(lv),
+		F_exp:   u.Exp,
+		F_next:  level.Next(lv),
+		F_max:   int32(level.MaxLevel()),
+	}, nil)
+}
@@ -0,0 +1,63 @@
+package client_handler
+
+import (
+	"errors"
+
+	"game/lockstep"
+	"game/misc/packet"
+	"game/rooms"
+	. "game/types"
+)
+
+var (
+	_replay_dir string // 为空时不录像
+
+	ERROR_NOT_LOCKSTEP = errors.New("room is not in lockstep mode")
+)
+
+// SetReplayDir 设置帧同步录像目录
+func SetReplayDir(dir string) {
+	_replay_dir = dir
+}
+
+// 创建帧同步战斗房间
+func create_battle(players []int32) *rooms.Room {
+	cfg := rooms.DefaultConfig()
+	cfg.MaxMembers = len(players)
+	return rooms.Create(cfg, lockstep.New(players, pack_lockstep_frame, _replay_dir))
+}
+
+func lockstep_frame(f *lockstep.Frame) S_lockstep_frame {
+	ret := S_lockstep_frame{F_frame: int32(f.Seq)}
+	for k := range f.Inputs {
+		ret.F_inputs = append(ret.F_inputs, S_lockstep_input{F_id: f.Inputs[k].UserId, F_data: f.Inputs[k].Data})
+	}
+	return ret
+}
+
+func pack_lockstep_frame(f *lockstep.Frame) []byte {
+	return packet.Pack(Code["lockstep_frame_notify"], lockstep_frame(f), nil)
+}
+
+//----------------------------------- 断线重连补帧, F_id为起始帧号
+func P_lockstep_frames_req(sess *Session, reader *packet.Packet) []byte {
+	tbl, _ := PKT_auto_id(reader)
+	r := rooms.Of(sess.UserId)
+	if r == nil {
+		return room_ack(rooms.ERROR_NOT_IN_ROOM)
+	}
+	l, ok := r.Logic().(*lockstep.Lockstep)
+	if !ok {
+		return error_ack("room_ack", ERRCODE_INVALID_PARAM, ERROR_NOT_LOCKSTEP)
+	}
+
+	var frames []lockstep.Frame
+	if err := r.Do(func() { frames = l.Frames(uint32(tbl.F_id)) }); err != nil {
+		return room_ack(err)
+	}
+	ret := S_lockstep_frames{}
+	for k := range frames {
+		ret.F_frames = append(ret.F_frames, lockstep_frame(&frames[k]))
+	}
+	return packet.Pack(Code["lockstep_frames_ack"], ret, nil)
+}
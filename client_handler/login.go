@@ -0,0 +1,184 @@
+package client_handler
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"game/db"
+	"game/inventory"
+	"game/kafka"
+	"game/leaderboard"
+	"game/misc/packet"
+	"game/repository"
+	. "game/types"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// 登陆:
+// 玩家id由agent通过metadata传入, 登陆包用于校验登陆凭证, 并通过repository加载玩家数据.
+// 设备UDID只做记录, 同一设备可以登陆多个玩家, 每个设备和玩家的组合在COLLECTION_DEVICES中保存一条.
+// 客户端证书(way 2)由账号服务签发, 格式为"玩家id:过期时间:签名", 签名为HMAC-SHA256("玩家id:过期时间")的hex,
+// 密钥与账号服务共享, 没有设置密钥时不接受证书登陆.
+const (
+	COLLECTION_DEVICES = "user_devices"
+
+	LOGIN_WAY_UDID        = int32(1) // 设备UDID
+	LOGIN_WAY_CERTIFICATE = int32(2) // 账号服务签发的证书
+)
+
+var (
+	ERROR_LOGIN_WAY  = errors.New("invalid login way or credential")
+	ERROR_LOGIN_CERT = errors.New("invalid or expired certificate")
+)
+
+var _cert_key []byte
+
+// SetCertificateKey 设置校验客户端证书的密钥
+func SetCertificateKey(key string) {
+	_cert_key = []byte(key)
+}
+
+// 玩家登陆过的设备
+type device struct {
+	Id        string `bson:"_id"`
+	Udid      string `bson:"udid"`
+	UserId    int32  `bson:"userid"`
+	CreatedAt int64  `bson:"created_at"` // 第一次在该设备上登陆的时间
+}
+
+// 校验登陆凭证
+func check_credential(tbl *S_user_login_info, userid int32, now time.Time) error {
+	switch tbl.F_login_way {
+	case LOGIN_WAY_UDID:
+		if tbl.F_open_udid != "" {
+			return nil
+		}
+	case LOGIN_WAY_CERTIFICATE:
+		if len(_cert_key) > 0 {
+			return verify_certificate(tbl.F_client_certificate, userid, now)
+		}
+	}
+	return ERROR_LOGIN_WAY
+}
+
+// 校验签名, 玩家id和过期时间
+func verify_certificate(cert string, userid int32, now time.Time) error {
+	parts := strings.Split(cert, ":")
+	if len(parts) != 3 {
+		return ERROR_LOGIN_CERT
+	}
+	sig, err := hex.DecodeString(parts[2])
+	if err != nil {
+		return ERROR_LOGIN_CERT
+	}
+	mac := hmac.New(sha256.New, _cert_key)
+	mac.Write([]byte(parts[0] + ":" + parts[1]))
+	if !hmac.Equal(sig, mac.Sum(nil)) {
+		return ERROR_LOGIN_CERT
+	}
+
+	id, err := strconv.ParseInt(parts[0], 10, 32)
+	if err != nil || int32(id) != userid {
+		return ERROR_LOGIN_CERT
+	}
+	expire, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil || now.Unix() >= expire {
+		return ERROR_LOGIN_CERT
+	}
+	return nil
+}
+
+// 记录玩家登陆的设备, 已记录时忽略; UDID由客户端上报, 取哈希作为_id, 避免本地存储中出现非法文件名
+func record_device(udid string, userid int32, now time.Time) error {
+	id := fmt.Sprintf("%x-%v", sha256.Sum256([]byte(udid)), userid)
+	err := DefaultDatabase.Insert(COLLECTION_DEVICES, id, &device{Id: id, Udid: udid, UserId: userid, CreatedAt: now.Unix()})
+	if err == db.ERROR_DUPLICATED {
+		return nil
+	}
+	return err
+}
+
+func user_snapshot(user *User) S_user_snapshot {
+	return S_user_snapshot{
+		F_uid:         user.Id,
+		F_name:        user.Name,
+		F_level:       int32(user.Level),
+		F_score:       leaderboard.SeasonScore(user),
+		F_create_time: user.CreateTime,
+		F_exp:         user.Exp,
+	}
+}
+
+func login_errcode(err error) int32 {
+	switch err {
+	case ERROR_LOGIN_WAY:
+		return ERRCODE_LOGIN_WAY
+	case ERROR_LOGIN_CERT:
+		return ERRCODE_LOGIN_CERT
+	}
+	return ERRCODE_INTERNAL
+}
+
+//----------------------------------- 登陆
+func P_user_login_req(sess *Session, reader *packet.Packet) []byte {
+	tbl, _ := PKT_user_login_info(reader)
+	if sess.User != nil {
+		if entry := repository.Get(sess.UserId); entry != nil {
+			return packet.Pack(Code["user_login_succeed_ack"], user_snapshot(entry.User()), nil)
+		}
+		return packet.Pack(Code["user_login_succeed_ack"], user_snapshot(sess.User), nil)
+	}
+
+	fields := map[string]interface{}{
+		"way":     tbl.F_login_way,
+		"version": tbl.F_client_version,
+		"lang":    tbl.F_user_lang,
+		"app":     tbl.F_app_id,
+		"os":      tbl.F_os_version,
+		"device":  tbl.F_device_name,
+		"ip":      tbl.F_login_ip,
+	}
+	fail := func(err error) []byte {
+		fields["error"] = err.Error()
+		kafka.TraceEvent("login_failed", sess.UserId, fields)
+		return error_ack("user_login_faild_ack", login_errcode(err), err)
+	}
+
+	now := time.Now()
+	if err := check_credential(&tbl, sess.UserId, now); err != nil {
+		return fail(err)
+	}
+	if tbl.F_login_way == LOGIN_WAY_UDID {
+		if err := record_device(tbl.F_open_udid, sess.UserId, now); err != nil {
+			log.Error(err)
+		}
+	}
+	entry, created, err := repository.Load(sess.UserId)
+	if err != nil {
+		log.Error(err)
+		return fail(err)
+	}
+	entry.UpdateUser(func(u *User) []string {
+		u.LastLoginTime = now.Unix()
+		return []string{"LastLoginTime"}
+	})
+	user := entry.User()
+	// 同步分数榜, 没有分数的玩家不上榜(匹配时使用默认分)
+	leaderboard.UpdateUser(user)
+	if user.Item, err = inventory.Get(sess.UserId); err != nil {
+		log.Error(err)
+		return fail(err)
+	}
+
+	sess.User = user
+	fields["created"] = created
+	kafka.TraceEvent("login", sess.UserId, fields)
+	return packet.Pack(Code["user_login_succeed_ack"], user_snapshot(user), nil)
+}
@@ -0,0 +1,95 @@
+package client_handler
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"testing"
+	"time"
+
+	"game/inventory"
+	"game/misc/packet"
+	"game/repository"
+	. "game/types"
+)
+
+func certificate(key string, userid int32, expire int64) string {
+	msg := fmt.Sprintf("%v:%v", userid, expire)
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(msg))
+	return msg + ":" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// 登陆并返回回复的协议号
+func login(t *testing.T, userid int32, tbl S_user_login_info) int16 {
+	reader := packet.Reader(packet.Pack(Code["user_login_req"], tbl, nil))
+	reader.ReadS16()
+	ret := P_user_login_req(&Session{UserId: userid}, reader)
+	code, err := packet.Reader(ret).ReadS16()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code == Code["user_login_succeed_ack"] {
+		repository.Release(userid)
+		inventory.Release(userid)
+	}
+	return code
+}
+
+func TestLoginUdid(t *testing.T) {
+	setup(t)
+	succeed, failed := Code["user_login_succeed_ack"], Code["user_login_faild_ack"]
+
+	// 同一设备可以登陆多个玩家
+	for _, id := range []int32{1001, 1002, 1001} {
+		if code := login(t, id, S_user_login_info{F_login_way: LOGIN_WAY_UDID, F_open_udid: "device/1"}); code != succeed {
+			t.Fatal("login failed:", id, code)
+		}
+	}
+	if code := login(t, 1003, S_user_login_info{F_login_way: LOGIN_WAY_UDID}); code != failed {
+		t.Fatal("empty udid accepted")
+	}
+	if code := login(t, 1003, S_user_login_info{F_login_way: 3, F_open_udid: "device/1"}); code != failed {
+		t.Fatal("unknown way accepted")
+	}
+	if u, err := repository.Peek(1002); err != nil || u == nil || u.CreateTime == 0 {
+		t.Fatal("user not created:", u, err)
+	}
+}
+
+func TestLoginCertificate(t *testing.T) {
+	setup(t)
+	succeed, failed := Code["user_login_succeed_ack"], Code["user_login_faild_ack"]
+	expire := time.Now().Add(time.Hour).Unix()
+	cert := func(cert string) S_user_login_info {
+		return S_user_login_info{F_login_way: LOGIN_WAY_CERTIFICATE, F_client_certificate: cert}
+	}
+
+	// 没有设置密钥时不接受证书
+	SetCertificateKey("")
+	if code := login(t, 1101, cert(certificate("", 1101, expire))); code != failed {
+		t.Fatal("certificate accepted without key")
+	}
+
+	SetCertificateKey("secret")
+	defer SetCertificateKey("")
+	if code := login(t, 1101, cert(certificate("secret", 1101, expire))); code != succeed {
+		t.Fatal("valid certificate rejected:", code)
+	}
+	cases := []string{
+		certificate("secret", 1102, expire),                      // 其他玩家的证书
+		certificate("secret", 1101, time.Now().Unix()-1),         // 已过期
+		certificate("other", 1101, expire),                       // 签名错误
+		fmt.Sprintf("1101:%v", expire),                           // 没有签名
+		certificate("secret", 1101, expire)[:len("1101:")] + "x", // 格式错误
+	}
+	for _, c := range cases {
+		if err := verify_certificate(c, 1101, time.Now()); err != ERROR_LOGIN_CERT {
+			t.Fatal("invalid certificate accepted:", c, err)
+		}
+		if code := login(t, 1101, cert(c)); code != failed {
+			t.Fatal("invalid certificate login:", c)
+		}
+	}
+}
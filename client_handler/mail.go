@@ -0,0 +1,193 @@
+package client_handler
+
+import (
+	"time"
+
+	"game/channels"
+	"game/chat"
+	"game/friends"
+	"game/mail"
+	"game/misc/packet"
+	"game/numbers"
+	"game/repository"
+	. "game/types"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// 道具和货币数值表:
+// Items    第一列为道具id
+// Currency 第一列为货币id
+const (
+	NUMBERS_ITEM           = "ItemConfig"
+	NUMBERS_ITEM_TABLE     = "Items"
+	NUMBERS_CURRENCY_TABLE = "Currency"
+)
+
+func init_mail() {
+	mail.Init(&DefaultDatabase)
+	mail.Validate = validate_attachment
+	mail.Notify = push_mail_unread
+}
+
+// 附件必须在数值表中存在
+func validate_attachment(a *mail.Attachment) error {
+	if a.Type == mail.ATTACH_EXP || a.Type == mail.ATTACH_SCORE {
+		if a.Id == 0 && a.Count > 0 {
+			return nil
+		}
+		return mail.ERROR_INVALID_ATTACH
+	}
+	if !numbers.IsExists(NUMBERS_ITEM) {
+		return mail.ERROR_INVALID_ATTACH
+	}
+	ns := numbers.Numbers(NUMBERS_ITEM)
+	switch a.Type {
+	case mail.ATTACH_ITEM:
+		if ns.IsRecordExists(NUMBERS_ITEM_TABLE, a.Id) {
+			return nil
+		}
+	case mail.ATTACH_CURRENCY:
+		if ns.IsRecordExists(NUMBERS_CURRENCY_TABLE, a.Id) {
+			return nil
+		}
+	}
+	return mail.ERROR_INVALID_ATTACH
+}
+
+// 推送未读邮件数, 玩家可能在其他实例上
+func push_mail_unread(userid int32) {
+	n, err := mail.Unread(userid)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	channels.SendTo(userid, packet.Pack(Code["mail_unread_notify"], S_auto_id{F_id: int32(n)}, nil))
+}
+
+// 登陆时投递全服邮件并推送未读数, 只投递注册之后发出的全服邮件
+// 会话开始早于登陆, 新玩家此时还没有创建, 以当前时间为准
+func mail_login(userid int32) {
+	since := time.Now()
+	user, err := repository.Peek(userid)
+	if err != nil {
+		log.Error(err)
+		return
+	} else if user != nil {
+		since = time.Unix(user.CreateTime, 0)
+	}
+	if err := mail.Deliver(userid, since); err != nil {
+		log.Error(err)
+	}
+	push_mail_unread(userid)
+}
+
+func mail_errcode(err error) int32 {
+	switch err {
+	case mail.ERROR_NOT_FOUND:
+		return ERRCODE_MAIL_NOT_FOUND
+	case mail.ERROR_CLAIMED:
+		return ERRCODE_MAIL_CLAIMED
+	case mail.ERROR_NO_ATTACHMENT:
+		return ERRCODE_MAIL_NO_ATTACH
+	case mail.ERROR_TOO_LONG:
+		return ERRCODE_MAIL_TOO_LONG
+	case mail.ERROR_INVALID_ATTACH, mail.ERROR_TOO_MANY_ATTACH:
+		return ERRCODE_MAIL_INVALID
+	}
+	return ERRCODE_INTERNAL
+}
+
+func mail_attachments(as []mail.Attachment) []S_mail_attachment {
+	ret := make([]S_mail_attachment, len(as))
+	for k := range as {
+		ret[k] = S_mail_attachment{F_type: as[k].Type, F_id: as[k].Id, F_count: as[k].Count}
+	}
+	return ret
+}
+
+//----------------------------------- 邮件列表
+func P_mail_list_req(sess *Session, reader *packet.Packet) []byte {
+	mails, err := mail.List(sess.UserId)
+	if err != nil {
+		log.Error(err)
+		return error_ack("mail_ack", ERRCODE_INTERNAL, err)
+	}
+
+	ret := S_mail_list{F_mails: make([]S_mail_info, len(mails))}
+	for k := range mails {
+		m := &mails[k]
+		ret.F_mails[k] = S_mail_info{
+			F_id:          m.Id,
+			F_from:        m.From,
+			F_type:        m.Type,
+			F_title:       m.Title,
+			F_content:     m.Content,
+			F_attachments: mail_attachments(m.Attachments),
+			F_read:        m.Read,
+			F_claimed:     m.Claimed,
+			F_create_time: m.CreatedAt.Unix(),
+			F_expire_time: m.ExpireAt.Unix(),
+		}
+	}
+	return packet.Pack(Code["mail_list_ack"], ret, nil)
+}
+
+//----------------------------------- 读邮件
+func P_mail_read_req(sess *Session, reader *packet.Packet) []byte {
+	tbl, _ := PKT_mail_id(reader)
+	if err := mail.Read(sess.UserId, tbl.F_id); err != nil {
+		return error_ack("mail_ack", mail_errcode(err), err)
+	}
+	return error_ack("mail_ack", ERRCODE_SUCCEED, nil)
+}
+
+//----------------------------------- 领取附件
+func P_mail_claim_req(sess *Session, reader *packet.Packet) []byte {
+	tbl, _ := PKT_mail_id(reader)
+	m, err := mail.Claim(sess.UserId, tbl.F_id)
+	if err != nil {
+		return error_ack("mail_ack", mail_errcode(err), err)
+	}
+	return packet.Pack(Code["mail_claim_ack"], S_mail_claim{F_id: m.Id, F_attachments: mail_attachments(m.Attachments)}, nil)
+}
+
+//----------------------------------- 删除邮件
+func P_mail_delete_req(sess *Session, reader *packet.Packet) []byte {
+	tbl, _ := PKT_mail_id(reader)
+	if err := mail.Delete(sess.UserId, tbl.F_id); err != nil {
+		return error_ack("mail_ack", mail_errcode(err), err)
+	}
+	return error_ack("mail_ack", ERRCODE_SUCCEED, nil)
+}
+
+//----------------------------------- 发送玩家邮件, 不允许带附件
+func P_mail_send_req(sess *Session, reader *packet.Packet) []byte {
+	tbl, _ := PKT_mail_send(reader)
+	if tbl.F_to == sess.UserId || tbl.F_to <= 0 {
+		return error_ack("mail_ack", ERRCODE_INVALID_PARAM, nil)
+	}
+	// 与聊天共用禁言和频率限制
+	if err := chat.Allow(sess.UserId); err != nil {
+		return error_ack("mail_ack", chat_errcode(err), err)
+	}
+
+	to, err := repository.Peek(tbl.F_to)
+	if err != nil {
+		return error_ack("mail_ack", ERRCODE_INTERNAL, err)
+	} else if to == nil {
+		return error_ack("mail_ack", ERRCODE_MAIL_NO_TARGET, nil)
+	}
+	blocked, err := friends.IsBlocked(sess.UserId, tbl.F_to)
+	if err != nil {
+		return error_ack("mail_ack", ERRCODE_INTERNAL, err)
+	} else if blocked {
+		return error_ack("mail_ack", ERRCODE_FRIEND_BLOCKED, friends.ERROR_BLOCKED)
+	}
+
+	title, content := chat.Filter(tbl.F_title), chat.Filter(tbl.F_content)
+	if _, err := mail.Send(tbl.F_to, sess.UserId, title, content, nil, 0); err != nil {
+		return error_ack("mail_ack", mail_errcode(err), err)
+	}
+	return error_ack("mail_ack", ERRCODE_SUCCEED, nil)
+}
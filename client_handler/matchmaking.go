@@ -0,0 +1,144 @@
+package client_handler
+
+import (
+	"sort"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"game/channels"
+	"game/leaderboard"
+	"game/matchmaking"
+	"game/misc/packet"
+	"game/numbers"
+	"game/rooms"
+	. "game/types"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// 匹配数值表:
+// Params  team_size timeout(秒) default_rating 的Value列
+// Windows 第一列为等待秒数, Value列为该时间之后允许的分差
+const (
+	NUMBERS_MATCH = "MatchConfig"
+)
+
+var (
+	_default_rating int32 = 1000 // 不在分数榜上的玩家使用的匹配分
+)
+
+func init() {
+	register_numbers(NUMBERS_MATCH, load_match_config)
+}
+
+func init_matchmaking() {
+	matchmaking.OnMatch = push_match_found
+	matchmaking.OnTimeout = push_match_timeout
+	matchmaking.Init()
+}
+
+func load_match_config(ns numbers.NumbersOp) {
+	if !ns.IsTableExists("Params") || !ns.IsTableExists("Windows") {
+		log.Error("match config: missing Params or Windows")
+		return
+	}
+
+	cfg := matchmaking.Config{
+		TeamSize: int(ns.GetInt("Params", "team_size", "Value")),
+		Timeout:  time.Duration(ns.GetInt("Params", "timeout", "Value")) * time.Second,
+	}
+	if ns.IsFieldExists("Params", "default_rating", "Value") {
+		atomic.StoreInt32(&_default_rating, ns.GetInt("Params", "default_rating", "Value"))
+	}
+	for _, key := range ns.GetKeys("Windows") {
+		secs, err := strconv.Atoi(key)
+		if err != nil {
+			log.Error("match config: invalid wait seconds:", key)
+			continue
+		}
+		cfg.Windows = append(cfg.Windows, matchmaking.WindowStep{
+			After:  time.Duration(secs) * time.Second,
+			Window: ns.GetInt("Windows", key, "Value"),
+		})
+	}
+	sort.Slice(cfg.Windows, func(i, j int) bool { return cfg.Windows[i].After < cfg.Windows[j].After })
+
+	if cfg.TeamSize <= 0 || len(cfg.Windows) == 0 {
+		log.Error("match config: invalid team_size or empty windows")
+		return
+	}
+	matchmaking.SetConfig(cfg)
+	log.Infof("match config loaded, team_size:%v timeout:%v windows:%v", cfg.TeamSize, cfg.Timeout, len(cfg.Windows))
+}
+
+// 匹配分, 使用分数榜上的分数
+func match_rating(userid int32) int32 {
+	if b := leaderboard.Get(leaderboard.BOARD_SCORE); b != nil {
+		if rank, score := b.Rank(userid); rank > 0 {
+			return int32(score)
+		}
+	}
+	return atomic.LoadInt32(&_default_rating)
+}
+
+// 匹配成功, 创建帧同步房间并让全部玩家加入, 推送给各玩家
+// 队伍只有在全部队员都在本实例上时才能匹配, 之后队员重新登陆到其他实例时仍能收到推送, 但无法加入房间
+func push_match_found(m *matchmaking.Match) {
+	ret := S_match_found{F_match_id: m.Id}
+	var players []int32
+	for team := range m.Teams {
+		for _, t := range m.Teams[team] {
+			for _, id := range t.Players() {
+				ret.F_players = append(ret.F_players, S_match_player{F_id: id, F_team: int32(team), F_rating: t.Rating})
+				players = append(players, id)
+			}
+		}
+	}
+
+	r := create_battle(players)
+	ret.F_room = r.Id
+	for _, id := range players {
+		if err := rooms.Join(r.Id, id); err != nil {
+			log.Warning("match found, join room failed:", id, err)
+		}
+	}
+
+	msg := packet.Pack(Code["match_found_notify"], ret, nil)
+	for _, p := range ret.F_players {
+		if !channels.SendTo(p.F_id, msg) {
+			log.Warning("match found, push failed:", p.F_id)
+		}
+	}
+}
+
+func push_match_timeout(t matchmaking.Ticket) {
+	msg := packet.Pack(Code["match_timeout_notify"], nil, nil)
+	for _, id := range t.Players() {
+		channels.SendTo(id, msg)
+	}
+}
+
+func match_ack(err error) []byte {
+	switch err {
+	case nil:
+		return error_ack("match_ack", ERRCODE_SUCCEED, nil)
+	case matchmaking.ERROR_ALREADY_QUEUED:
+		return error_ack("match_ack", ERRCODE_MATCH_QUEUED, err)
+	case matchmaking.ERROR_NOT_QUEUED:
+		return error_ack("match_ack", ERRCODE_MATCH_NOT_IN, err)
+	case matchmaking.ERROR_GROUP_SIZE:
+		return error_ack("match_ack", ERRCODE_INVALID_PARAM, err)
+	}
+	return error_ack("match_ack", ERRCODE_INTERNAL, err)
+}
+
+//----------------------------------- 开始匹配
+func P_match_join_req(sess *Session, reader *packet.Packet) []byte {
+	return match_ack(matchmaking.Enqueue(sess.UserId, match_rating(sess.UserId)))
+}
+
+//----------------------------------- 取消匹配
+func P_match_cancel_req(sess *Session, reader *packet.Packet) []byte {
+	return match_ack(matchmaking.Cancel(sess.UserId))
+}
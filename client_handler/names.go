@@ -0,0 +1,115 @@
+package client_handler
+
+import (
+	"time"
+
+	"game/currency"
+	"game/inventory"
+	"game/mail"
+	"game/misc/packet"
+	"game/names"
+	"game/numbers"
+	"game/repository"
+	. "game/types"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// 昵称数值表(NameCfg):
+// Words  第一列为屏蔽词
+// Params min_len max_len cooldown(小时) reserve_ttl(秒) cost_type cost_id cost 的Value列, 缺省时使用默认值
+const (
+	NUMBERS_NAME = "NameCfg"
+)
+
+func init() {
+	register_numbers(NUMBERS_NAME, load_name_config)
+}
+
+func init_names() {
+	names.Init(&DefaultDatabase)
+	names.Pay = pay_rename
+	names.Refund = refund_rename
+}
+
+func load_name_config(ns numbers.NumbersOp) {
+	cfg := names.DefaultConfig()
+	if ns.IsTableExists("Words") {
+		cfg.Words = ns.GetKeys("Words")
+	}
+	param := func(name string, value int32) int32 {
+		if ns.IsFieldExists("Params", name, "Value") {
+			return ns.GetInt("Params", name, "Value")
+		}
+		return value
+	}
+	cfg.MinLen = int(param("min_len", int32(cfg.MinLen)))
+	cfg.MaxLen = int(param("max_len", int32(cfg.MaxLen)))
+	cfg.Cooldown = time.Duration(param("cooldown", int32(cfg.Cooldown/time.Hour))) * time.Hour
+	cfg.ReserveTTL = time.Duration(param("reserve_ttl", int32(cfg.ReserveTTL/time.Second))) * time.Second
+	cfg.Cost = mail.Attachment{Type: param("cost_type", 0), Id: param("cost_id", 0), Count: param("cost", 0)}
+	if cfg.MinLen <= 0 || cfg.MaxLen < cfg.MinLen || cfg.ReserveTTL <= 0 {
+		log.Error("name config: invalid min_len, max_len or reserve_ttl")
+		return
+	}
+	if cfg.Cost.Count > 0 && validate_attachment(&cfg.Cost) != nil {
+		log.Error("name config: invalid cost")
+		return
+	}
+	names.SetConfig(cfg)
+	log.Infof("name config loaded, words:%v cooldown:%v cost:%+v", len(cfg.Words), cfg.Cooldown, cfg.Cost)
+}
+
+func pay_rename(userid int32, cost mail.Attachment) error {
+	return pay(userid, cost, inventory.REASON_RENAME)
+}
+
+func refund_rename(userid int32, cost mail.Attachment) error {
+	return grant(userid, []mail.Attachment{cost}, inventory.REASON_RENAME, "")
+}
+
+func name_errcode(err error) int32 {
+	switch err {
+	case names.ERROR_NAME_INVALID:
+		return ERRCODE_NAME_INVALID
+	case names.ERROR_NAME_FORBIDDEN:
+		return ERRCODE_NAME_FORBIDDEN
+	case names.ERROR_NAME_TAKEN:
+		return ERRCODE_NAME_TAKEN
+	case names.ERROR_SAME_NAME:
+		return ERRCODE_NAME_SAME
+	case names.ERROR_COOLDOWN:
+		return ERRCODE_NAME_COOLDOWN
+	case names.ERROR_RESERVATION:
+		return ERRCODE_NAME_BUSY
+	case currency.ERROR_NOT_ENOUGH:
+		return ERRCODE_CURRENCY_NOT_ENOUGH
+	}
+	return item_errcode(err)
+}
+
+//----------------------------------- 改名
+func P_user_rename_req(sess *Session, reader *packet.Packet) []byte {
+	tbl, _ := PKT_user_rename(reader)
+	entry := repository.Get(sess.UserId)
+	if entry == nil {
+		return error_ack("name_ack", ERRCODE_INTERNAL, nil)
+	}
+
+	r, err := names.Rename(sess.UserId, entry.User().Name, tbl.F_name, time.Now())
+	if err != nil {
+		return error_ack("name_ack", name_errcode(err), err)
+	}
+	entry.UpdateUser(func(u *User) []string {
+		u.Name = r.New
+		return []string{"Name"}
+	})
+
+	ret := S_user_renamed{F_name: r.New}
+	if next, err := names.NextRename(sess.UserId); err != nil {
+		log.Error(err)
+	} else if !next.IsZero() {
+		ret.F_next = next.Unix()
+	}
+	return packet.Pack(Code["user_rename_ack"], ret, nil)
+}
@@ -0,0 +1,46 @@
+package client_handler
+
+import (
+	"game/numbers"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// 各模块的数值表载入函数, 表名 -> 载入函数
+// 启动时载入一次, 之后随numbers watcher热更新
+var numbers_loaders = map[string][]func(numbers.NumbersOp){}
+
+func register_numbers(name string, loader func(numbers.NumbersOp)) {
+	numbers_loaders[name] = append(numbers_loaders[name], loader)
+}
+
+func load_numbers(name string) {
+	defer func() {
+		if x := recover(); x != nil {
+			log.Error("load numbers failed:", name, x)
+		}
+	}()
+
+	if !numbers.IsExists(name) {
+		log.Warn("numbers not exists:", name)
+		return
+	}
+	for _, loader := range numbers_loaders[name] {
+		loader(numbers.Numbers(name))
+	}
+}
+
+func numbers_watcher() {
+	ch := make(chan string, 64)
+	numbers.RegisterCallback(ch)
+	for name := range numbers_loaders {
+		load_numbers(name)
+	}
+
+	for name := range ch {
+		if _, ok := numbers_loaders[name]; ok {
+			log.Info("numbers reloading:", name)
+			load_numbers(name)
+		}
+	}
+}
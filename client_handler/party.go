@@ -0,0 +1,306 @@
+package client_handler
+
+import (
+	"time"
+
+	"game/channels"
+	"game/matchmaking"
+	"game/misc/packet"
+	"game/numbers"
+	"game/party"
+	"game/presence"
+	"game/rooms"
+	. "game/types"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// 队伍数值表(PartyCfg):
+// Params max_members invite_ttl(秒) 的Value列, 缺省时使用默认值
+const (
+	NUMBERS_PARTY = "PartyCfg"
+)
+
+func init() {
+	register_numbers(NUMBERS_PARTY, load_party_config)
+}
+
+func init_party() {
+	party.Init(&DefaultDatabase)
+	party.Notify = on_party_event
+}
+
+func load_party_config(ns numbers.NumbersOp) {
+	cfg := party.DefaultConfig()
+	if ns.IsFieldExists("Params", "max_members", "Value") {
+		cfg.MaxMembers = int(ns.GetInt("Params", "max_members", "Value"))
+	}
+	if ns.IsFieldExists("Params", "invite_ttl", "Value") {
+		cfg.InviteTTL = time.Duration(ns.GetInt("Params", "invite_ttl", "Value")) * time.Second
+	}
+	if cfg.MaxMembers <= 0 || cfg.InviteTTL <= 0 {
+		log.Error("party config: invalid max_members or invite_ttl")
+		return
+	}
+	party.SetConfig(cfg)
+	log.Infof("party config loaded, max_members:%v invite_ttl:%v", cfg.MaxMembers, cfg.InviteTTL)
+}
+
+// 队伍频道, 用于队伍聊天和状态推送
+func party_channel(id string) string {
+	return "party:" + id
+}
+
+// 广播到队伍频道, 本实例上没有成员时也需要创建频道才能转发给其他实例
+func party_broadcast(id string, msg []byte) {
+	name := party_channel(id)
+	channels.Create(name, true)
+	if err := channels.Broadcast(name, msg); err != nil {
+		log.Error(err)
+	}
+}
+
+// 队伍事件: 维护队伍频道的成员, 并把最新的队伍状态推送给全部成员
+// 成员变化时取消队伍的匹配, 队伍的匹配在队长发起匹配的实例上, 只有在该实例上操作时才能取消
+func on_party_event(p *party.Party, event int32, userid int32) {
+	name := party_channel(p.Id)
+	switch event {
+	case party.EVENT_INVITE:
+		channels.SendTo(userid, packet.Pack(Code["party_invite_notify"], S_party_invite{F_party: p.Id, F_from: p.Inviter(userid)}, nil))
+		return
+	case party.EVENT_JOIN:
+		matchmaking.Cancel(p.Leader)
+		channels.JoinGlobal(name, userid)
+	case party.EVENT_LEAVE, party.EVENT_KICK, party.EVENT_DISBAND:
+		matchmaking.Cancel(userid)
+		channels.LeaveGlobal(name, userid)
+	}
+
+	msg := packet.Pack(Code["party_notify"], S_party_event{F_event: event, F_id: userid, F_party: party_info(p)}, nil)
+	switch event {
+	case party.EVENT_LEAVE, party.EVENT_KICK:
+		channels.SendTo(userid, msg)
+	case party.EVENT_DISBAND:
+		channels.SendTo(userid, msg)
+		channels.Destroy(name)
+		return
+	}
+	party_broadcast(p.Id, msg)
+}
+
+// 登陆时加入队伍频道
+func party_login(userid int32) {
+	id, err := party.Of(userid)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	if id != "" {
+		name := party_channel(id)
+		channels.Create(name, true)
+		channels.Join(name, userid)
+	}
+}
+
+func party_errcode(err error) int32 {
+	switch err {
+	case party.ERROR_PARTY_NOT_FOUND:
+		return ERRCODE_PARTY_NONE
+	case party.ERROR_IN_PARTY:
+		return ERRCODE_PARTY_IN
+	case party.ERROR_NOT_IN_PARTY:
+		return ERRCODE_PARTY_NOT_IN
+	case party.ERROR_NOT_LEADER:
+		return ERRCODE_PARTY_LEADER
+	case party.ERROR_NOT_MEMBER:
+		return ERRCODE_PARTY_MEMBER
+	case party.ERROR_PARTY_FULL:
+		return ERRCODE_PARTY_FULL
+	case party.ERROR_INVITE_NOT_FOUND:
+		return ERRCODE_PARTY_NO_INVITE
+	case party.ERROR_CONFLICT:
+		return ERRCODE_PARTY_BUSY
+	case party.ERROR_NOT_READY:
+		return ERRCODE_PARTY_NOT_READY
+	}
+	return ERRCODE_INTERNAL
+}
+
+func party_ack(err error) []byte {
+	if err != nil {
+		return error_ack("party_ack", party_errcode(err), err)
+	}
+	return error_ack("party_ack", ERRCODE_SUCCEED, nil)
+}
+
+func party_info(p *party.Party) S_party_info {
+	ret := S_party_info{
+		F_id:          p.Id,
+		F_leader:      p.Leader,
+		F_target:      p.Target,
+		F_max_members: int32(party.MaxMembers()),
+	}
+	online := presence.QueryMulti(p.MemberIds())
+	for _, m := range p.Members {
+		_, ok := online[m.UserId]
+		ret.F_members = append(ret.F_members, S_party_member{F_id: m.UserId, F_ready: m.Ready, F_online: ok})
+	}
+	return ret
+}
+
+// 队长操作整个队伍前检查
+func party_leader(userid int32) (*party.Party, error) {
+	p, err := party.Mine(userid)
+	if err != nil {
+		return nil, err
+	}
+	if p.Leader != userid {
+		return nil, party.ERROR_NOT_LEADER
+	}
+	return p, nil
+}
+
+// 匹配和房间只在本实例上, 队伍整体操作要求全部队员都在本实例上在线并且已准备
+func party_check(p *party.Party) int32 {
+	for _, id := range p.MemberIds() {
+		if !presence.IsLocal(id) {
+			return ERRCODE_PARTY_REMOTE
+		}
+	}
+	if !p.AllReady() {
+		return ERRCODE_PARTY_NOT_READY
+	}
+	return ERRCODE_SUCCEED
+}
+
+// 进入匹配或房间后重置准备状态, 失败不影响已完成的操作
+func party_started(p *party.Party) {
+	if err := party.ResetReady(p.Leader); err != nil {
+		log.Warning("party reset ready failed:", p.Id, err)
+	}
+}
+
+//----------------------------------- 创建队伍
+func P_party_create_req(sess *Session, reader *packet.Packet) []byte {
+	p, err := party.Create(sess.UserId, time.Now())
+	if err != nil {
+		return party_ack(err)
+	}
+	return packet.Pack(Code["party_info_ack"], party_info(p), nil)
+}
+
+//----------------------------------- 队伍信息
+func P_party_info_req(sess *Session, reader *packet.Packet) []byte {
+	p, err := party.Mine(sess.UserId)
+	if err != nil {
+		return party_ack(err)
+	}
+	return packet.Pack(Code["party_info_ack"], party_info(p), nil)
+}
+
+//----------------------------------- 邀请加入队伍
+func P_party_invite_req(sess *Session, reader *packet.Packet) []byte {
+	tbl, _ := PKT_auto_id(reader)
+	if tbl.F_id == sess.UserId {
+		return error_ack("party_ack", ERRCODE_INVALID_PARAM, nil)
+	}
+	if !presence.IsOnline(tbl.F_id) {
+		return error_ack("party_ack", ERRCODE_TARGET_OFFLINE, nil)
+	}
+	_, err := party.Invite(sess.UserId, tbl.F_id, time.Now())
+	return party_ack(err)
+}
+
+//----------------------------------- 接受队伍邀请
+func P_party_join_req(sess *Session, reader *packet.Packet) []byte {
+	tbl, _ := PKT_party_id(reader)
+	p, err := party.Accept(sess.UserId, tbl.F_id, time.Now())
+	if err != nil {
+		return party_ack(err)
+	}
+	return packet.Pack(Code["party_info_ack"], party_info(p), nil)
+}
+
+//----------------------------------- 离开队伍
+func P_party_leave_req(sess *Session, reader *packet.Packet) []byte {
+	return party_ack(party.Leave(sess.UserId))
+}
+
+//----------------------------------- 踢出队员
+func P_party_kick_req(sess *Session, reader *packet.Packet) []byte {
+	tbl, _ := PKT_auto_id(reader)
+	return party_ack(party.Kick(sess.UserId, tbl.F_id))
+}
+
+//----------------------------------- 转让队长
+func P_party_transfer_req(sess *Session, reader *packet.Packet) []byte {
+	tbl, _ := PKT_auto_id(reader)
+	return party_ack(party.Transfer(sess.UserId, tbl.F_id))
+}
+
+//----------------------------------- 设置队伍目标
+func P_party_target_req(sess *Session, reader *packet.Packet) []byte {
+	tbl, _ := PKT_auto_id(reader)
+	return party_ack(party.SetTarget(sess.UserId, tbl.F_id))
+}
+
+//----------------------------------- 设置准备状态
+func P_party_ready_req(sess *Session, reader *packet.Packet) []byte {
+	tbl, _ := PKT_party_ready(reader)
+	return party_ack(party.SetReady(sess.UserId, tbl.F_ready))
+}
+
+//----------------------------------- 队伍开始匹配, 由队长在全部队员准备后发起, 匹配分为队员的平均分
+func P_party_match_req(sess *Session, reader *packet.Packet) []byte {
+	p, err := party_leader(sess.UserId)
+	if err != nil {
+		return party_ack(err)
+	}
+	if code := party_check(p); code != ERRCODE_SUCCEED {
+		return error_ack("match_ack", code, nil)
+	}
+	members := p.MemberIds()
+	var total int64
+	for _, id := range members {
+		total += int64(match_rating(id))
+	}
+	if err := matchmaking.EnqueueGroup(p.Leader, members, int32(total/int64(len(members)))); err != nil {
+		return match_ack(err)
+	}
+	party_started(p)
+	return match_ack(nil)
+}
+
+//----------------------------------- 队伍加入房间, 由队长在全部队员准备后发起, 全部队员加入同一房间, 有队员失败时已加入的全部退出
+func P_party_room_req(sess *Session, reader *packet.Packet) []byte {
+	tbl, _ := PKT_room_id(reader)
+	p, err := party_leader(sess.UserId)
+	if err != nil {
+		return party_ack(err)
+	}
+	if code := party_check(p); code != ERRCODE_SUCCEED {
+		return error_ack("room_ack", code, nil)
+	}
+	r := rooms.Get(tbl.F_room)
+	if r == nil {
+		return room_ack(rooms.ERROR_ROOM_NOT_FOUND)
+	}
+
+	var joined []int32
+	for _, id := range p.MemberIds() {
+		if rooms.Of(id) == r {
+			continue
+		}
+		if err := rooms.Join(r.Id, id); err != nil {
+			for _, m := range joined {
+				if err := rooms.Leave(m); err != nil {
+					log.Warning("party join room, rollback failed:", m, err)
+				}
+			}
+			return room_ack(err)
+		}
+		joined = append(joined, id)
+	}
+	party_started(p)
+	return room_ack(nil)
+}
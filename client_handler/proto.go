@@ -80,13 +80,1052 @@ func (p S_seed_info) Pack(w *packet.Packet) {
 
 //#用户信息包
 type S_user_snapshot struct {
-	F_uid int32
+	F_uid         int32
+	F_name        string
+	F_level       int32
+	F_score       int32
+	F_create_time int64
+	F_exp         int64
 }
 
 func (p S_user_snapshot) Pack(w *packet.Packet) {
 	w.WriteS32(p.F_uid)
+	w.WriteString(p.F_name)
+	w.WriteS32(p.F_level)
+	w.WriteS32(p.F_score)
+	w.WriteS64(p.F_create_time)
+	w.WriteS64(p.F_exp)
 
 }
+//#聊天发言 type:1世界 2私聊 3频道
+type S_chat_msg struct {
+	F_type    int32
+	F_channel string
+	F_to      int32
+	F_content string
+}
+
+func (p S_chat_msg) Pack(w *packet.Packet) {
+	w.WriteS32(p.F_type)
+	w.WriteString(p.F_channel)
+	w.WriteS32(p.F_to)
+	w.WriteString(p.F_content)
+
+}
+
+//#聊天消息
+type S_chat_info struct {
+	F_type    int32
+	F_channel string
+	F_from    int32
+	F_to      int32
+	F_content string
+	F_time    int64
+}
+
+func (p S_chat_info) Pack(w *packet.Packet) {
+	w.WriteS32(p.F_type)
+	w.WriteString(p.F_channel)
+	w.WriteS32(p.F_from)
+	w.WriteS32(p.F_to)
+	w.WriteString(p.F_content)
+	w.WriteS64(p.F_time)
+
+}
+
+//#聊天历史
+type S_chat_history struct {
+	F_msgs []S_chat_info
+}
+
+func (p S_chat_history) Pack(w *packet.Packet) {
+	w.WriteU16(uint16(len(p.F_msgs)))
+	for k := range p.F_msgs {
+		p.F_msgs[k].Pack(w)
+	}
+
+}
+//#邮件id
+type S_mail_id struct {
+	F_id string
+}
+
+func (p S_mail_id) Pack(w *packet.Packet) {
+	w.WriteString(p.F_id)
+
+}
+
+//#邮件附件 type:1道具 2货币 3经验
+type S_mail_attachment struct {
+	F_type  int32
+	F_id    int32
+	F_count int32
+}
+
+func (p S_mail_attachment) Pack(w *packet.Packet) {
+	w.WriteS32(p.F_type)
+	w.WriteS32(p.F_id)
+	w.WriteS32(p.F_count)
+
+}
+
+//#邮件 type:1系统 2玩家
+type S_mail_info struct {
+	F_id          string
+	F_from        int32
+	F_type        int32
+	F_title       string
+	F_content     string
+	F_attachments []S_mail_attachment
+	F_read        bool
+	F_claimed     bool
+	F_create_time int64
+	F_expire_time int64
+}
+
+func (p S_mail_info) Pack(w *packet.Packet) {
+	w.WriteString(p.F_id)
+	w.WriteS32(p.F_from)
+	w.WriteS32(p.F_type)
+	w.WriteString(p.F_title)
+	w.WriteString(p.F_content)
+	w.WriteU16(uint16(len(p.F_attachments)))
+	for k := range p.F_attachments {
+		p.F_attachments[k].Pack(w)
+	}
+	w.WriteBool(p.F_read)
+	w.WriteBool(p.F_claimed)
+	w.WriteS64(p.F_create_time)
+	w.WriteS64(p.F_expire_time)
+
+}
+
+//#邮件列表
+type S_mail_list struct {
+	F_mails []S_mail_info
+}
+
+func (p S_mail_list) Pack(w *packet.Packet) {
+	w.WriteU16(uint16(len(p.F_mails)))
+	for k := range p.F_mails {
+		p.F_mails[k].Pack(w)
+	}
+
+}
+
+//#发送玩家邮件
+type S_mail_send struct {
+	F_to      int32
+	F_title   string
+	F_content string
+}
+
+func (p S_mail_send) Pack(w *packet.Packet) {
+	w.WriteS32(p.F_to)
+	w.WriteString(p.F_title)
+	w.WriteString(p.F_content)
+
+}
+
+//#领取附件结果
+type S_mail_claim struct {
+	F_id          string
+	F_attachments []S_mail_attachment
+}
+
+func (p S_mail_claim) Pack(w *packet.Packet) {
+	w.WriteString(p.F_id)
+	w.WriteU16(uint16(len(p.F_attachments)))
+	for k := range p.F_attachments {
+		p.F_attachments[k].Pack(w)
+	}
+
+}
+//#好友信息 status见presence
+type S_friend_info struct {
+	F_id     int32
+	F_online bool
+	F_status int32
+}
+
+func (p S_friend_info) Pack(w *packet.Packet) {
+	w.WriteS32(p.F_id)
+	w.WriteBool(p.F_online)
+	w.WriteS32(p.F_status)
+
+}
+
+//#好友列表, 收到的申请, 黑名单
+type S_friend_list struct {
+	F_friends  []S_friend_info
+	F_requests []S_auto_id
+	F_blocked  []S_auto_id
+}
+
+func (p S_friend_list) Pack(w *packet.Packet) {
+	w.WriteU16(uint16(len(p.F_friends)))
+	for k := range p.F_friends {
+		p.F_friends[k].Pack(w)
+	}
+	w.WriteU16(uint16(len(p.F_requests)))
+	for k := range p.F_requests {
+		p.F_requests[k].Pack(w)
+	}
+	w.WriteU16(uint16(len(p.F_blocked)))
+	for k := range p.F_blocked {
+		p.F_blocked[k].Pack(w)
+	}
+
+}
+//#排行榜查询 count为数量或前后名次数
+type S_rank_query struct {
+	F_board string
+	F_count int32
+}
+
+func (p S_rank_query) Pack(w *packet.Packet) {
+	w.WriteString(p.F_board)
+	w.WriteS32(p.F_count)
+
+}
+
+//#排行榜条目
+type S_rank_entry struct {
+	F_rank  int32
+	F_id    int32
+	F_score int64
+}
+
+func (p S_rank_entry) Pack(w *packet.Packet) {
+	w.WriteS32(p.F_rank)
+	w.WriteS32(p.F_id)
+	w.WriteS64(p.F_score)
+
+}
+
+//#排行榜列表
+type S_rank_list struct {
+	F_board   string
+	F_season  int32
+	F_entries []S_rank_entry
+}
+
+func (p S_rank_list) Pack(w *packet.Packet) {
+	w.WriteString(p.F_board)
+	w.WriteS32(p.F_season)
+	w.WriteU16(uint16(len(p.F_entries)))
+	for k := range p.F_entries {
+		p.F_entries[k].Pack(w)
+	}
+
+}
+//#匹配到的玩家
+type S_match_player struct {
+	F_id     int32
+	F_team   int32
+	F_rating int32
+}
+
+func (p S_match_player) Pack(w *packet.Packet) {
+	w.WriteS32(p.F_id)
+	w.WriteS32(p.F_team)
+	w.WriteS32(p.F_rating)
+
+}
+
+//#匹配成功, 已加入房间F_room
+type S_match_found struct {
+	F_match_id int64
+	F_room     int64
+	F_players  []S_match_player
+}
+
+func (p S_match_found) Pack(w *packet.Packet) {
+	w.WriteS64(p.F_match_id)
+	w.WriteS64(p.F_room)
+	w.WriteU16(uint16(len(p.F_players)))
+	for k := range p.F_players {
+		p.F_players[k].Pack(w)
+	}
+
+}
+//#加入房间
+type S_room_id struct {
+	F_room int64
+}
+
+func (p S_room_id) Pack(w *packet.Packet) {
+	w.WriteS64(p.F_room)
+
+}
+
+//#房间输入, 内容由房间逻辑解释
+type S_room_input struct {
+	F_data []byte
+}
+
+func (p S_room_input) Pack(w *packet.Packet) {
+	w.WriteBytes(p.F_data)
+
+}
+
+//#房间状态推送, 内容由房间逻辑决定
+type S_room_state struct {
+	F_room  int64
+	F_frame int32
+	F_data  []byte
+}
+
+func (p S_room_state) Pack(w *packet.Packet) {
+	w.WriteS64(p.F_room)
+	w.WriteS32(p.F_frame)
+	w.WriteBytes(p.F_data)
+
+}
+
+//#房间关闭推送 reason见rooms.CLOSE_XXX
+type S_room_closed struct {
+	F_room   int64
+	F_reason int32
+}
+
+func (p S_room_closed) Pack(w *packet.Packet) {
+	w.WriteS64(p.F_room)
+	w.WriteS32(p.F_reason)
+
+}
+//#帧同步中一个玩家的输入
+type S_lockstep_input struct {
+	F_id   int32
+	F_data []byte
+}
+
+func (p S_lockstep_input) Pack(w *packet.Packet) {
+	w.WriteS32(p.F_id)
+	w.WriteBytes(p.F_data)
+
+}
+
+//#一个逻辑帧
+type S_lockstep_frame struct {
+	F_frame  int32
+	F_inputs []S_lockstep_input
+}
+
+func (p S_lockstep_frame) Pack(w *packet.Packet) {
+	w.WriteS32(p.F_frame)
+	w.WriteU16(uint16(len(p.F_inputs)))
+	for k := range p.F_inputs {
+		p.F_inputs[k].Pack(w)
+	}
+
+}
+
+//#补帧回复
+type S_lockstep_frames struct {
+	F_frames []S_lockstep_frame
+}
+
+func (p S_lockstep_frames) Pack(w *packet.Packet) {
+	w.WriteU16(uint16(len(p.F_frames)))
+	for k := range p.F_frames {
+		p.F_frames[k].Pack(w)
+	}
+
+}
+//#公会id, 为空时表示自己的公会
+type S_guild_id struct {
+	F_id string
+}
+
+func (p S_guild_id) Pack(w *packet.Packet) {
+	w.WriteString(p.F_id)
+
+}
+
+//#公会名字或公告
+type S_guild_text struct {
+	F_text string
+}
+
+func (p S_guild_text) Pack(w *packet.Packet) {
+	w.WriteString(p.F_text)
+
+}
+
+//#公会成员 role见guild.ROLE_XXX
+type S_guild_member struct {
+	F_id           int32
+	F_role         int32
+	F_contribution int64
+	F_online       bool
+}
+
+func (p S_guild_member) Pack(w *packet.Packet) {
+	w.WriteS32(p.F_id)
+	w.WriteS32(p.F_role)
+	w.WriteS64(p.F_contribution)
+	w.WriteBool(p.F_online)
+
+}
+
+//#公会信息, 申请列表只对有审批权限的成员可见
+type S_guild_info struct {
+	F_id          string
+	F_name        string
+	F_notice      string
+	F_level       int32
+	F_exp         int64
+	F_max_members int32
+	F_members     []S_guild_member
+	F_requests    []S_auto_id
+}
+
+func (p S_guild_info) Pack(w *packet.Packet) {
+	w.WriteString(p.F_id)
+	w.WriteString(p.F_name)
+	w.WriteString(p.F_notice)
+	w.WriteS32(p.F_level)
+	w.WriteS64(p.F_exp)
+	w.WriteS32(p.F_max_members)
+	w.WriteU16(uint16(len(p.F_members)))
+	for k := range p.F_members {
+		p.F_members[k].Pack(w)
+	}
+	w.WriteU16(uint16(len(p.F_requests)))
+	for k := range p.F_requests {
+		p.F_requests[k].Pack(w)
+	}
+
+}
+
+//#任命职位
+type S_guild_role struct {
+	F_id   int32
+	F_role int32
+}
+
+func (p S_guild_role) Pack(w *packet.Packet) {
+	w.WriteS32(p.F_id)
+	w.WriteS32(p.F_role)
+
+}
+
+//#公会事件推送 event见guild.EVENT_XXX
+type S_guild_event struct {
+	F_guild string
+	F_event int32
+	F_id    int32
+}
+
+func (p S_guild_event) Pack(w *packet.Packet) {
+	w.WriteString(p.F_guild)
+	w.WriteS32(p.F_event)
+	w.WriteS32(p.F_id)
+
+}
+
+//#公会邀请推送
+type S_guild_invite struct {
+	F_guild string
+	F_name  string
+	F_from  int32
+}
+
+func (p S_guild_invite) Pack(w *packet.Packet) {
+	w.WriteString(p.F_guild)
+	w.WriteString(p.F_name)
+	w.WriteS32(p.F_from)
+
+}
+
+//#捐献记录
+type S_guild_record struct {
+	F_id           int32
+	F_donation     int32
+	F_contribution int64
+	F_time         int64
+}
+
+func (p S_guild_record) Pack(w *packet.Packet) {
+	w.WriteS32(p.F_id)
+	w.WriteS32(p.F_donation)
+	w.WriteS64(p.F_contribution)
+	w.WriteS64(p.F_time)
+
+}
+
+//#捐献记录列表
+type S_guild_records struct {
+	F_records []S_guild_record
+}
+
+func (p S_guild_records) Pack(w *packet.Packet) {
+	w.WriteU16(uint16(len(p.F_records)))
+	for k := range p.F_records {
+		p.F_records[k].Pack(w)
+	}
+
+}
+//#背包中的一格
+type S_item struct {
+	F_uid    int64
+	F_id     int32
+	F_count  int32
+	F_expire int64
+}
+
+func (p S_item) Pack(w *packet.Packet) {
+	w.WriteS64(p.F_uid)
+	w.WriteS32(p.F_id)
+	w.WriteS32(p.F_count)
+	w.WriteS64(p.F_expire)
+
+}
+
+//#背包列表
+type S_item_list struct {
+	F_capacity int32
+	F_items    []S_item
+}
+
+func (p S_item_list) Pack(w *packet.Packet) {
+	w.WriteS32(p.F_capacity)
+	w.WriteU16(uint16(len(p.F_items)))
+	for k := range p.F_items {
+		p.F_items[k].Pack(w)
+	}
+
+}
+
+//#使用道具
+type S_item_use struct {
+	F_uid   int64
+	F_count int32
+}
+
+func (p S_item_use) Pack(w *packet.Packet) {
+	w.WriteS64(p.F_uid)
+	w.WriteS32(p.F_count)
+
+}
+
+//#一格的变化, F_count为变化后的数量, 0为删除
+type S_item_change struct {
+	F_item   S_item
+	F_delta  int32
+	F_reason int32
+}
+
+func (p S_item_change) Pack(w *packet.Packet) {
+	p.F_item.Pack(w)
+	w.WriteS32(p.F_delta)
+	w.WriteS32(p.F_reason)
+
+}
+
+//#背包变化
+type S_item_changes struct {
+	F_changes []S_item_change
+}
+
+func (p S_item_changes) Pack(w *packet.Packet) {
+	w.WriteU16(uint16(len(p.F_changes)))
+	for k := range p.F_changes {
+		p.F_changes[k].Pack(w)
+	}
+
+}
+
+//#任务进度
+type S_quest struct {
+	F_id      int32
+	F_count   int64
+	F_done    bool
+	F_claimed bool
+}
+
+func (p S_quest) Pack(w *packet.Packet) {
+	w.WriteS32(p.F_id)
+	w.WriteS64(p.F_count)
+	w.WriteBool(p.F_done)
+	w.WriteBool(p.F_claimed)
+
+}
+
+//#任务列表
+type S_quest_list struct {
+	F_quests []S_quest
+}
+
+func (p S_quest_list) Pack(w *packet.Packet) {
+	w.WriteU16(uint16(len(p.F_quests)))
+	for k := range p.F_quests {
+		p.F_quests[k].Pack(w)
+	}
+
+}
+
+//#抽卡, F_times为1或10
+type S_gacha_pull struct {
+	F_pool  int32
+	F_times int32
+}
+
+func (p S_gacha_pull) Pack(w *packet.Packet) {
+	w.WriteS32(p.F_pool)
+	w.WriteS32(p.F_times)
+
+}
+
+//#抽到的道具
+type S_gacha_item struct {
+	F_rarity int32
+	F_type   int32
+	F_id     int32
+	F_count  int32
+}
+
+func (p S_gacha_item) Pack(w *packet.Packet) {
+	w.WriteS32(p.F_rarity)
+	w.WriteS32(p.F_type)
+	w.WriteS32(p.F_id)
+	w.WriteS32(p.F_count)
+
+}
+
+//#抽卡结果
+type S_gacha_result struct {
+	F_pool  int32
+	F_pity  int32
+	F_items []S_gacha_item
+}
+
+func (p S_gacha_result) Pack(w *packet.Packet) {
+	w.WriteS32(p.F_pool)
+	w.WriteS32(p.F_pity)
+	w.WriteU16(uint16(len(p.F_items)))
+	for k := range p.F_items {
+		p.F_items[k].Pack(w)
+	}
+
+}
+
+//#一个卡池的保底计数
+type S_gacha_counter struct {
+	F_pool  int32
+	F_pity  int32
+	F_total int64
+}
+
+func (p S_gacha_counter) Pack(w *packet.Packet) {
+	w.WriteS32(p.F_pool)
+	w.WriteS32(p.F_pity)
+	w.WriteS64(p.F_total)
+
+}
+
+//#保底计数列表
+type S_gacha_counters struct {
+	F_counters []S_gacha_counter
+}
+
+func (p S_gacha_counters) Pack(w *packet.Packet) {
+	w.WriteU16(uint16(len(p.F_counters)))
+	for k := range p.F_counters {
+		p.F_counters[k].Pack(w)
+	}
+
+}
+
+//#一种货币的余额
+type S_currency struct {
+	F_id      int32
+	F_balance int64
+}
+
+func (p S_currency) Pack(w *packet.Packet) {
+	w.WriteS32(p.F_id)
+	w.WriteS64(p.F_balance)
+
+}
+
+//#货币余额列表
+type S_currency_list struct {
+	F_currencies []S_currency
+}
+
+func (p S_currency_list) Pack(w *packet.Packet) {
+	w.WriteU16(uint16(len(p.F_currencies)))
+	for k := range p.F_currencies {
+		p.F_currencies[k].Pack(w)
+	}
+
+}
+
+//#货币变化, F_amount为负时为支出
+type S_currency_change struct {
+	F_id      int32
+	F_amount  int64
+	F_balance int64
+	F_reason  string
+}
+
+func (p S_currency_change) Pack(w *packet.Packet) {
+	w.WriteS32(p.F_id)
+	w.WriteS64(p.F_amount)
+	w.WriteS64(p.F_balance)
+	w.WriteString(p.F_reason)
+
+}
+
+//#商店id
+type S_shop_id struct {
+	F_shop int32
+}
+
+func (p S_shop_id) Pack(w *packet.Packet) {
+	w.WriteS32(p.F_shop)
+
+}
+
+//#商品, F_limit为0时不限购, F_end为0时不限时
+type S_shop_goods struct {
+	F_id         int32
+	F_type       int32
+	F_item       int32
+	F_count      int32
+	F_price_type int32
+	F_price_id   int32
+	F_price      int32
+	F_limit      int32
+	F_bought     int32
+	F_end        int64
+}
+
+func (p S_shop_goods) Pack(w *packet.Packet) {
+	w.WriteS32(p.F_id)
+	w.WriteS32(p.F_type)
+	w.WriteS32(p.F_item)
+	w.WriteS32(p.F_count)
+	w.WriteS32(p.F_price_type)
+	w.WriteS32(p.F_price_id)
+	w.WriteS32(p.F_price)
+	w.WriteS32(p.F_limit)
+	w.WriteS32(p.F_bought)
+	w.WriteS64(p.F_end)
+
+}
+
+//#商店, F_refresh为下一次限购刷新时间, 0为不刷新
+type S_shop struct {
+	F_shop    int32
+	F_refresh int64
+	F_goods   []S_shop_goods
+}
+
+func (p S_shop) Pack(w *packet.Packet) {
+	w.WriteS32(p.F_shop)
+	w.WriteS64(p.F_refresh)
+	w.WriteU16(uint16(len(p.F_goods)))
+	for k := range p.F_goods {
+		p.F_goods[k].Pack(w)
+	}
+
+}
+
+//#购买商品
+type S_shop_buy struct {
+	F_goods int32
+	F_count int32
+}
+
+func (p S_shop_buy) Pack(w *packet.Packet) {
+	w.WriteS32(p.F_goods)
+	w.WriteS32(p.F_count)
+
+}
+
+//#进入地图
+type S_world_enter struct {
+	F_map int32
+}
+
+func (p S_world_enter) Pack(w *packet.Packet) {
+	w.WriteS32(p.F_map)
+
+}
+
+//#所在地图实例, 之后通过room_input_req移动
+type S_world struct {
+	F_map  int32
+	F_room int64
+}
+
+func (p S_world) Pack(w *packet.Packet) {
+	w.WriteS32(p.F_map)
+	w.WriteS64(p.F_room)
+
+}
+
+//#视野事件, F_type: 1进入 2离开 3移动 4状态变化
+type S_aoi_event struct {
+	F_type  int32
+	F_id    int64
+	F_x     float32
+	F_y     float32
+	F_state []byte
+}
+
+func (p S_aoi_event) Pack(w *packet.Packet) {
+	w.WriteS32(p.F_type)
+	w.WriteS64(p.F_id)
+	w.WriteFloat32(p.F_x)
+	w.WriteFloat32(p.F_y)
+	w.WriteBytes(p.F_state)
+
+}
+
+//#一次tick内的视野事件
+type S_aoi_events struct {
+	F_events []S_aoi_event
+}
+
+func (p S_aoi_events) Pack(w *packet.Packet) {
+	w.WriteU16(uint16(len(p.F_events)))
+	for k := range p.F_events {
+		p.F_events[k].Pack(w)
+	}
+
+}
+
+//#上架道具
+type S_auction_sell struct {
+	F_item     int32
+	F_count    int32
+	F_currency int32
+	F_price    int64
+}
+
+func (p S_auction_sell) Pack(w *packet.Packet) {
+	w.WriteS32(p.F_item)
+	w.WriteS32(p.F_count)
+	w.WriteS32(p.F_currency)
+	w.WriteS64(p.F_price)
+
+}
+
+//#挂单id
+type S_auction_id struct {
+	F_id string
+}
+
+func (p S_auction_id) Pack(w *packet.Packet) {
+	w.WriteString(p.F_id)
+
+}
+
+//#查询在售道具, F_item为0时不限
+type S_auction_search struct {
+	F_item int32
+}
+
+func (p S_auction_search) Pack(w *packet.Packet) {
+	w.WriteS32(p.F_item)
+
+}
+
+//#挂单, F_state: 1在售 2已售出 3已结算 4已下架 5已过期
+type S_auction_listing struct {
+	F_id       string
+	F_seller   int32
+	F_item     int32
+	F_count    int32
+	F_currency int32
+	F_price    int64
+	F_state    int32
+	F_expire   int64
+}
+
+func (p S_auction_listing) Pack(w *packet.Packet) {
+	w.WriteString(p.F_id)
+	w.WriteS32(p.F_seller)
+	w.WriteS32(p.F_item)
+	w.WriteS32(p.F_count)
+	w.WriteS32(p.F_currency)
+	w.WriteS64(p.F_price)
+	w.WriteS32(p.F_state)
+	w.WriteS64(p.F_expire)
+
+}
+
+//#挂单列表
+type S_auction_list struct {
+	F_listings []S_auction_listing
+}
+
+func (p S_auction_list) Pack(w *packet.Packet) {
+	w.WriteU16(uint16(len(p.F_listings)))
+	for k := range p.F_listings {
+		p.F_listings[k].Pack(w)
+	}
+
+}
+
+//#队伍id
+type S_party_id struct {
+	F_id string
+}
+
+func (p S_party_id) Pack(w *packet.Packet) {
+	w.WriteString(p.F_id)
+
+}
+
+//#队员
+type S_party_member struct {
+	F_id     int32
+	F_ready  bool
+	F_online bool
+}
+
+func (p S_party_member) Pack(w *packet.Packet) {
+	w.WriteS32(p.F_id)
+	w.WriteBool(p.F_ready)
+	w.WriteBool(p.F_online)
+
+}
+
+//#队伍信息
+type S_party_info struct {
+	F_id          string
+	F_leader      int32
+	F_target      int32
+	F_max_members int32
+	F_members     []S_party_member
+}
+
+func (p S_party_info) Pack(w *packet.Packet) {
+	w.WriteString(p.F_id)
+	w.WriteS32(p.F_leader)
+	w.WriteS32(p.F_target)
+	w.WriteS32(p.F_max_members)
+	w.WriteU16(uint16(len(p.F_members)))
+	for k := range p.F_members {
+		p.F_members[k].Pack(w)
+	}
+
+}
+
+//#准备状态
+type S_party_ready struct {
+	F_ready bool
+}
+
+func (p S_party_ready) Pack(w *packet.Packet) {
+	w.WriteBool(p.F_ready)
+
+}
+
+//#队伍状态推送 event见party.EVENT_XXX, F_id为事件相关的玩家, 解散时F_party没有成员
+type S_party_event struct {
+	F_event int32
+	F_id    int32
+	F_party S_party_info
+}
+
+func (p S_party_event) Pack(w *packet.Packet) {
+	w.WriteS32(p.F_event)
+	w.WriteS32(p.F_id)
+	p.F_party.Pack(w)
+
+}
+
+//#队伍邀请推送
+type S_party_invite struct {
+	F_party string
+	F_from  int32
+}
+
+func (p S_party_invite) Pack(w *packet.Packet) {
+	w.WriteString(p.F_party)
+	w.WriteS32(p.F_from)
+
+}
+
+//#改名
+type S_user_rename struct {
+	F_name string
+}
+
+func (p S_user_rename) Pack(w *packet.Packet) {
+	w.WriteString(p.F_name)
+
+}
+
+//#改名结果, F_next为下一次可以改名的时间
+type S_user_renamed struct {
+	F_name string
+	F_next int64
+}
+
+func (p S_user_renamed) Pack(w *packet.Packet) {
+	w.WriteString(p.F_name)
+	w.WriteS64(p.F_next)
+
+}
+
+//#等级和经验 next:升到下一级需要的经验, 满级为0
+type S_level_info struct {
+	F_level int32
+	F_exp   int64
+	F_next  int64
+	F_max   int32
+}
+
+func (p S_level_info) Pack(w *packet.Packet) {
+	w.WriteS32(p.F_level)
+	w.WriteS64(p.F_exp)
+	w.WriteS64(p.F_next)
+	w.WriteS32(p.F_max)
+
+}
+
+//#经验变化
+type S_exp_change struct {
+	F_amount int64
+	F_reason string
+	F_level  int32
+	F_exp    int64
+	F_next   int64
+}
+
+func (p S_exp_change) Pack(w *packet.Packet) {
+	w.WriteS64(p.F_amount)
+	w.WriteString(p.F_reason)
+	w.WriteS32(p.F_level)
+	w.WriteS64(p.F_exp)
+	w.WriteS64(p.F_next)
+
+}
+
+//#升级 rewards:跨过的每一级的奖励
+type S_level_up struct {
+	F_from    int32
+	F_level   int32
+	F_rewards []S_mail_attachment
+}
+
+func (p S_level_up) Pack(w *packet.Packet) {
+	w.WriteS32(p.F_from)
+	w.WriteS32(p.F_level)
+	w.WriteU16(uint16(len(p.F_rewards)))
+	for k := range p.F_rewards {
+		p.F_rewards[k].Pack(w)
+	}
+
+}
+
 func PKT_auto_id(reader *packet.Packet) (tbl S_auto_id, err error) {
 	tbl.F_id, err = reader.ReadS32()
 	checkErr(err)
@@ -94,70 +1133,1110 @@ func PKT_auto_id(reader *packet.Packet) (tbl S_auto_id, err error) {
 	return
 }
 
-func PKT_error_info(reader *packet.Packet) (tbl S_error_info, err error) {
-	tbl.F_code, err = reader.ReadS32()
+func PKT_error_info(reader *packet.Packet) (tbl S_error_info, err error) {
+	tbl.F_code, err = reader.ReadS32()
+	checkErr(err)
+
+	tbl.F_msg, err = reader.ReadString()
+	checkErr(err)
+
+	return
+}
+
+func PKT_user_login_info(reader *packet.Packet) (tbl S_user_login_info, err error) {
+	tbl.F_login_way, err = reader.ReadS32()
+	checkErr(err)
+
+	tbl.F_open_udid, err = reader.ReadString()
+	checkErr(err)
+
+	tbl.F_client_certificate, err = reader.ReadString()
+	checkErr(err)
+
+	tbl.F_client_version, err = reader.ReadS32()
+	checkErr(err)
+
+	tbl.F_user_lang, err = reader.ReadString()
+	checkErr(err)
+
+	tbl.F_app_id, err = reader.ReadString()
+	checkErr(err)
+
+	tbl.F_os_version, err = reader.ReadString()
+	checkErr(err)
+
+	tbl.F_device_name, err = reader.ReadString()
+	checkErr(err)
+
+	tbl.F_device_id, err = reader.ReadString()
+	checkErr(err)
+
+	tbl.F_device_id_type, err = reader.ReadS32()
+	checkErr(err)
+
+	tbl.F_login_ip, err = reader.ReadString()
+	checkErr(err)
+
+	return
+}
+
+func PKT_seed_info(reader *packet.Packet) (tbl S_seed_info, err error) {
+	tbl.F_client_send_seed, err = reader.ReadS32()
+	checkErr(err)
+
+	tbl.F_client_receive_seed, err = reader.ReadS32()
+	checkErr(err)
+
+	return
+}
+
+func PKT_user_snapshot(reader *packet.Packet) (tbl S_user_snapshot, err error) {
+	tbl.F_uid, err = reader.ReadS32()
+	checkErr(err)
+
+	tbl.F_name, err = reader.ReadString()
+	checkErr(err)
+
+	tbl.F_level, err = reader.ReadS32()
+	checkErr(err)
+
+	tbl.F_score, err = reader.ReadS32()
+	checkErr(err)
+
+	tbl.F_create_time, err = reader.ReadS64()
+	checkErr(err)
+
+	tbl.F_exp, err = reader.ReadS64()
+	checkErr(err)
+
+	return
+}
+
+func PKT_chat_msg(reader *packet.Packet) (tbl S_chat_msg, err error) {
+	tbl.F_type, err = reader.ReadS32()
+	checkErr(err)
+
+	tbl.F_channel, err = reader.ReadString()
+	checkErr(err)
+
+	tbl.F_to, err = reader.ReadS32()
+	checkErr(err)
+
+	tbl.F_content, err = reader.ReadString()
+	checkErr(err)
+
+	return
+}
+
+func PKT_chat_info(reader *packet.Packet) (tbl S_chat_info, err error) {
+	tbl.F_type, err = reader.ReadS32()
+	checkErr(err)
+
+	tbl.F_channel, err = reader.ReadString()
+	checkErr(err)
+
+	tbl.F_from, err = reader.ReadS32()
+	checkErr(err)
+
+	tbl.F_to, err = reader.ReadS32()
+	checkErr(err)
+
+	tbl.F_content, err = reader.ReadString()
+	checkErr(err)
+
+	tbl.F_time, err = reader.ReadS64()
+	checkErr(err)
+
+	return
+}
+
+func PKT_chat_history(reader *packet.Packet) (tbl S_chat_history, err error) {
+	narr, err := reader.ReadU16()
+	checkErr(err)
+
+	tbl.F_msgs = make([]S_chat_info, narr)
+	for i := 0; i < int(narr); i++ {
+		tbl.F_msgs[i], err = PKT_chat_info(reader)
+		checkErr(err)
+	}
+
+	return
+}
+
+func PKT_mail_id(reader *packet.Packet) (tbl S_mail_id, err error) {
+	tbl.F_id, err = reader.ReadString()
+	checkErr(err)
+
+	return
+}
+
+func PKT_mail_attachment(reader *packet.Packet) (tbl S_mail_attachment, err error) {
+	tbl.F_type, err = reader.ReadS32()
+	checkErr(err)
+
+	tbl.F_id, err = reader.ReadS32()
+	checkErr(err)
+
+	tbl.F_count, err = reader.ReadS32()
+	checkErr(err)
+
+	return
+}
+
+func PKT_mail_info(reader *packet.Packet) (tbl S_mail_info, err error) {
+	tbl.F_id, err = reader.ReadString()
+	checkErr(err)
+
+	tbl.F_from, err = reader.ReadS32()
+	checkErr(err)
+
+	tbl.F_type, err = reader.ReadS32()
+	checkErr(err)
+
+	tbl.F_title, err = reader.ReadString()
+	checkErr(err)
+
+	tbl.F_content, err = reader.ReadString()
+	checkErr(err)
+
+	narr, err := reader.ReadU16()
+	checkErr(err)
+
+	tbl.F_attachments = make([]S_mail_attachment, narr)
+	for i := 0; i < int(narr); i++ {
+		tbl.F_attachments[i], err = PKT_mail_attachment(reader)
+		checkErr(err)
+	}
+
+	tbl.F_read, err = reader.ReadBool()
+	checkErr(err)
+
+	tbl.F_claimed, err = reader.ReadBool()
+	checkErr(err)
+
+	tbl.F_create_time, err = reader.ReadS64()
+	checkErr(err)
+
+	tbl.F_expire_time, err = reader.ReadS64()
+	checkErr(err)
+
+	return
+}
+
+func PKT_mail_list(reader *packet.Packet) (tbl S_mail_list, err error) {
+	narr, err := reader.ReadU16()
+	checkErr(err)
+
+	tbl.F_mails = make([]S_mail_info, narr)
+	for i := 0; i < int(narr); i++ {
+		tbl.F_mails[i], err = PKT_mail_info(reader)
+		checkErr(err)
+	}
+
+	return
+}
+
+func PKT_mail_send(reader *packet.Packet) (tbl S_mail_send, err error) {
+	tbl.F_to, err = reader.ReadS32()
+	checkErr(err)
+
+	tbl.F_title, err = reader.ReadString()
+	checkErr(err)
+
+	tbl.F_content, err = reader.ReadString()
+	checkErr(err)
+
+	return
+}
+
+func PKT_mail_claim(reader *packet.Packet) (tbl S_mail_claim, err error) {
+	tbl.F_id, err = reader.ReadString()
+	checkErr(err)
+
+	narr, err := reader.ReadU16()
+	checkErr(err)
+
+	tbl.F_attachments = make([]S_mail_attachment, narr)
+	for i := 0; i < int(narr); i++ {
+		tbl.F_attachments[i], err = PKT_mail_attachment(reader)
+		checkErr(err)
+	}
+
+	return
+}
+
+func PKT_friend_info(reader *packet.Packet) (tbl S_friend_info, err error) {
+	tbl.F_id, err = reader.ReadS32()
+	checkErr(err)
+
+	tbl.F_online, err = reader.ReadBool()
+	checkErr(err)
+
+	tbl.F_status, err = reader.ReadS32()
+	checkErr(err)
+
+	return
+}
+
+func PKT_friend_list(reader *packet.Packet) (tbl S_friend_list, err error) {
+	narr, err := reader.ReadU16()
+	checkErr(err)
+
+	tbl.F_friends = make([]S_friend_info, narr)
+	for i := 0; i < int(narr); i++ {
+		tbl.F_friends[i], err = PKT_friend_info(reader)
+		checkErr(err)
+	}
+
+	narr, err = reader.ReadU16()
+	checkErr(err)
+
+	tbl.F_requests = make([]S_auto_id, narr)
+	for i := 0; i < int(narr); i++ {
+		tbl.F_requests[i], err = PKT_auto_id(reader)
+		checkErr(err)
+	}
+
+	narr, err = reader.ReadU16()
+	checkErr(err)
+
+	tbl.F_blocked = make([]S_auto_id, narr)
+	for i := 0; i < int(narr); i++ {
+		tbl.F_blocked[i], err = PKT_auto_id(reader)
+		checkErr(err)
+	}
+
+	return
+}
+
+func PKT_rank_query(reader *packet.Packet) (tbl S_rank_query, err error) {
+	tbl.F_board, err = reader.ReadString()
+	checkErr(err)
+
+	tbl.F_count, err = reader.ReadS32()
+	checkErr(err)
+
+	return
+}
+
+func PKT_rank_entry(reader *packet.Packet) (tbl S_rank_entry, err error) {
+	tbl.F_rank, err = reader.ReadS32()
+	checkErr(err)
+
+	tbl.F_id, err = reader.ReadS32()
+	checkErr(err)
+
+	tbl.F_score, err = reader.ReadS64()
+	checkErr(err)
+
+	return
+}
+
+func PKT_rank_list(reader *packet.Packet) (tbl S_rank_list, err error) {
+	tbl.F_board, err = reader.ReadString()
+	checkErr(err)
+
+	tbl.F_season, err = reader.ReadS32()
+	checkErr(err)
+
+	narr, err := reader.ReadU16()
+	checkErr(err)
+
+	tbl.F_entries = make([]S_rank_entry, narr)
+	for i := 0; i < int(narr); i++ {
+		tbl.F_entries[i], err = PKT_rank_entry(reader)
+		checkErr(err)
+	}
+
+	return
+}
+
+func PKT_match_player(reader *packet.Packet) (tbl S_match_player, err error) {
+	tbl.F_id, err = reader.ReadS32()
+	checkErr(err)
+
+	tbl.F_team, err = reader.ReadS32()
+	checkErr(err)
+
+	tbl.F_rating, err = reader.ReadS32()
+	checkErr(err)
+
+	return
+}
+
+func PKT_match_found(reader *packet.Packet) (tbl S_match_found, err error) {
+	tbl.F_match_id, err = reader.ReadS64()
+	checkErr(err)
+
+	tbl.F_room, err = reader.ReadS64()
+	checkErr(err)
+
+	narr, err := reader.ReadU16()
+	checkErr(err)
+
+	tbl.F_players = make([]S_match_player, narr)
+	for i := 0; i < int(narr); i++ {
+		tbl.F_players[i], err = PKT_match_player(reader)
+		checkErr(err)
+	}
+
+	return
+}
+
+func PKT_room_id(reader *packet.Packet) (tbl S_room_id, err error) {
+	tbl.F_room, err = reader.ReadS64()
+	checkErr(err)
+
+	return
+}
+
+func PKT_room_input(reader *packet.Packet) (tbl S_room_input, err error) {
+	tbl.F_data, err = reader.ReadBytes()
+	checkErr(err)
+
+	return
+}
+
+func PKT_room_state(reader *packet.Packet) (tbl S_room_state, err error) {
+	tbl.F_room, err = reader.ReadS64()
+	checkErr(err)
+
+	tbl.F_frame, err = reader.ReadS32()
+	checkErr(err)
+
+	tbl.F_data, err = reader.ReadBytes()
+	checkErr(err)
+
+	return
+}
+
+func PKT_room_closed(reader *packet.Packet) (tbl S_room_closed, err error) {
+	tbl.F_room, err = reader.ReadS64()
+	checkErr(err)
+
+	tbl.F_reason, err = reader.ReadS32()
+	checkErr(err)
+
+	return
+}
+
+func PKT_lockstep_input(reader *packet.Packet) (tbl S_lockstep_input, err error) {
+	tbl.F_id, err = reader.ReadS32()
+	checkErr(err)
+
+	tbl.F_data, err = reader.ReadBytes()
+	checkErr(err)
+
+	return
+}
+
+func PKT_lockstep_frame(reader *packet.Packet) (tbl S_lockstep_frame, err error) {
+	tbl.F_frame, err = reader.ReadS32()
+	checkErr(err)
+
+	narr, err := reader.ReadU16()
+	checkErr(err)
+
+	tbl.F_inputs = make([]S_lockstep_input, narr)
+	for i := 0; i < int(narr); i++ {
+		tbl.F_inputs[i], err = PKT_lockstep_input(reader)
+		checkErr(err)
+	}
+
+	return
+}
+
+func PKT_lockstep_frames(reader *packet.Packet) (tbl S_lockstep_frames, err error) {
+	narr, err := reader.ReadU16()
+	checkErr(err)
+
+	tbl.F_frames = make([]S_lockstep_frame, narr)
+	for i := 0; i < int(narr); i++ {
+		tbl.F_frames[i], err = PKT_lockstep_frame(reader)
+		checkErr(err)
+	}
+
+	return
+}
+
+func PKT_guild_id(reader *packet.Packet) (tbl S_guild_id, err error) {
+	tbl.F_id, err = reader.ReadString()
+	checkErr(err)
+
+	return
+}
+
+func PKT_guild_text(reader *packet.Packet) (tbl S_guild_text, err error) {
+	tbl.F_text, err = reader.ReadString()
+	checkErr(err)
+
+	return
+}
+
+func PKT_guild_member(reader *packet.Packet) (tbl S_guild_member, err error) {
+	tbl.F_id, err = reader.ReadS32()
+	checkErr(err)
+
+	tbl.F_role, err = reader.ReadS32()
+	checkErr(err)
+
+	tbl.F_contribution, err = reader.ReadS64()
+	checkErr(err)
+
+	tbl.F_online, err = reader.ReadBool()
+	checkErr(err)
+
+	return
+}
+
+func PKT_guild_info(reader *packet.Packet) (tbl S_guild_info, err error) {
+	tbl.F_id, err = reader.ReadString()
+	checkErr(err)
+
+	tbl.F_name, err = reader.ReadString()
+	checkErr(err)
+
+	tbl.F_notice, err = reader.ReadString()
+	checkErr(err)
+
+	tbl.F_level, err = reader.ReadS32()
+	checkErr(err)
+
+	tbl.F_exp, err = reader.ReadS64()
+	checkErr(err)
+
+	tbl.F_max_members, err = reader.ReadS32()
+	checkErr(err)
+
+	narr, err := reader.ReadU16()
+	checkErr(err)
+
+	tbl.F_members = make([]S_guild_member, narr)
+	for i := 0; i < int(narr); i++ {
+		tbl.F_members[i], err = PKT_guild_member(reader)
+		checkErr(err)
+	}
+
+	narr, err = reader.ReadU16()
+	checkErr(err)
+
+	tbl.F_requests = make([]S_auto_id, narr)
+	for i := 0; i < int(narr); i++ {
+		tbl.F_requests[i], err = PKT_auto_id(reader)
+		checkErr(err)
+	}
+
+	return
+}
+
+func PKT_guild_role(reader *packet.Packet) (tbl S_guild_role, err error) {
+	tbl.F_id, err = reader.ReadS32()
+	checkErr(err)
+
+	tbl.F_role, err = reader.ReadS32()
+	checkErr(err)
+
+	return
+}
+
+func PKT_guild_event(reader *packet.Packet) (tbl S_guild_event, err error) {
+	tbl.F_guild, err = reader.ReadString()
+	checkErr(err)
+
+	tbl.F_event, err = reader.ReadS32()
+	checkErr(err)
+
+	tbl.F_id, err = reader.ReadS32()
+	checkErr(err)
+
+	return
+}
+
+func PKT_guild_invite(reader *packet.Packet) (tbl S_guild_invite, err error) {
+	tbl.F_guild, err = reader.ReadString()
+	checkErr(err)
+
+	tbl.F_name, err = reader.ReadString()
+	checkErr(err)
+
+	tbl.F_from, err = reader.ReadS32()
+	checkErr(err)
+
+	return
+}
+
+func PKT_guild_record(reader *packet.Packet) (tbl S_guild_record, err error) {
+	tbl.F_id, err = reader.ReadS32()
+	checkErr(err)
+
+	tbl.F_donation, err = reader.ReadS32()
+	checkErr(err)
+
+	tbl.F_contribution, err = reader.ReadS64()
+	checkErr(err)
+
+	tbl.F_time, err = reader.ReadS64()
+	checkErr(err)
+
+	return
+}
+
+func PKT_guild_records(reader *packet.Packet) (tbl S_guild_records, err error) {
+	narr, err := reader.ReadU16()
+	checkErr(err)
+
+	tbl.F_records = make([]S_guild_record, narr)
+	for i := 0; i < int(narr); i++ {
+		tbl.F_records[i], err = PKT_guild_record(reader)
+		checkErr(err)
+	}
+
+	return
+}
+
+func PKT_item(reader *packet.Packet) (tbl S_item, err error) {
+	tbl.F_uid, err = reader.ReadS64()
+	checkErr(err)
+
+	tbl.F_id, err = reader.ReadS32()
+	checkErr(err)
+
+	tbl.F_count, err = reader.ReadS32()
+	checkErr(err)
+
+	tbl.F_expire, err = reader.ReadS64()
+	checkErr(err)
+
+	return
+}
+
+func PKT_item_list(reader *packet.Packet) (tbl S_item_list, err error) {
+	tbl.F_capacity, err = reader.ReadS32()
+	checkErr(err)
+
+	narr, err := reader.ReadU16()
+	checkErr(err)
+
+	tbl.F_items = make([]S_item, narr)
+	for i := 0; i < int(narr); i++ {
+		tbl.F_items[i], err = PKT_item(reader)
+		checkErr(err)
+	}
+
+	return
+}
+
+func PKT_item_use(reader *packet.Packet) (tbl S_item_use, err error) {
+	tbl.F_uid, err = reader.ReadS64()
+	checkErr(err)
+
+	tbl.F_count, err = reader.ReadS32()
+	checkErr(err)
+
+	return
+}
+
+func PKT_item_change(reader *packet.Packet) (tbl S_item_change, err error) {
+	tbl.F_item, err = PKT_item(reader)
+	checkErr(err)
+
+	tbl.F_delta, err = reader.ReadS32()
+	checkErr(err)
+
+	tbl.F_reason, err = reader.ReadS32()
+	checkErr(err)
+
+	return
+}
+
+func PKT_item_changes(reader *packet.Packet) (tbl S_item_changes, err error) {
+	narr, err := reader.ReadU16()
+	checkErr(err)
+
+	tbl.F_changes = make([]S_item_change, narr)
+	for i := 0; i < int(narr); i++ {
+		tbl.F_changes[i], err = PKT_item_change(reader)
+		checkErr(err)
+	}
+
+	return
+}
+
+func PKT_quest(reader *packet.Packet) (tbl S_quest, err error) {
+	tbl.F_id, err = reader.ReadS32()
+	checkErr(err)
+
+	tbl.F_count, err = reader.ReadS64()
+	checkErr(err)
+
+	tbl.F_done, err = reader.ReadBool()
+	checkErr(err)
+
+	tbl.F_claimed, err = reader.ReadBool()
+	checkErr(err)
+
+	return
+}
+
+func PKT_quest_list(reader *packet.Packet) (tbl S_quest_list, err error) {
+	narr, err := reader.ReadU16()
+	checkErr(err)
+
+	tbl.F_quests = make([]S_quest, narr)
+	for i := 0; i < int(narr); i++ {
+		tbl.F_quests[i], err = PKT_quest(reader)
+		checkErr(err)
+	}
+
+	return
+}
+
+func PKT_gacha_pull(reader *packet.Packet) (tbl S_gacha_pull, err error) {
+	tbl.F_pool, err = reader.ReadS32()
+	checkErr(err)
+
+	tbl.F_times, err = reader.ReadS32()
+	checkErr(err)
+
+	return
+}
+
+func PKT_gacha_item(reader *packet.Packet) (tbl S_gacha_item, err error) {
+	tbl.F_rarity, err = reader.ReadS32()
+	checkErr(err)
+
+	tbl.F_type, err = reader.ReadS32()
+	checkErr(err)
+
+	tbl.F_id, err = reader.ReadS32()
+	checkErr(err)
+
+	tbl.F_count, err = reader.ReadS32()
+	checkErr(err)
+
+	return
+}
+
+func PKT_gacha_result(reader *packet.Packet) (tbl S_gacha_result, err error) {
+	tbl.F_pool, err = reader.ReadS32()
+	checkErr(err)
+
+	tbl.F_pity, err = reader.ReadS32()
+	checkErr(err)
+
+	narr, err := reader.ReadU16()
+	checkErr(err)
+
+	tbl.F_items = make([]S_gacha_item, narr)
+	for i := 0; i < int(narr); i++ {
+		tbl.F_items[i], err = PKT_gacha_item(reader)
+		checkErr(err)
+	}
+
+	return
+}
+
+func PKT_gacha_counter(reader *packet.Packet) (tbl S_gacha_counter, err error) {
+	tbl.F_pool, err = reader.ReadS32()
+	checkErr(err)
+
+	tbl.F_pity, err = reader.ReadS32()
+	checkErr(err)
+
+	tbl.F_total, err = reader.ReadS64()
+	checkErr(err)
+
+	return
+}
+
+func PKT_gacha_counters(reader *packet.Packet) (tbl S_gacha_counters, err error) {
+	narr, err := reader.ReadU16()
+	checkErr(err)
+
+	tbl.F_counters = make([]S_gacha_counter, narr)
+	for i := 0; i < int(narr); i++ {
+		tbl.F_counters[i], err = PKT_gacha_counter(reader)
+		checkErr(err)
+	}
+
+	return
+}
+
+func PKT_currency(reader *packet.Packet) (tbl S_currency, err error) {
+	tbl.F_id, err = reader.ReadS32()
+	checkErr(err)
+
+	tbl.F_balance, err = reader.ReadS64()
+	checkErr(err)
+
+	return
+}
+
+func PKT_currency_list(reader *packet.Packet) (tbl S_currency_list, err error) {
+	narr, err := reader.ReadU16()
 	checkErr(err)
 
-	tbl.F_msg, err = reader.ReadString()
+	tbl.F_currencies = make([]S_currency, narr)
+	for i := 0; i < int(narr); i++ {
+		tbl.F_currencies[i], err = PKT_currency(reader)
+		checkErr(err)
+	}
+
+	return
+}
+
+func PKT_currency_change(reader *packet.Packet) (tbl S_currency_change, err error) {
+	tbl.F_id, err = reader.ReadS32()
+	checkErr(err)
+
+	tbl.F_amount, err = reader.ReadS64()
+	checkErr(err)
+
+	tbl.F_balance, err = reader.ReadS64()
+	checkErr(err)
+
+	tbl.F_reason, err = reader.ReadString()
 	checkErr(err)
 
 	return
 }
 
-func PKT_user_login_info(reader *packet.Packet) (tbl S_user_login_info, err error) {
-	tbl.F_login_way, err = reader.ReadS32()
+func PKT_shop_id(reader *packet.Packet) (tbl S_shop_id, err error) {
+	tbl.F_shop, err = reader.ReadS32()
 	checkErr(err)
 
-	tbl.F_open_udid, err = reader.ReadString()
+	return
+}
+
+func PKT_shop_goods(reader *packet.Packet) (tbl S_shop_goods, err error) {
+	tbl.F_id, err = reader.ReadS32()
 	checkErr(err)
 
-	tbl.F_client_certificate, err = reader.ReadString()
+	tbl.F_type, err = reader.ReadS32()
 	checkErr(err)
 
-	tbl.F_client_version, err = reader.ReadS32()
+	tbl.F_item, err = reader.ReadS32()
 	checkErr(err)
 
-	tbl.F_user_lang, err = reader.ReadString()
+	tbl.F_count, err = reader.ReadS32()
 	checkErr(err)
 
-	tbl.F_app_id, err = reader.ReadString()
+	tbl.F_price_type, err = reader.ReadS32()
 	checkErr(err)
 
-	tbl.F_os_version, err = reader.ReadString()
+	tbl.F_price_id, err = reader.ReadS32()
 	checkErr(err)
 
-	tbl.F_device_name, err = reader.ReadString()
+	tbl.F_price, err = reader.ReadS32()
 	checkErr(err)
 
-	tbl.F_device_id, err = reader.ReadString()
+	tbl.F_limit, err = reader.ReadS32()
 	checkErr(err)
 
-	tbl.F_device_id_type, err = reader.ReadS32()
+	tbl.F_bought, err = reader.ReadS32()
 	checkErr(err)
 
-	tbl.F_login_ip, err = reader.ReadString()
+	tbl.F_end, err = reader.ReadS64()
 	checkErr(err)
 
 	return
 }
 
-func PKT_seed_info(reader *packet.Packet) (tbl S_seed_info, err error) {
-	tbl.F_client_send_seed, err = reader.ReadS32()
+func PKT_shop(reader *packet.Packet) (tbl S_shop, err error) {
+	tbl.F_shop, err = reader.ReadS32()
 	checkErr(err)
 
-	tbl.F_client_receive_seed, err = reader.ReadS32()
+	tbl.F_refresh, err = reader.ReadS64()
+	checkErr(err)
+
+	narr, err := reader.ReadU16()
 	checkErr(err)
 
+	tbl.F_goods = make([]S_shop_goods, narr)
+	for i := 0; i < int(narr); i++ {
+		tbl.F_goods[i], err = PKT_shop_goods(reader)
+		checkErr(err)
+	}
+
 	return
 }
 
-func PKT_user_snapshot(reader *packet.Packet) (tbl S_user_snapshot, err error) {
-	tbl.F_uid, err = reader.ReadS32()
+func PKT_shop_buy(reader *packet.Packet) (tbl S_shop_buy, err error) {
+	tbl.F_goods, err = reader.ReadS32()
+	checkErr(err)
+
+	tbl.F_count, err = reader.ReadS32()
+	checkErr(err)
+
+	return
+}
+
+func PKT_world_enter(reader *packet.Packet) (tbl S_world_enter, err error) {
+	tbl.F_map, err = reader.ReadS32()
+	checkErr(err)
+
+	return
+}
+
+func PKT_world(reader *packet.Packet) (tbl S_world, err error) {
+	tbl.F_map, err = reader.ReadS32()
+	checkErr(err)
+
+	tbl.F_room, err = reader.ReadS64()
+	checkErr(err)
+
+	return
+}
+
+func PKT_aoi_event(reader *packet.Packet) (tbl S_aoi_event, err error) {
+	tbl.F_type, err = reader.ReadS32()
+	checkErr(err)
+
+	tbl.F_id, err = reader.ReadS64()
+	checkErr(err)
+
+	tbl.F_x, err = reader.ReadFloat32()
+	checkErr(err)
+
+	tbl.F_y, err = reader.ReadFloat32()
+	checkErr(err)
+
+	tbl.F_state, err = reader.ReadBytes()
+	checkErr(err)
+
+	return
+}
+
+func PKT_aoi_events(reader *packet.Packet) (tbl S_aoi_events, err error) {
+	narr, err := reader.ReadU16()
+	checkErr(err)
+
+	tbl.F_events = make([]S_aoi_event, narr)
+	for i := 0; i < int(narr); i++ {
+		tbl.F_events[i], err = PKT_aoi_event(reader)
+		checkErr(err)
+	}
+
+	return
+}
+
+func PKT_auction_sell(reader *packet.Packet) (tbl S_auction_sell, err error) {
+	tbl.F_item, err = reader.ReadS32()
+	checkErr(err)
+
+	tbl.F_count, err = reader.ReadS32()
+	checkErr(err)
+
+	tbl.F_currency, err = reader.ReadS32()
+	checkErr(err)
+
+	tbl.F_price, err = reader.ReadS64()
+	checkErr(err)
+
+	return
+}
+
+func PKT_auction_id(reader *packet.Packet) (tbl S_auction_id, err error) {
+	tbl.F_id, err = reader.ReadString()
+	checkErr(err)
+
+	return
+}
+
+func PKT_auction_search(reader *packet.Packet) (tbl S_auction_search, err error) {
+	tbl.F_item, err = reader.ReadS32()
+	checkErr(err)
+
+	return
+}
+
+func PKT_auction_listing(reader *packet.Packet) (tbl S_auction_listing, err error) {
+	tbl.F_id, err = reader.ReadString()
+	checkErr(err)
+
+	tbl.F_seller, err = reader.ReadS32()
+	checkErr(err)
+
+	tbl.F_item, err = reader.ReadS32()
+	checkErr(err)
+
+	tbl.F_count, err = reader.ReadS32()
+	checkErr(err)
+
+	tbl.F_currency, err = reader.ReadS32()
+	checkErr(err)
+
+	tbl.F_price, err = reader.ReadS64()
+	checkErr(err)
+
+	tbl.F_state, err = reader.ReadS32()
+	checkErr(err)
+
+	tbl.F_expire, err = reader.ReadS64()
+	checkErr(err)
+
+	return
+}
+
+func PKT_auction_list(reader *packet.Packet) (tbl S_auction_list, err error) {
+	narr, err := reader.ReadU16()
+	checkErr(err)
+
+	tbl.F_listings = make([]S_auction_listing, narr)
+	for i := 0; i < int(narr); i++ {
+		tbl.F_listings[i], err = PKT_auction_listing(reader)
+		checkErr(err)
+	}
+
+	return
+}
+
+func PKT_party_id(reader *packet.Packet) (tbl S_party_id, err error) {
+	tbl.F_id, err = reader.ReadString()
+	checkErr(err)
+
+	return
+}
+
+func PKT_party_member(reader *packet.Packet) (tbl S_party_member, err error) {
+	tbl.F_id, err = reader.ReadS32()
+	checkErr(err)
+
+	tbl.F_ready, err = reader.ReadBool()
+	checkErr(err)
+
+	tbl.F_online, err = reader.ReadBool()
+	checkErr(err)
+
+	return
+}
+
+func PKT_party_info(reader *packet.Packet) (tbl S_party_info, err error) {
+	tbl.F_id, err = reader.ReadString()
+	checkErr(err)
+
+	tbl.F_leader, err = reader.ReadS32()
+	checkErr(err)
+
+	tbl.F_target, err = reader.ReadS32()
+	checkErr(err)
+
+	tbl.F_max_members, err = reader.ReadS32()
+	checkErr(err)
+
+	narr, err := reader.ReadU16()
+	checkErr(err)
+
+	tbl.F_members = make([]S_party_member, narr)
+	for i := 0; i < int(narr); i++ {
+		tbl.F_members[i], err = PKT_party_member(reader)
+		checkErr(err)
+	}
+
+	return
+}
+
+func PKT_party_ready(reader *packet.Packet) (tbl S_party_ready, err error) {
+	tbl.F_ready, err = reader.ReadBool()
 	checkErr(err)
 
 	return
 }
 
+func PKT_party_event(reader *packet.Packet) (tbl S_party_event, err error) {
+	tbl.F_event, err = reader.ReadS32()
+	checkErr(err)
+
+	tbl.F_id, err = reader.ReadS32()
+	checkErr(err)
+
+	tbl.F_party, err = PKT_party_info(reader)
+	checkErr(err)
+
+	return
+}
+
+func PKT_party_invite(reader *packet.Packet) (tbl S_party_invite, err error) {
+	tbl.F_party, err = reader.ReadString()
+	checkErr(err)
+
+	tbl.F_from, err = reader.ReadS32()
+	checkErr(err)
+
+	return
+}
+
+func PKT_user_rename(reader *packet.Packet) (tbl S_user_rename, err error) {
+	tbl.F_name, err = reader.ReadString()
+	checkErr(err)
+
+	return
+}
+
+func PKT_user_renamed(reader *packet.Packet) (tbl S_user_renamed, err error) {
+	tbl.F_name, err = reader.ReadString()
+	checkErr(err)
+
+	tbl.F_next, err = reader.ReadS64()
+	checkErr(err)
+
+	return
+}
+
+func PKT_level_info(reader *packet.Packet) (tbl S_level_info, err error) {
+	tbl.F_level, err = reader.ReadS32()
+	checkErr(err)
+
+	tbl.F_exp, err = reader.ReadS64()
+	checkErr(err)
+
+	tbl.F_next, err = reader.ReadS64()
+	checkErr(err)
+
+	tbl.F_max, err = reader.ReadS32()
+	checkErr(err)
+
+	return
+}
+
+func PKT_exp_change(reader *packet.Packet) (tbl S_exp_change, err error) {
+	tbl.F_amount, err = reader.ReadS64()
+	checkErr(err)
+
+	tbl.F_reason, err = reader.ReadString()
+	checkErr(err)
+
+	tbl.F_level, err = reader.ReadS32()
+	checkErr(err)
+
+	tbl.F_exp, err = reader.ReadS64()
+	checkErr(err)
+
+	tbl.F_next, err = reader.ReadS64()
+	checkErr(err)
+
+	return
+}
+
+func PKT_level_up(reader *packet.Packet) (tbl S_level_up, err error) {
+	tbl.F_from, err = reader.ReadS32()
+	checkErr(err)
+
+	tbl.F_level, err = reader.ReadS32()
+	checkErr(err)
+
+	narr, err := reader.ReadU16()
+	checkErr(err)
+
+	tbl.F_rewards = make([]S_mail_attachment, narr)
+	for i := 0; i < int(narr); i++ {
+		tbl.F_rewards[i], err = PKT_mail_attachment(reader)
+		checkErr(err)
+	}
+
+	return
+}
+
 func checkErr(err error) {
 	if err != nil {
 		panic("error occured in protocol module")
@@ -0,0 +1,190 @@
+package client_handler
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"game/channels"
+	"game/events"
+	"game/inventory"
+	"game/mail"
+	"game/misc/packet"
+	"game/numbers"
+	"game/quest"
+	. "game/types"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// 任务数值表(TaskConfig):
+// KEY_Quest       第一列为任务id, Kind(1普通 2日常 3周常) Event Target Mode Count Prereq Type1 Id1 Count1 ... Type3 Id3 Count3
+// KEY_Achievement 第一列为成就id, 其余同KEY_Quest, 没有Kind
+// 任务和成就共用id空间, Event见events包, Mode为0累加, 1取最大值
+const (
+	NUMBERS_TASK             = "TaskConfig"
+	NUMBERS_TASK_QUEST       = "KEY_Quest"
+	NUMBERS_TASK_ACHIEVEMENT = "KEY_Achievement"
+	MAX_QUEST_REWARDS        = 3
+)
+
+func init() {
+	register_numbers(NUMBERS_TASK, load_task_config)
+}
+
+func init_quest() {
+	quest.Init(&DefaultDatabase)
+	quest.Grant = grant_quest
+	quest.OnProgress = push_quest_progress
+}
+
+func load_task_config(ns numbers.NumbersOp) {
+	var defs []*quest.Def
+	seen := make(map[int32]bool)
+	for _, tbl := range []string{NUMBERS_TASK_QUEST, NUMBERS_TASK_ACHIEVEMENT} {
+		if !ns.IsTableExists(tbl) {
+			continue
+		}
+		for _, key := range ns.GetKeys(tbl) {
+			def, err := load_quest(ns, tbl, key)
+			if err != nil {
+				log.Errorf("task config: %v, table:%v row:%v", err, tbl, key)
+				continue
+			}
+			if seen[def.Id] {
+				log.Errorf("task config: duplicated id, table:%v row:%v", tbl, key)
+				continue
+			}
+			seen[def.Id] = true
+			defs = append(defs, def)
+		}
+	}
+
+	quest.SetDefs(defs)
+	log.Infof("task config loaded, quests:%v", len(defs))
+}
+
+func load_quest(ns numbers.NumbersOp, tbl, key string) (*quest.Def, error) {
+	id, err := strconv.Atoi(key)
+	if err != nil {
+		return nil, err
+	}
+	def := &quest.Def{
+		Id:     int32(id),
+		Kind:   quest.KIND_ACHIEVEMENT,
+		Event:  ns.GetInt(tbl, key, "Event"),
+		Target: ns.GetInt(tbl, key, "Target"),
+		Mode:   ns.GetInt(tbl, key, "Mode"),
+		Count:  int64(ns.GetInt(tbl, key, "Count")),
+		Prereq: ns.GetInt(tbl, key, "Prereq"),
+	}
+	if tbl == NUMBERS_TASK_QUEST {
+		def.Kind = ns.GetInt(tbl, key, "Kind")
+		if def.Kind < quest.KIND_ONCE || def.Kind > quest.KIND_WEEKLY {
+			return nil, fmt.Errorf("invalid kind %v", def.Kind)
+		}
+	}
+	if def.Count <= 0 {
+		return nil, fmt.Errorf("invalid count %v", def.Count)
+	}
+	if !valid_quest_event(def.Event) {
+		return nil, fmt.Errorf("invalid event %v", def.Event)
+	}
+
+	for i := 1; i <= MAX_QUEST_REWARDS; i++ {
+		field := fmt.Sprint("Type", i)
+		if !ns.IsFieldExists(tbl, key, field) || ns.GetInt(tbl, key, field) == 0 {
+			continue
+		}
+		a := mail.Attachment{
+			Type:  ns.GetInt(tbl, key, field),
+			Id:    ns.GetInt(tbl, key, fmt.Sprint("Id", i)),
+			Count: ns.GetInt(tbl, key, fmt.Sprint("Count", i)),
+		}
+		if err := validate_attachment(&a); err != nil {
+			return nil, err
+		}
+		def.Rewards = append(def.Rewards, a)
+	}
+	return def, nil
+}
+
+func valid_quest_event(e int32) bool {
+	for _, v := range quest.EVENTS {
+		if v == e {
+			return true
+		}
+	}
+	return false
+}
+
+func grant_quest(userid int32, def *quest.Def, key string) error {
+	return grant(userid, def.Rewards, inventory.REASON_QUEST, key)
+}
+
+func quest_info(pg *quest.Progress) S_quest {
+	ret := S_quest{F_id: pg.Id, F_count: pg.Count, F_claimed: pg.Claimed}
+	if def := quest.Quest(pg.Id); def != nil {
+		ret.F_done = pg.Done(def)
+	}
+	return ret
+}
+
+func push_quest_progress(userid int32, progress []quest.Progress) {
+	ret := S_quest_list{F_quests: make([]S_quest, len(progress))}
+	for k := range progress {
+		ret.F_quests[k] = quest_info(&progress[k])
+	}
+	channels.SendTo(userid, packet.Pack(Code["quest_progress_notify"], ret, nil))
+}
+
+// 登陆时加载任务进度并触发登陆事件
+// 在会话锁内同步加载, 不会在会话结束释放之后才缓存进度
+func quest_login(userid int32) {
+	if _, err := quest.Get(userid); err != nil {
+		log.Error(err)
+		return
+	}
+	go events.Fire(events.EVENT_LOGIN, userid, 0, 1)
+}
+
+func quest_errcode(err error) int32 {
+	switch err {
+	case quest.ERROR_QUEST_NOT_FOUND:
+		return ERRCODE_QUEST_NOT_FOUND
+	case quest.ERROR_NOT_DONE:
+		return ERRCODE_QUEST_NOT_DONE
+	case quest.ERROR_CLAIMED:
+		return ERRCODE_QUEST_CLAIMED
+	}
+	return item_errcode(err)
+}
+
+//----------------------------------- 任务列表
+func P_quest_list_req(sess *Session, reader *packet.Packet) []byte {
+	j, err := quest.Get(sess.UserId)
+	if err != nil {
+		log.Error(err)
+		return error_ack("quest_ack", ERRCODE_INTERNAL, err)
+	}
+
+	progress := j.List(time.Now())
+	ret := S_quest_list{F_quests: make([]S_quest, len(progress))}
+	for k := range progress {
+		ret.F_quests[k] = quest_info(&progress[k])
+	}
+	return packet.Pack(Code["quest_list_ack"], ret, nil)
+}
+
+//----------------------------------- 领取任务奖励
+func P_quest_claim_req(sess *Session, reader *packet.Packet) []byte {
+	tbl, _ := PKT_auto_id(reader)
+	j, err := quest.Get(sess.UserId)
+	if err == nil {
+		_, err = j.Claim(tbl.F_id, time.Now())
+	}
+	if err != nil {
+		return error_ack("quest_ack", quest_errcode(err), err)
+	}
+	return error_ack("quest_ack", ERRCODE_SUCCEED, nil)
+}
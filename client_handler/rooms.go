@@ -0,0 +1,63 @@
+package client_handler
+
+import (
+	"game/ipc"
+	"game/misc/packet"
+	"game/rooms"
+	. "game/types"
+)
+
+func init_rooms() {
+	rooms.OnClosed = push_room_closed
+}
+
+// 房间关闭时通知关闭前的全部成员
+func push_room_closed(r *rooms.Room, members []int32, reason int) {
+	msg := packet.Pack(Code["room_closed_notify"], S_room_closed{F_room: r.Id, F_reason: int32(reason)}, nil)
+	for _, id := range members {
+		ipc.SendMessage(id, msg)
+	}
+}
+
+func room_errcode(err error) int32 {
+	switch err {
+	case rooms.ERROR_ROOM_NOT_FOUND, rooms.ERROR_ROOM_CLOSED:
+		return ERRCODE_ROOM_NOT_FOUND
+	case rooms.ERROR_ROOM_FULL:
+		return ERRCODE_ROOM_FULL
+	case rooms.ERROR_IN_OTHER_ROOM:
+		return ERRCODE_ROOM_OTHER
+	case rooms.ERROR_NOT_IN_ROOM, rooms.ERROR_NOT_MEMBER:
+		return ERRCODE_ROOM_NOT_IN
+	case rooms.ERROR_ROOM_BUSY:
+		return ERRCODE_ROOM_BUSY
+	}
+	return ERRCODE_INTERNAL
+}
+
+func room_ack(err error) []byte {
+	if err != nil {
+		return error_ack("room_ack", room_errcode(err), err)
+	}
+	return error_ack("room_ack", ERRCODE_SUCCEED, nil)
+}
+
+//----------------------------------- 加入房间
+func P_room_join_req(sess *Session, reader *packet.Packet) []byte {
+	tbl, _ := PKT_room_id(reader)
+	return room_ack(rooms.Join(tbl.F_room, sess.UserId))
+}
+
+//----------------------------------- 离开房间
+func P_room_leave_req(sess *Session, reader *packet.Packet) []byte {
+	return room_ack(rooms.Leave(sess.UserId))
+}
+
+//----------------------------------- 房间内输入, 成功时不回复
+func P_room_input_req(sess *Session, reader *packet.Packet) []byte {
+	tbl, _ := PKT_room_input(reader)
+	if err := rooms.Input(sess.UserId, tbl.F_data); err != nil {
+		return room_ack(err)
+	}
+	return nil
+}
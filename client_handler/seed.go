@@ -0,0 +1,41 @@
+package client_handler
+
+import (
+	"game/misc/crypto/dh"
+	"game/misc/packet"
+	. "game/types"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// 通信加密的密钥随get_seed_ack的帧的Metadata交给agent, agent发出该回复后切换流加密
+const (
+	METADATA_ENCRYPT_KEY = "encrypt_key" // 发往客户端方向
+	METADATA_DECRYPT_KEY = "decrypt_key" // 客户端发来方向
+)
+
+//----------------------------------- 交换加密种子, 每个会话只能协商一次, 失败时断开
+func P_get_seed_req(sess *Session, reader *packet.Packet) []byte {
+	tbl, _ := PKT_seed_info(reader)
+	if sess.Flag&SESS_ENCRYPTED != 0 {
+		log.Warn("seed already negotiated:", sess.UserId)
+		sess.Flag |= SESS_KICKED_OUT
+		return nil
+	}
+
+	send, receive, keys, err := dh.Negotiate(tbl.F_client_send_seed, tbl.F_client_receive_seed)
+	if err != nil {
+		log.Warn("seed negotiation failed:", sess.UserId, err)
+		sess.Flag |= SESS_KICKED_OUT
+		return nil
+	}
+
+	sess.Flag |= SESS_ENCRYPTED
+	sess.EncryptKey = keys.Encrypt
+	sess.DecryptKey = keys.Decrypt
+	sess.Metadata = map[string]string{
+		METADATA_ENCRYPT_KEY: string(keys.Encrypt),
+		METADATA_DECRYPT_KEY: string(keys.Decrypt),
+	}
+	return packet.Pack(Code["get_seed_ack"], S_seed_info{F_client_send_seed: send, F_client_receive_seed: receive}, nil)
+}
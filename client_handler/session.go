@@ -0,0 +1,85 @@
+package client_handler
+
+import (
+	"sync"
+
+	"game/channels"
+	"game/chat"
+	"game/inventory"
+	"game/matchmaking"
+	"game/misc/locks"
+	"game/presence"
+	"game/quest"
+	"game/repository"
+	"game/rooms"
+	. "game/types"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// 本实例上每个玩家当前会话的token
+// 重连时旧连接的会话结束可能晚于新会话开始, 而各模块的清理都以userid为键, 只有当前会话结束时才清理
+var _sessions = struct {
+	tokens map[int32]int64
+	next   int64
+	sync.Mutex
+}{tokens: make(map[int32]int64)}
+
+var _session_locks locks.UserLocks // 同一玩家的会话开始和结束串行执行
+
+// 分配会话token, 返回的token成为该玩家的当前会话
+func session_begin(userid int32) int64 {
+	_sessions.Lock()
+	defer _sessions.Unlock()
+	_sessions.next++
+	_sessions.tokens[userid] = _sessions.next
+	return _sessions.next
+}
+
+// 结束会话, 返回是否是当前会话
+func session_end(userid int32, token int64) bool {
+	_sessions.Lock()
+	defer _sessions.Unlock()
+	if _sessions.tokens[userid] != token {
+		return false
+	}
+	delete(_sessions.tokens, userid)
+	return true
+}
+
+// 会话开始, 在玩家注册到registry之后调用
+func OnSessionStart(sess *Session) {
+	lock := _session_locks.Of(sess.UserId)
+	lock.Lock()
+	defer lock.Unlock()
+
+	sess.Token = session_begin(sess.UserId)
+	presence.Login(sess.UserId)
+	channels.Join(chat.WORLD_CHANNEL, sess.UserId)
+	quest_login(sess.UserId)
+	go mail_login(sess.UserId)
+	go friends_notify_status(sess.UserId, true)
+	go guild_login(sess.UserId)
+	go party_login(sess.UserId)
+}
+
+// 会话结束, 在玩家从registry注销之前调用; 玩家已经在新会话中重连时不清理
+func OnSessionEnd(sess *Session) {
+	lock := _session_locks.Of(sess.UserId)
+	lock.Lock()
+	defer lock.Unlock()
+
+	if !session_end(sess.UserId, sess.Token) {
+		log.Debug("stale session end, skip cleanup:", sess.UserId, sess.Token)
+		return
+	}
+	channels.LeaveAll(sess.UserId)
+	chat.Logout(sess.UserId)
+	matchmaking.Cancel(sess.UserId)
+	rooms.Leave(sess.UserId)
+	inventory.Release(sess.UserId)
+	quest.Release(sess.UserId)
+	repository.Release(sess.UserId)
+	go friends_notify_status(sess.UserId, false)
+	presence.Logout(sess.UserId)
+}
@@ -0,0 +1,193 @@
+package client_handler
+
+import (
+	"strconv"
+	"time"
+
+	"game/cron"
+	"game/currency"
+	"game/inventory"
+	"game/mail"
+	"game/misc/packet"
+	"game/numbers"
+	"game/shop"
+	. "game/types"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// 商店数值表(ShopCfg):
+// KEY_Shops 第一列为商店id, Refresh(限购刷新的cron表达式, 空为不刷新) Timezone
+// KEY_Goods 第一列为商品id, Shop Type Id Count PriceType PriceId Price Limit Start End
+// Start End为限时商品的开始和结束时间(商店时区), 格式为2006-01-02 15:04:05, 空为不限
+const (
+	NUMBERS_SHOP     = "ShopCfg"
+	SHOP_TIME_LAYOUT = "2006-01-02 15:04:05"
+)
+
+func init() {
+	register_numbers(NUMBERS_SHOP, load_shop_config)
+}
+
+func init_shop() {
+	shop.Init(&DefaultDatabase)
+	shop.Pay = pay_shop
+	shop.Grant = grant_shop
+	shop.Refund = refund_shop
+}
+
+func load_shop_config(ns numbers.NumbersOp) {
+	const shops, goods = "KEY_Shops", "KEY_Goods"
+	if !ns.IsTableExists(shops) || !ns.IsTableExists(goods) {
+		log.Error("shop config: missing KEY_Shops or KEY_Goods")
+		return
+	}
+
+	m := make(map[int32]*shop.Shop)
+	locs := make(map[int32]*time.Location)
+	var ids []int32
+	for _, key := range ns.GetKeys(shops) {
+		id, err := strconv.Atoi(key)
+		if err != nil {
+			log.Error("shop config: invalid shop:", key)
+			continue
+		}
+		loc := time.Local
+		if tz := ns.GetString(shops, key, "Timezone"); tz != "" {
+			if loc, err = time.LoadLocation(tz); err != nil {
+				log.Error("shop config: invalid timezone, shop:", key, err)
+				continue
+			}
+		}
+		s := &shop.Shop{Id: int32(id)}
+		if spec := ns.GetString(shops, key, "Refresh"); spec != "" {
+			if s.Schedule, err = cron.Parse(spec, loc); err != nil {
+				log.Error("shop config: invalid refresh, shop:", key, err)
+				continue
+			}
+		}
+		m[s.Id] = s
+		locs[s.Id] = loc
+		ids = append(ids, s.Id)
+	}
+
+	for _, key := range ns.GetKeys(goods) {
+		id, err := strconv.Atoi(key)
+		if err != nil {
+			log.Error("shop config: invalid goods:", key)
+			continue
+		}
+		g := &shop.Goods{
+			Id:    int32(id),
+			Shop:  ns.GetInt(goods, key, "Shop"),
+			Item:  mail.Attachment{Type: ns.GetInt(goods, key, "Type"), Id: ns.GetInt(goods, key, "Id"), Count: ns.GetInt(goods, key, "Count")},
+			Price: mail.Attachment{Type: ns.GetInt(goods, key, "PriceType"), Id: ns.GetInt(goods, key, "PriceId"), Count: ns.GetInt(goods, key, "Price")},
+		}
+		s := m[g.Shop]
+		if s == nil {
+			log.Error("shop config: goods of unknown shop:", key)
+			continue
+		}
+		if ns.IsFieldExists(goods, key, "Limit") {
+			g.Limit = ns.GetInt(goods, key, "Limit")
+		}
+		if g.Item.Count <= 0 || g.Price.Count <= 0 || validate_attachment(&g.Item) != nil || validate_attachment(&g.Price) != nil {
+			log.Error("shop config: invalid item or price, goods:", key)
+			continue
+		}
+		if g.Start, err = shop_time(ns.GetString(goods, key, "Start"), locs[g.Shop]); err != nil {
+			log.Error("shop config: invalid start, goods:", key, err)
+			continue
+		}
+		if g.End, err = shop_time(ns.GetString(goods, key, "End"), locs[g.Shop]); err != nil {
+			log.Error("shop config: invalid end, goods:", key, err)
+			continue
+		}
+		s.Goods = append(s.Goods, g)
+	}
+
+	list := make([]*shop.Shop, 0, len(ids))
+	for _, id := range ids {
+		list = append(list, m[id])
+	}
+	shop.SetDefs(list)
+	log.Infof("shop config loaded, shops:%v", len(list))
+}
+
+func shop_time(value string, loc *time.Location) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	return time.ParseInLocation(SHOP_TIME_LAYOUT, value, loc)
+}
+
+func pay_shop(userid int32, price mail.Attachment) error {
+	return pay(userid, price, inventory.REASON_SHOP)
+}
+
+func grant_shop(userid int32, item mail.Attachment) error {
+	return grant(userid, []mail.Attachment{item}, inventory.REASON_SHOP, "")
+}
+
+func refund_shop(userid int32, price mail.Attachment) error {
+	return grant(userid, []mail.Attachment{price}, inventory.REASON_SHOP, "")
+}
+
+func shop_goods(item *shop.Item) S_shop_goods {
+	ret := S_shop_goods{
+		F_id:         item.Id,
+		F_type:       item.Item.Type,
+		F_item:       item.Item.Id,
+		F_count:      item.Item.Count,
+		F_price_type: item.Price.Type,
+		F_price_id:   item.Price.Id,
+		F_price:      item.Price.Count,
+		F_limit:      item.Limit,
+		F_bought:     item.Bought,
+	}
+	if !item.End.IsZero() {
+		ret.F_end = item.End.Unix()
+	}
+	return ret
+}
+
+func shop_errcode(err error) int32 {
+	switch err {
+	case shop.ERROR_GOODS_NOT_FOUND:
+		return ERRCODE_SHOP_GOODS
+	case shop.ERROR_LIMIT:
+		return ERRCODE_SHOP_LIMIT
+	case shop.ERROR_CLOSED:
+		return ERRCODE_SHOP_CLOSED
+	case shop.ERROR_PAY, inventory.ERROR_NOT_ENOUGH, currency.ERROR_NOT_ENOUGH, mail.ERROR_INVALID_ATTACH:
+		return ERRCODE_SHOP_PAY
+	case shop.ERROR_INVALID_COUNT:
+		return ERRCODE_INVALID_PARAM
+	}
+	return item_errcode(err)
+}
+
+//----------------------------------- 商品列表
+func P_shop_list_req(sess *Session, reader *packet.Packet) []byte {
+	tbl, _ := PKT_shop_id(reader)
+	items, refresh, err := shop.List(sess.UserId, tbl.F_shop, time.Now())
+	if err != nil {
+		return error_ack("shop_ack", shop_errcode(err), err)
+	}
+
+	ret := S_shop{F_shop: tbl.F_shop, F_refresh: refresh, F_goods: make([]S_shop_goods, len(items))}
+	for k := range items {
+		ret.F_goods[k] = shop_goods(&items[k])
+	}
+	return packet.Pack(Code["shop_list_ack"], ret, nil)
+}
+
+//----------------------------------- 购买商品
+func P_shop_buy_req(sess *Session, reader *packet.Packet) []byte {
+	tbl, _ := PKT_shop_buy(reader)
+	item, err := shop.Buy(sess.UserId, tbl.F_goods, tbl.F_count, time.Now())
+	if err != nil {
+		return error_ack("shop_ack", shop_errcode(err), err)
+	}
+	return packet.Pack(Code["shop_buy_ack"], shop_goods(item), nil)
+}
@@ -0,0 +1,118 @@
+package client_handler
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+
+	"game/aoi"
+	"game/misc/packet"
+	"game/numbers"
+	"game/rooms"
+	. "game/types"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// 开放世界数值表(WorldCfg):
+// KEY_Maps 第一列为地图id, Width Height Cell(视野半径) Speed(每秒最大移动距离, 0为不限制)
+// 每张地图在本实例上有一个房间实例, 第一个玩家进入时创建, 无人时按房间的空闲超时关闭
+const (
+	NUMBERS_WORLD = "WorldCfg"
+)
+
+var (
+	ERROR_MAP_NOT_FOUND = errors.New("map not found")
+)
+
+type world_def struct {
+	width, height, cell float32
+	speed               float32
+}
+
+var (
+	_world_defs = make(map[int32]world_def)
+	_worlds     = make(map[int32]*rooms.Room) // 地图id -> 房间
+	_worlds_m   sync.Mutex
+)
+
+func init() {
+	register_numbers(NUMBERS_WORLD, load_world_config)
+}
+
+func load_world_config(ns numbers.NumbersOp) {
+	const maps = "KEY_Maps"
+	if !ns.IsTableExists(maps) {
+		log.Error("world config: missing KEY_Maps")
+		return
+	}
+
+	defs := make(map[int32]world_def)
+	for _, key := range ns.GetKeys(maps) {
+		id, err := strconv.Atoi(key)
+		if err != nil {
+			log.Error("world config: invalid map:", key)
+			continue
+		}
+		def := world_def{width: float32(ns.GetFloat(maps, key, "Width")), height: float32(ns.GetFloat(maps, key, "Height")), cell: float32(ns.GetFloat(maps, key, "Cell"))}
+		def.speed = float32(ns.GetFloat(maps, key, "Speed"))
+		if def.width <= 0 || def.height <= 0 || def.cell <= 0 || def.speed < 0 {
+			log.Error("world config: invalid size, map:", key)
+			continue
+		}
+		defs[int32(id)] = def
+	}
+
+	// 已创建的地图实例不受影响
+	_worlds_m.Lock()
+	_world_defs = defs
+	_worlds_m.Unlock()
+	log.Infof("world config loaded, maps:%v", len(defs))
+}
+
+// 地图实例, 不存在或已关闭时创建
+func world_room(id int32) (*rooms.Room, error) {
+	_worlds_m.Lock()
+	defer _worlds_m.Unlock()
+	if r := _worlds[id]; r != nil {
+		select {
+		case <-r.Done():
+		default:
+			return r, nil
+		}
+	}
+
+	def, ok := _world_defs[id]
+	if !ok {
+		return nil, ERROR_MAP_NOT_FOUND
+	}
+	cfg := rooms.DefaultConfig()
+	cfg.MaxMembers = 0
+	cfg.MaxLifetime = 0
+	w := aoi.New(def.width, def.height, def.cell, pack_aoi_events)
+	w.MaxSpeed = def.speed
+	r := rooms.Create(cfg, w)
+	_worlds[id] = r
+	return r, nil
+}
+
+func pack_aoi_events(events []aoi.Event) []byte {
+	ret := S_aoi_events{F_events: make([]S_aoi_event, len(events))}
+	for k, ev := range events {
+		ret.F_events[k] = S_aoi_event{F_type: ev.Type, F_id: ev.Id, F_x: ev.X, F_y: ev.Y, F_state: ev.State}
+	}
+	return packet.Pack(Code["aoi_events_notify"], ret, nil)
+}
+
+//----------------------------------- 进入开放世界地图
+func P_world_enter_req(sess *Session, reader *packet.Packet) []byte {
+	tbl, _ := PKT_world_enter(reader)
+	r, err := world_room(tbl.F_map)
+	if err == ERROR_MAP_NOT_FOUND {
+		return error_ack("room_ack", ERRCODE_ROOM_NOT_FOUND, err)
+	}
+	if err := rooms.Join(r.Id, sess.UserId); err != nil {
+		return room_ack(err)
+	}
+	return packet.Pack(Code["world_enter_ack"], S_world{F_map: tbl.F_map, F_room: r.Id}, nil)
+}
@@ -0,0 +1,235 @@
+package cron
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"game/db"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// 全服定时任务:
+// 任务用cron表达式和时区描述执行时间, 集群中只有leader实例执行(IsLeader, 由election设置),
+// 单机模式下IsLeader为nil, 本实例总是执行.
+// 每次执行前把计划时间写入COLLECTION_RUNS, 执行后写入结果, 同时在COLLECTION_HISTORY保留执行记录.
+// 成为leader时从COLLECTION_RUNS读取上次执行的计划时间, 期间错过的执行合并为一次补执行(catchup为true时).
+// 执行前先写记录, 因此leader在执行中途崩溃时新leader不会重复执行, 任务最多执行一次.
+const (
+	COLLECTION_RUNS    = "cron_runs"
+	COLLECTION_HISTORY = "cron_history"
+
+	TICK_INTERVAL = time.Second
+)
+
+var (
+	ERROR_JOB_EXISTS = errors.New("cron job already exists")
+)
+
+var (
+	// IsLeader 本实例是否为leader, nil表示单机
+	IsLeader func() bool
+)
+
+// 执行记录
+type Run struct {
+	Name      string `bson:"_id"`
+	Scheduled int64  `bson:"scheduled"` // 计划执行时间
+	Instance  string `bson:"instance"`
+	Start     int64  `bson:"start"`
+	Finish    int64  `bson:"finish"` // 0表示未完成
+	Error     string `bson:"error,omitempty"`
+}
+
+type job struct {
+	name     string
+	schedule *Schedule
+	catchup  bool
+	run      func(scheduled time.Time) error
+	next     time.Time // 下一次执行时间, 零值表示不再执行
+	running  bool
+}
+
+type scheduler struct {
+	db         *db.Database
+	instanceId string
+	jobs       map[string]*job
+	leader     bool
+	sync.Mutex
+}
+
+var _default_scheduler = scheduler{jobs: make(map[string]*job)}
+
+// Init 开始调度
+func Init(database *db.Database, instanceId string) {
+	_default_scheduler.init(database, instanceId)
+	go _default_scheduler.loop()
+}
+
+func (s *scheduler) init(database *db.Database, instanceId string) {
+	s.Lock()
+	s.db = database
+	s.instanceId = instanceId
+	s.Unlock()
+}
+
+// Add 添加任务, tz为时区名(如Asia/Shanghai), 为空时使用本地时区;
+// catchup为true时, 错过的执行(停服, leader切换)会补执行一次
+func Add(name, spec, tz string, catchup bool, run func(scheduled time.Time) error) error {
+	return _default_scheduler.add(name, spec, tz, catchup, run)
+}
+
+// Remove 删除任务, 正在进行的执行不受影响
+func Remove(name string) {
+	_default_scheduler.Lock()
+	delete(_default_scheduler.jobs, name)
+	_default_scheduler.Unlock()
+}
+
+// Next 任务的下一次执行时间, 只在leader上有意义
+func Next(name string) time.Time {
+	_default_scheduler.Lock()
+	defer _default_scheduler.Unlock()
+	if j, ok := _default_scheduler.jobs[name]; ok {
+		return j.next
+	}
+	return time.Time{}
+}
+
+// Last 任务最近一次执行的记录
+func Last(name string) (*Run, error) {
+	r := &Run{}
+	if err := _default_scheduler.db.Load(COLLECTION_RUNS, name, r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (s *scheduler) add(name, spec, tz string, catchup bool, run func(time.Time) error) error {
+	loc := time.Local
+	if tz != "" {
+		var err error
+		if loc, err = time.LoadLocation(tz); err != nil {
+			return err
+		}
+	}
+	schedule, err := Parse(spec, loc)
+	if err != nil {
+		return err
+	}
+
+	s.Lock()
+	defer s.Unlock()
+	if _, ok := s.jobs[name]; ok {
+		return ERROR_JOB_EXISTS
+	}
+	j := &job{name: name, schedule: schedule, catchup: catchup, run: run}
+	if s.leader {
+		s.reload(j, time.Now())
+	}
+	s.jobs[name] = j
+	return nil
+}
+
+func (s *scheduler) loop() {
+	for now := range time.Tick(TICK_INTERVAL) {
+		s.tick(now)
+	}
+}
+
+func (s *scheduler) tick(now time.Time) {
+	leader := IsLeader == nil || IsLeader()
+
+	s.Lock()
+	defer s.Unlock()
+	if !leader {
+		if s.leader {
+			log.Info("cron: lost leadership")
+		}
+		s.leader = false
+		return
+	}
+	if !s.leader { // 刚成为leader, 其他实例可能已执行过, 从记录恢复
+		log.Info("cron: became leader")
+		s.leader = true
+		for _, j := range s.jobs {
+			s.reload(j, now)
+		}
+	}
+
+	for _, j := range s.jobs {
+		if j.running || j.next.IsZero() || now.Before(j.next) {
+			continue
+		}
+		// 错过的多次执行合并为最近的一次
+		scheduled := j.next
+		for {
+			t := j.schedule.Next(scheduled)
+			if t.IsZero() || t.After(now) {
+				break
+			}
+			scheduled = t
+		}
+		j.next = j.schedule.Next(now)
+		j.running = true
+		go s.execute(j, scheduled)
+	}
+}
+
+// 根据上次执行的计划时间计算下一次执行时间
+func (s *scheduler) reload(j *job, now time.Time) {
+	j.next = j.schedule.Next(now)
+	if !j.catchup {
+		return
+	}
+	r := &Run{}
+	if err := s.db.Load(COLLECTION_RUNS, j.name, r); err == nil {
+		if t := j.schedule.Next(time.Unix(r.Scheduled, 0)); !t.IsZero() && t.Before(j.next) {
+			j.next = t
+		}
+	} else if err != db.ERROR_NOT_FOUND {
+		log.Errorf("cron: load run failed, job:%v err:%v", j.name, err)
+	}
+}
+
+func (s *scheduler) execute(j *job, scheduled time.Time) {
+	defer func() {
+		s.Lock()
+		j.running = false
+		s.Unlock()
+	}()
+
+	r := &Run{Name: j.name, Scheduled: scheduled.Unix(), Instance: s.instanceId, Start: time.Now().Unix()}
+	if err := s.db.Save(COLLECTION_RUNS, j.name, r); err != nil {
+		// 无法记录时不执行, 避免新leader重复执行
+		log.Errorf("cron: save run failed, job:%v err:%v", j.name, err)
+		return
+	}
+	log.Infof("cron: run job:%v scheduled:%v", j.name, scheduled)
+	err := safe_run(j.run, scheduled)
+
+	r.Finish = time.Now().Unix()
+	if err != nil {
+		r.Error = err.Error()
+		log.Errorf("cron: job failed, job:%v scheduled:%v err:%v", j.name, scheduled, err)
+	}
+	if err := s.db.Save(COLLECTION_RUNS, j.name, r); err != nil {
+		log.Errorf("cron: save run failed, job:%v err:%v", j.name, err)
+	}
+	history := *r
+	history.Name = fmt.Sprintf("%v:%v", j.name, r.Scheduled)
+	if err := s.db.Save(COLLECTION_HISTORY, history.Name, &history); err != nil {
+		log.Errorf("cron: save history failed, job:%v err:%v", j.name, err)
+	}
+}
+
+func safe_run(run func(time.Time) error, scheduled time.Time) (err error) {
+	defer func() {
+		if x := recover(); x != nil {
+			err = fmt.Errorf("panic: %v", x)
+		}
+	}()
+	return run(scheduled)
+}
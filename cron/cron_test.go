@@ -0,0 +1,164 @@
+package cron
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"game/db"
+)
+
+func TestNext(t *testing.T) {
+	shanghai, err := time.LoadLocation("Asia/Shanghai")
+	if err != nil {
+		t.Skip(err)
+	}
+	from := time.Date(2026, 1, 30, 23, 59, 30, 0, shanghai) // 周五
+	cases := []struct {
+		spec   string
+		expect time.Time
+	}{
+		{"* * * * *", time.Date(2026, 1, 31, 0, 0, 0, 0, shanghai)},
+		{"0 5 * * *", time.Date(2026, 1, 31, 5, 0, 0, 0, shanghai)},
+		{"*/15 9-10 * * *", time.Date(2026, 1, 31, 9, 0, 0, 0, shanghai)},
+		{"0 0 * * 1", time.Date(2026, 2, 2, 0, 0, 0, 0, shanghai)},
+		{"0 0 * * 7", time.Date(2026, 2, 1, 0, 0, 0, 0, shanghai)},
+		{"30 12 29 2 *", time.Date(2028, 2, 29, 12, 30, 0, 0, shanghai)},
+		{"0 0 1 * 1", time.Date(2026, 2, 1, 0, 0, 0, 0, shanghai)}, // 日和周满足其一
+		{"0 8 1,15 */3 *", time.Date(2026, 4, 1, 8, 0, 0, 0, shanghai)},
+	}
+	for _, c := range cases {
+		s, err := Parse(c.spec, shanghai)
+		if err != nil {
+			t.Fatal(c.spec, err)
+		}
+		if next := s.Next(from); !next.Equal(c.expect) {
+			t.Fatal("unexpected next:", c.spec, next, c.expect)
+		}
+	}
+
+	// 同一时刻在不同时区
+	s, _ := Parse("0 5 * * *", time.UTC)
+	if next := s.Next(from); !next.Equal(time.Date(2026, 1, 31, 5, 0, 0, 0, time.UTC)) {
+		t.Fatal("unexpected utc next:", next)
+	}
+
+	for _, spec := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "0 0 0 * *", "*/0 * * * *", "a * * * *", "5-1 * * * *"} {
+		if _, err := Parse(spec, nil); err == nil {
+			t.Fatal("invalid spec accepted:", spec)
+		}
+	}
+}
+
+func TestNextZones(t *testing.T) {
+	// 半小时时区
+	kolkata := time.FixedZone("IST", 5*3600+1800)
+	s, _ := Parse("0 12 * * *", kolkata)
+	from := time.Date(2026, 1, 30, 8, 10, 0, 0, kolkata)
+	if next := s.Next(from); !next.Equal(time.Date(2026, 1, 30, 12, 0, 0, 0, kolkata)) {
+		t.Fatal("unexpected half-hour zone next:", next)
+	}
+
+	// 夏令时, 2026-03-08 02:00跳到03:00, 2026-11-01 02:00回到01:00
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip(err)
+	}
+	cases := []struct {
+		spec   string
+		from   time.Time
+		expect time.Time
+	}{
+		{"0 * * * *", time.Date(2026, 3, 8, 1, 30, 0, 0, ny), time.Date(2026, 3, 8, 3, 0, 0, 0, ny)},
+		{"0 3 * * *", time.Date(2026, 3, 8, 0, 0, 0, 0, ny), time.Date(2026, 3, 8, 3, 0, 0, 0, ny)},
+		{"30 2 * * *", time.Date(2026, 3, 8, 0, 0, 0, 0, ny), time.Date(2026, 3, 9, 2, 30, 0, 0, ny)}, // 不存在的时刻跳过
+		{"0 4 * * *", time.Date(2026, 10, 31, 23, 0, 0, 0, ny), time.Date(2026, 11, 1, 4, 0, 0, 0, ny)},
+	}
+	for _, c := range cases {
+		s, _ := Parse(c.spec, ny)
+		if next := s.Next(c.from); !next.Equal(c.expect) {
+			t.Fatal("unexpected dst next:", c.spec, next, c.expect)
+		}
+	}
+
+	// 回拨的一小时内按绝对时间前进
+	s, _ = Parse("0 * * * *", ny)
+	first := time.Date(2026, 11, 1, 0, 30, 0, 0, ny)
+	next := s.Next(first)
+	if next.Hour() != 1 || !next.After(first) {
+		t.Fatal("unexpected fall back next:", next)
+	}
+	if after := s.Next(next); !after.After(next) || after.Sub(next) > 2*time.Hour {
+		t.Fatal("unexpected fall back next:", after)
+	}
+}
+
+func TestCatchUp(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cron")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var database db.Database
+	database.InitLocal(dir)
+	s := &scheduler{jobs: make(map[string]*job)}
+	s.init(&database, "game1")
+
+	runs := make(chan time.Time, 10)
+	run := func(scheduled time.Time) error {
+		runs <- scheduled
+		return nil
+	}
+	wait := func() time.Time {
+		select {
+		case t := <-runs:
+			for i := 0; i < 100; i++ {
+				s.Lock()
+				running := s.jobs["daily"].running
+				s.Unlock()
+				if !running {
+					break
+				}
+				time.Sleep(time.Millisecond)
+			}
+			return t
+		case <-time.After(time.Second):
+			return time.Time{}
+		}
+	}
+	if err := s.add("daily", "0 5 * * *", "UTC", true, run); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.add("daily", "0 5 * * *", "UTC", true, run); err != ERROR_JOB_EXISTS {
+		t.Fatal("duplicated job:", err)
+	}
+
+	// 成为leader时没有记录, 从当前时间开始
+	day := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	s.tick(day.Add(4 * time.Hour))
+	s.tick(day.Add(5 * time.Hour))
+	if got := wait(); !got.Equal(day.Add(5 * time.Hour)) {
+		t.Fatal("unexpected run:", got)
+	}
+
+	// 失去leader期间错过三天, 重新成为leader后只补执行最近的一次
+	IsLeader = func() bool { return false }
+	s.tick(day.Add(30 * time.Hour))
+	IsLeader = nil
+	defer func() { IsLeader = nil }()
+	s.tick(day.Add(4*24*time.Hour + time.Hour))
+	if got := wait(); !got.Equal(day.Add(3*24*time.Hour + 5*time.Hour)) {
+		t.Fatal("unexpected catch up:", got)
+	}
+	s.tick(day.Add(4*24*time.Hour + 2*time.Hour))
+	if got := wait(); !got.IsZero() {
+		t.Fatal("run twice:", got)
+	}
+
+	r := &Run{}
+	if err := database.Load(COLLECTION_RUNS, "daily", r); err != nil || r.Scheduled != day.Add(3*24*time.Hour+5*time.Hour).Unix() || r.Finish == 0 || r.Instance != "game1" {
+		t.Fatal("unexpected record:", err, r)
+	}
+}
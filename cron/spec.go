@@ -0,0 +1,158 @@
+package cron
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cron表达式: 分 时 日 月 周, 每个字段支持 * a a-b a,b */n a-b/n, 周日为0或7
+// 日和周都不是*时, 满足其一即可, 与标准cron一致
+var (
+	ERROR_INVALID_SPEC = errors.New("invalid cron spec")
+)
+
+const (
+	MAX_SEARCH_YEARS = 5 // 查找下一次时间的范围
+)
+
+type Schedule struct {
+	minute, hour, dom, month, dow uint64 // 位图
+	dom_any, dow_any              bool
+	loc                           *time.Location
+}
+
+type bounds struct {
+	min, max int
+}
+
+var (
+	_minutes = bounds{0, 59}
+	_hours   = bounds{0, 23}
+	_doms    = bounds{1, 31}
+	_months  = bounds{1, 12}
+	_dows    = bounds{0, 7}
+)
+
+// Parse 解析cron表达式, loc为nil时使用本地时区
+func Parse(spec string, loc *time.Location) (*Schedule, error) {
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, ERROR_INVALID_SPEC
+	}
+	if loc == nil {
+		loc = time.Local
+	}
+
+	s := &Schedule{loc: loc, dom_any: fields[2] == "*", dow_any: fields[4] == "*"}
+	var err error
+	if s.minute, err = parse_field(fields[0], _minutes); err != nil {
+		return nil, err
+	}
+	if s.hour, err = parse_field(fields[1], _hours); err != nil {
+		return nil, err
+	}
+	if s.dom, err = parse_field(fields[2], _doms); err != nil {
+		return nil, err
+	}
+	if s.month, err = parse_field(fields[3], _months); err != nil {
+		return nil, err
+	}
+	if s.dow, err = parse_field(fields[4], _dows); err != nil {
+		return nil, err
+	}
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+	return s, nil
+}
+
+func parse_field(field string, b bounds) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("%v: %v", ERROR_INVALID_SPEC, field)
+			}
+			step = n
+			part = part[:i]
+		}
+
+		lo, hi := b.min, b.max
+		switch {
+		case part == "*":
+		case strings.Contains(part, "-"):
+			rng := strings.SplitN(part, "-", 2)
+			var err1, err2 error
+			lo, err1 = strconv.Atoi(rng[0])
+			hi, err2 = strconv.Atoi(rng[1])
+			if err1 != nil || err2 != nil {
+				return 0, fmt.Errorf("%v: %v", ERROR_INVALID_SPEC, field)
+			}
+		default:
+			n, err := strconv.Atoi(part)
+			if err != nil {
+				return 0, fmt.Errorf("%v: %v", ERROR_INVALID_SPEC, field)
+			}
+			lo, hi = n, n
+			if step > 1 {
+				hi = b.max
+			}
+		}
+		if lo < b.min || hi > b.max || lo > hi {
+			return 0, fmt.Errorf("%v: %v", ERROR_INVALID_SPEC, field)
+		}
+		for i := lo; i <= hi; i += step {
+			bits |= 1 << uint(i)
+		}
+	}
+	return bits, nil
+}
+
+func (s *Schedule) day_match(t time.Time) bool {
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.dom_any || s.dow_any {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// Next 严格晚于t的下一次触发时间, 找不到时返回零值
+func (s *Schedule) Next(t time.Time) time.Time {
+	t = t.In(s.loc).Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(MAX_SEARCH_YEARS, 0, 0)
+	for t.Before(limit) {
+		if s.month&(1<<uint(t.Month())) == 0 {
+			t = forward(t, time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, s.loc))
+			continue
+		}
+		if !s.day_match(t) {
+			t = forward(t, time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, s.loc))
+			continue
+		}
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			// 按本地时间进位, Truncate按UTC取整, 在半小时时区会落在:30
+			t = forward(t, time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, s.loc))
+			continue
+		}
+		if s.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+// 夏令时跳过的本地时间, time.Date会回退到跳过前, 按整小时前进到t之后
+func forward(t, next time.Time) time.Time {
+	for !next.After(t) {
+		next = next.Add(time.Hour)
+	}
+	return next
+}
@@ -0,0 +1,403 @@
+package currency
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"game/db"
+	"game/kafka"
+	"game/misc/locks"
+
+	log "github.com/Sirupsen/logrus"
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// 货币账本:
+// 每次余额变化先写一条不可修改的流水到COLLECTION_LEDGER, 以"userid:seq"为_id, seq从1连续递增,
+// 再把余额和已应用的seq写入COLLECTION_BALANCES. 流水是余额的唯一依据:
+// 读取余额时如果发现seq之后还有流水(写入余额前崩溃), 先补应用这些流水.
+// 同一seq只能插入一次, 多个实例同时修改同一玩家时, 插入失败的一方重新读取后重试.
+//
+// 幂等: 调用方提供idempotency key时, 写流水前先以插入的方式在COLLECTION_LEDGER_KEYS抢占 key -> seq,
+// 多个实例同时处理同一个key时只有一个能插入, 其他的返回ERROR_CONFLICT, 不会重复写流水.
+// 重复请求时找到seq对应的流水且key一致, 即视为已应用, 返回当时的余额, 不再修改.
+// key指向的流水不存在或属于其他交易(写流水前崩溃), 超过KEY_TIMEOUT后可以被新的交易接管.
+const (
+	COLLECTION_BALANCES    = "balances"
+	COLLECTION_LEDGER      = "ledger"
+	COLLECTION_LEDGER_KEYS = "ledger_keys"
+
+	MAX_RETRY   = 3           // 并发冲突时的重试次数
+	KEY_TIMEOUT = time.Minute // 抢占了key但没有写入流水的交易, 超时后视为失败
+)
+
+var (
+	ERROR_INVALID_AMOUNT = errors.New("invalid currency amount")
+	ERROR_NOT_ENOUGH     = errors.New("currency not enough")
+	ERROR_KEY_CONFLICT   = errors.New("idempotency key used by another transaction")
+	ERROR_CONFLICT       = errors.New("ledger modified concurrently")
+)
+
+// 流水, 写入后不再修改
+type Record struct {
+	Id        string `bson:"_id"` // userid:seq
+	UserId    int32  `bson:"userid"`
+	Seq       int64  `bson:"seq"`
+	Currency  int32  `bson:"currency"`
+	Amount    int64  `bson:"amount"`  // 正为收入, 负为支出
+	Balance   int64  `bson:"balance"` // 交易后该货币的余额
+	Reason    string `bson:"reason"`
+	Key       string `bson:"key,omitempty"`
+	CreatedAt int64  `bson:"created_at"`
+}
+
+// 玩家的余额
+type account struct {
+	UserId   int32            `bson:"_id"`
+	Seq      int64            `bson:"seq"`      // 已应用的最后一条流水
+	Balances map[string]int64 `bson:"balances"` // 货币id -> 余额
+}
+
+type key_record struct {
+	Id        string `bson:"_id"` // userid:key
+	Seq       int64  `bson:"seq"`
+	Owner     string `bson:"owner"` // 抢占key的交易
+	CreatedAt int64  `bson:"created_at"`
+}
+
+var (
+	_db    *db.Database
+	_locks locks.UserLocks // 同一实例内同一玩家的交易串行执行
+
+	// OnChange 余额变化后调用(不含重复请求), 由上层设置, 用于推送和触发事件
+	OnChange func(r *Record)
+)
+
+func Init(database *db.Database) {
+	_db = database
+	if database.IsLocal() {
+		return
+	}
+	err := database.Execute(func(sess *mgo.Session) error {
+		return sess.DB("").C(COLLECTION_LEDGER).EnsureIndex(mgo.Index{Key: []string{"userid", "seq"}})
+	})
+	if err != nil {
+		log.Error(err)
+	}
+}
+
+func record_id(userid int32, seq int64) string {
+	return fmt.Sprintf("%v:%v", userid, seq)
+}
+
+func key_id(userid int32, key string) string {
+	return fmt.Sprintf("%v:%v", userid, key)
+}
+
+func lock(userid int32) *sync.Mutex {
+	return _locks.Of(userid)
+}
+
+// Credit 增加货币, key为幂等键, 为空时不检查重复; 返回交易后的余额
+func Credit(userid, currency int32, amount int64, reason, key string) (int64, error) {
+	if amount <= 0 {
+		return 0, ERROR_INVALID_AMOUNT
+	}
+	return apply(userid, currency, amount, reason, key)
+}
+
+// Debit 扣除货币, 余额不足时返回ERROR_NOT_ENOUGH; 返回交易后的余额
+func Debit(userid, currency int32, amount int64, reason, key string) (int64, error) {
+	if amount <= 0 {
+		return 0, ERROR_INVALID_AMOUNT
+	}
+	return apply(userid, currency, -amount, reason, key)
+}
+
+// 一种货币的数量
+type Amount struct {
+	Currency int32
+	Amount   int64
+}
+
+// CreditAll 增加多种货币, 全部成功或全部失败; key不为空时第k种以"key:k"为幂等键.
+// 失败时撤销已增加的货币: 没有幂等键的扣回; 有幂等键的保留, 调用方重试时是重复请求, 不会再次增加,
+// 扣回反而会让幂等记录指向已撤销的交易, 重试时什么都得不到
+func CreditAll(userid int32, amounts []Amount, reason, key string) error {
+	for k, a := range amounts {
+		if _, err := Credit(userid, a.Currency, a.Amount, reason, batch_key(key, k)); err != nil {
+			if key == "" {
+				for _, a := range amounts[:k] {
+					if _, err := Debit(userid, a.Currency, a.Amount, reason, ""); err != nil {
+						log.Error("currency: revert credit failed:", userid, a.Currency, a.Amount, err)
+					}
+				}
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+func batch_key(key string, k int) string {
+	if key == "" {
+		return ""
+	}
+	return fmt.Sprintf("%v:%v", key, k)
+}
+
+// Balance 一种货币的余额
+func Balance(userid, currency int32) (int64, error) {
+	m := lock(userid)
+	m.Lock()
+	defer m.Unlock()
+	a, err := load_account(userid)
+	if err != nil {
+		return 0, err
+	}
+	return a.Balances[strconv.Itoa(int(currency))], nil
+}
+
+// Balances 全部货币的余额
+func Balances(userid int32) (map[int32]int64, error) {
+	m := lock(userid)
+	m.Lock()
+	defer m.Unlock()
+	a, err := load_account(userid)
+	if err != nil {
+		return nil, err
+	}
+	ret := make(map[int32]int64, len(a.Balances))
+	for k, v := range a.Balances {
+		if id, err := strconv.Atoi(k); err == nil {
+			ret[int32(id)] = v
+		}
+	}
+	return ret, nil
+}
+
+func apply(userid, currency int32, amount int64, reason, key string) (int64, error) {
+	r, applied, err := transact(userid, currency, amount, reason, key)
+	if err != nil {
+		return 0, err
+	}
+	if applied && OnChange != nil { // 在锁外回调, 回调中可以再次修改余额
+		OnChange(r)
+	}
+	return r.Balance, nil
+}
+
+// 在锁内完成一次交易, applied为false表示重复请求
+func transact(userid, currency int32, amount int64, reason, key string) (r *Record, applied bool, err error) {
+	m := lock(userid)
+	m.Lock()
+	defer m.Unlock()
+
+	owner := bson.NewObjectId().Hex()
+	for i := 0; i < MAX_RETRY; i++ {
+		var a *account
+		if a, err = load_account(userid); err != nil {
+			return nil, false, err
+		}
+		if key != "" {
+			if r, err = find_key(userid, key); err != nil {
+				return nil, false, err
+			} else if r != nil {
+				return applied_key(r, currency, amount)
+			}
+		}
+
+		field := strconv.Itoa(int(currency))
+		balance := a.Balances[field] + amount
+		if balance < 0 {
+			return nil, false, ERROR_NOT_ENOUGH
+		}
+
+		seq := a.Seq + 1
+		if key != "" {
+			if r, err = claim_key(userid, key, seq, owner); err != nil {
+				return nil, false, err
+			} else if r != nil {
+				return applied_key(r, currency, amount)
+			}
+		}
+		r = &Record{
+			Id:        record_id(userid, seq),
+			UserId:    userid,
+			Seq:       seq,
+			Currency:  currency,
+			Amount:    amount,
+			Balance:   balance,
+			Reason:    reason,
+			Key:       key,
+			CreatedAt: time.Now().Unix(),
+		}
+		if err = insert(r); err == ERROR_CONFLICT {
+			continue
+		} else if err != nil {
+			return nil, false, err
+		}
+
+		prev := a.Seq
+		a.Balances[field] = balance
+		a.Seq = seq
+		if err := save_account(a, prev); err != nil {
+			// 流水已写入, 交易成功, 余额在下次读取时补应用
+			log.Errorf("currency: save balance failed, userid:%v seq:%v err:%v", userid, seq, err)
+		}
+
+		kafka.CommitUpdate(r.Id, r, COLLECTION_LEDGER)
+		kafka.TraceEvent("currency_change", userid, map[string]interface{}{
+			"seq":      r.Seq,
+			"currency": r.Currency,
+			"amount":   r.Amount,
+			"balance":  r.Balance,
+			"reason":   r.Reason,
+			"key":      r.Key,
+		})
+		return r, true, nil
+	}
+	return nil, false, ERROR_CONFLICT
+}
+
+// 重复请求, 参数必须与已应用的交易一致
+func applied_key(r *Record, currency int32, amount int64) (*Record, bool, error) {
+	if r.Currency != currency || r.Amount != amount {
+		return nil, false, ERROR_KEY_CONFLICT
+	}
+	return r, false, nil
+}
+
+// 抢占幂等键, 指向将要写入的seq; 已被其他交易应用时返回该流水,
+// 其他交易正在处理(未超时)或同时抢占时返回ERROR_CONFLICT
+func claim_key(userid int32, key string, seq int64, owner string) (*Record, error) {
+	id := key_id(userid, key)
+	kr := &key_record{Id: id, Seq: seq, Owner: owner, CreatedAt: time.Now().Unix()}
+	err := _db.Insert(COLLECTION_LEDGER_KEYS, id, kr)
+	if err != db.ERROR_DUPLICATED {
+		return nil, err
+	}
+
+	old := &key_record{}
+	if err := _db.Load(COLLECTION_LEDGER_KEYS, id, old); err != nil {
+		return nil, err
+	}
+	if old.Owner != owner {
+		if r, err := load_record(userid, old.Seq); err != nil {
+			return nil, err
+		} else if r != nil && r.Key == key {
+			return r, nil
+		}
+		if time.Since(time.Unix(old.CreatedAt, 0)) < KEY_TIMEOUT {
+			return nil, ERROR_CONFLICT
+		}
+		log.Warnf("currency: take over stale key, userid:%v key:%v seq:%v", userid, key, old.Seq)
+	}
+
+	// 本交易重试时指向新的seq, 或接管超时的key, 以原来的owner为条件
+	if _db.IsLocal() {
+		return nil, _db.Save(COLLECTION_LEDGER_KEYS, id, kr)
+	}
+	err = _db.Execute(func(sess *mgo.Session) error {
+		return sess.DB("").C(COLLECTION_LEDGER_KEYS).Update(bson.M{"_id": id, "owner": old.Owner}, kr)
+	})
+	if err == mgo.ErrNotFound {
+		return nil, ERROR_CONFLICT
+	}
+	return nil, err
+}
+
+// 幂等键对应的已应用流水, 未应用时返回nil
+func find_key(userid int32, key string) (*Record, error) {
+	kr := &key_record{}
+	if err := _db.Load(COLLECTION_LEDGER_KEYS, key_id(userid, key), kr); err == db.ERROR_NOT_FOUND {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	r, err := load_record(userid, kr.Seq)
+	if err != nil || r == nil || r.Key != key {
+		return nil, err
+	}
+	return r, nil
+}
+
+// 读取流水, 不存在时返回nil
+func load_record(userid int32, seq int64) (*Record, error) {
+	r := &Record{}
+	if err := _db.Load(COLLECTION_LEDGER, record_id(userid, seq), r); err == db.ERROR_NOT_FOUND {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// 插入流水, seq已存在时返回ERROR_CONFLICT
+func insert(r *Record) error {
+	if _db.IsLocal() {
+		if old, err := load_record(r.UserId, r.Seq); err != nil {
+			return err
+		} else if old != nil {
+			return ERROR_CONFLICT
+		}
+		return _db.Save(COLLECTION_LEDGER, r.Id, r)
+	}
+	err := _db.Execute(func(sess *mgo.Session) error {
+		return sess.DB("").C(COLLECTION_LEDGER).Insert(r)
+	})
+	if mgo.IsDup(err) {
+		return ERROR_CONFLICT
+	}
+	return err
+}
+
+// 读取余额, 并补应用已写入但未计入余额的流水
+func load_account(userid int32) (*account, error) {
+	a := &account{}
+	if err := _db.Load(COLLECTION_BALANCES, userid, a); err == db.ERROR_NOT_FOUND {
+		a = &account{UserId: userid}
+	} else if err != nil {
+		return nil, err
+	}
+	if a.Balances == nil {
+		a.Balances = make(map[string]int64)
+	}
+
+	prev := a.Seq
+	for {
+		r, err := load_record(userid, a.Seq+1)
+		if err != nil {
+			return nil, err
+		} else if r == nil {
+			break
+		}
+		a.Balances[strconv.Itoa(int(r.Currency))] += r.Amount
+		a.Seq = r.Seq
+	}
+	if a.Seq != prev {
+		log.Warnf("currency: recovered ledger, userid:%v seq:%v -> %v", userid, prev, a.Seq)
+		if err := save_account(a, prev); err != nil {
+			log.Error(err)
+		}
+	}
+	return a, nil
+}
+
+// 写入余额, 只在seq仍为prev时写入; 否则其他实例已写入更新的余额(并包含了本次流水), 忽略
+func save_account(a *account, prev int64) error {
+	if _db.IsLocal() {
+		return _db.Save(COLLECTION_BALANCES, a.UserId, a)
+	}
+	return _db.Execute(func(sess *mgo.Session) error {
+		_, err := sess.DB("").C(COLLECTION_BALANCES).Upsert(bson.M{"_id": a.UserId, "seq": prev}, a)
+		if mgo.IsDup(err) {
+			return nil
+		}
+		return err
+	})
+}
@@ -0,0 +1,139 @@
+package currency
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"game/db"
+	"game/kafka"
+)
+
+func init() {
+	kafka.InitDiscard()
+}
+
+func init_local(t *testing.T) func() {
+	dir, err := ioutil.TempDir("", "currency")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var database db.Database
+	database.InitLocal(dir)
+	Init(&database)
+	return func() { os.RemoveAll(dir) }
+}
+
+func TestLedger(t *testing.T) {
+	defer init_local(t)()
+
+	var changes []Record
+	OnChange = func(r *Record) { changes = append(changes, *r) }
+	defer func() { OnChange = nil }()
+
+	if b, err := Credit(1, 1, 100, "test", "order1"); err != nil || b != 100 {
+		t.Fatal("credit failed:", b, err)
+	}
+	// 重复请求不再修改余额
+	if b, err := Credit(1, 1, 100, "test", "order1"); err != nil || b != 100 {
+		t.Fatal("duplicated credit:", b, err)
+	}
+	if _, err := Credit(1, 1, 50, "test", "order1"); err != ERROR_KEY_CONFLICT {
+		t.Fatal("key conflict expected:", err)
+	}
+	if _, err := Debit(1, 1, 101, "test", ""); err != ERROR_NOT_ENOUGH {
+		t.Fatal("negative balance:", err)
+	}
+	if _, err := Debit(1, 1, 0, "test", ""); err != ERROR_INVALID_AMOUNT {
+		t.Fatal("zero amount:", err)
+	}
+	if b, err := Debit(1, 1, 30, "test", "buy1"); err != nil || b != 70 {
+		t.Fatal("debit failed:", b, err)
+	}
+	Credit(1, 2, 5, "test", "")
+	if len(changes) != 3 || changes[1].Amount != -30 || changes[1].Seq != 2 {
+		t.Fatal("unexpected changes:", changes)
+	}
+
+	balances, err := Balances(1)
+	if err != nil || balances[1] != 70 || balances[2] != 5 {
+		t.Fatal("unexpected balances:", balances, err)
+	}
+	if mm, err := Reconcile(1); err != nil || len(mm) != 0 {
+		t.Fatal("unexpected mismatch:", mm, err)
+	}
+}
+
+func TestRecover(t *testing.T) {
+	defer init_local(t)()
+	Credit(2, 1, 10, "test", "")
+
+	// 流水已写入但余额未写入(崩溃), 读取时补应用
+	r := &Record{Id: record_id(2, 2), UserId: 2, Seq: 2, Currency: 1, Amount: 5, Balance: 15, Key: "lost"}
+	if err := insert(r); err != nil {
+		t.Fatal(err)
+	}
+	if err := insert(r); err != ERROR_CONFLICT {
+		t.Fatal("seq inserted twice:", err)
+	}
+	if b, err := Balance(2, 1); err != nil || b != 15 {
+		t.Fatal("not recovered:", b, err)
+	}
+	if b, err := Credit(2, 1, 5, "test", "lost"); err != nil || b != 20 {
+		t.Fatal("key without pointer should apply:", b, err)
+	}
+
+	// 余额被篡改
+	a := &account{}
+	_db.Load(COLLECTION_BALANCES, int32(2), a)
+	a.Balances["1"] = 999
+	a.Balances["3"] = 1
+	_db.Save(COLLECTION_BALANCES, a.UserId, a)
+	mm, err := Reconcile(2)
+	if err != nil || len(mm) != 2 {
+		t.Fatal("mismatch not found:", mm, err)
+	}
+	for _, m := range mm {
+		if (m.Currency == 1 && m.Expected != 20) || (m.Currency == 3 && m.Expected != 0) {
+			t.Fatal("unexpected mismatch:", m)
+		}
+	}
+}
+
+func TestCreditAll(t *testing.T) {
+	defer init_local(t)()
+	amounts := []Amount{{Currency: 1, Amount: 100}, {Currency: 2, Amount: 50}}
+
+	// 第二种货币的key正被其他交易处理, 发放失败, 已发放的不撤销
+	pending := &key_record{Id: key_id(3, "mail:1:1"), Seq: 99, Owner: "other", CreatedAt: time.Now().Unix()}
+	if err := _db.Insert(COLLECTION_LEDGER_KEYS, pending.Id, pending); err != nil {
+		t.Fatal(err)
+	}
+	if err := CreditAll(3, amounts, "mail", "mail:1"); err != ERROR_CONFLICT {
+		t.Fatal("expect conflict, got:", err)
+	}
+	if b, _ := Balances(3); b[1] != 100 || b[2] != 0 {
+		t.Fatal("unexpected balances:", b)
+	}
+
+	// 其他交易超时后重试, 已发放的是重复请求
+	pending.CreatedAt -= int64(2 * KEY_TIMEOUT / time.Second)
+	_db.Save(COLLECTION_LEDGER_KEYS, pending.Id, pending)
+	for i := 0; i < 2; i++ {
+		if err := CreditAll(3, amounts, "mail", "mail:1"); err != nil {
+			t.Fatal(err)
+		}
+		if b, _ := Balances(3); b[1] != 100 || b[2] != 50 {
+			t.Fatal("unexpected balances after retry:", b)
+		}
+	}
+
+	// 没有key时扣回已发放的
+	if err := CreditAll(3, []Amount{{Currency: 1, Amount: 10}, {Currency: 2, Amount: 0}}, "gm", ""); err != ERROR_INVALID_AMOUNT {
+		t.Fatal("expect invalid amount, got:", err)
+	}
+	if b, _ := Balances(3); b[1] != 100 {
+		t.Fatal("credit not reverted:", b)
+	}
+}
@@ -0,0 +1,124 @@
+package currency
+
+import (
+	"strconv"
+
+	"game/db"
+	"game/kafka"
+
+	log "github.com/Sirupsen/logrus"
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// 对账: 按seq顺序重新累加流水, 与保存的余额和每条流水记录的余额比较
+// Seq为0表示余额与流水不一致, 否则为记录的余额与累加结果不一致的流水
+type Mismatch struct {
+	UserId   int32
+	Currency int32
+	Seq      int64
+	Balance  int64 // 保存的余额
+	Expected int64 // 由流水计算的余额
+}
+
+// Reconcile 对账一个玩家, 不一致时写入trace并返回
+func Reconcile(userid int32) ([]Mismatch, error) {
+	m := lock(userid)
+	m.Lock()
+	defer m.Unlock()
+
+	a := &account{}
+	if err := _db.Load(COLLECTION_BALANCES, userid, a); err != nil && err != db.ERROR_NOT_FOUND {
+		return nil, err
+	}
+	records, err := load_records(userid)
+	if err != nil {
+		return nil, err
+	}
+
+	var mismatches []Mismatch
+	sums := make(map[int32]int64)
+	for _, r := range records {
+		if r.Seq > a.Seq { // 尚未计入余额, 下次读取时补应用
+			break
+		}
+		sums[r.Currency] += r.Amount
+		if r.Balance != sums[r.Currency] {
+			mismatches = append(mismatches, Mismatch{UserId: userid, Currency: r.Currency, Seq: r.Seq, Balance: r.Balance, Expected: sums[r.Currency]})
+		}
+	}
+	for k, v := range a.Balances {
+		id, err := strconv.Atoi(k)
+		if err != nil {
+			continue
+		}
+		if expected := sums[int32(id)]; v != expected {
+			mismatches = append(mismatches, Mismatch{UserId: userid, Currency: int32(id), Balance: v, Expected: expected})
+		}
+	}
+	for id, expected := range sums {
+		if _, ok := a.Balances[strconv.Itoa(int(id))]; !ok && expected != 0 {
+			mismatches = append(mismatches, Mismatch{UserId: userid, Currency: id, Expected: expected})
+		}
+	}
+
+	for _, mm := range mismatches {
+		log.Errorf("currency: mismatch %+v", mm)
+		kafka.TraceEvent("currency_mismatch", userid, map[string]interface{}{
+			"currency": mm.Currency,
+			"seq":      mm.Seq,
+			"balance":  mm.Balance,
+			"expected": mm.Expected,
+		})
+	}
+	return mismatches, nil
+}
+
+// ReconcileAll 对账全部玩家, 只能在mongodb上执行
+func ReconcileAll() ([]Mismatch, error) {
+	var ids []int32
+	err := _db.Execute(func(sess *mgo.Session) error {
+		var doc struct {
+			Id int32 `bson:"_id"`
+		}
+		iter := sess.DB("").C(COLLECTION_BALANCES).Find(nil).Select(bson.M{"_id": 1}).Iter()
+		for iter.Next(&doc) {
+			ids = append(ids, doc.Id)
+		}
+		return iter.Close()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var mismatches []Mismatch
+	for _, id := range ids {
+		mm, err := Reconcile(id)
+		if err != nil {
+			log.Errorf("currency: reconcile failed, userid:%v err:%v", id, err)
+			continue
+		}
+		mismatches = append(mismatches, mm...)
+	}
+	return mismatches, nil
+}
+
+// 按seq顺序读取玩家的全部流水
+func load_records(userid int32) ([]Record, error) {
+	var records []Record
+	if _db.IsLocal() {
+		for seq := int64(1); ; seq++ {
+			r, err := load_record(userid, seq)
+			if err != nil {
+				return nil, err
+			} else if r == nil {
+				return records, nil
+			}
+			records = append(records, *r)
+		}
+	}
+	err := _db.Execute(func(sess *mgo.Session) error {
+		return sess.DB("").C(COLLECTION_LEDGER).Find(bson.M{"userid": userid}).Sort("seq").All(&records)
+	})
+	return records, err
+}
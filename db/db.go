@@ -1,6 +1,7 @@
 package db
 
 import (
+	"errors"
 	"os"
 	"time"
 
@@ -9,9 +10,15 @@ import (
 	mgo "gopkg.in/mgo.v2"
 )
 
+var (
+	ERROR_NOT_FOUND  = mgo.ErrNotFound
+	ERROR_STANDALONE = errors.New("mongodb not available in standalone mode")
+)
+
 type Database struct {
 	session *mgo.Session
 	latch   chan *mgo.Session
+	local   *local_store // standalone模式下的本地存储
 }
 
 func (db *Database) Init(addr string, concurrent int, timeout time.Duration) {
@@ -34,7 +41,26 @@ func (db *Database) Init(addr string, concurrent int, timeout time.Duration) {
 	}
 }
 
+// InitLocal 使用本地目录作为存储, 用于standalone模式
+func (db *Database) InitLocal(dir string) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		log.Println("localdb: cannot create - ", dir, err)
+		os.Exit(-1)
+	}
+	db.local = &local_store{dir: dir}
+}
+
+// IsLocal 是否运行在standalone模式
+func (db *Database) IsLocal() bool {
+	return db.local != nil
+}
+
+// Execute 在mongodb上执行任意操作, standalone模式下返回ERROR_STANDALONE
 func (db *Database) Execute(f func(sess *mgo.Session) error) error {
+	if db.local != nil {
+		return ERROR_STANDALONE
+	}
+
 	// latch control
 	sess := <-db.latch
 	defer func() {
@@ -43,3 +69,48 @@ func (db *Database) Execute(f func(sess *mgo.Session) error) error {
 	sess.Refresh()
 	return f(sess)
 }
+
+// Load 按_id读取一个文档, 不存在时返回ERROR_NOT_FOUND
+func (db *Database) Load(collection string, id interface{}, result interface{}) error {
+	if db.local != nil {
+		return db.local.load(collection, id, result)
+	}
+	return db.Execute(func(sess *mgo.Session) error {
+		return sess.DB("").C(collection).FindId(id).One(result)
+	})
+}
+
+// Save 按_id写入(覆盖)一个文档
+func (db *Database) Save(collection string, id interface{}, doc interface{}) error {
+	if db.local != nil {
+		return db.local.save(collection, id, doc)
+	}
+	return db.Execute(func(sess *mgo.Session) error {
+		_, err := sess.DB("").C(collection).UpsertId(id, doc)
+		return err
+	})
+}
+
+// Insert 插入一个文档, _id已存在时返回ERROR_DUPLICATED
+func (db *Database) Insert(collection string, id interface{}, doc interface{}) error {
+	if db.local != nil {
+		return db.local.insert(collection, id, doc)
+	}
+	err := db.Execute(func(sess *mgo.Session) error {
+		return sess.DB("").C(collection).Insert(doc)
+	})
+	if mgo.IsDup(err) {
+		return ERROR_DUPLICATED
+	}
+	return err
+}
+
+// Remove 按_id删除一个文档
+func (db *Database) Remove(collection string, id interface{}) error {
+	if db.local != nil {
+		return db.local.remove(collection, id)
+	}
+	return db.Execute(func(sess *mgo.Session) error {
+		return sess.DB("").C(collection).RemoveId(id)
+	})
+}
@@ -0,0 +1,116 @@
+package db
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	LOCAL_DOC_EXT = ".bson"
+)
+
+// 嵌入式本地存储, 用于standalone模式
+// 每个集合对应一个目录, 每个文档以bson格式存为一个文件: <dir>/<collection>/<id>.bson
+type local_store struct {
+	dir string
+	sync.RWMutex
+}
+
+func (s *local_store) path(collection string, id interface{}) string {
+	return filepath.Join(s.dir, collection, fmt.Sprint(id)+LOCAL_DOC_EXT)
+}
+
+func (s *local_store) load(collection string, id interface{}, result interface{}) error {
+	s.RLock()
+	defer s.RUnlock()
+	bts, err := ioutil.ReadFile(s.path(collection, id))
+	if os.IsNotExist(err) {
+		return mgo.ErrNotFound
+	} else if err != nil {
+		return err
+	}
+	return bson.Unmarshal(bts, result)
+}
+
+// 先写临时文件再rename, 保证进程崩溃时不会留下半个文档
+func (s *local_store) save(collection string, id interface{}, doc interface{}) error {
+	bts, err := bson.Marshal(doc)
+	if err != nil {
+		return err
+	}
+
+	s.Lock()
+	defer s.Unlock()
+	return s.write(collection, id, bts)
+}
+
+// 文档已存在时返回ERROR_DUPLICATED
+func (s *local_store) insert(collection string, id interface{}, doc interface{}) error {
+	bts, err := bson.Marshal(doc)
+	if err != nil {
+		return err
+	}
+
+	s.Lock()
+	defer s.Unlock()
+	if _, err := os.Stat(s.path(collection, id)); err == nil {
+		return ERROR_DUPLICATED
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	return s.write(collection, id, bts)
+}
+
+func (s *local_store) write(collection string, id interface{}, bts []byte) error {
+	if err := os.MkdirAll(filepath.Join(s.dir, collection), 0755); err != nil {
+		return err
+	}
+	name := s.path(collection, id)
+	tmp := name + ".tmp"
+	if err := ioutil.WriteFile(tmp, bts, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, name)
+}
+
+func (s *local_store) remove(collection string, id interface{}) error {
+	s.Lock()
+	defer s.Unlock()
+	err := os.Remove(s.path(collection, id))
+	if os.IsNotExist(err) {
+		return mgo.ErrNotFound
+	}
+	return err
+}
+
+// 遍历集合中的全部文档
+func (s *local_store) scan(collection string, f func(bts []byte) error) error {
+	s.RLock()
+	defer s.RUnlock()
+	files, err := ioutil.ReadDir(filepath.Join(s.dir, collection))
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	for _, fi := range files {
+		if fi.IsDir() || !strings.HasSuffix(fi.Name(), LOCAL_DOC_EXT) {
+			continue
+		}
+		bts, err := ioutil.ReadFile(filepath.Join(s.dir, collection, fi.Name()))
+		if err != nil {
+			return err
+		}
+		if err := f(bts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package db
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+type doc struct {
+	Id   int32 `bson:"_id"`
+	Name string
+}
+
+func TestLocalStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "localdb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var db Database
+	db.InitLocal(dir)
+
+	var d doc
+	if err := db.Load("users", 1, &d); err != ERROR_NOT_FOUND {
+		t.Fatal("expect not found, got:", err)
+	}
+
+	if err := db.Save("users", 1, &doc{Id: 1, Name: "alice"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Load("users", 1, &d); err != nil {
+		t.Fatal(err)
+	}
+	if d.Id != 1 || d.Name != "alice" {
+		t.Fatal("mismatch:", d)
+	}
+
+	// 插入不覆盖已存在的文档
+	if err := db.Insert("users", 1, &doc{Id: 1, Name: "bob"}); err != ERROR_DUPLICATED {
+		t.Fatal("expect duplicated, got:", err)
+	}
+	if err := db.Insert("users", 2, &doc{Id: 2, Name: "bob"}); err != nil {
+		t.Fatal(err)
+	}
+	if db.Load("users", 1, &d); d.Name != "alice" {
+		t.Fatal("overwritten by insert:", d)
+	}
+
+	if err := db.Remove("users", 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Load("users", 1, &d); err != ERROR_NOT_FOUND {
+		t.Fatal("expect not found, got:", err)
+	}
+}
+
+func TestTable(t *testing.T) {
+	tbl := NewTable()
+	if err := tbl.Insert(1, doc{Id: 1, Name: "alice"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := tbl.Insert(1, doc{Id: 1, Name: "bob"}); err != ERROR_DUPLICATED {
+		t.Fatal("expect duplicated, got:", err)
+	}
+
+	// 条件不满足时不修改
+	err := tbl.Modify(1, func(cur interface{}) (interface{}, error) {
+		if cur.(doc).Name != "bob" {
+			return nil, ERROR_NOT_FOUND
+		}
+		return doc{Id: 1, Name: "carol"}, nil
+	})
+	if err != ERROR_NOT_FOUND || tbl.Get(1).(doc).Name != "alice" {
+		t.Fatal("unexpected modify:", err, tbl.Get(1))
+	}
+
+	// 返回nil时删除
+	tbl.Modify(1, func(cur interface{}) (interface{}, error) { return nil, nil })
+	if tbl.Get(1) != nil {
+		t.Fatal("expect removed")
+	}
+	n := 0
+	tbl.Scan(func(interface{}) { n++ })
+	if n != 0 {
+		t.Fatal("unexpected rows:", n)
+	}
+}
+
+func TestLocalTable(t *testing.T) {
+	dir, err := ioutil.TempDir("", "localdb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var db Database
+	db.InitLocal(dir)
+	open := func() *Table {
+		return db.Table("docs", func() interface{} { return &doc{} })
+	}
+
+	tbl := open()
+	tbl.Insert(1, doc{Id: 1, Name: "alice"})
+	tbl.Insert(2, doc{Id: 2, Name: "bob"})
+	tbl.Modify(2, func(cur interface{}) (interface{}, error) { return nil, nil })
+
+	// 重新打开后只剩下未删除的文档
+	tbl = open()
+	if d, ok := tbl.Get(1).(doc); !ok || d.Name != "alice" {
+		t.Fatal("not persisted:", tbl.Get(1))
+	}
+	if tbl.Get(2) != nil {
+		t.Fatal("removed doc reloaded")
+	}
+}
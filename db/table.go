@@ -0,0 +1,122 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"sync"
+
+	log "github.com/Sirupsen/logrus"
+	"gopkg.in/mgo.v2/bson"
+)
+
+var (
+	ERROR_DUPLICATED = errors.New("document already exists")
+)
+
+// 内存表, 用于standalone模式和单元测试
+// 文档以_id为键保存在内存中, 修改都在表锁内执行, 因此可以实现和mongodb相同的条件更新.
+// 文档按值保存, 包含切片等引用类型的文档需要调用者自己拷贝.
+// standalone模式下通过Database.Table创建, 每次修改先写入本地存储, 启动时全部载入, 重启后不丢失.
+type Table struct {
+	rows       map[string]interface{}
+	local      *local_store // 为nil时只保存在内存中
+	collection string
+	sync.Mutex
+}
+
+func NewTable() *Table {
+	return &Table{rows: make(map[string]interface{})}
+}
+
+// Table 创建collection对应的内存表, standalone模式下从本地存储载入并持久化,
+// 否则(包括db为nil)只保存在内存中; doc返回用于解码的空文档指针
+func (db *Database) Table(collection string, doc func() interface{}) *Table {
+	t := NewTable()
+	if db == nil || db.local == nil {
+		return t
+	}
+	t.local = db.local
+	t.collection = collection
+	err := db.local.scan(collection, func(bts []byte) error {
+		d := doc()
+		if err := bson.Unmarshal(bts, d); err != nil {
+			return err
+		}
+		var raw struct {
+			Id interface{} `bson:"_id"`
+		}
+		if err := bson.Unmarshal(bts, &raw); err != nil {
+			return err
+		}
+		t.rows[table_key(raw.Id)] = reflect.ValueOf(d).Elem().Interface()
+		return nil
+	})
+	if err != nil {
+		log.Println("localdb: cannot load - ", collection, err)
+		os.Exit(-1)
+	}
+	return t
+}
+
+func table_key(id interface{}) string {
+	if oid, ok := id.(bson.ObjectId); ok {
+		return oid.Hex()
+	}
+	return fmt.Sprint(id)
+}
+
+// Get 按_id读取, 不存在时返回nil
+func (t *Table) Get(id interface{}) interface{} {
+	t.Lock()
+	defer t.Unlock()
+	return t.rows[table_key(id)]
+}
+
+// Insert 插入文档, _id已存在时返回ERROR_DUPLICATED
+func (t *Table) Insert(id interface{}, doc interface{}) error {
+	return t.Modify(id, func(cur interface{}) (interface{}, error) {
+		if cur != nil {
+			return nil, ERROR_DUPLICATED
+		}
+		return doc, nil
+	})
+}
+
+// Modify 在表锁内读取-修改-写入一个文档, 不存在时cur为nil
+// f返回错误时不修改, 返回nil文档时删除
+func (t *Table) Modify(id interface{}, f func(cur interface{}) (interface{}, error)) error {
+	key := table_key(id)
+	t.Lock()
+	defer t.Unlock()
+	doc, err := f(t.rows[key])
+	if err != nil {
+		return err
+	}
+	if t.local != nil {
+		if doc == nil {
+			err = t.local.remove(t.collection, key)
+		} else {
+			err = t.local.save(t.collection, key, doc)
+		}
+		if err != nil && err != ERROR_NOT_FOUND {
+			return err
+		}
+	}
+	if doc == nil {
+		delete(t.rows, key)
+	} else {
+		t.rows[key] = doc
+	}
+	return nil
+}
+
+// Scan 遍历全部文档, 顺序不确定
+func (t *Table) Scan(f func(doc interface{})) {
+	t.Lock()
+	defer t.Unlock()
+	for _, doc := range t.rows {
+		f(doc)
+	}
+}
@@ -0,0 +1,135 @@
+package election
+
+import (
+	"sync"
+	"time"
+
+	"game/etcdclient"
+
+	log "github.com/Sirupsen/logrus"
+	etcd "github.com/coreos/etcd/client"
+	"golang.org/x/net/context"
+)
+
+// leader选举:
+// 以etcd中的一个带TTL的key作为租约, 值为实例id.
+// 没有leader时用PrevNoExist创建key, 创建成功即成为leader;
+// leader每隔REFRESH_INTERVAL用PrevValue(比较并交换)续期, 续期失败(key被删除或已属于其他实例)立即放弃leader.
+// leader异常退出时租约在DEFAULT_TTL后过期, 其他实例接管.
+// 续期请求超时等网络错误时, 为避免与新leader同时执行, 在租约可能过期前主动放弃.
+const (
+	DEFAULT_TTL      = 15 * time.Second // 租约时间
+	REFRESH_INTERVAL = 5 * time.Second  // 续期/竞选间隔
+	REQUEST_TIMEOUT  = 3 * time.Second  // 单次etcd请求超时
+)
+
+type election struct {
+	key        string
+	instanceId string
+	leader     bool
+	expire     time.Time // 本实例认为的租约到期时间
+	sync.Mutex
+}
+
+var (
+	_default_election election
+)
+
+// Init 开始竞选, key为租约在etcd中的路径
+func Init(key, instanceId string) {
+	_default_election.key = key
+	_default_election.instanceId = instanceId
+	go _default_election.campaign()
+}
+
+// IsLeader 本实例当前是否为leader
+func IsLeader() bool {
+	return _default_election.is_leader()
+}
+
+// Resign 主动放弃leader, 用于停服
+func Resign() {
+	_default_election.resign()
+}
+
+func (e *election) is_leader() bool {
+	e.Lock()
+	defer e.Unlock()
+	return e.leader && time.Now().Before(e.expire)
+}
+
+func (e *election) set_leader(leader bool, since time.Time) {
+	e.Lock()
+	defer e.Unlock()
+	if leader != e.leader {
+		log.Infof("election: instance:%v leader:%v", e.instanceId, leader)
+	}
+	e.leader = leader
+	if leader {
+		// 以发出请求的时间计算, 保证早于etcd中的实际过期时间
+		e.expire = since.Add(DEFAULT_TTL - REQUEST_TIMEOUT)
+	}
+}
+
+func (e *election) campaign() {
+	e.try()
+	for range time.Tick(REFRESH_INTERVAL) {
+		e.try()
+	}
+}
+
+func (e *election) try() {
+	kapi := etcdclient.KeysAPI()
+	since := time.Now()
+	ctx, cancel := context.WithTimeout(context.Background(), REQUEST_TIMEOUT)
+	defer cancel()
+
+	e.Lock()
+	leader := e.leader
+	e.Unlock()
+
+	if leader {
+		opts := &etcd.SetOptions{TTL: DEFAULT_TTL, Refresh: true, PrevValue: e.instanceId}
+		if _, err := kapi.Set(ctx, e.key, "", opts); err != nil {
+			if is_error(err, etcd.ErrorCodeKeyNotFound) || is_error(err, etcd.ErrorCodeTestFailed) {
+				e.set_leader(false, since)
+			} else {
+				log.Error(err) // 网络错误, 保持到租约可能过期为止
+			}
+			return
+		}
+		e.set_leader(true, since)
+		return
+	}
+
+	opts := &etcd.SetOptions{TTL: DEFAULT_TTL, PrevExist: etcd.PrevNoExist}
+	if _, err := kapi.Set(ctx, e.key, e.instanceId, opts); err != nil {
+		if !is_error(err, etcd.ErrorCodeNodeExist) {
+			log.Error(err)
+		}
+		return
+	}
+	e.set_leader(true, since)
+}
+
+func (e *election) resign() {
+	e.Lock()
+	leader := e.leader
+	e.leader = false
+	e.Unlock()
+	if !leader {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), REQUEST_TIMEOUT)
+	defer cancel()
+	if _, err := etcdclient.KeysAPI().Delete(ctx, e.key, &etcd.DeleteOptions{PrevValue: e.instanceId}); err != nil {
+		log.Error(err)
+	}
+}
+
+func is_error(err error, code int) bool {
+	if e, ok := err.(etcd.Error); ok {
+		return e.Code == code
+	}
+	return false
+}
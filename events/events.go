@@ -0,0 +1,65 @@
+package events
+
+import (
+	"sync"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// 进程内的游戏事件:
+// 各玩法在玩家行为发生时调用Publish, 任务等系统通过Subscribe监听.
+// 监听函数在Publish的goroutine中同步执行, 不能阻塞, 单个监听函数panic不影响其他监听函数.
+const (
+	EVENT_LOGIN    = int32(1) // 登陆
+	EVENT_SPEND    = int32(3) // 消耗货币, Target为货币id, Count为数量
+	EVENT_LEVEL_UP = int32(4) // 升级, Count为新等级
+	EVENT_ITEM     = int32(5) // 获得道具, Target为道具id
+)
+
+type Event struct {
+	Type   int32
+	UserId int32
+	Target int32 // 事件对象, 如道具id, 0为无
+	Count  int64
+}
+
+var _default_events events
+
+type events struct {
+	handlers map[int32][]func(*Event)
+	sync.RWMutex
+}
+
+// Subscribe 监听一种事件, 通常在init时调用
+func Subscribe(typ int32, f func(*Event)) {
+	_default_events.Lock()
+	defer _default_events.Unlock()
+	if _default_events.handlers == nil {
+		_default_events.handlers = make(map[int32][]func(*Event))
+	}
+	_default_events.handlers[typ] = append(_default_events.handlers[typ], f)
+}
+
+// Publish 发布事件
+func Publish(e *Event) {
+	_default_events.RLock()
+	handlers := _default_events.handlers[e.Type]
+	_default_events.RUnlock()
+	for _, f := range handlers {
+		call(f, e)
+	}
+}
+
+// Fire 发布事件的简写
+func Fire(typ int32, userid int32, target int32, count int64) {
+	Publish(&Event{Type: typ, UserId: userid, Target: target, Count: count})
+}
+
+func call(f func(*Event), e *Event) {
+	defer func() {
+		if x := recover(); x != nil {
+			log.Errorf("events: handler panic, event:%+v err:%v", *e, x)
+		}
+	}()
+	f(e)
+}
@@ -0,0 +1,222 @@
+package friends
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"game/db"
+	"game/kafka"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// 好友:
+// 每个玩家一个文档保存好友和黑名单, 好友申请单独保存并随TTL过期; standalone模式下保存在本地存储中.
+// 好友关系是双向的, 先各自检查上限再分别写入, 第二步失败时回滚第一步.
+const (
+	COLLECTION_FRIENDS  = "friends"
+	COLLECTION_REQUESTS = "friend_requests"
+
+	DEFAULT_MAX_FRIENDS = 100                // 好友上限, 可由数值表配置
+	MAX_BLOCKED         = 100                // 黑名单上限
+	REQUEST_EXPIRE      = 7 * 24 * time.Hour // 好友申请有效期
+)
+
+var (
+	ERROR_SELF              = errors.New("cannot add self")
+	ERROR_ALREADY_FRIEND    = errors.New("already friend")
+	ERROR_ALREADY_REQUESTED = errors.New("already requested")
+	ERROR_REQUEST_NOT_FOUND = errors.New("friend request not found")
+	ERROR_FRIENDS_FULL      = errors.New("friend list full")
+	ERROR_TARGET_FULL       = errors.New("target friend list full")
+	ERROR_BLOCKED           = errors.New("blocked by target")
+	ERROR_BLOCKED_FULL      = errors.New("block list full")
+)
+
+// 玩家的社交关系
+type Relation struct {
+	UserId  int32   `bson:"_id"`
+	Friends []int32 `bson:"friends"`
+	Blocked []int32 `bson:"blocked"`
+}
+
+// 好友申请
+type Request struct {
+	Id        string    `bson:"_id"`
+	From      int32     `bson:"from"`
+	To        int32     `bson:"to"`
+	CreatedAt time.Time `bson:"created_at"`
+}
+
+var (
+	_store      store
+	_maxFriends = DEFAULT_MAX_FRIENDS
+	_mu         sync.RWMutex
+)
+
+func Init(database *db.Database) {
+	if database.IsLocal() {
+		_store = new_memory_store(database)
+	} else {
+		_store = new_mongo_store(database)
+	}
+}
+
+// SetMaxFriends 设置好友上限, 数值表热更新时调用
+func SetMaxFriends(n int) {
+	if n <= 0 {
+		return
+	}
+	_mu.Lock()
+	_maxFriends = n
+	_mu.Unlock()
+}
+
+func max_friends() int {
+	_mu.RLock()
+	defer _mu.RUnlock()
+	return _maxFriends
+}
+
+func request_id(from, to int32) string {
+	return fmt.Sprintf("%v-%v", from, to)
+}
+
+func contains(ids []int32, id int32) bool {
+	for _, v := range ids {
+		if v == id {
+			return true
+		}
+	}
+	return false
+}
+
+// Get 读取社交关系, 不存在时返回空关系
+func Get(userid int32) (*Relation, error) {
+	return _store.get(userid)
+}
+
+// IsBlocked userid是否在by的黑名单中
+func IsBlocked(userid, by int32) (bool, error) {
+	r, err := Get(by)
+	if err != nil {
+		return false, err
+	}
+	return contains(r.Blocked, userid), nil
+}
+
+// Requests 收到的好友申请
+func Requests(userid int32) ([]Request, error) {
+	return _store.requests(userid, time.Now())
+}
+
+// SendRequest 发送好友申请
+func SendRequest(from, to int32) error {
+	if from == to {
+		return ERROR_SELF
+	}
+
+	me, err := Get(from)
+	if err != nil {
+		return err
+	}
+	if contains(me.Friends, to) {
+		return ERROR_ALREADY_FRIEND
+	}
+	if len(me.Friends) >= max_friends() {
+		return ERROR_FRIENDS_FULL
+	}
+
+	target, err := Get(to)
+	if err != nil {
+		return err
+	}
+	if contains(target.Blocked, from) {
+		return ERROR_BLOCKED
+	}
+
+	return _store.insert_request(&Request{Id: request_id(from, to), From: from, To: to, CreatedAt: time.Now()})
+}
+
+// Accept 接受from发来的好友申请
+func Accept(userid, from int32) error {
+	now := time.Now()
+	if err := _store.remove_request(request_id(from, userid), now); err != nil {
+		return err
+	}
+
+	// 对方也向我发过申请的话一并删除
+	_store.remove_request(request_id(userid, from), now)
+
+	if err := add_friend(userid, from, ERROR_FRIENDS_FULL); err != nil {
+		return err
+	}
+	if err := add_friend(from, userid, ERROR_TARGET_FULL); err != nil {
+		_store.pull(userid, "friends", from)
+		return err
+	}
+
+	kafka.CommitUpdate(userid, bson.M{"op": "add", "friend": from}, COLLECTION_FRIENDS)
+	kafka.CommitUpdate(from, bson.M{"op": "add", "friend": userid}, COLLECTION_FRIENDS)
+	return nil
+}
+
+// 在不超过上限的前提下添加单向好友
+func add_friend(userid, friend int32, full error) error {
+	ok, err := _store.add(userid, "friends", friend, max_friends())
+	if err != nil {
+		return err
+	} else if !ok {
+		return full
+	}
+	return nil
+}
+
+// Reject 拒绝from发来的好友申请
+func Reject(userid, from int32) error {
+	return _store.remove_request(request_id(from, userid), time.Now())
+}
+
+// Remove 删除好友, 双向删除
+func Remove(userid, friend int32) error {
+	if err := _store.pull(userid, "friends", friend); err != nil {
+		return err
+	}
+	if err := _store.pull(friend, "friends", userid); err != nil {
+		return err
+	}
+	kafka.CommitUpdate(userid, bson.M{"op": "remove", "friend": friend}, COLLECTION_FRIENDS)
+	kafka.CommitUpdate(friend, bson.M{"op": "remove", "friend": userid}, COLLECTION_FRIENDS)
+	return nil
+}
+
+// Block 加入黑名单, 同时解除好友关系和双方的申请
+func Block(userid, target int32) error {
+	if userid == target {
+		return ERROR_SELF
+	}
+
+	if ok, err := _store.add(userid, "blocked", target, MAX_BLOCKED); err != nil {
+		return err
+	} else if !ok {
+		return ERROR_BLOCKED_FULL
+	}
+
+	Remove(userid, target)
+	now := time.Now()
+	_store.remove_request(request_id(userid, target), now)
+	_store.remove_request(request_id(target, userid), now)
+	kafka.CommitUpdate(userid, bson.M{"op": "block", "target": target}, COLLECTION_FRIENDS)
+	return nil
+}
+
+// Unblock 移出黑名单
+func Unblock(userid, target int32) error {
+	if err := _store.pull(userid, "blocked", target); err != nil {
+		return err
+	}
+	kafka.CommitUpdate(userid, bson.M{"op": "unblock", "target": target}, COLLECTION_FRIENDS)
+	return nil
+}
@@ -0,0 +1,128 @@
+package friends
+
+import (
+	"testing"
+	"time"
+
+	"game/kafka"
+)
+
+func init() {
+	kafka.InitDiscard()
+}
+
+func TestAccept(t *testing.T) {
+	_store = new_memory_store(nil)
+	if err := SendRequest(1, 1); err != ERROR_SELF {
+		t.Fatal("unexpected:", err)
+	}
+	if err := SendRequest(1, 2); err != nil {
+		t.Fatal(err)
+	}
+	if err := SendRequest(1, 2); err != ERROR_ALREADY_REQUESTED {
+		t.Fatal("unexpected:", err)
+	}
+	// 双方互相申请, 接受一方时另一方的申请一并删除
+	SendRequest(2, 1)
+	if reqs, _ := Requests(2); len(reqs) != 1 || reqs[0].From != 1 {
+		t.Fatal("unexpected requests:", reqs)
+	}
+	if err := Accept(2, 1); err != nil {
+		t.Fatal(err)
+	}
+	if reqs, _ := Requests(1); len(reqs) != 0 {
+		t.Fatal("reverse request not removed:", reqs)
+	}
+	for _, id := range []int32{1, 2} {
+		r, _ := Get(id)
+		if len(r.Friends) != 1 || r.Friends[0] != 3-id {
+			t.Fatal("unexpected friends:", id, r.Friends)
+		}
+	}
+	if err := SendRequest(1, 2); err != ERROR_ALREADY_FRIEND {
+		t.Fatal("unexpected:", err)
+	}
+	if err := Accept(2, 1); err != ERROR_REQUEST_NOT_FOUND {
+		t.Fatal("unexpected:", err)
+	}
+
+	Remove(1, 2)
+	if r, _ := Get(2); len(r.Friends) != 0 {
+		t.Fatal("not removed:", r.Friends)
+	}
+}
+
+func TestFull(t *testing.T) {
+	_store = new_memory_store(nil)
+	SetMaxFriends(1)
+	defer SetMaxFriends(DEFAULT_MAX_FRIENDS)
+
+	SendRequest(2, 3)
+	SendRequest(1, 2)
+	Accept(2, 1)
+	if err := SendRequest(1, 3); err != ERROR_FRIENDS_FULL {
+		t.Fatal("unexpected:", err)
+	}
+	// 申请之后对方已满, 接受时回滚自己这一侧
+	if err := Accept(3, 2); err != ERROR_TARGET_FULL {
+		t.Fatal("unexpected:", err)
+	}
+	if r, _ := Get(3); len(r.Friends) != 0 {
+		t.Fatal("not rolled back:", r.Friends)
+	}
+}
+
+func TestBlock(t *testing.T) {
+	_store = new_memory_store(nil)
+	SendRequest(1, 2)
+	Accept(2, 1)
+	SendRequest(3, 1)
+
+	// 拉黑解除好友关系和双方的申请
+	if err := Block(1, 2); err != nil {
+		t.Fatal(err)
+	}
+	if err := Block(1, 3); err != nil {
+		t.Fatal(err)
+	}
+	if r, _ := Get(2); len(r.Friends) != 0 {
+		t.Fatal("friendship not removed:", r.Friends)
+	}
+	if reqs, _ := Requests(1); len(reqs) != 0 {
+		t.Fatal("requests not removed:", reqs)
+	}
+	if blocked, _ := IsBlocked(2, 1); !blocked {
+		t.Fatal("should be blocked")
+	}
+	if blocked, _ := IsBlocked(1, 2); blocked {
+		t.Fatal("block is one-way")
+	}
+	if err := SendRequest(2, 1); err != ERROR_BLOCKED {
+		t.Fatal("unexpected:", err)
+	}
+
+	Unblock(1, 2)
+	if blocked, _ := IsBlocked(2, 1); blocked {
+		t.Fatal("still blocked")
+	}
+}
+
+func TestRequestExpire(t *testing.T) {
+	s := new_memory_store(nil)
+	now := time.Now()
+	s.insert_request(&Request{Id: request_id(1, 2), From: 1, To: 2, CreatedAt: now.Add(-REQUEST_EXPIRE)})
+	if reqs, _ := s.requests(2, now); len(reqs) != 0 {
+		t.Fatal("expired request listed:", reqs)
+	}
+	if err := s.remove_request(request_id(1, 2), now); err != ERROR_REQUEST_NOT_FOUND {
+		t.Fatal("unexpected:", err)
+	}
+	// 过期后可以重新申请
+	s.insert_request(&Request{Id: request_id(1, 2), From: 1, To: 2, CreatedAt: now.Add(-REQUEST_EXPIRE)})
+	if err := s.insert_request(&Request{Id: request_id(1, 2), From: 1, To: 2, CreatedAt: now}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.remove_request(request_id(1, 2), now); err != nil {
+		t.Fatal(err)
+	}
+}
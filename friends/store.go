@@ -0,0 +1,219 @@
+package friends
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"game/db"
+
+	log "github.com/Sirupsen/logrus"
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// 社交关系和好友申请的存储, field为"friends"或"blocked"
+type store interface {
+	get(userid int32) (*Relation, error)                             // 不存在时返回空关系
+	add(userid int32, field string, id int32, max int) (bool, error) // 已有max个时不添加, 返回false
+	pull(userid int32, field string, id int32) error
+	requests(to int32, now time.Time) ([]Request, error) // 未过期的申请, 按时间从新到旧
+	insert_request(req *Request) error                   // 已存在时返回ERROR_ALREADY_REQUESTED
+	remove_request(id string, now time.Time) error       // 不存在或已过期时返回ERROR_REQUEST_NOT_FOUND
+}
+
+// mongodb存储, 过期的申请由TTL索引删除
+type mongo_store struct {
+	db *db.Database
+}
+
+func new_mongo_store(database *db.Database) *mongo_store {
+	err := database.Execute(func(sess *mgo.Session) error {
+		c := sess.DB("").C(COLLECTION_REQUESTS)
+		if err := c.EnsureIndex(mgo.Index{Key: []string{"to"}}); err != nil {
+			return err
+		}
+		return c.EnsureIndex(mgo.Index{Key: []string{"created_at"}, ExpireAfter: REQUEST_EXPIRE})
+	})
+	if err != nil {
+		log.Error(err)
+	}
+	return &mongo_store{db: database}
+}
+
+func (s *mongo_store) get(userid int32) (*Relation, error) {
+	r := &Relation{UserId: userid}
+	err := s.db.Execute(func(sess *mgo.Session) error {
+		return sess.DB("").C(COLLECTION_FRIENDS).FindId(userid).One(r)
+	})
+	if err != nil && err != mgo.ErrNotFound {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (s *mongo_store) add(userid int32, field string, id int32, max int) (ok bool, err error) {
+	err = s.db.Execute(func(sess *mgo.Session) error {
+		c := sess.DB("").C(COLLECTION_FRIENDS)
+		// 确保文档存在
+		if _, err := c.UpsertId(userid, bson.M{"$setOnInsert": bson.M{"friends": []int32{}, "blocked": []int32{}}}); err != nil {
+			return err
+		}
+
+		// <field>.<max-1>不存在即数量小于上限
+		q := bson.M{"_id": userid, fmt.Sprintf("%v.%v", field, max-1): bson.M{"$exists": false}}
+		err := c.Update(q, bson.M{"$addToSet": bson.M{field: id}})
+		if err == mgo.ErrNotFound {
+			return nil
+		}
+		ok = err == nil
+		return err
+	})
+	return
+}
+
+func (s *mongo_store) pull(userid int32, field string, id int32) error {
+	err := s.db.Execute(func(sess *mgo.Session) error {
+		return sess.DB("").C(COLLECTION_FRIENDS).UpdateId(userid, bson.M{"$pull": bson.M{field: id}})
+	})
+	if err == mgo.ErrNotFound {
+		return nil
+	}
+	return err
+}
+
+func (s *mongo_store) requests(to int32, now time.Time) (reqs []Request, err error) {
+	err = s.db.Execute(func(sess *mgo.Session) error {
+		q := bson.M{"to": to, "created_at": bson.M{"$gt": now.Add(-REQUEST_EXPIRE)}}
+		return sess.DB("").C(COLLECTION_REQUESTS).Find(q).Sort("-created_at").All(&reqs)
+	})
+	return
+}
+
+func (s *mongo_store) insert_request(req *Request) error {
+	err := s.db.Execute(func(sess *mgo.Session) error {
+		return sess.DB("").C(COLLECTION_REQUESTS).Insert(req)
+	})
+	if mgo.IsDup(err) {
+		return ERROR_ALREADY_REQUESTED
+	}
+	return err
+}
+
+func (s *mongo_store) remove_request(id string, now time.Time) error {
+	err := s.db.Execute(func(sess *mgo.Session) error {
+		return sess.DB("").C(COLLECTION_REQUESTS).Remove(bson.M{"_id": id, "created_at": bson.M{"$gt": now.Add(-REQUEST_EXPIRE)}})
+	})
+	if err == mgo.ErrNotFound {
+		return ERROR_REQUEST_NOT_FOUND
+	}
+	return err
+}
+
+// 基于db.Table的存储, standalone模式下写入data-dir; 过期的申请视为不存在, 重新申请时覆盖
+type memory_store struct {
+	relations *db.Table
+	reqs      *db.Table
+}
+
+func new_memory_store(database *db.Database) *memory_store {
+	return &memory_store{
+		relations: database.Table(COLLECTION_FRIENDS, func() interface{} { return &Relation{} }),
+		reqs:      database.Table(COLLECTION_REQUESTS, func() interface{} { return &Request{} }),
+	}
+}
+
+// 文档中的切片不能和调用者共享
+func (r Relation) clone() *Relation {
+	r.Friends = append([]int32{}, r.Friends...)
+	r.Blocked = append([]int32{}, r.Blocked...)
+	return &r
+}
+
+func (r *Relation) list(field string) *[]int32 {
+	if field == "blocked" {
+		return &r.Blocked
+	}
+	return &r.Friends
+}
+
+func (s *memory_store) get(userid int32) (*Relation, error) {
+	if doc := s.relations.Get(userid); doc != nil {
+		return doc.(Relation).clone(), nil
+	}
+	return &Relation{UserId: userid}, nil
+}
+
+func (s *memory_store) add(userid int32, field string, id int32, max int) (ok bool, err error) {
+	err = s.relations.Modify(userid, func(cur interface{}) (interface{}, error) {
+		r := &Relation{UserId: userid, Friends: []int32{}, Blocked: []int32{}}
+		if cur != nil {
+			r = cur.(Relation).clone()
+		}
+		ids := r.list(field)
+		if contains(*ids, id) {
+			ok = true
+			return cur, nil
+		}
+		if len(*ids) >= max {
+			return cur, nil
+		}
+		*ids = append(*ids, id)
+		ok = true
+		return *r, nil
+	})
+	return
+}
+
+func (s *memory_store) pull(userid int32, field string, id int32) error {
+	return s.relations.Modify(userid, func(cur interface{}) (interface{}, error) {
+		if cur == nil {
+			return nil, nil
+		}
+		r := cur.(Relation).clone()
+		ids := r.list(field)
+		for k := range *ids {
+			if (*ids)[k] == id {
+				*ids = append((*ids)[:k], (*ids)[k+1:]...)
+				return *r, nil
+			}
+		}
+		return cur, nil
+	})
+}
+
+func (s *memory_store) requests(to int32, now time.Time) ([]Request, error) {
+	var reqs []Request
+	s.reqs.Scan(func(doc interface{}) {
+		if req := doc.(Request); req.To == to && now.Sub(req.CreatedAt) < REQUEST_EXPIRE {
+			reqs = append(reqs, req)
+		}
+	})
+	sort.Slice(reqs, func(i, k int) bool { return reqs[i].CreatedAt.After(reqs[k].CreatedAt) })
+	return reqs, nil
+}
+
+func (s *memory_store) insert_request(req *Request) error {
+	return s.reqs.Modify(req.Id, func(cur interface{}) (interface{}, error) {
+		if cur != nil && req.CreatedAt.Sub(cur.(Request).CreatedAt) < REQUEST_EXPIRE {
+			return nil, ERROR_ALREADY_REQUESTED
+		}
+		return *req, nil
+	})
+}
+
+// 过期的申请也一并删除
+func (s *memory_store) remove_request(id string, now time.Time) error {
+	expired := false
+	err := s.reqs.Modify(id, func(cur interface{}) (interface{}, error) {
+		if cur == nil {
+			return nil, ERROR_REQUEST_NOT_FOUND
+		}
+		expired = now.Sub(cur.(Request).CreatedAt) >= REQUEST_EXPIRE
+		return nil, nil
+	})
+	if err == nil && expired {
+		return ERROR_REQUEST_NOT_FOUND
+	}
+	return err
+}
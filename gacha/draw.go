@@ -0,0 +1,140 @@
+package gacha
+
+import (
+	"math/rand"
+
+	"game/mail"
+)
+
+// 卡池定义
+type Pool struct {
+	Id         int32
+	Cost       mail.Attachment // 单抽消耗
+	TenCost    mail.Attachment // 十连消耗, Count为0时为单抽的10倍
+	PityRarity int32           // 保底的稀有度
+	PityCount  int32           // 连续PityCount次未出PityRarity及以上时, 下一次必出, 0为无保底
+	TenRarity  int32           // 十连至少出一个该稀有度及以上, 0为无
+	Rarities   []Rarity        // 按稀有度从低到高
+}
+
+// 一个稀有度的权重和道具
+type Rarity struct {
+	Rarity int32
+	Weight int32
+	Items  []Entry
+}
+
+type Entry struct {
+	Item   mail.Attachment
+	Weight int32
+}
+
+// 单次抽取的结果
+type Result struct {
+	Rarity int32
+	Item   mail.Attachment
+}
+
+// 玩家在一个卡池的保底计数
+type Counter struct {
+	Pool  int32 `bson:"pool"`
+	Pity  int32 `bson:"pity"`  // 距上次出PityRarity及以上的次数
+	Total int64 `bson:"total"` // 累计抽取次数
+}
+
+// Draw 抽取times次, 结果只由卡池定义, 抽取前的计数和seed决定, 可以用日志中的seed重现
+func Draw(pool *Pool, counter Counter, times int, seed int64) ([]Result, Counter) {
+	rnd := rand.New(rand.NewSource(seed))
+	results := make([]Result, 0, times)
+	best := int32(0)
+	for i := 0; i < times; i++ {
+		counter.Pity++
+		counter.Total++
+
+		var r *Rarity
+		switch {
+		case pool.PityCount > 0 && counter.Pity >= pool.PityCount:
+			r = pool.rarity(pool.PityRarity)
+		case times >= TEN_PULL && i == times-1 && best < pool.TenRarity:
+			r = pool.rarity(pool.TenRarity)
+		}
+		if r == nil {
+			r = pool.roll(rnd)
+		}
+
+		if r.Rarity >= pool.PityRarity {
+			counter.Pity = 0
+		}
+		if r.Rarity > best {
+			best = r.Rarity
+		}
+		results = append(results, Result{Rarity: r.Rarity, Item: r.pick(rnd)})
+	}
+	return results, counter
+}
+
+// 不低于rarity的最低稀有度
+func (p *Pool) rarity(rarity int32) *Rarity {
+	for k := range p.Rarities {
+		if p.Rarities[k].Rarity >= rarity {
+			return &p.Rarities[k]
+		}
+	}
+	return &p.Rarities[len(p.Rarities)-1]
+}
+
+func (p *Pool) roll(rnd *rand.Rand) *Rarity {
+	total := int32(0)
+	for k := range p.Rarities {
+		total += p.Rarities[k].Weight
+	}
+	n := rnd.Int31n(total)
+	for k := range p.Rarities {
+		if n < p.Rarities[k].Weight {
+			return &p.Rarities[k]
+		}
+		n -= p.Rarities[k].Weight
+	}
+	return &p.Rarities[len(p.Rarities)-1]
+}
+
+func (r *Rarity) pick(rnd *rand.Rand) mail.Attachment {
+	total := int32(0)
+	for k := range r.Items {
+		total += r.Items[k].Weight
+	}
+	n := rnd.Int31n(total)
+	for k := range r.Items {
+		if n < r.Items[k].Weight {
+			return r.Items[k].Item
+		}
+		n -= r.Items[k].Weight
+	}
+	return r.Items[len(r.Items)-1].Item
+}
+
+// 检查卡池定义, 保证Draw不会失败
+func (p *Pool) valid() bool {
+	if len(p.Rarities) == 0 {
+		return false
+	}
+	total := int32(0)
+	for k := range p.Rarities {
+		r := &p.Rarities[k]
+		if r.Weight < 0 || len(r.Items) == 0 || (k > 0 && r.Rarity <= p.Rarities[k-1].Rarity) {
+			return false
+		}
+		total += r.Weight
+		items := int32(0)
+		for _, e := range r.Items {
+			if e.Weight < 0 {
+				return false
+			}
+			items += e.Weight
+		}
+		if items <= 0 {
+			return false
+		}
+	}
+	return total > 0
+}
@@ -0,0 +1,77 @@
+package gacha
+
+import (
+	"reflect"
+	"testing"
+
+	"game/mail"
+)
+
+func test_pool() *Pool {
+	item := func(id int32) Entry {
+		return Entry{Item: mail.Attachment{Type: mail.ATTACH_ITEM, Id: id, Count: 1}, Weight: 1}
+	}
+	return &Pool{
+		Id:         1,
+		PityRarity: 3,
+		PityCount:  20,
+		TenRarity:  2,
+		Rarities: []Rarity{
+			{Rarity: 1, Weight: 1000, Items: []Entry{item(1), item(2)}},
+			{Rarity: 2, Weight: 0, Items: []Entry{item(3)}},
+			{Rarity: 3, Weight: 0, Items: []Entry{item(4)}},
+		},
+	}
+}
+
+func TestDrawReproducible(t *testing.T) {
+	p := test_pool()
+	a, ca := Draw(p, Counter{Pool: 1, Pity: 3}, TEN_PULL, 42)
+	b, cb := Draw(p, Counter{Pool: 1, Pity: 3}, TEN_PULL, 42)
+	if !reflect.DeepEqual(a, b) || ca != cb {
+		t.Fatal("same seed should draw the same results")
+	}
+}
+
+func TestDrawGuarantee(t *testing.T) {
+	p := test_pool()
+
+	// 十连的最后一次必出TenRarity
+	results, counter := Draw(p, Counter{Pool: 1}, TEN_PULL, 1)
+	if results[9].Rarity != 2 || counter.Pity != 10 || counter.Total != 10 {
+		t.Fatal("ten pull guarantee failed:", results[9], counter)
+	}
+	for _, r := range results[:9] {
+		if r.Rarity != 1 {
+			t.Fatal("unexpected rarity:", r)
+		}
+	}
+
+	// 第20次必出PityRarity, 并重置计数
+	results, counter = Draw(p, counter, TEN_PULL, 2)
+	if results[9].Rarity != 3 || results[9].Item.Id != 4 || counter.Pity != 0 {
+		t.Fatal("pity failed:", results[9], counter)
+	}
+
+	// 单抽没有十连保底
+	results, counter = Draw(p, counter, 1, 3)
+	if results[0].Rarity != 1 || counter.Pity != 1 {
+		t.Fatal("unexpected single pull:", results[0], counter)
+	}
+}
+
+func TestPoolValid(t *testing.T) {
+	p := test_pool()
+	if !p.valid() {
+		t.Fatal("pool should be valid")
+	}
+	p.Rarities[0].Weight = 0
+	if p.valid() {
+		t.Fatal("zero total weight should be invalid")
+	}
+	p = test_pool()
+	p.Rarities[1].Rarity = 1
+	if p.valid() {
+		t.Fatal("unordered rarities should be invalid")
+	}
+}
@@ -0,0 +1,255 @@
+package gacha
+
+import (
+	crand "crypto/rand"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"game/db"
+	"game/kafka"
+	"game/mail"
+	"game/misc/locks"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// 抽卡:
+// 卡池定义来自数值表, 先按权重抽稀有度, 再在稀有度内按权重抽道具.
+// 每个玩家在每个卡池有保底计数, 持久化在COLLECTION_GACHA中.
+// 随机数只在服务器生成, 每次请求使用一个新的seed, Draw的结果只由卡池定义, 抽取前的计数和seed决定,
+// seed和抽取前后的计数以及卡池定义的hash一起写入trace, 客服可以用Draw重现有争议的抽取;
+// 卡池定义在加载时以hash为key写入trace(gacha_pool), 热更新后仍能找到抽取时的定义.
+// 直接发放失败时抽到的道具通过邮件补发, 补发也失败时返还消耗并撤销保底计数.
+const (
+	COLLECTION_GACHA = "gacha"
+	TEN_PULL         = 10
+
+	MAIL_TITLE   = "抽卡奖励"
+	MAIL_CONTENT = "抽到的道具未能直接发放(如背包已满), 通过邮件补发"
+)
+
+var (
+	ERROR_POOL_NOT_FOUND = errors.New("gacha pool not found")
+	ERROR_INVALID_TIMES  = errors.New("invalid gacha times")
+	ERROR_PAY            = errors.New("gacha cost not paid")
+)
+
+// 玩家的保底计数, 持久化的文档
+type record struct {
+	UserId   int32     `bson:"_id"`
+	Counters []Counter `bson:"counters"`
+}
+
+var (
+	_db     *db.Database
+	_pools  = make(map[int32]*Pool)
+	_hashes = make(map[int32]string) // 卡池定义的hash, 写入trace, 用于确定重现时使用的定义
+	_mu     sync.RWMutex
+	_locks  locks.UserLocks // 保证同一玩家的抽取串行执行
+
+	// Pay 扣除消耗, 由上层设置
+	Pay func(userid int32, cost mail.Attachment) error
+
+	// Refund 返还消耗, 由上层设置
+	Refund func(userid int32, cost mail.Attachment) error
+
+	// Grant 发放抽到的道具, 由上层设置
+	Grant func(userid int32, results []Result) error
+)
+
+func Init(database *db.Database) {
+	_db = database
+}
+
+// SetPools 替换全部卡池, 数值表热更新时调用, 定义不合法的卡池被忽略
+func SetPools(pools []*Pool) {
+	m := make(map[int32]*Pool)
+	hashes := make(map[int32]string)
+	for _, p := range pools {
+		if !p.valid() {
+			log.Error("gacha: invalid pool:", p.Id)
+			continue
+		}
+		bts, err := json.Marshal(p)
+		if err != nil {
+			log.Error("gacha: invalid pool:", p.Id, err)
+			continue
+		}
+		sum := sha1.Sum(bts)
+		m[p.Id] = p
+		hashes[p.Id] = hex.EncodeToString(sum[:])
+		if _hashes[p.Id] != hashes[p.Id] {
+			kafka.TraceEvent("gacha_pool", 0, map[string]interface{}{"pool": p.Id, "hash": hashes[p.Id], "def": string(bts)})
+		}
+	}
+	_mu.Lock()
+	_pools = m
+	_hashes = hashes
+	_mu.Unlock()
+}
+
+// Get 卡池定义, 不存在时返回nil
+func Get(id int32) *Pool {
+	_mu.RLock()
+	defer _mu.RUnlock()
+	return _pools[id]
+}
+
+func pool_hash(id int32) (*Pool, string) {
+	_mu.RLock()
+	defer _mu.RUnlock()
+	return _pools[id], _hashes[id]
+}
+
+func new_seed() int64 {
+	var b [8]byte
+	if _, err := crand.Read(b[:]); err != nil {
+		return time.Now().UnixNano()
+	}
+	return int64(binary.LittleEndian.Uint64(b[:]))
+}
+
+func load(userid int32) (*record, error) {
+	rec := &record{UserId: userid}
+	if err := _db.Load(COLLECTION_GACHA, userid, rec); err != nil && err != db.ERROR_NOT_FOUND {
+		return nil, err
+	}
+	return rec, nil
+}
+
+func (rec *record) counter(pool int32) *Counter {
+	for k := range rec.Counters {
+		if rec.Counters[k].Pool == pool {
+			return &rec.Counters[k]
+		}
+	}
+	rec.Counters = append(rec.Counters, Counter{Pool: pool})
+	return &rec.Counters[len(rec.Counters)-1]
+}
+
+// Counters 玩家在全部卡池的保底计数
+func Counters(userid int32) ([]Counter, error) {
+	rec, err := load(userid)
+	if err != nil {
+		return nil, err
+	}
+	return rec.Counters, nil
+}
+
+// Pull 单抽或十连, 先扣除消耗再发放
+func Pull(userid int32, poolid int32, times int) ([]Result, Counter, error) {
+	if times != 1 && times != TEN_PULL {
+		return nil, Counter{}, ERROR_INVALID_TIMES
+	}
+	pool, hash := pool_hash(poolid)
+	if pool == nil {
+		return nil, Counter{}, ERROR_POOL_NOT_FOUND
+	}
+	cost := pool.Cost
+	if times == TEN_PULL {
+		if pool.TenCost.Count > 0 {
+			cost = pool.TenCost
+		} else {
+			cost.Count *= TEN_PULL
+		}
+	}
+
+	lock := _locks.Of(userid)
+	lock.Lock()
+	defer lock.Unlock()
+
+	rec, err := load(userid)
+	if err != nil {
+		return nil, Counter{}, err
+	}
+	counter := rec.counter(poolid)
+	before := *counter
+	seed := new_seed()
+	results, after := Draw(pool, before, times, seed)
+
+	if cost.Count > 0 {
+		if Pay == nil {
+			return nil, before, ERROR_PAY
+		}
+		if err := Pay(userid, cost); err != nil {
+			return nil, before, err
+		}
+	}
+
+	*counter = after
+	if err := _db.Save(COLLECTION_GACHA, userid, rec); err != nil {
+		log.Error("gacha: save failed:", userid, err)
+	}
+	kafka.CommitUpdate(userid, rec, COLLECTION_GACHA)
+	kafka.TraceEvent("gacha_pull", userid, map[string]interface{}{
+		"pool":    poolid,
+		"hash":    hash,
+		"seed":    seed,
+		"times":   times,
+		"cost":    cost,
+		"before":  before,
+		"after":   after,
+		"results": results,
+	})
+
+	if Grant == nil {
+		return results, after, nil
+	}
+	err = Grant(userid, results)
+	if err == nil {
+		return results, after, nil
+	}
+	log.Errorf("gacha: grant failed, userid:%v pool:%v seed:%v err:%v", userid, poolid, seed, err)
+	sent, err := deliver(userid, results)
+	if err == nil {
+		return results, after, nil
+	}
+	log.Errorf("gacha: deliver failed, userid:%v pool:%v seed:%v sent:%v err:%v", userid, poolid, seed, sent, err)
+	if sent > 0 {
+		// 已补发一部分, 剩余的按trace处理
+		return results, after, err
+	}
+
+	// 一个都没有发放, 撤销这次抽取
+	if cost.Count > 0 {
+		if Refund == nil {
+			return results, after, err
+		}
+		if err := Refund(userid, cost); err != nil {
+			log.Errorf("gacha: refund failed, userid:%v pool:%v seed:%v err:%v", userid, poolid, seed, err)
+			return results, after, err
+		}
+	}
+	*counter = before
+	if err := _db.Save(COLLECTION_GACHA, userid, rec); err != nil {
+		log.Error("gacha: save failed:", userid, err)
+	}
+	kafka.CommitUpdate(userid, rec, COLLECTION_GACHA)
+	kafka.TraceEvent("gacha_refund", userid, map[string]interface{}{"pool": poolid, "seed": seed, "cost": cost})
+	return nil, before, err
+}
+
+// 通过邮件补发, 每封最多MAX_ATTACHMENTS个, 返回已发送的个数
+func deliver(userid int32, results []Result) (int, error) {
+	sent := 0
+	for sent < len(results) {
+		n := len(results) - sent
+		if n > mail.MAX_ATTACHMENTS {
+			n = mail.MAX_ATTACHMENTS
+		}
+		attachments := make([]mail.Attachment, n)
+		for k := range attachments {
+			attachments[k] = results[sent+k].Item
+		}
+		if _, err := mail.Send(userid, 0, MAIL_TITLE, MAIL_CONTENT, attachments, 0); err != nil {
+			return sent, err
+		}
+		sent += n
+	}
+	return sent, nil
+}
@@ -0,0 +1,81 @@
+package gacha
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"game/db"
+	"game/kafka"
+	"game/mail"
+)
+
+func init() {
+	kafka.InitDiscard()
+}
+
+func TestPoolHash(t *testing.T) {
+	SetPools([]*Pool{test_pool()})
+	_, a := pool_hash(1)
+	SetPools([]*Pool{test_pool()})
+	if _, b := pool_hash(1); a == "" || a != b {
+		t.Fatal("hash of the same definition changed:", a, b)
+	}
+
+	p := test_pool()
+	p.Rarities[0].Items[0].Weight = 2
+	SetPools([]*Pool{p})
+	if _, b := pool_hash(1); a == b {
+		t.Fatal("hash not changed with definition")
+	}
+	SetPools(nil)
+}
+
+func TestGrantFailed(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gacha")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var database db.Database
+	database.InitLocal(dir)
+	Init(&database)
+	mail.Init(&database)
+
+	p := test_pool()
+	p.Cost = mail.Attachment{Type: mail.ATTACH_CURRENCY, Id: 1, Count: 10}
+	SetPools([]*Pool{p})
+	defer SetPools(nil)
+
+	paid := int32(0)
+	Pay = func(userid int32, cost mail.Attachment) error { paid += cost.Count; return nil }
+	Refund = func(userid int32, cost mail.Attachment) error { paid -= cost.Count; return nil }
+	Grant = func(userid int32, results []Result) error { return errors.New("grant failed") }
+	defer func() { Pay, Refund, Grant = nil, nil, nil }()
+
+	// 发放失败时通过邮件补发
+	results, counter, err := Pull(1, 1, TEN_PULL)
+	if err != nil || len(results) != TEN_PULL || counter.Total != TEN_PULL {
+		t.Fatal("unexpected pull:", err, len(results), counter)
+	}
+	mails, _ := mail.List(1)
+	n := 0
+	for _, m := range mails {
+		n += len(m.Attachments)
+	}
+	if len(mails) != 2 || n != TEN_PULL || paid != 100 {
+		t.Fatal("results not delivered by mail:", len(mails), n, paid)
+	}
+
+	// 补发也失败时返还消耗并撤销保底计数
+	mail.Validate = func(a *mail.Attachment) error { return mail.ERROR_INVALID_ATTACH }
+	defer func() { mail.Validate = nil }()
+	if results, counter, err = Pull(1, 1, 1); err == nil || results != nil || counter.Total != TEN_PULL {
+		t.Fatal("pull not reverted:", err, results, counter)
+	}
+	if counters, _ := Counters(1); counters[0].Total != TEN_PULL || paid != 100 {
+		t.Fatal("counter or cost not reverted:", counters, paid)
+	}
+}
@@ -0,0 +1,357 @@
+package guild
+
+import (
+	"errors"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"game/db"
+	"game/kafka"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// 公会:
+// 公会文档保存在mongodb中(standalone模式下保存在本地存储中), 成员, 入会申请和邀请都内嵌在公会文档里.
+// 多个实例上的成员可能同时修改同一个公会, 所有修改都通过update完成:
+// 读出文档, 在内存中修改, 再以version为条件写回, 冲突时重新读取并重试.
+// 玩家所属的公会单独保存在COLLECTION_MEMBERS中, 以userid为_id, 保证一个玩家只能加入一个公会.
+// 每次修改都写入WAL.
+const (
+	COLLECTION_GUILDS    = "guilds"
+	COLLECTION_MEMBERS   = "guild_members"
+	COLLECTION_DONATIONS = "guild_donations"
+
+	MAX_RETRY    = 5  // 并发修改冲突时的最大重试次数
+	MAX_REQUESTS = 50 // 入会申请上限, 超过后丢弃最早的申请
+	MAX_INVITES  = 50 // 邀请上限, 超过后丢弃最早的邀请
+	MAX_NAME     = 24 // 名字最大长度(字节)
+	MAX_NOTICE   = 256
+)
+
+// 职位
+const (
+	ROLE_MEMBER = int32(1) // 成员
+	ROLE_ELDER  = int32(2) // 长老
+	ROLE_VICE   = int32(3) // 副会长
+	ROLE_LEADER = int32(4) // 会长
+)
+
+// 权限
+const (
+	PERM_APPROVE = 1 << iota // 审批入会申请
+	PERM_INVITE              // 邀请
+	PERM_KICK                // 踢出职位更低的成员
+	PERM_NOTICE              // 修改公告
+	PERM_APPOINT             // 任命职位更低的成员
+	PERM_DISBAND             // 解散
+)
+
+var _permissions = map[int32]int{
+	ROLE_MEMBER: 0,
+	ROLE_ELDER:  PERM_APPROVE | PERM_INVITE,
+	ROLE_VICE:   PERM_APPROVE | PERM_INVITE | PERM_KICK | PERM_NOTICE | PERM_APPOINT,
+	ROLE_LEADER: PERM_APPROVE | PERM_INVITE | PERM_KICK | PERM_NOTICE | PERM_APPOINT | PERM_DISBAND,
+}
+
+// 事件, 通过Notify通知上层
+const (
+	EVENT_JOIN     = int32(1)
+	EVENT_LEAVE    = int32(2)
+	EVENT_KICK     = int32(3)
+	EVENT_ROLE     = int32(4)
+	EVENT_LEVEL_UP = int32(5)
+	EVENT_DISBAND  = int32(6)
+	EVENT_NOTICE   = int32(7)
+	EVENT_APPLY    = int32(8)
+	EVENT_DONATE   = int32(9)
+)
+
+var (
+	ERROR_GUILD_NOT_FOUND   = errors.New("guild not found")
+	ERROR_IN_GUILD          = errors.New("already in a guild")
+	ERROR_NOT_IN_GUILD      = errors.New("not in guild")
+	ERROR_NAME_EXISTS       = errors.New("guild name exists")
+	ERROR_NAME_INVALID      = errors.New("invalid guild name or notice")
+	ERROR_NO_PERMISSION     = errors.New("permission denied")
+	ERROR_GUILD_FULL        = errors.New("guild full")
+	ERROR_REQUEST_NOT_FOUND = errors.New("guild request not found")
+	ERROR_INVITE_NOT_FOUND  = errors.New("guild invite not found")
+	ERROR_LEADER_LEAVE      = errors.New("leader cannot leave, transfer or disband first")
+	ERROR_DONATION_INVALID  = errors.New("invalid donation")
+	ERROR_CHARGE            = errors.New("charge unavailable")
+	ERROR_CONFLICT          = errors.New("guild modified concurrently, try again")
+)
+
+type Member struct {
+	UserId       int32     `bson:"userid"`
+	Role         int32     `bson:"role"`
+	Contribution int64     `bson:"contribution"` // 累计贡献
+	JoinedAt     time.Time `bson:"joined_at"`
+}
+
+// 入会申请或邀请
+type Request struct {
+	UserId    int32     `bson:"userid"`
+	From      int32     `bson:"from,omitempty"` // 邀请人
+	CreatedAt time.Time `bson:"created_at"`
+}
+
+type Guild struct {
+	Id        string    `bson:"_id"`
+	Name      string    `bson:"name"`
+	Notice    string    `bson:"notice"`
+	Level     int32     `bson:"level"`
+	Exp       int64     `bson:"exp"` // 当前等级的经验
+	Members   []Member  `bson:"members"`
+	Requests  []Request `bson:"requests"`
+	Invites   []Request `bson:"invites"`
+	Version   int64     `bson:"version"` // 乐观锁
+	CreatedAt time.Time `bson:"created_at"`
+}
+
+// 玩家所属的公会
+type membership struct {
+	UserId  int32  `bson:"_id"`
+	GuildId string `bson:"guild"`
+}
+
+// 捐献流水
+type Record struct {
+	Id           bson.ObjectId `bson:"_id"`
+	GuildId      string        `bson:"guild"`
+	UserId       int32         `bson:"userid"`
+	Donation     int32         `bson:"donation"`
+	Currency     int32         `bson:"currency"`
+	Cost         int64         `bson:"cost"`
+	Contribution int64         `bson:"contribution"`
+	Exp          int64         `bson:"exp"`
+	CreatedAt    time.Time     `bson:"created_at"`
+}
+
+// 公会等级, 由数值表配置
+type Level struct {
+	Exp        int64 // 升到下一级需要的经验, 0为满级
+	MaxMembers int
+}
+
+// 捐献档位, 由数值表配置
+type Donation struct {
+	Currency     int32
+	Cost         int64
+	Contribution int64 // 个人贡献
+	Exp          int64 // 公会经验
+}
+
+type Config struct {
+	Levels         []Level // Levels[0]为1级
+	Donations      map[int32]Donation
+	CreateCurrency int32
+	CreateCost     int64
+}
+
+var (
+	_store  store
+	_config = &Config{Levels: []Level{{MaxMembers: 30}}}
+	_mu     sync.RWMutex
+
+	// Notify 公会事件, 由上层设置, 用于推送和维护公会频道
+	Notify func(g *Guild, event int32, userid int32)
+
+	// Charge 扣除货币, amount为负时为返还, 由上层(货币)设置
+	Charge func(userid int32, currency int32, amount int64, reason string) error
+)
+
+func Init(database *db.Database) {
+	if database.IsLocal() {
+		_store = new_memory_store(database)
+	} else {
+		_store = new_mongo_store(database)
+	}
+}
+
+// SetConfig 设置等级和捐献配置, 数值表热更新时调用
+func SetConfig(cfg *Config) {
+	if len(cfg.Levels) == 0 {
+		return
+	}
+	_mu.Lock()
+	_config = cfg
+	_mu.Unlock()
+}
+
+func config() *Config {
+	_mu.RLock()
+	defer _mu.RUnlock()
+	return _config
+}
+
+func can(role int32, perm int) bool {
+	return _permissions[role]&perm != 0
+}
+
+// MaxMembers 当前等级的成员上限
+func (g *Guild) MaxMembers() int {
+	levels := config().Levels
+	if int(g.Level) > len(levels) {
+		return levels[len(levels)-1].MaxMembers
+	}
+	return levels[g.Level-1].MaxMembers
+}
+
+// Member 查找成员, 不存在返回nil
+func (g *Guild) Member(userid int32) *Member {
+	for k := range g.Members {
+		if g.Members[k].UserId == userid {
+			return &g.Members[k]
+		}
+	}
+	return nil
+}
+
+// Can 成员是否拥有权限
+func (g *Guild) Can(userid int32, perm int) bool {
+	_, err := check(g, userid, perm)
+	return err == nil
+}
+
+// MemberIds 全部成员id
+func (g *Guild) MemberIds() []int32 {
+	ids := make([]int32, 0, len(g.Members))
+	for k := range g.Members {
+		ids = append(ids, g.Members[k].UserId)
+	}
+	return ids
+}
+
+func (g *Guild) remove_member(userid int32) {
+	for k := range g.Members {
+		if g.Members[k].UserId == userid {
+			g.Members = append(g.Members[:k], g.Members[k+1:]...)
+			return
+		}
+	}
+}
+
+// 查找玩家的申请或邀请, 不修改reqs
+func has_request(reqs []Request, userid int32) bool {
+	for k := range reqs {
+		if reqs[k].UserId == userid {
+			return true
+		}
+	}
+	return false
+}
+
+func remove_request(reqs []Request, userid int32) ([]Request, bool) {
+	for k := range reqs {
+		if reqs[k].UserId == userid {
+			return append(reqs[:k], reqs[k+1:]...), true
+		}
+	}
+	return reqs, false
+}
+
+// 添加申请或邀请, 已存在时更新时间, 超过上限时丢弃最早的
+func add_request(reqs []Request, r Request, max int) []Request {
+	reqs, _ = remove_request(reqs, r.UserId)
+	reqs = append(reqs, r)
+	if len(reqs) > max {
+		reqs = reqs[len(reqs)-max:]
+	}
+	return reqs
+}
+
+// 检查操作者权限, 返回操作者
+func check(g *Guild, userid int32, perm int) (*Member, error) {
+	m := g.Member(userid)
+	if m == nil {
+		return nil, ERROR_NOT_IN_GUILD
+	}
+	if !can(m.Role, perm) {
+		return nil, ERROR_NO_PERMISSION
+	}
+	return m, nil
+}
+
+func valid_text(s string, max int) bool {
+	return s != "" && len(s) <= max && utf8.ValidString(s)
+}
+
+func notify(g *Guild, event int32, userid int32) {
+	if Notify != nil {
+		Notify(g, event, userid)
+	}
+}
+
+// 乐观锁更新: fn在内存中修改公会, 写回时version不一致则重试
+func update(id string, fn func(g *Guild) error) (*Guild, error) {
+	for i := 0; i < MAX_RETRY; i++ {
+		g, err := _store.get(id)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := fn(g); err != nil {
+			return nil, err
+		}
+
+		version := g.Version
+		g.Version++
+		if ok, err := _store.replace(g, version); err != nil {
+			return nil, err
+		} else if ok {
+			return g, nil
+		}
+	}
+	return nil, ERROR_CONFLICT
+}
+
+func commit(g *Guild, op string, userid int32, fields bson.M) {
+	record := bson.M{"op": op, "userid": userid, "version": g.Version}
+	for k, v := range fields {
+		record[k] = v
+	}
+	kafka.CommitUpdate(g.Id, record, COLLECTION_GUILDS)
+}
+
+// Get 读取公会
+func Get(id string) (*Guild, error) {
+	return _store.get(id)
+}
+
+// Of 玩家所在公会的id, 不在公会中返回空
+func Of(userid int32) (string, error) {
+	return _store.of(userid)
+}
+
+// Mine 玩家所在的公会
+func Mine(userid int32) (*Guild, error) {
+	id, err := Of(userid)
+	if err != nil {
+		return nil, err
+	}
+	if id == "" {
+		return nil, ERROR_NOT_IN_GUILD
+	}
+	return Get(id)
+}
+
+// 占用玩家的公会归属, 已在公会中返回ERROR_IN_GUILD
+func bind(userid int32, id string) error {
+	return _store.bind(userid, id)
+}
+
+func unbind(userid int32, id string) {
+	_store.unbind(userid, id)
+}
+
+// 深拷贝, 内存存储中的文档不能和调用者共享切片
+func (g *Guild) clone() *Guild {
+	c := *g
+	c.Members = append([]Member{}, g.Members...)
+	c.Requests = append([]Request{}, g.Requests...)
+	c.Invites = append([]Request{}, g.Invites...)
+	return &c
+}
@@ -0,0 +1,101 @@
+package guild
+
+import (
+	"testing"
+
+	"game/kafka"
+)
+
+func init() {
+	kafka.InitDiscard()
+}
+
+func TestLevelUp(t *testing.T) {
+	SetConfig(&Config{Levels: []Level{{100, 10}, {200, 20}, {0, 30}}})
+	defer SetConfig(&Config{Levels: []Level{{MaxMembers: 30}}})
+
+	g := &Guild{Level: 1, Exp: 350}
+	level_up(g)
+	if g.Level != 3 || g.Exp != 50 || g.MaxMembers() != 30 {
+		t.Fatal("unexpected level:", g.Level, g.Exp, g.MaxMembers())
+	}
+
+	// 满级后经验继续累积
+	g.Exp += 1000
+	level_up(g)
+	if g.Level != 3 {
+		t.Fatal("level overflow:", g.Level)
+	}
+}
+
+func TestRequests(t *testing.T) {
+	var reqs []Request
+	for i := int32(0); i < MAX_REQUESTS+5; i++ {
+		reqs = add_request(reqs, Request{UserId: i}, MAX_REQUESTS)
+	}
+	if len(reqs) != MAX_REQUESTS || reqs[0].UserId != 5 {
+		t.Fatal("unexpected requests:", len(reqs), reqs[0])
+	}
+
+	reqs = add_request(reqs, Request{UserId: 5}, MAX_REQUESTS)
+	if len(reqs) != MAX_REQUESTS || reqs[len(reqs)-1].UserId != 5 {
+		t.Fatal("duplicated request not moved to tail")
+	}
+	if _, ok := remove_request(reqs, 1000); ok {
+		t.Fatal("removed non-existent request")
+	}
+}
+
+func TestPermissions(t *testing.T) {
+	g := &Guild{Members: []Member{{UserId: 1, Role: ROLE_LEADER}, {UserId: 2, Role: ROLE_ELDER}}}
+	if _, err := check(g, 2, PERM_KICK); err != ERROR_NO_PERMISSION {
+		t.Fatal("elder should not kick, got:", err)
+	}
+	if _, err := check(g, 2, PERM_APPROVE); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := check(g, 3, PERM_APPROVE); err != ERROR_NOT_IN_GUILD {
+		t.Fatal("expect not in guild, got:", err)
+	}
+	if _, err := check(g, 1, PERM_DISBAND); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestChargeUnavailable(t *testing.T) {
+	SetConfig(&Config{Levels: []Level{{MaxMembers: 30}}, Donations: map[int32]Donation{1: {Currency: 1, Cost: 10}}})
+	defer SetConfig(&Config{Levels: []Level{{MaxMembers: 30}}})
+
+	// 没有设置扣费接口时拒绝捐献, 不会免费增加贡献
+	if err := Donate(1, 1); err != ERROR_CHARGE {
+		t.Fatal("expect charge unavailable, got:", err)
+	}
+}
+
+func TestAcceptInvite(t *testing.T) {
+	_store = new_memory_store(nil)
+	g, err := Create(1, "guild")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []int32{10, 11, 12} {
+		if _, err := Invite(1, id); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 中间的邀请被接受, 其余邀请保持不变
+	if err := AcceptInvite(11, g.Id); err != nil {
+		t.Fatal(err)
+	}
+	g, _ = Get(g.Id)
+	if len(g.Invites) != 2 || g.Invites[0].UserId != 10 || g.Invites[1].UserId != 12 {
+		t.Fatal("unexpected invites:", g.Invites)
+	}
+	if g.Member(11) == nil {
+		t.Fatal("not joined")
+	}
+	if err := AcceptInvite(13, g.Id); err != ERROR_INVITE_NOT_FOUND {
+		t.Fatal("expect invite not found, got:", err)
+	}
+}
@@ -0,0 +1,441 @@
+package guild
+
+import (
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	MAX_RECORDS = 100 // 捐献流水查询的最大条数
+)
+
+// 返还已扣除的货币
+func refund(userid int32, currency int32, amount int64, reason string) {
+	if err := Charge(userid, currency, -amount, reason); err != nil {
+		log.Error("guild: refund failed:", userid, currency, amount, err)
+	}
+}
+
+// Create 创建公会, 创建者成为会长
+func Create(userid int32, name string) (*Guild, error) {
+	if !valid_text(name, MAX_NAME) {
+		return nil, ERROR_NAME_INVALID
+	}
+
+	id := bson.NewObjectId().Hex()
+	if err := bind(userid, id); err != nil {
+		return nil, err
+	}
+
+	cfg := config()
+	if cfg.CreateCost > 0 {
+		if Charge == nil {
+			unbind(userid, id)
+			return nil, ERROR_CHARGE
+		}
+		if err := Charge(userid, cfg.CreateCurrency, cfg.CreateCost, "guild_create"); err != nil {
+			unbind(userid, id)
+			return nil, err
+		}
+	}
+
+	now := time.Now()
+	g := &Guild{
+		Id:        id,
+		Name:      name,
+		Level:     1,
+		Members:   []Member{{UserId: userid, Role: ROLE_LEADER, JoinedAt: now}},
+		Requests:  []Request{},
+		Invites:   []Request{},
+		CreatedAt: now,
+	}
+	if err := _store.insert(g); err != nil {
+		unbind(userid, id)
+		if cfg.CreateCost > 0 {
+			refund(userid, cfg.CreateCurrency, cfg.CreateCost, "guild_create")
+		}
+		return nil, err
+	}
+
+	commit(g, "create", userid, bson.M{"name": name})
+	notify(g, EVENT_JOIN, userid)
+	return g, nil
+}
+
+// Disband 解散公会
+func Disband(userid int32) error {
+	g, err := Mine(userid)
+	if err != nil {
+		return err
+	}
+	if _, err := check(g, userid, PERM_DISBAND); err != nil {
+		return err
+	}
+
+	if ok, err := _store.remove(g.Id, g.Version); err != nil {
+		return err
+	} else if !ok {
+		return ERROR_CONFLICT
+	}
+	_store.unbind_all(g.Id)
+
+	commit(g, "disband", userid, nil)
+	notify(g, EVENT_DISBAND, userid)
+	return nil
+}
+
+// Apply 申请加入公会
+func Apply(userid int32, id string) error {
+	if cur, err := Of(userid); err != nil {
+		return err
+	} else if cur != "" {
+		return ERROR_IN_GUILD
+	}
+
+	g, err := update(id, func(g *Guild) error {
+		if len(g.Members) >= g.MaxMembers() {
+			return ERROR_GUILD_FULL
+		}
+		g.Requests = add_request(g.Requests, Request{UserId: userid, CreatedAt: time.Now()}, MAX_REQUESTS)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	commit(g, "apply", userid, nil)
+	notify(g, EVENT_APPLY, userid)
+	return nil
+}
+
+// 加入公会: 先占用玩家的公会归属, 再写入成员, 失败时释放
+func join(id string, userid int32, fn func(g *Guild) error) (*Guild, error) {
+	if err := bind(userid, id); err != nil {
+		return nil, err
+	}
+
+	g, err := update(id, func(g *Guild) error {
+		if err := fn(g); err != nil {
+			return err
+		}
+		if g.Member(userid) != nil {
+			return nil
+		}
+		if len(g.Members) >= g.MaxMembers() {
+			return ERROR_GUILD_FULL
+		}
+		g.Requests, _ = remove_request(g.Requests, userid)
+		g.Invites, _ = remove_request(g.Invites, userid)
+		g.Members = append(g.Members, Member{UserId: userid, Role: ROLE_MEMBER, JoinedAt: time.Now()})
+		return nil
+	})
+	if err != nil {
+		unbind(userid, id)
+		return nil, err
+	}
+
+	commit(g, "join", userid, nil)
+	notify(g, EVENT_JOIN, userid)
+	return g, nil
+}
+
+// Accept 同意入会申请
+func Accept(userid, applicant int32) error {
+	id, err := Of(userid)
+	if err != nil {
+		return err
+	} else if id == "" {
+		return ERROR_NOT_IN_GUILD
+	}
+
+	_, err = join(id, applicant, func(g *Guild) error {
+		if _, err := check(g, userid, PERM_APPROVE); err != nil {
+			return err
+		}
+		var ok bool
+		if g.Requests, ok = remove_request(g.Requests, applicant); !ok {
+			return ERROR_REQUEST_NOT_FOUND
+		}
+		return nil
+	})
+	if err == ERROR_IN_GUILD { // 已加入其他公会, 清除申请
+		Reject(userid, applicant)
+	}
+	return err
+}
+
+// Reject 拒绝入会申请
+func Reject(userid, applicant int32) error {
+	id, err := Of(userid)
+	if err != nil {
+		return err
+	} else if id == "" {
+		return ERROR_NOT_IN_GUILD
+	}
+
+	_, err = update(id, func(g *Guild) error {
+		if _, err := check(g, userid, PERM_APPROVE); err != nil {
+			return err
+		}
+		var ok bool
+		if g.Requests, ok = remove_request(g.Requests, applicant); !ok {
+			return ERROR_REQUEST_NOT_FOUND
+		}
+		return nil
+	})
+	return err
+}
+
+// Invite 邀请玩家加入, 返回公会用于通知被邀请者
+func Invite(userid, target int32) (*Guild, error) {
+	id, err := Of(userid)
+	if err != nil {
+		return nil, err
+	} else if id == "" {
+		return nil, ERROR_NOT_IN_GUILD
+	}
+	if cur, err := Of(target); err != nil {
+		return nil, err
+	} else if cur != "" {
+		return nil, ERROR_IN_GUILD
+	}
+
+	g, err := update(id, func(g *Guild) error {
+		if _, err := check(g, userid, PERM_INVITE); err != nil {
+			return err
+		}
+		g.Invites = add_request(g.Invites, Request{UserId: target, From: userid, CreatedAt: time.Now()}, MAX_INVITES)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	commit(g, "invite", userid, bson.M{"target": target})
+	return g, nil
+}
+
+// AcceptInvite 接受邀请
+func AcceptInvite(userid int32, id string) error {
+	_, err := join(id, userid, func(g *Guild) error {
+		if !has_request(g.Invites, userid) {
+			return ERROR_INVITE_NOT_FOUND
+		}
+		return nil
+	})
+	return err
+}
+
+// Leave 退出公会, 会长需要先转让或解散
+func Leave(userid int32) error {
+	id, err := Of(userid)
+	if err != nil {
+		return err
+	} else if id == "" {
+		return ERROR_NOT_IN_GUILD
+	}
+
+	g, err := update(id, func(g *Guild) error {
+		m := g.Member(userid)
+		if m == nil {
+			return ERROR_NOT_IN_GUILD
+		}
+		if m.Role == ROLE_LEADER {
+			return ERROR_LEADER_LEAVE
+		}
+		g.remove_member(userid)
+		return nil
+	})
+	if err == ERROR_GUILD_NOT_FOUND || err == ERROR_NOT_IN_GUILD {
+		unbind(userid, id)
+		return ERROR_NOT_IN_GUILD
+	} else if err != nil {
+		return err
+	}
+
+	unbind(userid, id)
+	commit(g, "leave", userid, nil)
+	notify(g, EVENT_LEAVE, userid)
+	return nil
+}
+
+// Kick 踢出职位更低的成员
+func Kick(userid, target int32) error {
+	id, err := Of(userid)
+	if err != nil {
+		return err
+	} else if id == "" {
+		return ERROR_NOT_IN_GUILD
+	}
+
+	g, err := update(id, func(g *Guild) error {
+		m, err := check(g, userid, PERM_KICK)
+		if err != nil {
+			return err
+		}
+		t := g.Member(target)
+		if t == nil {
+			return ERROR_NOT_IN_GUILD
+		}
+		if t.Role >= m.Role {
+			return ERROR_NO_PERMISSION
+		}
+		g.remove_member(target)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	unbind(target, id)
+	commit(g, "kick", userid, bson.M{"target": target})
+	notify(g, EVENT_KICK, target)
+	return nil
+}
+
+// SetRole 任命职位, 会长任命别人为会长时转让会长, 自己成为副会长
+func SetRole(userid, target, role int32) error {
+	if role < ROLE_MEMBER || role > ROLE_LEADER || userid == target {
+		return ERROR_NO_PERMISSION
+	}
+	id, err := Of(userid)
+	if err != nil {
+		return err
+	} else if id == "" {
+		return ERROR_NOT_IN_GUILD
+	}
+
+	g, err := update(id, func(g *Guild) error {
+		m, err := check(g, userid, PERM_APPOINT)
+		if err != nil {
+			return err
+		}
+		t := g.Member(target)
+		if t == nil {
+			return ERROR_NOT_IN_GUILD
+		}
+		if t.Role >= m.Role {
+			return ERROR_NO_PERMISSION
+		}
+		if role == ROLE_LEADER && m.Role == ROLE_LEADER {
+			m.Role = ROLE_VICE
+		} else if role >= m.Role {
+			return ERROR_NO_PERMISSION
+		}
+		t.Role = role
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	commit(g, "role", userid, bson.M{"target": target, "role": role})
+	notify(g, EVENT_ROLE, target)
+	return nil
+}
+
+// SetNotice 修改公告
+func SetNotice(userid int32, notice string) error {
+	if len(notice) > MAX_NOTICE || (notice != "" && !valid_text(notice, MAX_NOTICE)) {
+		return ERROR_NAME_INVALID
+	}
+	id, err := Of(userid)
+	if err != nil {
+		return err
+	} else if id == "" {
+		return ERROR_NOT_IN_GUILD
+	}
+
+	g, err := update(id, func(g *Guild) error {
+		if _, err := check(g, userid, PERM_NOTICE); err != nil {
+			return err
+		}
+		g.Notice = notice
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	commit(g, "notice", userid, nil)
+	notify(g, EVENT_NOTICE, userid)
+	return nil
+}
+
+// 经验足够时升级, 可以连续升级
+func level_up(g *Guild) {
+	levels := config().Levels
+	for int(g.Level) < len(levels) {
+		need := levels[g.Level-1].Exp
+		if need <= 0 || g.Exp < need {
+			return
+		}
+		g.Exp -= need
+		g.Level++
+	}
+}
+
+// Donate 按档位捐献, 扣除货币后增加个人贡献和公会经验
+func Donate(userid int32, donation int32) error {
+	d, ok := config().Donations[donation]
+	if !ok || d.Cost <= 0 {
+		return ERROR_DONATION_INVALID
+	}
+	if Charge == nil {
+		return ERROR_CHARGE
+	}
+	id, err := Of(userid)
+	if err != nil {
+		return err
+	} else if id == "" {
+		return ERROR_NOT_IN_GUILD
+	}
+
+	if err := Charge(userid, d.Currency, d.Cost, "guild_donate"); err != nil {
+		return err
+	}
+
+	var from int32
+	g, err := update(id, func(g *Guild) error {
+		m := g.Member(userid)
+		if m == nil {
+			return ERROR_NOT_IN_GUILD
+		}
+		from = g.Level
+		m.Contribution += d.Contribution
+		g.Exp += d.Exp
+		level_up(g)
+		return nil
+	})
+	if err != nil {
+		refund(userid, d.Currency, d.Cost, "guild_donate")
+		return err
+	}
+
+	record := &Record{
+		Id:           bson.NewObjectId(),
+		GuildId:      id,
+		UserId:       userid,
+		Donation:     donation,
+		Currency:     d.Currency,
+		Cost:         d.Cost,
+		Contribution: d.Contribution,
+		Exp:          d.Exp,
+		CreatedAt:    time.Now(),
+	}
+	if err := _store.record(record); err != nil {
+		log.Error(err)
+	}
+
+	commit(g, "donate", userid, bson.M{"donation": donation, "contribution": d.Contribution, "exp": d.Exp})
+	notify(g, EVENT_DONATE, userid)
+	if g.Level > from {
+		commit(g, "level_up", userid, bson.M{"level": g.Level})
+		notify(g, EVENT_LEVEL_UP, userid)
+	}
+	return nil
+}
+
+// Records 最近的捐献流水
+func Records(id string) ([]Record, error) {
+	return _store.records(id, MAX_RECORDS)
+}
@@ -0,0 +1,259 @@
+package guild
+
+import (
+	"sort"
+	"sync"
+
+	"game/db"
+
+	log "github.com/Sirupsen/logrus"
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// 公会, 成员归属和捐献流水的存储, replace和remove是以version为条件的比较并交换
+type store interface {
+	insert(g *Guild) error // 名字已存在返回ERROR_NAME_EXISTS
+	get(id string) (*Guild, error)
+	replace(g *Guild, version int64) (bool, error) // 只在当前version一致时替换, 返回是否成功
+	remove(id string, version int64) (bool, error)
+	bind(userid int32, id string) error // 已在公会中返回ERROR_IN_GUILD
+	unbind(userid int32, id string)
+	unbind_all(id string) // 解散时清除全部成员的归属
+	of(userid int32) (string, error)
+	record(r *Record) error
+	records(id string, limit int) ([]Record, error) // 按时间从新到旧
+}
+
+// mongodb存储
+type mongo_store struct {
+	db *db.Database
+}
+
+func new_mongo_store(database *db.Database) *mongo_store {
+	err := database.Execute(func(sess *mgo.Session) error {
+		if err := sess.DB("").C(COLLECTION_GUILDS).EnsureIndex(mgo.Index{Key: []string{"name"}, Unique: true}); err != nil {
+			return err
+		}
+		if err := sess.DB("").C(COLLECTION_MEMBERS).EnsureIndex(mgo.Index{Key: []string{"guild"}}); err != nil {
+			return err
+		}
+		return sess.DB("").C(COLLECTION_DONATIONS).EnsureIndex(mgo.Index{Key: []string{"guild", "-created_at"}})
+	})
+	if err != nil {
+		log.Error(err)
+	}
+	return &mongo_store{db: database}
+}
+
+func (s *mongo_store) insert(g *Guild) error {
+	err := s.db.Execute(func(sess *mgo.Session) error {
+		return sess.DB("").C(COLLECTION_GUILDS).Insert(g)
+	})
+	if mgo.IsDup(err) {
+		return ERROR_NAME_EXISTS
+	}
+	return err
+}
+
+func (s *mongo_store) get(id string) (*Guild, error) {
+	g := &Guild{}
+	err := s.db.Execute(func(sess *mgo.Session) error {
+		return sess.DB("").C(COLLECTION_GUILDS).FindId(id).One(g)
+	})
+	if err == mgo.ErrNotFound {
+		return nil, ERROR_GUILD_NOT_FOUND
+	} else if err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+func (s *mongo_store) replace(g *Guild, version int64) (bool, error) {
+	err := s.db.Execute(func(sess *mgo.Session) error {
+		return sess.DB("").C(COLLECTION_GUILDS).Update(bson.M{"_id": g.Id, "version": version}, g)
+	})
+	if err == mgo.ErrNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (s *mongo_store) remove(id string, version int64) (bool, error) {
+	err := s.db.Execute(func(sess *mgo.Session) error {
+		return sess.DB("").C(COLLECTION_GUILDS).Remove(bson.M{"_id": id, "version": version})
+	})
+	if err == mgo.ErrNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (s *mongo_store) bind(userid int32, id string) error {
+	err := s.db.Execute(func(sess *mgo.Session) error {
+		return sess.DB("").C(COLLECTION_MEMBERS).Insert(&membership{UserId: userid, GuildId: id})
+	})
+	if mgo.IsDup(err) {
+		return ERROR_IN_GUILD
+	}
+	return err
+}
+
+func (s *mongo_store) unbind(userid int32, id string) {
+	err := s.db.Execute(func(sess *mgo.Session) error {
+		return sess.DB("").C(COLLECTION_MEMBERS).Remove(bson.M{"_id": userid, "guild": id})
+	})
+	if err != nil && err != mgo.ErrNotFound {
+		log.Error("guild: unbind failed:", userid, id, err)
+	}
+}
+
+func (s *mongo_store) unbind_all(id string) {
+	err := s.db.Execute(func(sess *mgo.Session) error {
+		_, err := sess.DB("").C(COLLECTION_MEMBERS).RemoveAll(bson.M{"guild": id})
+		return err
+	})
+	if err != nil {
+		log.Error("guild: unbind members failed:", id, err)
+	}
+}
+
+func (s *mongo_store) of(userid int32) (string, error) {
+	m := &membership{}
+	err := s.db.Execute(func(sess *mgo.Session) error {
+		return sess.DB("").C(COLLECTION_MEMBERS).FindId(userid).One(m)
+	})
+	if err == mgo.ErrNotFound {
+		return "", nil
+	}
+	return m.GuildId, err
+}
+
+func (s *mongo_store) record(r *Record) error {
+	return s.db.Execute(func(sess *mgo.Session) error {
+		return sess.DB("").C(COLLECTION_DONATIONS).Insert(r)
+	})
+}
+
+func (s *mongo_store) records(id string, limit int) (records []Record, err error) {
+	err = s.db.Execute(func(sess *mgo.Session) error {
+		return sess.DB("").C(COLLECTION_DONATIONS).Find(bson.M{"guild": id}).Sort("-created_at").Limit(limit).All(&records)
+	})
+	return
+}
+
+// 基于db.Table的存储, standalone模式下写入data-dir
+// 没有唯一索引, 创建公会时在names锁内检查重名
+type memory_store struct {
+	guilds    *db.Table
+	members   *db.Table
+	donations *db.Table
+	names     sync.Mutex
+}
+
+func new_memory_store(database *db.Database) *memory_store {
+	return &memory_store{
+		guilds:    database.Table(COLLECTION_GUILDS, func() interface{} { return &Guild{} }),
+		members:   database.Table(COLLECTION_MEMBERS, func() interface{} { return &membership{} }),
+		donations: database.Table(COLLECTION_DONATIONS, func() interface{} { return &Record{} }),
+	}
+}
+
+func (s *memory_store) insert(g *Guild) error {
+	s.names.Lock()
+	defer s.names.Unlock()
+	exists := false
+	s.guilds.Scan(func(doc interface{}) {
+		exists = exists || doc.(Guild).Name == g.Name
+	})
+	if exists {
+		return ERROR_NAME_EXISTS
+	}
+	return s.guilds.Insert(g.Id, *g.clone())
+}
+
+func (s *memory_store) get(id string) (*Guild, error) {
+	doc := s.guilds.Get(id)
+	if doc == nil {
+		return nil, ERROR_GUILD_NOT_FOUND
+	}
+	g := doc.(Guild)
+	return g.clone(), nil
+}
+
+// 以version为条件修改, g为nil时删除
+func (s *memory_store) cas(id string, g *Guild, version int64) (ok bool, err error) {
+	err = s.guilds.Modify(id, func(cur interface{}) (interface{}, error) {
+		if cur == nil || cur.(Guild).Version != version {
+			return cur, nil
+		}
+		ok = true
+		if g == nil {
+			return nil, nil
+		}
+		return *g.clone(), nil
+	})
+	return
+}
+
+func (s *memory_store) replace(g *Guild, version int64) (bool, error) {
+	return s.cas(g.Id, g, version)
+}
+
+func (s *memory_store) remove(id string, version int64) (bool, error) {
+	return s.cas(id, nil, version)
+}
+
+func (s *memory_store) bind(userid int32, id string) error {
+	err := s.members.Insert(userid, membership{UserId: userid, GuildId: id})
+	if err == db.ERROR_DUPLICATED {
+		return ERROR_IN_GUILD
+	}
+	return err
+}
+
+func (s *memory_store) unbind(userid int32, id string) {
+	s.members.Modify(userid, func(cur interface{}) (interface{}, error) {
+		if cur != nil && cur.(membership).GuildId == id {
+			return nil, nil
+		}
+		return cur, nil
+	})
+}
+
+func (s *memory_store) unbind_all(id string) {
+	var ids []int32
+	s.members.Scan(func(doc interface{}) {
+		if m := doc.(membership); m.GuildId == id {
+			ids = append(ids, m.UserId)
+		}
+	})
+	for _, userid := range ids {
+		s.unbind(userid, id)
+	}
+}
+
+func (s *memory_store) of(userid int32) (string, error) {
+	if doc := s.members.Get(userid); doc != nil {
+		return doc.(membership).GuildId, nil
+	}
+	return "", nil
+}
+
+func (s *memory_store) record(r *Record) error {
+	return s.donations.Insert(r.Id, *r)
+}
+
+func (s *memory_store) records(id string, limit int) ([]Record, error) {
+	var records []Record
+	s.donations.Scan(func(doc interface{}) {
+		if r := doc.(Record); r.GuildId == id {
+			records = append(records, r)
+		}
+	})
+	sort.Slice(records, func(i, k int) bool { return records[i].CreatedAt.After(records[k].CreatedAt) })
+	if limit > 0 && len(records) > limit {
+		records = records[:limit]
+	}
+	return records, nil
+}
@@ -0,0 +1,152 @@
+package inventory
+
+import (
+	"sync"
+	"time"
+
+	"game/db"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// 背包:
+// 道具定义来自数值表, 以道具id为key, 可堆叠的道具按MaxStack分格, MaxStack为1的是唯一道具, 每个占一格.
+// 每格有背包内唯一的Uid, 客户端按Uid使用道具.
+// 每次操作结束时保存整个背包, 并把每格的变化写入WAL和trace(带原因码), 再通过OnChange增量同步给客户端.
+// 在线玩家的背包缓存在内存中, 会话结束时释放.
+const (
+	COLLECTION_INVENTORIES = "inventories"
+
+	DEFAULT_CAPACITY = 200
+	SWEEP_INTERVAL   = time.Minute // 过期检查间隔
+)
+
+// 变化原因, 写入trace用于经济分析, 上层可以从REASON_CUSTOM开始定义自己的原因
+const (
+	REASON_MAIL    = int32(1)  // 邮件附件
+	REASON_USE     = int32(2)  // 使用
+	REASON_EXPIRE  = int32(3)  // 过期
+	REASON_GM      = int32(4)  // GM指令
+	REASON_QUEST   = int32(5)  // 任务奖励
+	REASON_GACHA   = int32(6)  // 抽卡
+	REASON_SHOP    = int32(7)  // 商店
+	REASON_AUCTION = int32(8)  // 拍卖行托管
+	REASON_RENAME  = int32(9)  // 改名费用
+	REASON_LEVEL   = int32(10) // 升级奖励
+	REASON_CUSTOM  = int32(100)
+)
+
+var (
+	_db       *db.Database
+	_defs     = make(map[int32]*ItemDef)
+	_capacity = DEFAULT_CAPACITY
+	_mu       sync.RWMutex
+
+	// OnUse 道具的使用效果, 由上层设置, 返回错误时不扣除道具
+	OnUse func(userid int32, def *ItemDef, count int32) error
+
+	// OnChange 背包变化, 由上层设置, 用于增量同步给客户端
+	OnChange func(userid int32, changes []Change)
+)
+
+var _default_inventories inventories
+
+// 在线玩家的背包缓存
+type inventories struct {
+	managers map[int32]*ItemManager
+	sync.Mutex
+}
+
+func Init(database *db.Database) {
+	_db = database
+	_default_inventories.managers = make(map[int32]*ItemManager)
+	go sweep()
+}
+
+// SetDefs 设置道具定义, 数值表热更新时调用
+func SetDefs(defs map[int32]*ItemDef) {
+	for _, def := range defs {
+		if def.MaxStack < 1 {
+			def.MaxStack = 1
+		}
+	}
+	_mu.Lock()
+	_defs = defs
+	_mu.Unlock()
+}
+
+// Def 道具定义, 不存在时返回nil
+func Def(id int32) *ItemDef {
+	_mu.RLock()
+	defer _mu.RUnlock()
+	return _defs[id]
+}
+
+// SetCapacity 设置新背包的格子数, 已有的背包不变
+func SetCapacity(n int) {
+	if n <= 0 {
+		return
+	}
+	_mu.Lock()
+	_capacity = n
+	_mu.Unlock()
+}
+
+func default_capacity() int {
+	_mu.RLock()
+	defer _mu.RUnlock()
+	return _capacity
+}
+
+// Get 读取玩家的背包, 不存在时创建
+func Get(userid int32) (*ItemManager, error) {
+	return _default_inventories.get(userid)
+}
+
+// Release 玩家下线时释放缓存
+func Release(userid int32) {
+	_default_inventories.release(userid)
+}
+
+func (s *inventories) get(userid int32) (*ItemManager, error) {
+	s.Lock()
+	defer s.Unlock()
+	if m, ok := s.managers[userid]; ok {
+		return m, nil
+	}
+
+	m := new_manager(userid)
+	if err := _db.Load(COLLECTION_INVENTORIES, userid, m); err != nil && err != db.ERROR_NOT_FOUND {
+		return nil, err
+	}
+	m.Expire(time.Now())
+	s.managers[userid] = m
+	return m, nil
+}
+
+func (s *inventories) release(userid int32) {
+	s.Lock()
+	delete(s.managers, userid)
+	s.Unlock()
+}
+
+// 定时删除在线玩家背包中过期的道具
+func sweep() {
+	for range time.Tick(SWEEP_INTERVAL) {
+		_default_inventories.Lock()
+		managers := make([]*ItemManager, 0, len(_default_inventories.managers))
+		for _, m := range _default_inventories.managers {
+			managers = append(managers, m)
+		}
+		_default_inventories.Unlock()
+
+		now := time.Now()
+		n := 0
+		for _, m := range managers {
+			n += m.Expire(now)
+		}
+		if n > 0 {
+			log.Debugf("inventory: %v item stacks expired", n)
+		}
+	}
+}
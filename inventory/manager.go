@@ -0,0 +1,369 @@
+package inventory
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"game/kafka"
+	"game/mail"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+var (
+	ERROR_UNKNOWN_ITEM   = errors.New("unknown item")
+	ERROR_INVALID_COUNT  = errors.New("invalid item count")
+	ERROR_FULL           = errors.New("inventory full")
+	ERROR_NOT_ENOUGH     = errors.New("not enough items")
+	ERROR_ITEM_NOT_FOUND = errors.New("item not found")
+	ERROR_NOT_USABLE     = errors.New("item not usable")
+)
+
+// 道具定义, 来自数值表
+type ItemDef struct {
+	Id       int32
+	MaxStack int32         // 单格堆叠上限, 1为不可堆叠的唯一道具
+	Expire   time.Duration // 获得后的有效期, 0为永久
+	Usable   bool
+	Effects  []mail.Attachment // 使用一个获得的奖励
+}
+
+// 背包中的一格
+type Item struct {
+	Uid      int64 `bson:"uid"` // 背包内唯一
+	Id       int32 `bson:"id"`
+	Count    int32 `bson:"count"`
+	ExpireAt int64 `bson:"expire_at,omitempty"` // unix秒, 0为永久
+}
+
+// 一格的变化, Count为变化后的数量, 0为删除, 用于增量同步
+type Change struct {
+	Item
+	Delta  int32
+	Reason int32
+}
+
+// 背包, 持久化的文档
+type ItemManager struct {
+	UserId   int32   `bson:"_id"`
+	Items    []*Item `bson:"items"`
+	Capacity int     `bson:"capacity"` // 格子数
+	NextUid  int64   `bson:"next_uid"`
+	changes  []Change
+	mu       sync.Mutex
+}
+
+func new_manager(userid int32) *ItemManager {
+	return &ItemManager{UserId: userid, Items: []*Item{}, Capacity: default_capacity()}
+}
+
+func (m *ItemManager) find(uid int64) (int, *Item) {
+	for k, it := range m.Items {
+		if it.Uid == uid {
+			return k, it
+		}
+	}
+	return -1, nil
+}
+
+func (m *ItemManager) change(it *Item, delta, reason int32) {
+	m.changes = append(m.changes, Change{Item: *it, Delta: delta, Reason: reason})
+}
+
+// 清除数量为0的格子
+func (m *ItemManager) compact() {
+	items := m.Items[:0]
+	for _, it := range m.Items {
+		if it.Count > 0 {
+			items = append(items, it)
+		}
+	}
+	m.Items = items
+}
+
+// 获得道具时的过期时间
+func expire_at(def *ItemDef, now time.Time) int64 {
+	if def.Expire <= 0 {
+		return 0
+	}
+	return now.Add(def.Expire).Unix()
+}
+
+// 需要的新格子数, 优先堆叠到过期时间相同的已有格子
+func (m *ItemManager) slots_needed(def *ItemDef, count int32, expire int64) int {
+	free := int32(0)
+	if def.MaxStack > 1 {
+		for _, it := range m.Items {
+			if it.Id == def.Id && it.ExpireAt == expire {
+				free += def.MaxStack - it.Count
+			}
+		}
+	}
+	if count <= free {
+		return 0
+	}
+	return int((count - free + def.MaxStack - 1) / def.MaxStack)
+}
+
+func (m *ItemManager) add(def *ItemDef, count int32, expire int64, reason int32) {
+	if def.MaxStack > 1 {
+		for _, it := range m.Items {
+			if count == 0 {
+				return
+			}
+			if it.Id == def.Id && it.ExpireAt == expire && it.Count < def.MaxStack {
+				n := def.MaxStack - it.Count
+				if n > count {
+					n = count
+				}
+				it.Count += n
+				count -= n
+				m.change(it, n, reason)
+			}
+		}
+	}
+	for count > 0 {
+		n := def.MaxStack
+		if n > count {
+			n = count
+		}
+		m.NextUid++
+		it := &Item{Uid: m.NextUid, Id: def.Id, Count: n, ExpireAt: expire}
+		m.Items = append(m.Items, it)
+		count -= n
+		m.change(it, n, reason)
+	}
+}
+
+// AddItems 批量添加道具, 全部成功或全部失败
+func (m *ItemManager) AddItems(items map[int32]int32, reason int32) error {
+	defer m.commit()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+
+	slots := 0
+	for id, count := range items {
+		def := Def(id)
+		if def == nil {
+			return ERROR_UNKNOWN_ITEM
+		}
+		if count <= 0 {
+			return ERROR_INVALID_COUNT
+		}
+		slots += m.slots_needed(def, count, expire_at(def, now))
+	}
+	if len(m.Items)+slots > m.Capacity {
+		return ERROR_FULL
+	}
+
+	for id, count := range items {
+		def := Def(id)
+		m.add(def, count, expire_at(def, now), reason)
+	}
+	return nil
+}
+
+// Add 添加道具
+func (m *ItemManager) Add(id, count, reason int32) error {
+	return m.AddItems(map[int32]int32{id: count}, reason)
+}
+
+// Count 道具总数(不包括已过期的)
+func (m *ItemManager) Count(id int32) (n int32) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now().Unix()
+	for _, it := range m.Items {
+		if it.Id == id && (it.ExpireAt == 0 || it.ExpireAt > now) {
+			n += it.Count
+		}
+	}
+	return
+}
+
+// Remove 按道具id扣除, 优先扣除最早过期的
+func (m *ItemManager) Remove(id, count, reason int32) error {
+	defer m.commit()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if count <= 0 {
+		return ERROR_INVALID_COUNT
+	}
+
+	now := time.Now().Unix()
+	var stacks []*Item
+	total := int32(0)
+	for _, it := range m.Items {
+		if it.Id == id && (it.ExpireAt == 0 || it.ExpireAt > now) {
+			stacks = append(stacks, it)
+			total += it.Count
+		}
+	}
+	if total < count {
+		return ERROR_NOT_ENOUGH
+	}
+
+	// 永久的排在最后
+	sort.SliceStable(stacks, func(i, j int) bool {
+		a, b := stacks[i].ExpireAt, stacks[j].ExpireAt
+		return a != 0 && (b == 0 || a < b)
+	})
+	for _, it := range stacks {
+		if count == 0 {
+			break
+		}
+		n := it.Count
+		if n > count {
+			n = count
+		}
+		it.Count -= n
+		count -= n
+		m.change(it, -n, reason)
+	}
+	m.compact()
+	return nil
+}
+
+// RemoveUid 从指定格子扣除
+func (m *ItemManager) RemoveUid(uid int64, count, reason int32) (*Item, error) {
+	defer m.commit()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.remove_uid(uid, count, reason)
+}
+
+func (m *ItemManager) remove_uid(uid int64, count, reason int32) (*Item, error) {
+	if count <= 0 {
+		return nil, ERROR_INVALID_COUNT
+	}
+	_, it := m.find(uid)
+	if it == nil || (it.ExpireAt != 0 && it.ExpireAt <= time.Now().Unix()) {
+		return nil, ERROR_ITEM_NOT_FOUND
+	}
+	if it.Count < count {
+		return nil, ERROR_NOT_ENOUGH
+	}
+	it.Count -= count
+	m.change(it, -count, reason)
+	ret := *it
+	m.compact()
+	return &ret, nil
+}
+
+// Use 使用道具, 效果由上层的OnUse实现, 失败时不扣除
+// 先扣除再调用OnUse, 调用时不持有背包的锁(效果可能再修改背包), 失败时归还到原来的格子
+func (m *ItemManager) Use(uid int64, count int32) error {
+	def, it, err := m.take(uid, count)
+	if err != nil {
+		return err
+	}
+	if err := OnUse(m.UserId, def, count); err != nil {
+		m.restore(it, count)
+		return err
+	}
+	return nil
+}
+
+// 扣除要使用的道具, 返回扣除前的格子
+func (m *ItemManager) take(uid int64, count int32) (*ItemDef, Item, error) {
+	defer m.commit()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, it := m.find(uid)
+	if it == nil {
+		return nil, Item{}, ERROR_ITEM_NOT_FOUND
+	}
+	def := Def(it.Id)
+	if def == nil || !def.Usable || OnUse == nil {
+		return nil, Item{}, ERROR_NOT_USABLE
+	}
+	if it.Count < count {
+		return nil, Item{}, ERROR_NOT_ENOUGH
+	}
+	ret := *it
+	if _, err := m.remove_uid(uid, count, REASON_USE); err != nil {
+		return nil, Item{}, err
+	}
+	return def, ret, nil
+}
+
+// 归还使用失败的道具, 格子已被删除时按原来的Uid和过期时间重建
+func (m *ItemManager) restore(it Item, count int32) {
+	defer m.commit()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, cur := m.find(it.Uid)
+	if cur == nil {
+		cur = &Item{Uid: it.Uid, Id: it.Id, ExpireAt: it.ExpireAt}
+		m.Items = append(m.Items, cur)
+	}
+	cur.Count += count
+	m.change(cur, count, REASON_USE)
+}
+
+// Expire 删除已过期的道具, 返回删除的格子数
+func (m *ItemManager) Expire(now time.Time) int {
+	defer m.commit()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n := 0
+	for _, it := range m.Items {
+		if it.ExpireAt != 0 && it.ExpireAt <= now.Unix() {
+			delta := it.Count
+			it.Count = 0
+			m.change(it, -delta, REASON_EXPIRE)
+			n++
+		}
+	}
+	if n > 0 {
+		m.compact()
+	}
+	return n
+}
+
+// List 全部格子的拷贝
+func (m *ItemManager) List() []Item {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ret := make([]Item, 0, len(m.Items))
+	for _, it := range m.Items {
+		ret = append(ret, *it)
+	}
+	return ret
+}
+
+// 保存并同步变化: 写入数据库, WAL和trace, 再通知上层增量同步给客户端
+func (m *ItemManager) commit() {
+	m.mu.Lock()
+	changes := m.changes
+	m.changes = nil
+	var err error
+	if len(changes) > 0 && _db != nil {
+		err = _db.Save(COLLECTION_INVENTORIES, m.UserId, m)
+	}
+	m.mu.Unlock()
+
+	if len(changes) == 0 {
+		return
+	}
+	if err != nil {
+		log.Error("inventory: save failed:", m.UserId, err)
+	}
+
+	for _, c := range changes {
+		kafka.CommitUpdate(m.UserId, c, COLLECTION_INVENTORIES)
+		kafka.TraceEvent("item_change", m.UserId, map[string]interface{}{
+			"reason": c.Reason,
+			"item":   c.Id,
+			"uid":    c.Uid,
+			"delta":  c.Delta,
+			"count":  c.Count,
+		})
+	}
+	if OnChange != nil {
+		OnChange(m.UserId, changes)
+	}
+}
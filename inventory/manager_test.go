@@ -0,0 +1,105 @@
+package inventory
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"game/kafka"
+)
+
+func init() {
+	kafka.InitDiscard()
+	SetDefs(map[int32]*ItemDef{
+		1: {Id: 1, MaxStack: 10},
+		2: {Id: 2},
+		3: {Id: 3, MaxStack: 10, Expire: time.Hour},
+		4: {Id: 4, MaxStack: 10, Usable: true},
+	})
+}
+
+func TestStack(t *testing.T) {
+	m := new_manager(1)
+	m.Capacity = 3
+	if err := m.Add(1, 15, REASON_GM); err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Items) != 2 || m.Count(1) != 15 {
+		t.Fatal("unexpected stacks:", len(m.Items), m.Count(1))
+	}
+	// 先堆满已有的格子
+	if err := m.Add(1, 5, REASON_GM); err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Items) != 2 {
+		t.Fatal("should fill existing stack:", len(m.Items))
+	}
+
+	// 容量不足时全部失败
+	if err := m.AddItems(map[int32]int32{1: 1, 2: 1}, REASON_GM); err != ERROR_FULL {
+		t.Fatal("expect full, got:", err)
+	}
+	if m.Count(1) != 20 || m.Count(2) != 0 {
+		t.Fatal("partial add:", m.Count(1), m.Count(2))
+	}
+	if err := m.Add(5, 1, REASON_GM); err != ERROR_UNKNOWN_ITEM {
+		t.Fatal("expect unknown item, got:", err)
+	}
+}
+
+func TestRemove(t *testing.T) {
+	m := new_manager(1)
+	m.Add(3, 5, REASON_GM)
+	m.Items[0].ExpireAt = time.Now().Add(time.Minute).Unix()
+	m.Add(3, 5, REASON_GM)
+
+	// 优先扣除最早过期的
+	if err := m.Remove(3, 7, REASON_GM); err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Items) != 1 || m.Items[0].Count != 3 {
+		t.Fatal("unexpected remove:", len(m.Items), m.Items[0].Count)
+	}
+	if err := m.Remove(3, 4, REASON_GM); err != ERROR_NOT_ENOUGH {
+		t.Fatal("expect not enough, got:", err)
+	}
+
+	if n := m.Expire(time.Now().Add(2 * time.Hour)); n != 1 || len(m.Items) != 0 {
+		t.Fatal("unexpected expire:", n, len(m.Items))
+	}
+}
+
+func TestUse(t *testing.T) {
+	m := new_manager(1)
+	m.Add(2, 1, REASON_GM)
+	m.Add(4, 2, REASON_GM)
+	defer func() { OnUse = nil }()
+
+	OnUse = func(userid int32, def *ItemDef, count int32) error { return nil }
+	if err := m.Use(m.Items[0].Uid, 1); err != ERROR_NOT_USABLE {
+		t.Fatal("expect not usable, got:", err)
+	}
+
+	// 使用失败时道具不扣除
+	uid := m.Items[1].Uid
+	OnUse = func(userid int32, def *ItemDef, count int32) error { return errors.New("failed") }
+	if err := m.Use(uid, 2); err == nil {
+		t.Fatal("expect error")
+	}
+	if m.Count(4) != 2 {
+		t.Fatal("use not reverted:", m.Count(4))
+	}
+
+	if _, it := m.find(uid); it == nil || it.Count != 2 {
+		t.Fatal("slot not restored:", it)
+	}
+
+	// 效果中可以再修改背包
+	OnUse = func(userid int32, def *ItemDef, count int32) error { return m.Add(2, count, REASON_USE) }
+	if err := m.Use(uid, 2); err != nil {
+		t.Fatal(err)
+	}
+	if m.Count(4) != 0 || m.Count(2) != 3 || len(m.Items) != 3 {
+		t.Fatal("unexpected use:", m.Count(4), m.Count(2), len(m.Items))
+	}
+}
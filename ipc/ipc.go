@@ -0,0 +1,27 @@
+package ipc
+
+import (
+	. "game/proto"
+	"game/registry"
+)
+
+// Send 向在线玩家的ch_ipc投递一个frame, 由玩家的会话循环转发给agent
+// 不阻塞: 玩家不在线或队列已满时返回false
+func Send(userid int32, frame *Game_Frame) bool {
+	ch, ok := registry.Query(userid).(chan *Game_Frame)
+	if !ok {
+		return false
+	}
+
+	select {
+	case ch <- frame:
+		return true
+	default:
+		return false
+	}
+}
+
+// SendMessage 向在线玩家投递一个消息包(协议号+数据)
+func SendMessage(userid int32, msg []byte) bool {
+	return Send(userid, &Game_Frame{Type: Game_Message, Message: msg})
+}
@@ -13,6 +13,7 @@ import (
 var (
 	kAsyncProducer sarama.AsyncProducer
 	kClient        sarama.Client
+	discard        bool // 单元测试时丢弃全部写入
 )
 
 const WALType = "WAL"
@@ -65,11 +66,15 @@ func Init(brokers []string, waltopic, tracetopic, id string) {
 	initKafka(brokers, waltopic, tracetopic, id)
 }
 
+// InitDiscard 丢弃全部WAL和trace, 只用于单元测试
+func InitDiscard() {
+	discard = true
+}
+
 // Trace user events
 func Trace(content map[string]*json.RawMessage) {
 	if bts, err := json.Marshal(&content); err == nil {
-		msg := &sarama.ProducerMessage{Topic: traceTopic, Value: sarama.ByteEncoder(bts)}
-		kAsyncProducer.Input() <- msg
+		produce(traceTopic, "", bts)
 	} else {
 		log.Println(err)
 	}
@@ -90,13 +95,58 @@ func CommitUpdate(key, data interface{}, tblname string) {
 	kafkaKey := fmt.Sprintf("%v-%v-%v-%v-%v", wal.Type, wal.InstanceId, wal.Table, wal.Host, wal.Key)
 
 	if bts, err := json.Marshal(wal); err == nil {
-		msg := &sarama.ProducerMessage{Topic: walTopic, Key: sarama.StringEncoder(kafkaKey), Value: sarama.ByteEncoder(bts)}
-		kAsyncProducer.Input() <- msg
+		produce(walTopic, kafkaKey, bts)
 	} else {
 		log.Println(err)
 	}
 }
 
+// 写入kafka, standalone模式下写入本地滚动日志
+func produce(topic, key string, value []byte) {
+	if localWriters != nil {
+		localWriters.write(topic, value)
+		return
+	}
+
+	if discard {
+		return
+	}
+	if kAsyncProducer == nil {
+		log.Panicln("kafka: producer not initialized, message dropped:", topic, key)
+	}
+
+	msg := &sarama.ProducerMessage{Topic: topic, Value: sarama.ByteEncoder(value)}
+	if key != "" {
+		msg.Key = sarama.StringEncoder(key)
+	}
+	kAsyncProducer.Input() <- msg
+}
+
 func NewConsumer() (sarama.Consumer, error) {
+	if localWriters != nil {
+		return nil, ERROR_STANDALONE
+	}
 	return sarama.NewConsumerFromClient(kClient)
 }
+
+// TraceEvent 以事件名+字段的形式记录用户事件
+func TraceEvent(event string, userid int32, fields map[string]interface{}) {
+	content := make(map[string]*json.RawMessage)
+	set := func(k string, v interface{}) {
+		if bts, err := json.Marshal(v); err == nil {
+			raw := json.RawMessage(bts)
+			content[k] = &raw
+		} else {
+			log.Println(err)
+		}
+	}
+
+	set("event", event)
+	set("userid", userid)
+	set("instanceId", instanceId)
+	set("created_at", time.Now())
+	for k, v := range fields {
+		set(k, v)
+	}
+	Trace(content)
+}
@@ -0,0 +1,115 @@
+package kafka
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	LOCAL_LOG_MAX_SIZE = 64 << 20 // 单个本地日志文件的最大字节数
+	LOCAL_LOG_EXT      = ".jsonl"
+)
+
+var (
+	ERROR_STANDALONE = errors.New("kafka not available in standalone mode")
+)
+
+var (
+	localWriters *local_writers
+)
+
+// standalone模式下, WAL和trace按topic写入本地滚动的JSON-lines文件
+// 文件名格式: <dir>/<topic>-<yyyymmdd>-<seq>.jsonl, 跨天或超过大小限制时滚动
+type local_writers struct {
+	dir     string
+	writers map[string]*rotate_writer
+	sync.Mutex
+}
+
+type rotate_writer struct {
+	dir   string
+	topic string
+	day   string
+	seq   int
+	size  int64
+	file  *os.File
+}
+
+func InitLocal(dir string, waltopic, tracetopic, id string) {
+	walTopic = waltopic
+	traceTopic = tracetopic
+	instanceId = id
+	host, _ = os.Hostname()
+	topicSuffix = "_" + id
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		log.Fatalln(err)
+	}
+	localWriters = &local_writers{dir: dir, writers: make(map[string]*rotate_writer)}
+}
+
+func (lw *local_writers) write(topic string, value []byte) {
+	lw.Lock()
+	defer lw.Unlock()
+	w, ok := lw.writers[topic]
+	if !ok {
+		w = &rotate_writer{dir: lw.dir, topic: topic}
+		lw.writers[topic] = w
+	}
+
+	if err := w.write(append(value, '\n')); err != nil {
+		log.Println(err)
+	}
+}
+
+func (w *rotate_writer) write(line []byte) error {
+	day := time.Now().Format("20060102")
+	if w.file == nil || w.day != day || w.size+int64(len(line)) > LOCAL_LOG_MAX_SIZE {
+		if err := w.rotate(day); err != nil {
+			return err
+		}
+	}
+
+	n, err := w.file.Write(line)
+	w.size += int64(n)
+	return err
+}
+
+// 打开下一个可用的日志文件
+func (w *rotate_writer) rotate(day string) error {
+	if w.file != nil {
+		w.file.Close()
+		w.file = nil
+	}
+
+	if w.day != day {
+		w.day = day
+		w.seq = 0
+	}
+
+	for {
+		name := filepath.Join(w.dir, fmt.Sprintf("%v-%v-%03d%v", w.topic, w.day, w.seq, LOCAL_LOG_EXT))
+		fi, err := os.Stat(name)
+		if err == nil && fi.Size() >= LOCAL_LOG_MAX_SIZE {
+			w.seq++
+			continue
+		}
+
+		f, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return err
+		}
+		w.file = f
+		w.size = 0
+		if fi != nil {
+			w.size = fi.Size()
+		}
+		w.seq++
+		return nil
+	}
+}
@@ -0,0 +1,76 @@
+package kafka
+
+import (
+	"log"
+
+	"github.com/Shopify/sarama"
+)
+
+// 订阅收到的一条消息, Offset为消息在分区中的位置
+type Message struct {
+	Partition int32
+	Offset    int64
+	Value     []byte
+}
+
+// Publish 向指定topic发送消息, 用于实例间广播
+func Publish(topic string, value []byte) {
+	produce(topic, "", value)
+}
+
+// Subscribe 从最新位置开始消费topic的全部分区, 实例间广播使用
+// standalone模式下返回ERROR_STANDALONE
+func Subscribe(topic string) (<-chan []byte, error) {
+	msgs, err := SubscribeFrom(topic, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	ch := make(chan []byte, 1024)
+	go func() {
+		for msg := range msgs {
+			ch <- msg.Value
+		}
+	}()
+	return ch, nil
+}
+
+// SubscribeFrom 从offsets中记录的位置(分区 -> 下一条消息的offset)继续消费, 用于重启后补齐快照之后的消息;
+// 没有记录的分区从最新位置开始, 记录的位置已被kafka清理时从最早位置开始
+func SubscribeFrom(topic string, offsets map[int32]int64) (<-chan *Message, error) {
+	consumer, err := NewConsumer()
+	if err != nil {
+		return nil, err
+	}
+
+	partitions, err := consumer.Partitions(topic)
+	if err != nil {
+		consumer.Close()
+		return nil, err
+	}
+
+	ch := make(chan *Message, 1024)
+	for _, partition := range partitions {
+		offset, ok := offsets[partition]
+		if !ok {
+			offset = sarama.OffsetNewest
+		}
+		pc, err := consumer.ConsumePartition(topic, partition, offset)
+		if err == sarama.ErrOffsetOutOfRange {
+			log.Println("offset out of range, consume from oldest:", topic, partition, offset)
+			pc, err = consumer.ConsumePartition(topic, partition, sarama.OffsetOldest)
+		}
+		if err != nil {
+			consumer.Close()
+			return nil, err
+		}
+
+		go func(pc sarama.PartitionConsumer) {
+			for msg := range pc.Messages() {
+				ch <- &Message{Partition: msg.Partition, Offset: msg.Offset, Value: msg.Value}
+			}
+			log.Println("partition consumer closed:", topic)
+		}(pc)
+	}
+	return ch, nil
+}
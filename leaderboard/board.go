@@ -0,0 +1,103 @@
+package leaderboard
+
+import (
+	"sync"
+)
+
+// 一个排行榜
+type Board struct {
+	Name    string
+	season  int32
+	sl      *skiplist
+	entries map[int32]Entry // id -> 当前条目
+	sync.RWMutex
+}
+
+func new_board(name string, season int32) *Board {
+	return &Board{Name: name, season: season, sl: new_skiplist(), entries: make(map[int32]Entry)}
+}
+
+// 更新分数, 分数不变时保留原来的时间
+func (b *Board) update(e Entry) {
+	b.Lock()
+	defer b.Unlock()
+	if old, ok := b.entries[e.Id]; ok {
+		if old.Score == e.Score {
+			return
+		}
+		b.sl.delete(&old)
+	}
+	b.sl.insert(e)
+	b.entries[e.Id] = e
+}
+
+// Remove 从排行榜中删除
+func (b *Board) Remove(id int32) {
+	b.Lock()
+	defer b.Unlock()
+	if old, ok := b.entries[id]; ok {
+		b.sl.delete(&old)
+		delete(b.entries, id)
+	}
+}
+
+// Rank 排名(1开始)和分数, 不在榜上返回0
+func (b *Board) Rank(id int32) (rank int, score int64) {
+	b.RLock()
+	defer b.RUnlock()
+	e, ok := b.entries[id]
+	if !ok {
+		return 0, 0
+	}
+	return b.sl.rank(&e), e.Score
+}
+
+// Top 前n名
+func (b *Board) Top(n int) []Entry {
+	b.RLock()
+	defer b.RUnlock()
+	return b.sl.slice(1, n)
+}
+
+// Range 从排名start(1开始)起的n个条目
+func (b *Board) Range(start, n int) []Entry {
+	b.RLock()
+	defer b.RUnlock()
+	return b.sl.slice(start, n)
+}
+
+// Around 玩家前后各n名(包括自己), 返回起始排名, 不在榜上返回nil
+func (b *Board) Around(id int32, n int) (start int, entries []Entry) {
+	b.RLock()
+	defer b.RUnlock()
+	e, ok := b.entries[id]
+	if !ok {
+		return 0, nil
+	}
+	start = b.sl.rank(&e) - n
+	if start < 1 {
+		start = 1
+	}
+	return start, b.sl.slice(start, 2*n+1)
+}
+
+// Count 上榜人数
+func (b *Board) Count() int {
+	b.RLock()
+	defer b.RUnlock()
+	return b.sl.length
+}
+
+// Season 当前赛季
+func (b *Board) Season() int32 {
+	b.RLock()
+	defer b.RUnlock()
+	return b.season
+}
+
+// 全部条目, 按排名顺序
+func (b *Board) all() []Entry {
+	b.RLock()
+	defer b.RUnlock()
+	return b.sl.slice(1, b.sl.length)
+}
@@ -0,0 +1,322 @@
+package leaderboard
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"game/db"
+	"game/kafka"
+	"game/mail"
+	"game/types"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// 排行榜:
+// 内存中的跳表排行榜, 按名字区分多个榜单, 定期保存快照到数据库, 启动时从快照重建.
+// 多实例部署时, 分数更新经kafka广播给其他实例, 各实例维护相同的内存副本;
+// 快照中记录已处理到的kafka位置, 重启后从该位置继续消费, 补齐快照之后其他实例的更新.
+// 赛季结束时归档旧榜单, 按数值表配置的名次区间通过邮件发放奖励.
+const (
+	BOARD_SCORE = "score" // 基于types.User.Score的排行榜
+
+	COLLECTION_SNAPSHOTS = "leaderboards"
+	COLLECTION_ARCHIVES  = "leaderboard_archives"
+
+	SNAPSHOT_INTERVAL = 5 * time.Minute
+	REWARD_TITLE      = "赛季奖励"
+)
+
+// 快照, 也用于归档
+type snapshot struct {
+	Name      string           `bson:"name"`
+	Season    int32            `bson:"season"`
+	Entries   []Entry          `bson:"entries"`
+	Offsets   map[string]int64 `bson:"offsets,omitempty"` // kafka分区 -> 下一条消息的offset
+	UpdatedAt time.Time        `bson:"updated_at"`
+}
+
+// 赛季奖励, 名次在[RankMin, RankMax]之间的玩家获得
+type Reward struct {
+	RankMin     int
+	RankMax     int
+	Attachments []mail.Attachment
+}
+
+// 实例间同步的消息
+type sync_message struct {
+	InstanceId string `json:"instance"`
+	Board      string `json:"board"`
+	Entry      *Entry `json:"entry,omitempty"`  // 分数更新
+	Season     int32  `json:"season,omitempty"` // 分数更新所属的赛季, 没有Entry时为赛季重置
+}
+
+type leaderboards struct {
+	db         *db.Database
+	boards     map[string]*Board
+	rewards    map[string][]Reward
+	topic      string
+	instanceId string
+	offsets    map[int32]int64 // 已处理到的kafka位置, 分区 -> 下一条消息的offset
+	sync.RWMutex
+}
+
+var (
+	_default_leaderboards leaderboards
+)
+
+func init() {
+	_default_leaderboards.boards = make(map[string]*Board)
+	_default_leaderboards.rewards = make(map[string][]Reward)
+	_default_leaderboards.offsets = make(map[int32]int64)
+}
+
+// Init 从快照重建榜单, 并开始定期保存
+func Init(database *db.Database, names []string) {
+	lb := &_default_leaderboards
+	lb.db = database
+	for _, name := range names {
+		lb.load(name)
+	}
+	go lb.snapshot_loop()
+}
+
+// InitSync 通过kafka topic在实例间同步分数更新, 需要在Init之后调用
+func InitSync(topic, instanceId string) {
+	lb := &_default_leaderboards
+	lb.RLock()
+	offsets := make(map[int32]int64, len(lb.offsets))
+	for p, o := range lb.offsets {
+		offsets[p] = o
+	}
+	lb.RUnlock()
+
+	ch, err := kafka.SubscribeFrom(topic, offsets)
+	if err != nil {
+		log.Error("leaderboard: cross-instance sync disabled:", err)
+		return
+	}
+	lb.topic = topic
+	lb.instanceId = instanceId
+	go lb.receiver(ch)
+}
+
+func (lb *leaderboards) load(name string) {
+	s := &snapshot{}
+	b := new_board(name, 1)
+	if err := lb.db.Load(COLLECTION_SNAPSHOTS, name, s); err == nil {
+		b.season = s.Season
+		for _, e := range s.Entries {
+			b.update(e)
+		}
+		lb.resume_from(s.Offsets)
+		log.Infof("leaderboard %v loaded, season:%v entries:%v", name, s.Season, len(s.Entries))
+	} else if err != db.ERROR_NOT_FOUND {
+		log.Error(err)
+	}
+
+	lb.Lock()
+	lb.boards[name] = b
+	lb.Unlock()
+}
+
+// 多个榜单共用一个topic, 从各快照中最早的位置继续消费
+func (lb *leaderboards) resume_from(offsets map[string]int64) {
+	lb.Lock()
+	defer lb.Unlock()
+	for key, offset := range offsets {
+		p, err := strconv.ParseInt(key, 10, 32)
+		if err != nil {
+			log.Error("leaderboard: invalid partition:", key)
+			continue
+		}
+		if cur, ok := lb.offsets[int32(p)]; !ok || offset < cur {
+			lb.offsets[int32(p)] = offset
+		}
+	}
+}
+
+func (lb *leaderboards) get(name string) *Board {
+	lb.RLock()
+	defer lb.RUnlock()
+	return lb.boards[name]
+}
+
+// 先取kafka位置再取条目, 快照中的条目不会落后于记录的位置
+func (lb *leaderboards) save(b *Board) error {
+	lb.RLock()
+	offsets := make(map[string]int64, len(lb.offsets))
+	for p, o := range lb.offsets {
+		offsets[fmt.Sprint(p)] = o
+	}
+	lb.RUnlock()
+
+	s := &snapshot{Name: b.Name, Season: b.Season(), Entries: b.all(), Offsets: offsets, UpdatedAt: time.Now()}
+	return lb.db.Save(COLLECTION_SNAPSHOTS, b.Name, s)
+}
+
+func (lb *leaderboards) snapshot_loop() {
+	for range time.Tick(SNAPSHOT_INTERVAL) {
+		lb.RLock()
+		boards := make([]*Board, 0, len(lb.boards))
+		for _, b := range lb.boards {
+			boards = append(boards, b)
+		}
+		lb.RUnlock()
+
+		for _, b := range boards {
+			if err := lb.save(b); err != nil {
+				log.Error(err)
+			}
+		}
+	}
+}
+
+func (lb *leaderboards) publish(msg *sync_message) {
+	if lb.topic == "" {
+		return
+	}
+	msg.InstanceId = lb.instanceId
+	if bts, err := json.Marshal(msg); err == nil {
+		kafka.Publish(lb.topic, bts)
+	} else {
+		log.Error(err)
+	}
+}
+
+func (lb *leaderboards) receiver(ch <-chan *kafka.Message) {
+	for m := range ch {
+		lb.apply(m.Value)
+		lb.Lock()
+		lb.offsets[m.Partition] = m.Offset + 1
+		lb.Unlock()
+	}
+}
+
+// 重启后会重放快照之前的部分消息, 旧赛季的更新和已经生效的赛季重置都忽略
+func (lb *leaderboards) apply(bts []byte) {
+	msg := &sync_message{}
+	if err := json.Unmarshal(bts, msg); err != nil {
+		log.Error(err)
+		return
+	}
+	if msg.InstanceId == lb.instanceId {
+		return
+	}
+
+	b := lb.get(msg.Board)
+	if b == nil {
+		return
+	}
+	if msg.Entry != nil {
+		if msg.Season == 0 || msg.Season == b.Season() {
+			b.update(*msg.Entry)
+		}
+	} else if msg.Season > b.Season() {
+		lb.reset(msg.Board, msg.Season)
+	}
+}
+
+func (lb *leaderboards) update(name string, id int32, score int64) {
+	b := lb.get(name)
+	if b == nil {
+		log.Error("leaderboard not exists:", name)
+		return
+	}
+	e := Entry{Id: id, Score: score, Time: time.Now().UnixNano()}
+	b.update(e)
+	lb.publish(&sync_message{Board: name, Entry: &e, Season: b.Season()})
+}
+
+// 替换为新赛季的空榜单, 返回旧榜单
+func (lb *leaderboards) reset(name string, season int32) *Board {
+	lb.Lock()
+	defer lb.Unlock()
+	old := lb.boards[name]
+	lb.boards[name] = new_board(name, season)
+	return old
+}
+
+// 赛季结束: 归档, 发奖, 开始新赛季
+func (lb *leaderboards) new_season(name string) error {
+	b := lb.get(name)
+	if b == nil {
+		return fmt.Errorf("leaderboard not exists: %v", name)
+	}
+
+	season := b.Season()
+	old := lb.reset(name, season+1)
+	entries := old.all()
+	archive := &snapshot{Name: name, Season: season, Entries: entries, UpdatedAt: time.Now()}
+	if err := lb.db.Save(COLLECTION_ARCHIVES, fmt.Sprintf("%v:%v", name, season), archive); err != nil {
+		log.Error(err)
+	}
+	if err := lb.save(lb.get(name)); err != nil {
+		log.Error(err)
+	}
+	lb.publish(&sync_message{Board: name, Season: season + 1})
+	kafka.CommitUpdate(fmt.Sprintf("%v:%v", name, season), archive, COLLECTION_ARCHIVES)
+
+	// 发放奖励
+	lb.RLock()
+	rewards := lb.rewards[name]
+	lb.RUnlock()
+	for _, r := range rewards {
+		for rank := r.RankMin; rank <= r.RankMax && rank <= len(entries); rank++ {
+			e := entries[rank-1]
+			content := fmt.Sprintf("%v 第%v赛季 第%v名", name, season, rank)
+			// 以榜单, 赛季和玩家为key, 重复发放时只发一次
+			key := fmt.Sprintf("%v:%v:%v", name, season, e.Id)
+			if err := mail.SendOnce(key, e.Id, REWARD_TITLE, content, r.Attachments); err != nil {
+				log.Error("leaderboard: reward failed:", e.Id, err)
+			}
+		}
+	}
+	log.Infof("leaderboard %v season %v archived, entries:%v", name, season, len(entries))
+	return nil
+}
+
+// Create 创建一个新榜单(不从快照载入)
+func Create(name string) *Board {
+	lb := &_default_leaderboards
+	lb.Lock()
+	defer lb.Unlock()
+	if b, ok := lb.boards[name]; ok {
+		return b
+	}
+	b := new_board(name, 1)
+	lb.boards[name] = b
+	return b
+}
+
+// Get 查找榜单, 不存在返回nil
+func Get(name string) *Board {
+	return _default_leaderboards.get(name)
+}
+
+// Update 更新分数
+func Update(name string, id int32, score int64) {
+	_default_leaderboards.update(name, id, score)
+}
+
+// UpdateUser 用当前赛季的分数更新分数榜, 没有分数的玩家不上榜
+func UpdateUser(u *types.User) {
+	if score := SeasonScore(u); score > 0 {
+		_default_leaderboards.update(BOARD_SCORE, u.Id, int64(score))
+	}
+}
+
+// SetRewards 设置赛季奖励, 数值表热更新时调用
+func SetRewards(name string, rewards []Reward) {
+	_default_leaderboards.Lock()
+	_default_leaderboards.rewards[name] = rewards
+	_default_leaderboards.Unlock()
+}
+
+// NewSeason 结束当前赛季并开始新赛季, 集群中只能由一个实例调用
+func NewSeason(name string) error {
+	return _default_leaderboards.new_season(name)
+}
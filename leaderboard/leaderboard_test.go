@@ -0,0 +1,126 @@
+package leaderboard
+
+import (
+	"encoding/json"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func TestSkiplist(t *testing.T) {
+	sl := new_skiplist()
+	var all []Entry
+	for i := 0; i < 1000; i++ {
+		e := Entry{Id: int32(i), Score: rand.Int63n(100), Time: rand.Int63n(10)}
+		sl.insert(e)
+		all = append(all, e)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].less(&all[j]) })
+
+	for k := range all {
+		if r := sl.rank(&all[k]); r != k+1 {
+			t.Fatalf("rank of %v: expect %v, got %v", all[k], k+1, r)
+		}
+		if n := sl.by_rank(k + 1); n == nil || n.entry != all[k] {
+			t.Fatalf("by_rank %v mismatch", k+1)
+		}
+	}
+
+	// 删除一半后排名依然连续
+	for k := 0; k < len(all); k += 2 {
+		if !sl.delete(&all[k]) {
+			t.Fatal("delete failed:", all[k])
+		}
+	}
+	if sl.delete(&all[0]) {
+		t.Fatal("deleted twice")
+	}
+	for k := 1; k < len(all); k += 2 {
+		if r := sl.rank(&all[k]); r != k/2+1 {
+			t.Fatalf("rank of %v: expect %v, got %v", all[k], k/2+1, r)
+		}
+	}
+	if sl.length != len(all)/2 {
+		t.Fatal("unexpected length:", sl.length)
+	}
+}
+
+func TestBoard(t *testing.T) {
+	b := new_board("test", 1)
+	b.update(Entry{Id: 1, Score: 10, Time: 1})
+	b.update(Entry{Id: 2, Score: 30, Time: 2})
+	b.update(Entry{Id: 3, Score: 20, Time: 3})
+	b.update(Entry{Id: 4, Score: 20, Time: 4}) // 同分后达到者在后
+	b.update(Entry{Id: 5, Score: 5, Time: 5})
+
+	if r, s := b.Rank(3); r != 2 || s != 20 {
+		t.Fatal("expect rank 2, got:", r, s)
+	}
+	if r, _ := b.Rank(4); r != 3 {
+		t.Fatal("expect rank 3, got:", r)
+	}
+	if r, _ := b.Rank(100); r != 0 {
+		t.Fatal("expect not on board, got:", r)
+	}
+
+	top := b.Top(2)
+	if len(top) != 2 || top[0].Id != 2 || top[1].Id != 3 {
+		t.Fatal("unexpected top:", top)
+	}
+
+	start, around := b.Around(1, 1)
+	if start != 3 || len(around) != 3 || around[0].Id != 4 || around[2].Id != 5 {
+		t.Fatal("unexpected around:", start, around)
+	}
+	start, around = b.Around(2, 2)
+	if start != 1 || len(around) != 5 {
+		t.Fatal("unexpected around at top:", start, around)
+	}
+
+	// 分数不变不影响排名, 分数变化重新排序
+	b.update(Entry{Id: 3, Score: 20, Time: 100})
+	if r, _ := b.Rank(3); r != 2 {
+		t.Fatal("expect rank kept, got:", r)
+	}
+	b.update(Entry{Id: 5, Score: 50, Time: 6})
+	if r, _ := b.Rank(5); r != 1 {
+		t.Fatal("expect rank 1, got:", r)
+	}
+
+	b.Remove(2)
+	if b.Count() != 4 {
+		t.Fatal("expect 4 entries, got:", b.Count())
+	}
+	if all := b.all(); all[1].Id != 3 {
+		t.Fatal("unexpected order:", all)
+	}
+}
+
+func TestReplay(t *testing.T) {
+	lb := &leaderboards{boards: make(map[string]*Board), offsets: make(map[int32]int64), instanceId: "a"}
+	lb.boards["test"] = new_board("test", 2)
+	apply := func(msg *sync_message) {
+		bts, _ := json.Marshal(msg)
+		lb.apply(bts)
+	}
+
+	// 重放的旧赛季更新和已生效的赛季重置被忽略, 本实例的消息被忽略
+	apply(&sync_message{InstanceId: "b", Board: "test", Entry: &Entry{Id: 1, Score: 10}, Season: 1})
+	apply(&sync_message{InstanceId: "b", Board: "test", Entry: &Entry{Id: 2, Score: 20}, Season: 2})
+	apply(&sync_message{InstanceId: "b", Board: "test", Season: 2})
+	apply(&sync_message{InstanceId: "a", Board: "test", Entry: &Entry{Id: 3, Score: 30}, Season: 2})
+	if b := lb.get("test"); b.Count() != 1 || b.Top(1)[0].Id != 2 {
+		t.Fatal("unexpected entries:", b.all())
+	}
+	apply(&sync_message{InstanceId: "b", Board: "test", Season: 3})
+	if b := lb.get("test"); b.Season() != 3 || b.Count() != 0 {
+		t.Fatal("season not reset:", b.Season(), b.Count())
+	}
+
+	// 从各快照中最早的位置继续消费
+	lb.resume_from(map[string]int64{"0": 10, "1": 5})
+	lb.resume_from(map[string]int64{"0": 7})
+	if lb.offsets[0] != 7 || lb.offsets[1] != 5 {
+		t.Fatal("unexpected offsets:", lb.offsets)
+	}
+}
@@ -0,0 +1,74 @@
+package leaderboard
+
+import (
+	"errors"
+
+	"game/kafka"
+	"game/repository"
+	"game/types"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// 分数:
+// types.User.Score只通过AddScore修改, 修改后立即写入WAL和trace并更新分数榜;
+// 登陆时用UpdateUser把离线期间(如其他实例上)的分数同步到榜单.
+// 分数按赛季计算, ScoreSeason不是分数榜的当前赛季时视为0分, 下次修改时清零.
+var (
+	ERROR_NOT_ONLINE     = errors.New("player not online")
+	ERROR_INVALID_AMOUNT = errors.New("invalid score amount")
+)
+
+// AddScore 在线玩家的分数变化(可为负, 最低为0), reason写入trace, 返回变化后的分数
+func AddScore(userid int32, amount int32, reason string) (int32, error) {
+	if amount == 0 {
+		return 0, ERROR_INVALID_AMOUNT
+	}
+	e := repository.Get(userid)
+	if e == nil {
+		return 0, ERROR_NOT_ONLINE
+	}
+
+	season := current_season()
+	var score int32
+	e.UpdateUser(func(u *types.User) []string {
+		u.Score = SeasonScore(u)
+		u.ScoreSeason = season
+		u.Score += amount
+		if u.Score < 0 {
+			u.Score = 0
+		}
+		score = u.Score
+		return []string{"Score", "ScoreSeason"}
+	})
+
+	// 与repository相同的$set格式
+	kafka.CommitUpdate(userid, bson.M{"score": score, "scoreseason": season}, repository.COLLECTION_USERS)
+	kafka.TraceEvent("score_change", userid, map[string]interface{}{
+		"amount": amount,
+		"reason": reason,
+		"score":  score,
+	})
+	Update(BOARD_SCORE, userid, int64(score))
+	return score, nil
+}
+
+// 分数榜的当前赛季, 没有分数榜时为第1赛季
+func current_season() int32 {
+	if b := Get(BOARD_SCORE); b != nil {
+		return b.Season()
+	}
+	return 1
+}
+
+// SeasonScore 玩家当前赛季的分数; 旧数据没有ScoreSeason, 视为第1赛季
+func SeasonScore(u *types.User) int32 {
+	season := u.ScoreSeason
+	if season == 0 {
+		season = 1
+	}
+	if season != current_season() {
+		return 0
+	}
+	return u.Score
+}
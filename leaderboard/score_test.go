@@ -0,0 +1,98 @@
+package leaderboard
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"game/db"
+	"game/kafka"
+	"game/repository"
+)
+
+func init() {
+	kafka.InitDiscard()
+}
+
+func TestAddScore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "leaderboard")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var database db.Database
+	database.InitLocal(dir)
+	repository.Init(&database, time.Hour)
+	b := Create(BOARD_SCORE)
+
+	if _, err := AddScore(1, 10, "test"); err != ERROR_NOT_ONLINE {
+		t.Fatal("expect not online, got:", err)
+	}
+	for _, id := range []int32{1, 2} {
+		if _, _, err := repository.Load(id); err != nil {
+			t.Fatal(err)
+		}
+		defer repository.Release(id)
+	}
+
+	AddScore(1, 50, "test")
+	AddScore(2, 30, "test")
+	if r, s := b.Rank(1); r != 1 || s != 50 {
+		t.Fatal("expect rank 1, got:", r, s)
+	}
+
+	// 分数变化后排名随之变化, 最低为0
+	if score, err := AddScore(2, 40, "test"); err != nil || score != 70 {
+		t.Fatal("unexpected score:", score, err)
+	}
+	if r, s := b.Rank(1); r != 2 || s != 50 {
+		t.Fatal("expect rank 2, got:", r, s)
+	}
+	if score, _ := AddScore(1, -100, "test"); score != 0 || repository.Get(1).User().Score != 0 {
+		t.Fatal("unexpected score:", score)
+	}
+	if r, s := b.Rank(1); r != 2 || s != 0 {
+		t.Fatal("expect rank 2, got:", r, s)
+	}
+}
+
+func TestSeasonScore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "leaderboard")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var database db.Database
+	database.InitLocal(dir)
+	repository.Init(&database, time.Hour)
+	_default_leaderboards.db = &database
+	Create(BOARD_SCORE)
+
+	if _, _, err := repository.Load(3); err != nil {
+		t.Fatal(err)
+	}
+	defer repository.Release(3)
+	AddScore(3, 50, "test")
+	if err := NewSeason(BOARD_SCORE); err != nil {
+		t.Fatal(err)
+	}
+
+	// 新赛季旧分数不计, 登陆同步不上榜, 第一次修改时清零
+	u := repository.Get(3).User()
+	if SeasonScore(u) != 0 {
+		t.Fatal("old season score counted:", u.Score, u.ScoreSeason)
+	}
+	UpdateUser(u)
+	if Get(BOARD_SCORE).Count() != 0 {
+		t.Fatal("old season score on board")
+	}
+	if score, _ := AddScore(3, 5, "test"); score != 5 {
+		t.Fatal("unexpected score:", score)
+	}
+	if r, s := Get(BOARD_SCORE).Rank(3); r != 1 || s != 5 {
+		t.Fatal("expect rank 1, got:", r, s)
+	}
+}
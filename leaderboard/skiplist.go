@@ -0,0 +1,192 @@
+package leaderboard
+
+import (
+	"math/rand"
+)
+
+const (
+	SKIPLIST_MAXLEVEL = 32
+	SKIPLIST_P        = 0.25
+)
+
+// 排行榜条目, 分数高者在前, 同分时先达到者在前, 再按id
+type Entry struct {
+	Id    int32 `bson:"id"`
+	Score int64 `bson:"score"`
+	Time  int64 `bson:"time"` // 达到该分数的时间(纳秒), 用于同分排序
+}
+
+func (e *Entry) less(o *Entry) bool {
+	if e.Score != o.Score {
+		return e.Score > o.Score
+	}
+	if e.Time != o.Time {
+		return e.Time < o.Time
+	}
+	return e.Id < o.Id
+}
+
+// 带跨度的跳表, 和redis zset的实现相同, 排名查询为O(logN)
+type sl_level struct {
+	forward *sl_node
+	span    int
+}
+
+type sl_node struct {
+	entry    Entry
+	backward *sl_node
+	level    []sl_level
+}
+
+type skiplist struct {
+	header *sl_node
+	tail   *sl_node
+	length int
+	level  int
+	rnd    *rand.Rand
+}
+
+func new_skiplist() *skiplist {
+	return &skiplist{
+		header: &sl_node{level: make([]sl_level, SKIPLIST_MAXLEVEL)},
+		level:  1,
+		rnd:    rand.New(rand.NewSource(rand.Int63())),
+	}
+}
+
+func (sl *skiplist) random_level() int {
+	level := 1
+	for level < SKIPLIST_MAXLEVEL && sl.rnd.Float64() < SKIPLIST_P {
+		level++
+	}
+	return level
+}
+
+func (sl *skiplist) insert(e Entry) *sl_node {
+	var update [SKIPLIST_MAXLEVEL]*sl_node
+	var rank [SKIPLIST_MAXLEVEL]int
+
+	x := sl.header
+	for i := sl.level - 1; i >= 0; i-- {
+		if i != sl.level-1 {
+			rank[i] = rank[i+1]
+		}
+		for x.level[i].forward != nil && x.level[i].forward.entry.less(&e) {
+			rank[i] += x.level[i].span
+			x = x.level[i].forward
+		}
+		update[i] = x
+	}
+
+	level := sl.random_level()
+	if level > sl.level {
+		for i := sl.level; i < level; i++ {
+			rank[i] = 0
+			update[i] = sl.header
+			update[i].level[i].span = sl.length
+		}
+		sl.level = level
+	}
+
+	x = &sl_node{entry: e, level: make([]sl_level, level)}
+	for i := 0; i < level; i++ {
+		x.level[i].forward = update[i].level[i].forward
+		update[i].level[i].forward = x
+		x.level[i].span = update[i].level[i].span - (rank[0] - rank[i])
+		update[i].level[i].span = (rank[0] - rank[i]) + 1
+	}
+
+	for i := level; i < sl.level; i++ {
+		update[i].level[i].span++
+	}
+
+	if update[0] != sl.header {
+		x.backward = update[0]
+	}
+	if x.level[0].forward != nil {
+		x.level[0].forward.backward = x
+	} else {
+		sl.tail = x
+	}
+	sl.length++
+	return x
+}
+
+func (sl *skiplist) delete(e *Entry) bool {
+	var update [SKIPLIST_MAXLEVEL]*sl_node
+	x := sl.header
+	for i := sl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && x.level[i].forward.entry.less(e) {
+			x = x.level[i].forward
+		}
+		update[i] = x
+	}
+
+	x = x.level[0].forward
+	if x == nil || x.entry != *e {
+		return false
+	}
+
+	for i := 0; i < sl.level; i++ {
+		if update[i].level[i].forward == x {
+			update[i].level[i].span += x.level[i].span - 1
+			update[i].level[i].forward = x.level[i].forward
+		} else {
+			update[i].level[i].span--
+		}
+	}
+	if x.level[0].forward != nil {
+		x.level[0].forward.backward = x.backward
+	} else {
+		sl.tail = x.backward
+	}
+	for sl.level > 1 && sl.header.level[sl.level-1].forward == nil {
+		sl.level--
+	}
+	sl.length--
+	return true
+}
+
+// 1开始的排名, 不存在返回0
+func (sl *skiplist) rank(e *Entry) int {
+	rank := 0
+	x := sl.header
+	for i := sl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && !e.less(&x.level[i].forward.entry) {
+			rank += x.level[i].span
+			x = x.level[i].forward
+		}
+		if x != sl.header && x.entry == *e {
+			return rank
+		}
+	}
+	return 0
+}
+
+// 按排名(1开始)查找节点
+func (sl *skiplist) by_rank(rank int) *sl_node {
+	if rank <= 0 || rank > sl.length {
+		return nil
+	}
+	traversed := 0
+	x := sl.header
+	for i := sl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && traversed+x.level[i].span <= rank {
+			traversed += x.level[i].span
+			x = x.level[i].forward
+		}
+		if traversed == rank {
+			return x
+		}
+	}
+	return nil
+}
+
+// 从排名start(1开始)起的n个条目
+func (sl *skiplist) slice(start, n int) []Entry {
+	var ret []Entry
+	for x := sl.by_rank(start); x != nil && len(ret) < n; x = x.level[0].forward {
+		ret = append(ret, x.entry)
+	}
+	return ret
+}
@@ -0,0 +1,163 @@
+package level
+
+import (
+	"errors"
+	"math"
+	"sync"
+
+	"game/events"
+	"game/kafka"
+	"game/mail"
+	"game/repository"
+	"game/types"
+
+	log "github.com/Sirupsen/logrus"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// 等级:
+// 玩家的经验和等级保存在types.User中, 通过repository修改, 随玩家数据定期保存.
+// 获得经验后按数值表的升级经验连续升级, 一次可以跨多级, 满级后经验继续累积.
+// 每次经验变化立即写入WAL和trace; 升级时对跨过的每一级调用Grant发放该级的奖励,
+// 并发布EVENT_LEVEL_UP(Count为新等级), 最后通过OnChange通知上层推送.
+const (
+	MAX_LEVEL = math.MaxUint8 // User.Level为uint8
+)
+
+var (
+	ERROR_NOT_ONLINE  = errors.New("player not online")
+	ERROR_INVALID_EXP = errors.New("invalid exp amount")
+)
+
+// 等级配置, 由数值表配置
+type Level struct {
+	Exp     int64             // 升到下一级需要的经验, 0为满级
+	Rewards []mail.Attachment // 升到该级的奖励
+}
+
+// 一次经验变化
+type Change struct {
+	UserId int32
+	Amount int64
+	Reason string
+	From   uint8 // 变化前的等级
+	To     uint8 // 变化后的等级
+	Exp    int64 // 变化后当前等级的经验
+}
+
+var (
+	_levels = []Level{{}}
+	_mu     sync.RWMutex
+
+	// Grant 发放升到level的奖励, 由上层设置
+	Grant func(userid int32, level uint8, rewards []mail.Attachment)
+
+	// OnChange 经验变化, 由上层设置, 用于推送
+	OnChange func(c *Change)
+)
+
+// SetLevels 设置等级配置, levels[0]为1级, 数值表热更新时调用
+func SetLevels(levels []Level) {
+	if len(levels) == 0 {
+		return
+	}
+	if len(levels) > MAX_LEVEL {
+		levels = levels[:MAX_LEVEL]
+	}
+	_mu.Lock()
+	_levels = levels
+	_mu.Unlock()
+}
+
+func config() []Level {
+	_mu.RLock()
+	defer _mu.RUnlock()
+	return _levels
+}
+
+// MaxLevel 满级
+func MaxLevel() uint8 {
+	return uint8(len(config()))
+}
+
+// Next 升到下一级需要的经验, 满级时返回0
+func Next(level uint8) int64 {
+	levels := config()
+	if level == 0 || int(level) >= len(levels) {
+		return 0
+	}
+	return levels[level-1].Exp
+}
+
+// Rewards 升到level的奖励
+func Rewards(level uint8) []mail.Attachment {
+	levels := config()
+	if level == 0 || int(level) > len(levels) {
+		return nil
+	}
+	return levels[level-1].Rewards
+}
+
+// 增加经验并连续升级, 返回变化前的等级
+func apply(u *types.User, amount int64, levels []Level) uint8 {
+	if u.Level == 0 {
+		u.Level = 1
+	}
+	from := u.Level
+	u.Exp += amount
+	for int(u.Level) < len(levels) {
+		need := levels[u.Level-1].Exp
+		if need <= 0 || u.Exp < need {
+			break
+		}
+		u.Exp -= need
+		u.Level++
+	}
+	return from
+}
+
+// Add 在线玩家获得经验, reason写入trace
+func Add(userid int32, amount int64, reason string) (*Change, error) {
+	if amount <= 0 {
+		return nil, ERROR_INVALID_EXP
+	}
+	e := repository.Get(userid)
+	if e == nil {
+		return nil, ERROR_NOT_ONLINE
+	}
+
+	levels := config()
+	c := &Change{UserId: userid, Amount: amount, Reason: reason}
+	e.UpdateUser(func(u *types.User) []string {
+		c.From = apply(u, amount, levels)
+		c.To, c.Exp = u.Level, u.Exp
+		return []string{"Level", "Exp"}
+	})
+	commit(c)
+
+	if c.To > c.From {
+		for lv := int(c.From) + 1; lv <= int(c.To); lv++ {
+			if rewards := levels[lv-1].Rewards; len(rewards) > 0 && Grant != nil {
+				Grant(userid, uint8(lv), rewards)
+			}
+		}
+		events.Fire(events.EVENT_LEVEL_UP, userid, 0, int64(c.To))
+		log.Debugf("level up, userid:%v from:%v to:%v", userid, c.From, c.To)
+	}
+	if OnChange != nil {
+		OnChange(c)
+	}
+	return c, nil
+}
+
+// 写入WAL(与repository相同的$set格式)和trace
+func commit(c *Change) {
+	kafka.CommitUpdate(c.UserId, bson.M{"level": c.To, "exp": c.Exp}, repository.COLLECTION_USERS)
+	kafka.TraceEvent("exp_change", c.UserId, map[string]interface{}{
+		"amount": c.Amount,
+		"reason": c.Reason,
+		"from":   c.From,
+		"to":     c.To,
+		"exp":    c.Exp,
+	})
+}
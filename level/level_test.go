@@ -0,0 +1,46 @@
+package level
+
+import (
+	"testing"
+
+	"game/types"
+)
+
+func TestApply(t *testing.T) {
+	levels := []Level{{Exp: 100}, {Exp: 200}, {Exp: 300}, {}}
+
+	u := &types.User{Level: 1}
+	if from := apply(u, 50, levels); from != 1 || u.Level != 1 || u.Exp != 50 {
+		t.Fatal("unexpected level:", from, u.Level, u.Exp)
+	}
+
+	// 一次跨多级
+	if from := apply(u, 400, levels); from != 1 || u.Level != 3 || u.Exp != 150 {
+		t.Fatal("multi-level jump failed:", from, u.Level, u.Exp)
+	}
+
+	// 满级后经验继续累积
+	apply(u, 1000, levels)
+	if u.Level != 4 || u.Exp != 850 {
+		t.Fatal("unexpected max level:", u.Level, u.Exp)
+	}
+
+	// 旧数据的0级按1级处理
+	u = &types.User{}
+	if from := apply(u, 100, levels); from != 1 || u.Level != 2 || u.Exp != 0 {
+		t.Fatal("level 0 not fixed:", from, u.Level, u.Exp)
+	}
+}
+
+func TestConfig(t *testing.T) {
+	SetLevels([]Level{{Exp: 100}, {Exp: 200}, {}})
+	defer SetLevels([]Level{{}})
+	if MaxLevel() != 3 || Next(1) != 100 || Next(3) != 0 || Next(0) != 0 {
+		t.Fatal("unexpected config:", MaxLevel(), Next(1), Next(3))
+	}
+
+	SetLevels(make([]Level, 300))
+	if MaxLevel() != MAX_LEVEL {
+		t.Fatal("level overflow:", MaxLevel())
+	}
+}
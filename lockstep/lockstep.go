@@ -0,0 +1,135 @@
+package lockstep
+
+import (
+	"errors"
+	"time"
+
+	"game/rooms"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// 帧同步:
+// 作为rooms的房间逻辑运行, 服务器不计算战斗, 只收集每个逻辑帧内的玩家输入,
+// 在每次tick时打上帧号广播给全部成员, 客户端按帧确定性地执行.
+// 在某帧广播之后才到达的输入(迟到)自然进入下一帧.
+// 全部帧保存在内存中供断线重连补帧, 同时写入录像文件.
+const (
+	MAX_FRAMES_PER_REQ = 1000 // 补帧时单次返回的最大帧数
+)
+
+var (
+	ERROR_NOT_PLAYER = errors.New("not a player of this match")
+)
+
+// 一个玩家的输入
+type Input struct {
+	UserId int32  `json:"id"`
+	Data   []byte `json:"data"`
+}
+
+// 一个逻辑帧的全部输入
+type Frame struct {
+	Seq    uint32  `json:"seq"`
+	Inputs []Input `json:"inputs,omitempty"`
+}
+
+type Lockstep struct {
+	Players []int32             // 参与对局的玩家, 只有他们可以加入(包括重连)
+	Encode  func(*Frame) []byte // 打包帧推送
+	frames  []Frame             // frames[i].Seq == i+1
+	pending []Input
+	replay  *replay_writer
+	dir     string
+}
+
+// New 创建帧同步逻辑, replayDir为空时不录像
+func New(players []int32, encode func(*Frame) []byte, replayDir string) *Lockstep {
+	return &Lockstep{Players: players, Encode: encode, dir: replayDir}
+}
+
+func (l *Lockstep) is_player(userid int32) bool {
+	for _, id := range l.Players {
+		if id == userid {
+			return true
+		}
+	}
+	return false
+}
+
+func (l *Lockstep) OnJoin(r *rooms.Room, userid int32) error {
+	if !l.is_player(userid) {
+		return ERROR_NOT_PLAYER
+	}
+	return nil
+}
+
+func (l *Lockstep) OnLeave(r *rooms.Room, userid int32) {}
+
+func (l *Lockstep) OnInput(r *rooms.Room, userid int32, data []byte) {
+	l.pending = append(l.pending, Input{UserId: userid, Data: data})
+}
+
+func (l *Lockstep) OnTick(r *rooms.Room, seq uint32) {
+	if l.replay == nil && l.dir != "" && len(l.frames) == 0 {
+		l.open_replay(r)
+	}
+
+	// 房间的帧号从1开始连续递增
+	f := Frame{Seq: seq, Inputs: l.pending}
+	l.pending = nil
+	l.frames = append(l.frames, f)
+
+	if l.replay != nil {
+		if err := l.replay.write(&f); err != nil {
+			log.Error("lockstep: replay disabled:", err)
+			l.close_replay()
+			l.dir = ""
+		}
+	}
+	r.Broadcast(l.Encode(&f))
+}
+
+func (l *Lockstep) OnClose(r *rooms.Room, reason int) {
+	l.close_replay()
+}
+
+func (l *Lockstep) open_replay(r *rooms.Room) {
+	h := &Header{RoomId: r.Id, Players: l.Players, TickRate: r.TickRate(), Start: time.Now()}
+	rw, err := create_replay(l.dir, h)
+	if err != nil {
+		log.Error("lockstep: replay disabled:", err)
+		l.dir = ""
+		return
+	}
+	l.replay = rw
+}
+
+func (l *Lockstep) close_replay() {
+	if l.replay == nil {
+		return
+	}
+	if err := l.replay.close(); err != nil {
+		log.Error(err)
+	} else {
+		log.Debug("lockstep: replay saved:", l.replay.path)
+	}
+	l.replay = nil
+}
+
+// Frames 从帧号from开始(包括)的帧, 用于断线重连补帧, 需在房间goroutine中调用(rooms.Room.Do)
+func (l *Lockstep) Frames(from uint32) []Frame {
+	if from == 0 {
+		from = 1
+	}
+	if int(from) > len(l.frames) {
+		return nil
+	}
+	frames := l.frames[from-1:]
+	if len(frames) > MAX_FRAMES_PER_REQ {
+		frames = frames[:MAX_FRAMES_PER_REQ]
+	}
+	ret := make([]Frame, len(frames))
+	copy(ret, frames)
+	return ret
+}
@@ -0,0 +1,72 @@
+package lockstep
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"game/rooms"
+)
+
+func TestLockstep(t *testing.T) {
+	dir, err := ioutil.TempDir("", "replay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	l := New([]int32{1, 2}, func(*Frame) []byte { return nil }, dir)
+	cfg := rooms.DefaultConfig()
+	cfg.TickRate = 100
+	r := rooms.Create(cfg, l)
+
+	if err := rooms.Join(r.Id, 3); err != ERROR_NOT_PLAYER {
+		t.Fatal("expect not player, got:", err)
+	}
+	rooms.Join(r.Id, 1)
+	rooms.Join(r.Id, 2)
+	rooms.Input(1, []byte("a"))
+	rooms.Input(2, []byte("b"))
+	time.Sleep(50 * time.Millisecond)
+	rooms.Input(1, []byte("c"))
+	time.Sleep(50 * time.Millisecond)
+
+	var frames []Frame
+	r.Do(func() { frames = l.Frames(1) })
+	var inputs []Input
+	for k := range frames {
+		if frames[k].Seq != uint32(k+1) {
+			t.Fatal("frame seq not continuous:", frames[k].Seq, k)
+		}
+		inputs = append(inputs, frames[k].Inputs...)
+	}
+	if len(inputs) != 3 || string(inputs[2].Data) != "c" {
+		t.Fatal("unexpected inputs:", inputs)
+	}
+
+	var tail []Frame
+	r.Do(func() { tail = l.Frames(uint32(len(frames))) })
+	if len(tail) == 0 || tail[0].Seq != uint32(len(frames)) {
+		t.Fatal("unexpected tail frames:", tail)
+	}
+
+	r.Close()
+	<-r.Done()
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.replay"))
+	if len(files) != 1 {
+		t.Fatal("expect 1 replay, got:", files)
+	}
+	h, replay, err := LoadReplay(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.RoomId != r.Id || len(h.Players) != 2 || h.TickRate != 100 {
+		t.Fatal("unexpected header:", h)
+	}
+	if len(replay) < len(frames) {
+		t.Fatal("replay too short:", len(replay), len(frames))
+	}
+}
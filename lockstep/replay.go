@@ -0,0 +1,81 @@
+package lockstep
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// 录像文件:
+// JSON lines, 第一行为Header, 之后每行一个Frame, 按帧号顺序追加写入.
+// 对局异常结束时文件可能不完整, 但已写入的帧依然可以回放.
+type Header struct {
+	RoomId   int64     `json:"room"`
+	Players  []int32   `json:"players"`
+	TickRate int       `json:"tick_rate"`
+	Start    time.Time `json:"start"`
+}
+
+type replay_writer struct {
+	path string
+	f    *os.File
+	w    *bufio.Writer
+	enc  *json.Encoder
+}
+
+func create_replay(dir string, h *Header) (*replay_writer, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	path := filepath.Join(dir, fmt.Sprintf("%v-%v.replay", h.Start.Format("20060102150405"), h.RoomId))
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0644)
+	if err != nil {
+		return nil, err
+	}
+	rw := &replay_writer{path: path, f: f, w: bufio.NewWriter(f)}
+	rw.enc = json.NewEncoder(rw.w)
+	if err := rw.enc.Encode(h); err != nil {
+		rw.close()
+		return nil, err
+	}
+	return rw, nil
+}
+
+func (rw *replay_writer) write(f *Frame) error {
+	return rw.enc.Encode(f)
+}
+
+func (rw *replay_writer) close() error {
+	if err := rw.w.Flush(); err != nil {
+		rw.f.Close()
+		return err
+	}
+	return rw.f.Close()
+}
+
+// LoadReplay 读取录像文件
+func LoadReplay(path string) (*Header, []Frame, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	dec := json.NewDecoder(bufio.NewReader(f))
+	h := &Header{}
+	if err := dec.Decode(h); err != nil {
+		return nil, nil, err
+	}
+	var frames []Frame
+	for dec.More() {
+		var frame Frame
+		if err := dec.Decode(&frame); err != nil {
+			return h, frames, err
+		}
+		frames = append(frames, frame)
+	}
+	return h, frames, nil
+}
@@ -0,0 +1,308 @@
+package mail
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"game/db"
+	"game/kafka"
+
+	log "github.com/Sirupsen/logrus"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// 邮件:
+// 系统邮件和玩家邮件保存在mongodb中, 过期后由TTL索引自动删除; standalone模式下保存在本地存储中, 过期的邮件不再列出.
+// 附件(道具, 货币)的领取通过条件更新原子的标记, 并写入WAL以便审计和重放.
+//
+// 全服邮件(补偿等)只保存一份在COLLECTION_BROADCASTS中, 玩家登陆时按需投递成个人邮件,
+// 个人邮件的_id由全服邮件id和userid组成, 重复投递是幂等的.
+const (
+	MAIL_SYSTEM = int32(1) // 系统邮件
+	MAIL_PLAYER = int32(2) // 玩家邮件
+
+	ATTACH_ITEM     = int32(1) // 道具
+	ATTACH_CURRENCY = int32(2) // 货币
+	ATTACH_EXP      = int32(3) // 经验, Id为0
+	ATTACH_SCORE    = int32(4) // 分数, Id为0
+
+	COLLECTION_MAILS      = "mails"
+	COLLECTION_BROADCASTS = "mail_broadcasts"
+
+	DEFAULT_EXPIRE  = 30 * 24 * time.Hour // 默认有效期
+	MAX_MAILS       = 100                 // 邮件列表最大条数
+	MAX_ATTACHMENTS = 8                   // 单封邮件最大附件数
+	MAX_TITLE       = 32                  // 标题最大长度(字节)
+	MAX_CONTENT     = 1024                // 正文最大长度(字节)
+)
+
+var (
+	ERROR_NOT_FOUND         = errors.New("mail not found")
+	ERROR_CLAIMED           = errors.New("attachments already claimed")
+	ERROR_NO_ATTACHMENT     = errors.New("mail has no attachment")
+	ERROR_TOO_LONG          = errors.New("mail title or content too long")
+	ERROR_TOO_MANY_ATTACH   = errors.New("too many attachments")
+	ERROR_INVALID_ATTACH    = errors.New("invalid attachment")
+	ERROR_GRANT_UNAVAILABLE = errors.New("attachment granter not set")
+)
+
+// 附件
+type Attachment struct {
+	Type  int32 `bson:"type"`
+	Id    int32 `bson:"id"` // 道具id或货币id, 对应数值表
+	Count int32 `bson:"count"`
+}
+
+// 个人邮件
+type Mail struct {
+	Id          string       `bson:"_id"`
+	UserId      int32        `bson:"userid"` // 收件人
+	From        int32        `bson:"from"`   // 发件人, 系统邮件为0
+	Type        int32        `bson:"type"`
+	Title       string       `bson:"title"`
+	Content     string       `bson:"content"`
+	Attachments []Attachment `bson:"attachments,omitempty"`
+	Read        bool         `bson:"read"`
+	Claimed     bool         `bson:"claimed"`
+	Deleted     bool         `bson:"deleted"` // 软删除, 保证全服邮件不会被重复投递
+	CreatedAt   time.Time    `bson:"created_at"`
+	ExpireAt    time.Time    `bson:"expire_at"`
+}
+
+// 全服邮件
+type Broadcast struct {
+	Id          bson.ObjectId `bson:"_id"`
+	Title       string        `bson:"title"`
+	Content     string        `bson:"content"`
+	Attachments []Attachment  `bson:"attachments,omitempty"`
+	CreatedAt   time.Time     `bson:"created_at"`
+	ExpireAt    time.Time     `bson:"expire_at"`
+}
+
+// 领取记录, 写入WAL
+type claim_record struct {
+	MailId      string       `json:"mailid"`
+	UserId      int32        `json:"userid"`
+	Attachments []Attachment `json:"attachments"`
+	Reverted    bool         `json:"reverted,omitempty"`
+}
+
+var (
+	_store store
+
+	// Validate 校验附件定义, 由上层根据数值表设置
+	Validate func(a *Attachment) error
+
+	// Grant 发放附件, 由上层(背包, 货币)设置, 返回错误时领取被撤销; 未设置时不允许领取
+	Grant func(userid int32, mailid string, attachments []Attachment) error
+
+	// Notify 新邮件通知, 由上层设置, 用于推送未读数
+	Notify func(userid int32)
+)
+
+func Init(database *db.Database) {
+	if database.IsLocal() {
+		_store = new_memory_store(database)
+	} else {
+		_store = new_mongo_store(database)
+	}
+}
+
+func check(title, content string, attachments []Attachment) error {
+	if len(title) > MAX_TITLE || len(content) > MAX_CONTENT {
+		return ERROR_TOO_LONG
+	}
+	if len(attachments) > MAX_ATTACHMENTS {
+		return ERROR_TOO_MANY_ATTACH
+	}
+	for k := range attachments {
+		if attachments[k].Count <= 0 {
+			return ERROR_INVALID_ATTACH
+		}
+		if Validate != nil {
+			if err := Validate(&attachments[k]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Send 发送个人邮件, expire为0时使用默认有效期
+func Send(userid, from int32, title, content string, attachments []Attachment, expire time.Duration) (*Mail, error) {
+	return send(bson.NewObjectId().Hex(), userid, from, title, content, attachments, expire)
+}
+
+// SendOnce 以key为邮件id发送系统邮件, 同一key只发送一次, 重复发送时直接返回成功, 用于需要重试的发放
+func SendOnce(key string, userid int32, title, content string, attachments []Attachment) error {
+	_, err := send("k"+key, userid, 0, title, content, attachments, 0)
+	if err == db.ERROR_DUPLICATED {
+		return nil
+	}
+	return err
+}
+
+func send(id string, userid, from int32, title, content string, attachments []Attachment, expire time.Duration) (*Mail, error) {
+	if err := check(title, content, attachments); err != nil {
+		return nil, err
+	}
+	if expire <= 0 {
+		expire = DEFAULT_EXPIRE
+	}
+
+	now := time.Now()
+	m := &Mail{
+		Id:          id,
+		UserId:      userid,
+		From:        from,
+		Type:        MAIL_SYSTEM,
+		Title:       title,
+		Content:     content,
+		Attachments: attachments,
+		CreatedAt:   now,
+		ExpireAt:    now.Add(expire),
+	}
+	if from != 0 {
+		m.Type = MAIL_PLAYER
+	}
+
+	if err := _store.insert(m); err != nil {
+		return nil, err
+	}
+
+	kafka.CommitUpdate(m.Id, m, COLLECTION_MAILS)
+	if Notify != nil {
+		Notify(userid)
+	}
+	return m, nil
+}
+
+// SendAll 发送全服邮件, 在线和之后登陆的玩家都会收到, 用于补偿
+func SendAll(title, content string, attachments []Attachment, expire time.Duration) (*Broadcast, error) {
+	if err := check(title, content, attachments); err != nil {
+		return nil, err
+	}
+	if expire <= 0 {
+		expire = DEFAULT_EXPIRE
+	}
+
+	now := time.Now()
+	b := &Broadcast{
+		Id:          bson.NewObjectId(),
+		Title:       title,
+		Content:     content,
+		Attachments: attachments,
+		CreatedAt:   now,
+		ExpireAt:    now.Add(expire),
+	}
+	if err := _store.insert_broadcast(b); err != nil {
+		return nil, err
+	}
+
+	kafka.CommitUpdate(b.Id.Hex(), b, COLLECTION_BROADCASTS)
+	return b, nil
+}
+
+// 全服邮件投递给玩家后的个人邮件id
+func broadcast_mail_id(b bson.ObjectId, userid int32) string {
+	return fmt.Sprintf("b%v-%v", b.Hex(), userid)
+}
+
+// Deliver 把尚未投递的全服邮件投递给玩家, 登陆时调用; since为玩家注册时间, 之前发出的全服邮件不投递
+func Deliver(userid int32, since time.Time) error {
+	bs, err := _store.active_broadcasts(time.Now())
+	if err != nil {
+		return err
+	}
+	for k := range bs {
+		if bs[k].CreatedAt.Before(since) {
+			continue
+		}
+		m := &Mail{
+			Id:          broadcast_mail_id(bs[k].Id, userid),
+			UserId:      userid,
+			Type:        MAIL_SYSTEM,
+			Title:       bs[k].Title,
+			Content:     bs[k].Content,
+			Attachments: bs[k].Attachments,
+			CreatedAt:   bs[k].CreatedAt,
+			ExpireAt:    bs[k].ExpireAt,
+		}
+		// 已投递过的(包括已删除的)由唯一_id保证不重复
+		if err := _store.insert(m); err != nil && err != db.ERROR_DUPLICATED {
+			return err
+		}
+	}
+	return nil
+}
+
+// List 玩家的邮件, 按时间从新到旧
+func List(userid int32) ([]Mail, error) {
+	return _store.list(userid, time.Now(), MAX_MAILS)
+}
+
+// Unread 未读邮件数
+func Unread(userid int32) (int, error) {
+	return _store.unread(userid, time.Now())
+}
+
+// Read 标记已读
+func Read(userid int32, id string) error {
+	return _store.read(userid, id)
+}
+
+// Delete 删除邮件, 有未领取的附件时不允许删除
+func Delete(userid int32, id string) error {
+	return _store.remove(userid, id)
+}
+
+// Claim 原子的领取附件:
+// 1. 条件更新把claimed从false改为true, 保证只能领取一次
+// 2. 发放附件, 失败时把claimed改回false
+// 每一步都写入WAL
+func Claim(userid int32, id string) (*Mail, error) {
+	if Grant == nil {
+		return nil, ERROR_GRANT_UNAVAILABLE
+	}
+	m, err := _store.claim(userid, id, time.Now())
+	if err == ERROR_NOT_FOUND {
+		return nil, claim_error(userid, id)
+	} else if err != nil {
+		return nil, err
+	}
+
+	record := &claim_record{MailId: m.Id, UserId: userid, Attachments: m.Attachments}
+	kafka.CommitUpdate(m.Id, record, COLLECTION_MAILS+"_claim")
+	if err := Grant(userid, m.Id, m.Attachments); err != nil {
+		revert(m)
+		record.Reverted = true
+		kafka.CommitUpdate(m.Id, record, COLLECTION_MAILS+"_claim")
+		return nil, err
+	}
+
+	kafka.TraceEvent("mail_claim", userid, map[string]interface{}{"mailid": m.Id, "attachments": m.Attachments})
+	return m, nil
+}
+
+// 区分邮件不存在, 已领取和没有附件
+func claim_error(userid int32, id string) error {
+	m, err := _store.get(userid, id)
+	switch {
+	case err != nil:
+		return err
+	case m == nil || m.Deleted:
+		return ERROR_NOT_FOUND
+	case m.Claimed:
+		return ERROR_CLAIMED
+	case len(m.Attachments) == 0:
+		return ERROR_NO_ATTACHMENT
+	}
+	return ERROR_NOT_FOUND // 已过期
+}
+
+func revert(m *Mail) {
+	if err := _store.revert(m.Id); err != nil {
+		log.Error("mail: revert claim failed:", m.Id, err)
+	}
+}
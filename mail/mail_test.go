@@ -0,0 +1,122 @@
+package mail
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"game/kafka"
+)
+
+func init() {
+	kafka.InitDiscard()
+}
+
+func TestClaim(t *testing.T) {
+	_store = new_memory_store(nil)
+	defer func() { Grant = nil }()
+
+	gold := int32(0)
+	fail := false
+	Grant = func(userid int32, mailid string, attachments []Attachment) error {
+		if fail {
+			return errors.New("grant failed")
+		}
+		for _, a := range attachments {
+			gold += a.Count
+		}
+		return nil
+	}
+
+	plain, _ := Send(1, 2, "hello", "", nil, 0)
+	gift, _ := Send(1, 0, "gift", "", []Attachment{{Type: ATTACH_CURRENCY, Id: 1, Count: 100}}, 0)
+	if n, _ := Unread(1); n != 2 {
+		t.Fatal("unexpected unread:", n)
+	}
+
+	// 没有附件的邮件不能领取, 也不会被标记为已领取
+	if _, err := Claim(1, plain.Id); err != ERROR_NO_ATTACHMENT {
+		t.Fatal("expect no attachment, got:", err)
+	}
+	if m, _ := _store.get(1, plain.Id); m.Claimed {
+		t.Fatal("mail without attachment marked claimed")
+	}
+
+	// 发放失败时撤销领取, 可以重试
+	fail = true
+	if _, err := Claim(1, gift.Id); err == nil {
+		t.Fatal("expect grant error")
+	}
+	fail = false
+	if _, err := Claim(1, gift.Id); err != nil || gold != 100 {
+		t.Fatal("retry claim failed:", err, gold)
+	}
+	if _, err := Claim(1, gift.Id); err != ERROR_CLAIMED || gold != 100 {
+		t.Fatal("claimed twice:", err, gold)
+	}
+	if _, err := Claim(2, gift.Id); err != ERROR_NOT_FOUND {
+		t.Fatal("claimed by others:", err)
+	}
+
+	// 没有设置Grant时不允许领取
+	Grant = nil
+	other, _ := Send(1, 0, "gift", "", []Attachment{{Type: ATTACH_CURRENCY, Id: 1, Count: 1}}, 0)
+	if _, err := Claim(1, other.Id); err != ERROR_GRANT_UNAVAILABLE {
+		t.Fatal("expect grant unavailable, got:", err)
+	}
+	if err := Delete(1, other.Id); err != ERROR_NOT_FOUND {
+		t.Fatal("deleted mail with unclaimed attachments:", err)
+	}
+	if err := Delete(1, gift.Id); err != nil {
+		t.Fatal(err)
+	}
+	if mails, _ := List(1); len(mails) != 2 {
+		t.Fatal("unexpected mails:", len(mails))
+	}
+}
+
+func TestDeliver(t *testing.T) {
+	_store = new_memory_store(nil)
+	if _, err := SendAll("compensation", "", []Attachment{{Type: ATTACH_ITEM, Id: 1, Count: 1}}, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	// 重复投递是幂等的, 删除后也不会再次投递
+	for k := 0; k < 2; k++ {
+		if err := Deliver(1, time.Time{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mails, _ := List(1)
+	if len(mails) != 1 {
+		t.Fatal("unexpected mails:", len(mails))
+	}
+	Grant = func(int32, string, []Attachment) error { return nil }
+	defer func() { Grant = nil }()
+	Claim(1, mails[0].Id)
+	Delete(1, mails[0].Id)
+	Deliver(1, time.Time{})
+	if mails, _ := List(1); len(mails) != 0 {
+		t.Fatal("delivered again:", len(mails))
+	}
+
+	// 注册之前发出的全服邮件不投递给新玩家
+	if err := Deliver(2, time.Now().Add(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if mails, _ := List(2); len(mails) != 0 {
+		t.Fatal("delivered to later user:", len(mails))
+	}
+}
+
+func TestSendOnce(t *testing.T) {
+	_store = new_memory_store(nil)
+	for k := 0; k < 2; k++ {
+		if err := SendOnce("auction:1:deliver", 1, "bought", "", []Attachment{{Type: ATTACH_ITEM, Id: 1, Count: 1}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if mails, _ := List(1); len(mails) != 1 {
+		t.Fatal("sent twice:", len(mails))
+	}
+}
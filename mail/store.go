@@ -0,0 +1,257 @@
+package mail
+
+import (
+	"sort"
+	"time"
+
+	"game/db"
+
+	log "github.com/Sirupsen/logrus"
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// 邮件存储, 过期的邮件视为不存在
+type store interface {
+	insert(m *Mail) error // _id已存在时返回db.ERROR_DUPLICATED
+	insert_broadcast(b *Broadcast) error
+	active_broadcasts(now time.Time) ([]Broadcast, error) // 未过期的全服邮件
+	list(userid int32, now time.Time, limit int) ([]Mail, error)
+	unread(userid int32, now time.Time) (int, error)
+	read(userid int32, id string) error                          // 不存在返回ERROR_NOT_FOUND
+	remove(userid int32, id string) error                        // 软删除, 有未领取的附件时返回ERROR_NOT_FOUND
+	claim(userid int32, id string, now time.Time) (*Mail, error) // 有附件时claimed从false改为true, 不满足时返回ERROR_NOT_FOUND
+	get(userid int32, id string) (*Mail, error)                  // 不存在返回nil
+	revert(id string) error                                      // claimed从true改回false
+}
+
+// mongodb存储
+type mongo_store struct {
+	db *db.Database
+}
+
+func new_mongo_store(database *db.Database) *mongo_store {
+	err := database.Execute(func(sess *mgo.Session) error {
+		c := sess.DB("").C(COLLECTION_MAILS)
+		if err := c.EnsureIndex(mgo.Index{Key: []string{"userid", "-created_at"}}); err != nil {
+			return err
+		}
+		if err := c.EnsureIndex(mgo.Index{Key: []string{"expire_at"}, ExpireAfter: time.Second}); err != nil {
+			return err
+		}
+		return sess.DB("").C(COLLECTION_BROADCASTS).EnsureIndex(mgo.Index{Key: []string{"expire_at"}, ExpireAfter: time.Second})
+	})
+	if err != nil {
+		log.Error(err)
+	}
+	return &mongo_store{db: database}
+}
+
+func (s *mongo_store) insert(m *Mail) error {
+	err := s.db.Execute(func(sess *mgo.Session) error {
+		return sess.DB("").C(COLLECTION_MAILS).Insert(m)
+	})
+	if mgo.IsDup(err) {
+		return db.ERROR_DUPLICATED
+	}
+	return err
+}
+
+func (s *mongo_store) insert_broadcast(b *Broadcast) error {
+	return s.db.Execute(func(sess *mgo.Session) error {
+		return sess.DB("").C(COLLECTION_BROADCASTS).Insert(b)
+	})
+}
+
+func (s *mongo_store) active_broadcasts(now time.Time) (bs []Broadcast, err error) {
+	err = s.db.Execute(func(sess *mgo.Session) error {
+		return sess.DB("").C(COLLECTION_BROADCASTS).Find(bson.M{"expire_at": bson.M{"$gt": now}}).All(&bs)
+	})
+	return
+}
+
+func (s *mongo_store) list(userid int32, now time.Time, limit int) (mails []Mail, err error) {
+	err = s.db.Execute(func(sess *mgo.Session) error {
+		q := bson.M{"userid": userid, "deleted": false, "expire_at": bson.M{"$gt": now}}
+		return sess.DB("").C(COLLECTION_MAILS).Find(q).Sort("-created_at").Limit(limit).All(&mails)
+	})
+	return
+}
+
+func (s *mongo_store) unread(userid int32, now time.Time) (n int, err error) {
+	err = s.db.Execute(func(sess *mgo.Session) error {
+		q := bson.M{"userid": userid, "read": false, "deleted": false, "expire_at": bson.M{"$gt": now}}
+		n, err = sess.DB("").C(COLLECTION_MAILS).Find(q).Count()
+		return err
+	})
+	return
+}
+
+func (s *mongo_store) update(q, change bson.M) error {
+	err := s.db.Execute(func(sess *mgo.Session) error {
+		return sess.DB("").C(COLLECTION_MAILS).Update(q, change)
+	})
+	if err == mgo.ErrNotFound {
+		return ERROR_NOT_FOUND
+	}
+	return err
+}
+
+func (s *mongo_store) read(userid int32, id string) error {
+	return s.update(bson.M{"_id": id, "userid": userid, "deleted": false}, bson.M{"$set": bson.M{"read": true}})
+}
+
+func (s *mongo_store) remove(userid int32, id string) error {
+	q := bson.M{"_id": id, "userid": userid, "deleted": false, "$or": []bson.M{
+		{"attachments": bson.M{"$exists": false}},
+		{"claimed": true},
+	}}
+	return s.update(q, bson.M{"$set": bson.M{"deleted": true, "read": true}})
+}
+
+func (s *mongo_store) claim(userid int32, id string, now time.Time) (*Mail, error) {
+	m := &Mail{}
+	err := s.db.Execute(func(sess *mgo.Session) error {
+		q := bson.M{"_id": id, "userid": userid, "claimed": false, "deleted": false, "expire_at": bson.M{"$gt": now},
+			"attachments.0": bson.M{"$exists": true}}
+		change := mgo.Change{Update: bson.M{"$set": bson.M{"claimed": true, "read": true}}, ReturnNew: true}
+		_, err := sess.DB("").C(COLLECTION_MAILS).Find(q).Apply(change, m)
+		return err
+	})
+	if err == mgo.ErrNotFound {
+		return nil, ERROR_NOT_FOUND
+	} else if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (s *mongo_store) get(userid int32, id string) (*Mail, error) {
+	m := &Mail{}
+	err := s.db.Execute(func(sess *mgo.Session) error {
+		return sess.DB("").C(COLLECTION_MAILS).Find(bson.M{"_id": id, "userid": userid}).One(m)
+	})
+	if err == mgo.ErrNotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (s *mongo_store) revert(id string) error {
+	return s.update(bson.M{"_id": id, "claimed": true}, bson.M{"$set": bson.M{"claimed": false}})
+}
+
+// 基于db.Table的存储, standalone模式下写入data-dir; 没有TTL索引, 过期的邮件保留在表中, 查询时过滤
+type memory_store struct {
+	mails      *db.Table
+	broadcasts *db.Table
+}
+
+func new_memory_store(database *db.Database) *memory_store {
+	return &memory_store{
+		mails:      database.Table(COLLECTION_MAILS, func() interface{} { return &Mail{} }),
+		broadcasts: database.Table(COLLECTION_BROADCASTS, func() interface{} { return &Broadcast{} }),
+	}
+}
+
+func (s *memory_store) insert(m *Mail) error {
+	return s.mails.Insert(m.Id, *m)
+}
+
+func (s *memory_store) insert_broadcast(b *Broadcast) error {
+	return s.broadcasts.Insert(b.Id, *b)
+}
+
+func (s *memory_store) active_broadcasts(now time.Time) ([]Broadcast, error) {
+	var bs []Broadcast
+	s.broadcasts.Scan(func(doc interface{}) {
+		if b := doc.(Broadcast); b.ExpireAt.After(now) {
+			bs = append(bs, b)
+		}
+	})
+	return bs, nil
+}
+
+func (s *memory_store) filter(match func(m *Mail) bool) []Mail {
+	var mails []Mail
+	s.mails.Scan(func(doc interface{}) {
+		if m := doc.(Mail); match(&m) {
+			mails = append(mails, m)
+		}
+	})
+	return mails
+}
+
+func (s *memory_store) list(userid int32, now time.Time, limit int) ([]Mail, error) {
+	mails := s.filter(func(m *Mail) bool {
+		return m.UserId == userid && !m.Deleted && m.ExpireAt.After(now)
+	})
+	sort.Slice(mails, func(i, k int) bool { return mails[i].CreatedAt.After(mails[k].CreatedAt) })
+	if limit > 0 && len(mails) > limit {
+		mails = mails[:limit]
+	}
+	return mails, nil
+}
+
+func (s *memory_store) unread(userid int32, now time.Time) (int, error) {
+	return len(s.filter(func(m *Mail) bool {
+		return m.UserId == userid && !m.Read && !m.Deleted && m.ExpireAt.After(now)
+	})), nil
+}
+
+// 满足match时修改, 否则返回ERROR_NOT_FOUND
+func (s *memory_store) update(id string, match func(m *Mail) bool, change func(m *Mail)) (*Mail, error) {
+	var ret Mail
+	err := s.mails.Modify(id, func(cur interface{}) (interface{}, error) {
+		if cur == nil {
+			return nil, ERROR_NOT_FOUND
+		}
+		m := cur.(Mail)
+		if !match(&m) {
+			return nil, ERROR_NOT_FOUND
+		}
+		change(&m)
+		ret = m
+		return m, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+func (s *memory_store) read(userid int32, id string) error {
+	_, err := s.update(id, func(m *Mail) bool {
+		return m.UserId == userid && !m.Deleted
+	}, func(m *Mail) { m.Read = true })
+	return err
+}
+
+func (s *memory_store) remove(userid int32, id string) error {
+	_, err := s.update(id, func(m *Mail) bool {
+		return m.UserId == userid && !m.Deleted && (len(m.Attachments) == 0 || m.Claimed)
+	}, func(m *Mail) { m.Deleted, m.Read = true, true })
+	return err
+}
+
+func (s *memory_store) claim(userid int32, id string, now time.Time) (*Mail, error) {
+	return s.update(id, func(m *Mail) bool {
+		return m.UserId == userid && !m.Claimed && !m.Deleted && m.ExpireAt.After(now) && len(m.Attachments) > 0
+	}, func(m *Mail) { m.Claimed, m.Read = true, true })
+}
+
+func (s *memory_store) get(userid int32, id string) (*Mail, error) {
+	doc := s.mails.Get(id)
+	if doc == nil || doc.(Mail).UserId != userid {
+		return nil, nil
+	}
+	m := doc.(Mail)
+	return &m, nil
+}
+
+func (s *memory_store) revert(id string) error {
+	_, err := s.update(id, func(m *Mail) bool { return m.Claimed }, func(m *Mail) { m.Claimed = false })
+	return err
+}
@@ -1,10 +1,15 @@
 package main
 
 import (
+	"game/channels"
 	"game/client_handler"
+	"game/cron"
+	"game/election"
 	"game/etcdclient"
 	"game/kafka"
+	"game/leaderboard"
 	"game/numbers"
+	"game/presence"
 	pb "game/proto"
 	"game/services"
 	"net"
@@ -44,6 +49,16 @@ func main() {
 				Value: "/backends",
 				Usage: "etcd root path",
 			},
+			&cli.StringFlag{
+				Name:  "presence-root",
+				Value: "/presence",
+				Usage: "online presence path in etcd",
+			},
+			&cli.StringFlag{
+				Name:  "election-key",
+				Value: "/election/game",
+				Usage: "leader election key in etcd, the leader runs cron jobs",
+			},
 			&cli.StringFlag{
 				Name:  "numbers",
 				Value: "/numbers",
@@ -64,6 +79,30 @@ func main() {
 				Value: "trace-MYGAME",
 				Usage: "user tracking topic",
 			},
+			&cli.StringFlag{
+				Name:  "channel-topic",
+				Value: "channel-MYGAME",
+				Usage: "cross-instance channel topic in kafka",
+			},
+			&cli.StringFlag{
+				Name:  "leaderboard-topic",
+				Value: "leaderboard-MYGAME",
+				Usage: "cross-instance leaderboard sync topic in kafka",
+			},
+			&cli.StringFlag{
+				Name:  "replay-dir",
+				Value: "replays",
+				Usage: "lockstep battle replay directory, empty to disable",
+			},
+			&cli.DurationFlag{
+				Name:  "flush-interval",
+				Value: 10 * time.Second,
+				Usage: "user data write-behind interval, at most this much is lost on crash",
+			},
+			&cli.StringFlag{
+				Name:  "cert-key",
+				Usage: "key shared with the account service to verify client certificates, empty to disable certificate login",
+			},
 			&cli.StringSliceFlag{
 				Name:  "services",
 				Value: cli.NewStringSlice("snowflake-10000"),
@@ -84,6 +123,29 @@ func main() {
 				Value: 128,
 				Usage: "mongodb concurrent queries",
 			},
+			&cli.BoolFlag{
+				Name:  "standalone",
+				Usage: "run without etcd, kafka and mongodb, for local development",
+			},
+			&cli.StringFlag{
+				Name:  "numbers-dir",
+				Value: "./numbers",
+				Usage: "local xlsx directory in standalone mode",
+			},
+			&cli.StringFlag{
+				Name:  "log-dir",
+				Value: "./logs",
+				Usage: "local WAL & trace directory in standalone mode",
+			},
+			&cli.StringFlag{
+				Name:  "data-dir",
+				Value: "./data",
+				Usage: "local user data directory in standalone mode",
+			},
+			&cli.StringSliceFlag{
+				Name:  "static-services",
+				Usage: "static services in standalone mode, eg: snowflake-10000/snowflake1=127.0.0.1:50003",
+			},
 		},
 		Action: func(c *cli.Context) error {
 			log.Println("id:", c.String("id"))
@@ -92,10 +154,17 @@ func main() {
 			log.Println("etcd-root:", c.String("etcd-root"))
 			log.Println("services:", c.StringSlice("services"))
 			log.Println("numbers:", c.String("numbers"))
+			log.Println("presence-root:", c.String("presence-root"))
+			log.Println("election-key:", c.String("election-key"))
 			log.Println("kafka-brokers:", c.StringSlice("kafka-brokers"))
+			log.Println("channel-topic:", c.String("channel-topic"))
+			log.Println("leaderboard-topic:", c.String("leaderboard-topic"))
 			log.Println("mongodb:", c.String("mongodb"))
 			log.Println("mongodb-timeout:", c.Duration("mongodb-timeout"))
 			log.Println("mongodb-concurrent:", c.Int("mongodb-concurrent"))
+			log.Println("replay-dir:", c.String("replay-dir"))
+			log.Println("flush-interval:", c.Duration("flush-interval"))
+			log.Println("standalone:", c.Bool("standalone"))
 
 			// 监听
 			lis, err := net.Listen("tcp", c.String("listen"))
@@ -110,12 +179,36 @@ func main() {
 			ins := new(server)
 			pb.RegisterGameServiceServer(s, ins)
 
+			client_handler.SetReplayDir(c.String("replay-dir"))
+			client_handler.SetFlushInterval(c.Duration("flush-interval"))
+			client_handler.SetCertificateKey(c.String("cert-key"))
+
 			// 初始化Services
-			etcdclient.Init(c.StringSlice("etcd-hosts"))
-			services.Init(c.String("etcd-root"), c.StringSlice("etcd-hosts"), c.StringSlice("services"))
-			numbers.Init(c.String("numbers"))
-			kafka.Init(c.StringSlice("kafka-brokers"), c.String("wal-topic"), c.String("trace-topic"), c.String("id"))
-			client_handler.Init(c.String("mongodb"), c.Int("mongodb-concurrent"), c.Duration("mongodb-timeout"))
+			if c.Bool("standalone") {
+				// 单机模式, 不依赖etcd, kafka, mongodb
+				log.Println("numbers-dir:", c.String("numbers-dir"))
+				log.Println("log-dir:", c.String("log-dir"))
+				log.Println("data-dir:", c.String("data-dir"))
+				log.Println("static-services:", c.StringSlice("static-services"))
+				services.InitStatic(c.String("etcd-root"), c.StringSlice("static-services"))
+				numbers.InitLocal(c.String("numbers-dir"))
+				kafka.InitLocal(c.String("log-dir"), c.String("wal-topic"), c.String("trace-topic"), c.String("id"))
+				presence.InitLocal(c.String("id"))
+				client_handler.InitLocal(c.String("data-dir"))
+				cron.Init(&client_handler.DefaultDatabase, c.String("id"))
+			} else {
+				etcdclient.Init(c.StringSlice("etcd-hosts"))
+				services.Init(c.String("etcd-root"), c.StringSlice("etcd-hosts"), c.StringSlice("services"))
+				numbers.Init(c.String("numbers"))
+				presence.Init(c.String("presence-root"), c.String("id"))
+				kafka.Init(c.StringSlice("kafka-brokers"), c.String("wal-topic"), c.String("trace-topic"), c.String("id"))
+				channels.Init(c.String("channel-topic"), c.String("id"))
+				client_handler.Init(c.String("mongodb"), c.Int("mongodb-concurrent"), c.Duration("mongodb-timeout"))
+				leaderboard.InitSync(c.String("leaderboard-topic"), c.String("id"))
+				election.Init(c.String("election-key"), c.String("id"))
+				cron.IsLeader = election.IsLeader
+				cron.Init(&client_handler.DefaultDatabase, c.String("id"))
+			}
 			// 开始服务
 			return s.Serve(lis)
 		},
@@ -0,0 +1,340 @@
+package matchmaking
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	ERROR_ALREADY_QUEUED = errors.New("already in queue")
+	ERROR_NOT_QUEUED     = errors.New("not in queue")
+	ERROR_GROUP_SIZE     = errors.New("group larger than team size")
+)
+
+// 时钟, 测试时替换为可控的时钟
+type Clock interface {
+	Now() time.Time
+}
+
+type real_clock struct{}
+
+func (real_clock) Now() time.Time { return time.Now() }
+
+// 匹配窗口曲线的一段: 等待超过After后, 允许的分差为Window
+type WindowStep struct {
+	After  time.Duration
+	Window int32
+}
+
+// 匹配参数
+type Config struct {
+	TeamSize int           // 每队人数, 一场比赛两队
+	Windows  []WindowStep  // 按After升序
+	Timeout  time.Duration // 超时未匹配到则移出队列
+}
+
+func default_config() Config {
+	return Config{
+		TeamSize: 1,
+		Windows: []WindowStep{
+			{0, 100},
+			{10 * time.Second, 200},
+			{20 * time.Second, 400},
+			{30 * time.Second, 800},
+		},
+		Timeout: 60 * time.Second,
+	}
+}
+
+// 等待wait时允许的分差
+func (cfg *Config) window(wait time.Duration) int32 {
+	var w int32
+	for _, step := range cfg.Windows {
+		if wait < step.After {
+			break
+		}
+		w = step.Window
+	}
+	return w
+}
+
+// 排队中的玩家或队伍, 队伍以队长的UserId排队, 整体分到同一队
+type Ticket struct {
+	UserId   int32
+	Members  []int32 // 队伍的全部成员(含队长), 单人排队时为空
+	Rating   int32
+	Enqueued time.Time
+}
+
+// Players 排队的全部玩家
+func (t *Ticket) Players() []int32 {
+	if len(t.Members) == 0 {
+		return []int32{t.UserId}
+	}
+	return t.Members
+}
+
+func (t *Ticket) size() int {
+	if len(t.Members) == 0 {
+		return 1
+	}
+	return len(t.Members)
+}
+
+// 匹配结果
+type Match struct {
+	Id      int64
+	Teams   [][]Ticket
+	Created time.Time
+}
+
+// 排队统计
+type Stats struct {
+	Queued    int           // 当前排队人数
+	Matched   int64         // 累计匹配成功人数
+	Cancelled int64         // 累计取消人数
+	TimedOut  int64         // 累计超时人数
+	AvgWait   time.Duration // 匹配成功者的平均等待时间
+	MaxWait   time.Duration // 匹配成功者的最长等待时间
+}
+
+// 匹配器, 由外部定期调用Tick驱动
+type Matcher struct {
+	cfg       Config
+	clock     Clock
+	tickets   map[int32]*Ticket // userid -> ticket, 队伍的每个成员都指向同一个ticket
+	nextId    int64
+	stats     Stats
+	totalWait time.Duration
+	sync.Mutex
+}
+
+// NewMatcher 创建匹配器, clock为nil时使用系统时钟
+func NewMatcher(cfg Config, clock Clock) *Matcher {
+	if clock == nil {
+		clock = real_clock{}
+	}
+	return &Matcher{cfg: cfg, clock: clock, tickets: make(map[int32]*Ticket)}
+}
+
+// SetConfig 更新匹配参数, 对排队中的玩家立即生效
+func (m *Matcher) SetConfig(cfg Config) {
+	m.Lock()
+	m.cfg = cfg
+	m.Unlock()
+}
+
+// Enqueue 加入队列
+func (m *Matcher) Enqueue(userid, rating int32) error {
+	m.Lock()
+	defer m.Unlock()
+	if _, ok := m.tickets[userid]; ok {
+		return ERROR_ALREADY_QUEUED
+	}
+	m.tickets[userid] = &Ticket{UserId: userid, Rating: rating, Enqueued: m.clock.Now()}
+	return nil
+}
+
+// EnqueueGroup 队伍整体加入队列, members包含leader, rating为队伍的匹配分
+func (m *Matcher) EnqueueGroup(leader int32, members []int32, rating int32) error {
+	m.Lock()
+	defer m.Unlock()
+	if len(members) > m.cfg.TeamSize {
+		return ERROR_GROUP_SIZE
+	}
+	for _, id := range members {
+		if _, ok := m.tickets[id]; ok {
+			return ERROR_ALREADY_QUEUED
+		}
+	}
+	t := &Ticket{UserId: leader, Members: append([]int32(nil), members...), Rating: rating, Enqueued: m.clock.Now()}
+	for _, id := range members {
+		m.tickets[id] = t
+	}
+	return nil
+}
+
+// Cancel 离开队列, 队伍的任一成员取消时整个队伍离开
+func (m *Matcher) Cancel(userid int32) error {
+	m.Lock()
+	defer m.Unlock()
+	t, ok := m.tickets[userid]
+	if !ok {
+		return ERROR_NOT_QUEUED
+	}
+	m.remove(t)
+	m.stats.Cancelled += int64(t.size())
+	return nil
+}
+
+func (m *Matcher) remove(t *Ticket) {
+	for _, id := range t.Players() {
+		delete(m.tickets, id)
+	}
+}
+
+// IsQueued 是否在队列中
+func (m *Matcher) IsQueued(userid int32) bool {
+	m.Lock()
+	defer m.Unlock()
+	_, ok := m.tickets[userid]
+	return ok
+}
+
+// Stats 排队统计
+func (m *Matcher) Stats() Stats {
+	m.Lock()
+	defer m.Unlock()
+	s := m.stats
+	s.Queued = len(m.tickets) // 按玩家计
+	if s.Matched > 0 {
+		s.AvgWait = m.totalWait / time.Duration(s.Matched)
+	}
+	return s
+}
+
+// Tick 移出超时的玩家并进行一轮匹配
+// 排队者按分数排序后, 从每个未成局的排队者开始按分数顺序凑满两队人数(跳过放不下的队伍),
+// 当组内分差不超过每个成员当前的窗口, 且能分成人数相等的两队时成局
+func (m *Matcher) Tick() (matches []*Match, timeouts []Ticket) {
+	m.Lock()
+	defer m.Unlock()
+	now := m.clock.Now()
+
+	queue := make([]*Ticket, 0, len(m.tickets))
+	for id, t := range m.tickets {
+		if id != t.UserId {
+			continue
+		}
+		if m.cfg.Timeout > 0 && now.Sub(t.Enqueued) >= m.cfg.Timeout {
+			timeouts = append(timeouts, *t)
+			m.remove(t)
+			m.stats.TimedOut += int64(t.size())
+			continue
+		}
+		queue = append(queue, t)
+	}
+
+	size := m.cfg.TeamSize * 2
+	if size <= 0 {
+		return
+	}
+	sort.Slice(queue, func(i, j int) bool {
+		if queue[i].Rating != queue[j].Rating {
+			return queue[i].Rating < queue[j].Rating
+		}
+		return queue[i].Enqueued.Before(queue[j].Enqueued)
+	})
+
+	used := make(map[*Ticket]bool)
+	for i := range queue {
+		if used[queue[i]] {
+			continue
+		}
+		group, teams := m.pick(queue[i:], used, size, now)
+		if group == nil {
+			continue
+		}
+		for _, t := range group {
+			used[t] = true
+		}
+		matches = append(matches, m.make_match(group, teams, now))
+	}
+	return
+}
+
+// 从queue[0]开始凑满size人, 返回成局的排队者和分队结果
+func (m *Matcher) pick(queue []*Ticket, used map[*Ticket]bool, size int, now time.Time) ([]*Ticket, []int) {
+	var group []*Ticket
+	var teams []int
+	n := 0
+	for _, t := range queue {
+		if used[t] || n+t.size() > size {
+			continue
+		}
+		group = append(group, t)
+		n += t.size()
+		if n < size {
+			continue
+		}
+		// 无法分队时去掉最后加入的, 继续向后找
+		if teams = split(group, m.cfg.TeamSize); teams != nil {
+			break
+		}
+		group = group[:len(group)-1]
+		n -= t.size()
+	}
+	if teams == nil {
+		return nil, nil
+	}
+
+	spread := group[len(group)-1].Rating - group[0].Rating
+	for _, t := range group {
+		if spread > m.cfg.window(now.Sub(t.Enqueued)) {
+			return nil, nil
+		}
+	}
+	return group, teams
+}
+
+// 分队: 按分数从高到低依次放入总分较低且放得下的一队, 放不下时回溯,
+// 全部单人时结果为蛇形分队 0 1 1 0 0 1 1 0...; 无法分成人数相等的两队时返回nil
+func split(group []*Ticket, team_size int) []int {
+	order := make([]int, len(group))
+	for k := range order {
+		order[k] = len(group) - 1 - k
+	}
+	teams := make([]int, len(group))
+	var count [2]int
+	var total [2]int64
+	var assign func(k int) bool
+	assign = func(k int) bool {
+		if k == len(order) {
+			return true
+		}
+		t := group[order[k]]
+		first := 0
+		if total[1] < total[0] {
+			first = 1
+		}
+		for _, team := range []int{first, 1 - first} {
+			if count[team]+t.size() > team_size {
+				continue
+			}
+			teams[order[k]] = team
+			count[team] += t.size()
+			total[team] += int64(t.Rating) * int64(t.size())
+			if assign(k + 1) {
+				return true
+			}
+			count[team] -= t.size()
+			total[team] -= int64(t.Rating) * int64(t.size())
+		}
+		return false
+	}
+	if !assign(0) {
+		return nil
+	}
+	return teams
+}
+
+// 成局
+func (m *Matcher) make_match(group []*Ticket, teams []int, now time.Time) *Match {
+	m.nextId++
+	match := &Match{Id: m.nextId, Teams: make([][]Ticket, 2), Created: now}
+	for k := len(group) - 1; k >= 0; k-- {
+		t := group[k]
+		match.Teams[teams[k]] = append(match.Teams[teams[k]], *t)
+
+		wait := now.Sub(t.Enqueued)
+		m.totalWait += wait * time.Duration(t.size())
+		if wait > m.stats.MaxWait {
+			m.stats.MaxWait = wait
+		}
+		m.stats.Matched += int64(t.size())
+		m.remove(t)
+	}
+	return match
+}
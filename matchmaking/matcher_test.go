@@ -0,0 +1,148 @@
+package matchmaking
+
+import (
+	"testing"
+	"time"
+)
+
+type fake_clock struct {
+	now time.Time
+}
+
+func (c *fake_clock) Now() time.Time          { return c.now }
+func (c *fake_clock) Advance(d time.Duration) { c.now = c.now.Add(d) }
+func new_fake_clock() *fake_clock             { return &fake_clock{now: time.Unix(1000, 0)} }
+
+func TestWindowWidening(t *testing.T) {
+	clock := new_fake_clock()
+	m := NewMatcher(default_config(), clock)
+	m.Enqueue(1, 1000)
+	m.Enqueue(2, 1150)
+
+	// 分差150超过初始窗口100
+	if matches, _ := m.Tick(); len(matches) != 0 {
+		t.Fatal("unexpected match:", matches)
+	}
+
+	// 10秒后窗口扩大到200
+	clock.Advance(10 * time.Second)
+	matches, _ := m.Tick()
+	if len(matches) != 1 {
+		t.Fatal("expect 1 match, got:", len(matches))
+	}
+	if len(matches[0].Teams[0]) != 1 || len(matches[0].Teams[1]) != 1 {
+		t.Fatal("unexpected teams:", matches[0].Teams)
+	}
+	if m.IsQueued(1) || m.IsQueued(2) {
+		t.Fatal("matched players still queued")
+	}
+
+	s := m.Stats()
+	if s.Matched != 2 || s.AvgWait != 10*time.Second || s.MaxWait != 10*time.Second {
+		t.Fatal("unexpected stats:", s)
+	}
+}
+
+func TestWindowPerPlayer(t *testing.T) {
+	clock := new_fake_clock()
+	m := NewMatcher(default_config(), clock)
+	m.Enqueue(1, 1000)
+	clock.Advance(20 * time.Second)
+	m.Enqueue(2, 1300)
+
+	// 1号窗口已到400, 但2号刚进入, 窗口只有100
+	if matches, _ := m.Tick(); len(matches) != 0 {
+		t.Fatal("unexpected match:", matches)
+	}
+	clock.Advance(20 * time.Second)
+	if matches, _ := m.Tick(); len(matches) != 1 {
+		t.Fatal("expect match")
+	}
+}
+
+func TestTeamsAndTimeout(t *testing.T) {
+	clock := new_fake_clock()
+	cfg := default_config()
+	cfg.TeamSize = 2
+	m := NewMatcher(cfg, clock)
+	for i, r := range []int32{1000, 1010, 1020, 1030, 3000} {
+		if err := m.Enqueue(int32(i+1), r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := m.Enqueue(1, 1000); err != ERROR_ALREADY_QUEUED {
+		t.Fatal("expect already queued, got:", err)
+	}
+
+	matches, _ := m.Tick()
+	if len(matches) != 1 {
+		t.Fatal("expect 1 match, got:", len(matches))
+	}
+	// 蛇形分队: 1030+1000 vs 1020+1010
+	team0 := matches[0].Teams[0]
+	if len(team0) != 2 || team0[0].Rating+team0[1].Rating != 2030 {
+		t.Fatal("unexpected teams:", matches[0].Teams)
+	}
+
+	clock.Advance(cfg.Timeout)
+	_, timeouts := m.Tick()
+	if len(timeouts) != 1 || timeouts[0].UserId != 5 {
+		t.Fatal("expect 5 timed out, got:", timeouts)
+	}
+	if err := m.Cancel(5); err != ERROR_NOT_QUEUED {
+		t.Fatal("expect not queued, got:", err)
+	}
+	if s := m.Stats(); s.Queued != 0 || s.TimedOut != 1 || s.Matched != 4 {
+		t.Fatal("unexpected stats:", s)
+	}
+}
+
+func TestGroup(t *testing.T) {
+	clock := new_fake_clock()
+	cfg := default_config()
+	cfg.TeamSize = 3
+	m := NewMatcher(cfg, clock)
+	if err := m.EnqueueGroup(1, []int32{1, 2, 3, 4}, 1000); err != ERROR_GROUP_SIZE {
+		t.Fatal("expect group too large, got:", err)
+	}
+	if err := m.EnqueueGroup(1, []int32{1, 2}, 1000); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Enqueue(2, 1000); err != ERROR_ALREADY_QUEUED {
+		t.Fatal("member queued twice:", err)
+	}
+	// 三个双人队伍无法分成3v3
+	m.EnqueueGroup(3, []int32{3, 4}, 1010)
+	m.EnqueueGroup(5, []int32{5, 6}, 1020)
+	if matches, _ := m.Tick(); len(matches) != 0 {
+		t.Fatal("unexpected match:", matches[0].Teams)
+	}
+
+	m.Enqueue(7, 1030)
+	m.Enqueue(8, 1040)
+	matches, _ := m.Tick()
+	if len(matches) != 1 {
+		t.Fatal("expect 1 match, got:", len(matches))
+	}
+	for _, team := range matches[0].Teams {
+		n := 0
+		for _, ticket := range team {
+			n += len(ticket.Players())
+		}
+		if n != 3 {
+			t.Fatal("unbalanced teams:", matches[0].Teams)
+		}
+	}
+	if m.IsQueued(7) || !m.IsQueued(5) {
+		t.Fatal("unexpected queue after match")
+	}
+	if s := m.Stats(); s.Queued != 2 || s.Matched != 6 {
+		t.Fatal("unexpected stats:", s)
+	}
+
+	// 任一成员取消时整个队伍离开
+	m.EnqueueGroup(8, []int32{8, 9}, 1000)
+	if err := m.Cancel(9); err != nil || m.IsQueued(8) {
+		t.Fatal("group not cancelled:", err)
+	}
+}
@@ -0,0 +1,99 @@
+package matchmaking
+
+import (
+	"time"
+
+	"game/kafka"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// 匹配:
+// 玩家带着分数进入本实例的匹配队列, 等待越久允许的分差越大, 超时未匹配则移出队列.
+// 匹配结果和超时通过OnMatch/OnTimeout回调通知, 由client_handler推送给玩家.
+const (
+	TICK_INTERVAL = time.Second
+)
+
+var (
+	_default_matcher = NewMatcher(default_config(), nil)
+
+	OnMatch   func(m *Match) // 匹配成功
+	OnTimeout func(t Ticket) // 排队超时
+)
+
+// Init 开始匹配循环
+func Init() {
+	go loop()
+}
+
+func loop() {
+	for range time.Tick(TICK_INTERVAL) {
+		matches, timeouts := _default_matcher.Tick()
+		for _, m := range matches {
+			trace_match(m)
+			if OnMatch != nil {
+				OnMatch(m)
+			}
+		}
+		for _, t := range timeouts {
+			for _, id := range t.Players() {
+				kafka.TraceEvent("match_timeout", id, map[string]interface{}{"rating": t.Rating})
+			}
+			if OnTimeout != nil {
+				OnTimeout(t)
+			}
+		}
+		if len(matches) > 0 || len(timeouts) > 0 {
+			s := _default_matcher.Stats()
+			log.Debugf("matchmaking: queued:%v matched:%v timeout:%v avg_wait:%v max_wait:%v",
+				s.Queued, s.Matched, s.TimedOut, s.AvgWait, s.MaxWait)
+		}
+	}
+}
+
+func trace_match(m *Match) {
+	for team := range m.Teams {
+		for _, t := range m.Teams[team] {
+			for _, id := range t.Players() {
+				kafka.TraceEvent("match_found", id, map[string]interface{}{
+					"match":   m.Id,
+					"team":    team,
+					"rating":  t.Rating,
+					"leader":  t.UserId,
+					"wait_ms": int64(m.Created.Sub(t.Enqueued) / time.Millisecond),
+				})
+			}
+		}
+	}
+}
+
+// SetConfig 更新匹配参数, 数值表热更新时调用
+func SetConfig(cfg Config) {
+	_default_matcher.SetConfig(cfg)
+}
+
+// Enqueue 加入匹配队列
+func Enqueue(userid, rating int32) error {
+	return _default_matcher.Enqueue(userid, rating)
+}
+
+// EnqueueGroup 队伍整体加入匹配队列, 分到同一队
+func EnqueueGroup(leader int32, members []int32, rating int32) error {
+	return _default_matcher.EnqueueGroup(leader, members, rating)
+}
+
+// Cancel 取消匹配
+func Cancel(userid int32) error {
+	return _default_matcher.Cancel(userid)
+}
+
+// IsQueued 是否在匹配队列中
+func IsQueued(userid int32) bool {
+	return _default_matcher.IsQueued(userid)
+}
+
+// GetStats 排队统计
+func GetStats() Stats {
+	return _default_matcher.Stats()
+}
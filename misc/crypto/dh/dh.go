@@ -0,0 +1,79 @@
+package dh
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// Diffie-Hellman密钥交换, 用于socket通信加密:
+// 客户端生成两对密钥, 把两个公钥(client_send_seed, client_receive_seed)发给服务器,
+// 服务器同样生成两对密钥, 回复两个公钥, 双方各自算出两个方向的共享密钥.
+// 公钥需要放进int32, 因此使用31位的素数, 共享密钥加上SALT后作为流加密(rc4)的密钥.
+const (
+	SALT = "DH"
+)
+
+var (
+	DH1BASE  = big.NewInt(3)
+	DH1PRIME = big.NewInt(0x7FFFFFC3)
+)
+
+var (
+	ERROR_INVALID_PUBLIC = errors.New("invalid dh public key")
+)
+
+// 协商出的密钥, 以服务器的视角命名
+type Keys struct {
+	Encrypt []byte // 服务器发往客户端方向
+	Decrypt []byte // 客户端发往服务器方向
+}
+
+// GenerateKey 生成一对密钥
+func GenerateKey() (secret, public *big.Int, err error) {
+	// secret取值[1, prime-2]
+	secret, err = rand.Int(rand.Reader, new(big.Int).Sub(DH1PRIME, big.NewInt(2)))
+	if err != nil {
+		return nil, nil, err
+	}
+	secret.Add(secret, big.NewInt(1))
+	public = new(big.Int).Exp(DH1BASE, secret, DH1PRIME)
+	return secret, public, nil
+}
+
+// SharedKey 用自己的私钥和对方的公钥计算共享密钥
+func SharedKey(secret, peer *big.Int) *big.Int {
+	return new(big.Int).Exp(peer, secret, DH1PRIME)
+}
+
+// CipherKey 共享密钥对应的流加密密钥
+func CipherKey(shared *big.Int) []byte {
+	return []byte(fmt.Sprintf("%v%v", SALT, shared))
+}
+
+// 拒绝0, 1和prime-1等退化的公钥
+func valid_public(p *big.Int) bool {
+	return p.Cmp(big.NewInt(1)) > 0 && p.Cmp(new(big.Int).Sub(DH1PRIME, big.NewInt(1))) < 0
+}
+
+// Negotiate 服务器端的协商, 参数为客户端的两个公钥, 返回回复给客户端的两个公钥和协商出的密钥.
+// 客户端用client_send_seed对应的私钥和服务器的send公钥加密上行数据, 用另一对解密下行数据
+func Negotiate(client_send, client_receive int32) (send, receive int32, keys Keys, err error) {
+	cs, cr := big.NewInt(int64(client_send)), big.NewInt(int64(client_receive))
+	if !valid_public(cs) || !valid_public(cr) {
+		return 0, 0, keys, ERROR_INVALID_PUBLIC
+	}
+
+	x1, e1, err := GenerateKey()
+	if err != nil {
+		return 0, 0, keys, err
+	}
+	x2, e2, err := GenerateKey()
+	if err != nil {
+		return 0, 0, keys, err
+	}
+	keys.Decrypt = CipherKey(SharedKey(x1, cs))
+	keys.Encrypt = CipherKey(SharedKey(x2, cr))
+	return int32(e1.Int64()), int32(e2.Int64()), keys, nil
+}
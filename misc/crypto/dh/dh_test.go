@@ -0,0 +1,58 @@
+package dh
+
+import (
+	"bytes"
+	"crypto/rc4"
+	"math/big"
+	"testing"
+)
+
+func TestHandshake(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		// 客户端
+		xs, es, err := GenerateKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		xr, er, err := GenerateKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// 服务器
+		send, receive, keys, err := Negotiate(int32(es.Int64()), int32(er.Int64()))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// 客户端用服务器的公钥算出两个方向的密钥
+		up := CipherKey(SharedKey(xs, bigint(send)))
+		down := CipherKey(SharedKey(xr, bigint(receive)))
+		if !bytes.Equal(up, keys.Decrypt) || !bytes.Equal(down, keys.Encrypt) {
+			t.Fatal("keys mismatch")
+		}
+
+		// 上行: 客户端加密, 服务器解密
+		msg := []byte("hello")
+		enc, _ := rc4.NewCipher(up)
+		dec, _ := rc4.NewCipher(keys.Decrypt)
+		buf := make([]byte, len(msg))
+		enc.XORKeyStream(buf, msg)
+		dec.XORKeyStream(buf, buf)
+		if !bytes.Equal(buf, msg) {
+			t.Fatal("stream cipher mismatch")
+		}
+	}
+}
+
+func TestInvalidPublic(t *testing.T) {
+	for _, p := range []int32{0, 1, int32(DH1PRIME.Int64() - 1), -5} {
+		if _, _, _, err := Negotiate(p, 2); err != ERROR_INVALID_PUBLIC {
+			t.Fatal("expect invalid public:", p, err)
+		}
+	}
+}
+
+func bigint(n int32) *big.Int {
+	return big.NewInt(int64(n))
+}
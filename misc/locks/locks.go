@@ -0,0 +1,18 @@
+package locks
+
+import (
+	"sync"
+)
+
+const (
+	NUM_LOCKS = 64
+)
+
+// 按玩家分段的锁, 保证同一实例内同一玩家的操作串行执行
+// 不同模块各自声明, 互不影响
+type UserLocks [NUM_LOCKS]sync.Mutex
+
+// Of 玩家对应的锁
+func (l *UserLocks) Of(userid int32) *sync.Mutex {
+	return &l[uint32(userid)%NUM_LOCKS]
+}
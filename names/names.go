@@ -0,0 +1,241 @@
+package names
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"game/db"
+	"game/kafka"
+	"game/mail"
+
+	log "github.com/Sirupsen/logrus"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// 昵称:
+// 每个昵称以规范化后的名字(去除首尾空白, 转小写)为_id保存在COLLECTION_NAMES中, 由_id的唯一索引保证不重复.
+// 改名分两步: 先预留(RESERVED, 带过期时间), 扣除费用后再提交(COMMITTED), 提交后释放旧名字.
+// 预留过期后其他玩家可以抢占, 因此崩溃后残留的预留不需要清理; 提交时以userid和state为条件,
+// 预留被抢占时提交失败并退还费用.
+// 每次改名都记录在COLLECTION_HISTORY中, 用于客服查询玩家用过的名字和名字的历任主人.
+const (
+	COLLECTION_NAMES   = "names"
+	COLLECTION_HISTORY = "name_history"
+
+	MAX_HISTORY = 50 // 历史查询的最大条数
+)
+
+// 名字状态
+const (
+	STATE_RESERVED  = int32(1) // 已预留, 等待提交
+	STATE_COMMITTED = int32(2) // 已使用
+)
+
+var (
+	ERROR_NAME_INVALID    = errors.New("invalid name length or charset")
+	ERROR_NAME_FORBIDDEN  = errors.New("name contains forbidden words")
+	ERROR_NAME_TAKEN      = errors.New("name already taken")
+	ERROR_SAME_NAME       = errors.New("same as current name")
+	ERROR_COOLDOWN        = errors.New("rename in cooldown")
+	ERROR_RESERVATION     = errors.New("name reservation lost")
+	ERROR_PAY_UNAVAILABLE = errors.New("rename payment unavailable")
+)
+
+// 名字的归属
+type Name struct {
+	Key       string `bson:"_id"` // 规范化后的名字
+	Name      string `bson:"name"`
+	UserId    int32  `bson:"userid"`
+	State     int32  `bson:"state"`
+	ExpireAt  int64  `bson:"expire_at"` // 预留的过期时间
+	UpdatedAt int64  `bson:"updated_at"`
+}
+
+// 改名记录, 首次取名时Old为空
+type Record struct {
+	Id        bson.ObjectId   `bson:"_id"`
+	UserId    int32           `bson:"userid"`
+	Old       string          `bson:"old"`
+	New       string          `bson:"new"`
+	Keys      []string        `bson:"keys"` // 新旧名字规范化后的值, 用于按名字查询
+	Cost      mail.Attachment `bson:"cost"`
+	CreatedAt int64           `bson:"created_at"`
+}
+
+// 昵称规则, 来自数值表
+type Config struct {
+	MinLen     int             // 最小长度(字符)
+	MaxLen     int             // 最大长度(字符)
+	Words      []string        // 屏蔽词, 不区分大小写
+	Cooldown   time.Duration   // 两次改名的最小间隔, 首次取名不受限制
+	Cost       mail.Attachment // 改名费用, Count为0时免费, 首次取名免费
+	ReserveTTL time.Duration   // 预留的有效期
+}
+
+func DefaultConfig() Config {
+	return Config{MinLen: 2, MaxLen: 12, Cooldown: 24 * time.Hour, ReserveTTL: time.Minute}
+}
+
+var (
+	_store  store
+	_config = DefaultConfig()
+	_mu     sync.RWMutex
+
+	// Pay 扣除改名费用, 由上层设置
+	Pay func(userid int32, cost mail.Attachment) error
+
+	// Refund 退还改名费用, 由上层设置
+	Refund func(userid int32, cost mail.Attachment) error
+)
+
+func Init(database *db.Database) {
+	if database.IsLocal() {
+		_store = new_memory_store(database)
+	} else {
+		_store = new_mongo_store(database)
+	}
+}
+
+// SetConfig 设置规则, 数值表热更新时调用
+func SetConfig(cfg Config) {
+	words := make([]string, len(cfg.Words))
+	for k := range cfg.Words {
+		words[k] = strings.ToLower(cfg.Words[k])
+	}
+	cfg.Words = words
+	_mu.Lock()
+	_config = cfg
+	_mu.Unlock()
+}
+
+func config() Config {
+	_mu.RLock()
+	defer _mu.RUnlock()
+	return _config
+}
+
+// Normalize 规范化的名字, 用于判重
+func Normalize(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
+
+// Validate 检查长度, 字符集(字母, 数字, 下划线)和屏蔽词, 返回去除首尾空白后的名字
+func Validate(name string) (string, error) {
+	cfg := config()
+	name = strings.TrimSpace(name)
+	if !utf8.ValidString(name) {
+		return "", ERROR_NAME_INVALID
+	}
+	if n := utf8.RuneCountInString(name); n < cfg.MinLen || n > cfg.MaxLen {
+		return "", ERROR_NAME_INVALID
+	}
+	for _, r := range name {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' {
+			return "", ERROR_NAME_INVALID
+		}
+	}
+	key := Normalize(name)
+	for _, w := range cfg.Words {
+		if w != "" && strings.Contains(key, w) {
+			return "", ERROR_NAME_FORBIDDEN
+		}
+	}
+	return name, nil
+}
+
+// Owner 名字当前的主人, 没有或只是预留时返回0
+func Owner(name string) (int32, error) {
+	n, err := _store.get(Normalize(name))
+	if err != nil || n == nil || n.State != STATE_COMMITTED {
+		return 0, err
+	}
+	return n.UserId, nil
+}
+
+// History 玩家的改名记录, 按时间倒序
+func History(userid int32) ([]Record, error) {
+	return _store.history(userid, MAX_HISTORY)
+}
+
+// Owners 用过该名字的改名记录, 按时间倒序
+func Owners(name string) ([]Record, error) {
+	return _store.by_name(Normalize(name), MAX_HISTORY)
+}
+
+// NextRename 玩家下一次可以改名的时间, 没有改过名时返回零值
+func NextRename(userid int32) (time.Time, error) {
+	records, err := _store.history(userid, 1)
+	if err != nil || len(records) == 0 || records[0].Old == "" {
+		return time.Time{}, err
+	}
+	return time.Unix(records[0].CreatedAt, 0).Add(config().Cooldown), nil
+}
+
+// Rename 改名, old为玩家当前的名字, 为空时是首次取名(免费, 不受冷却限制)
+// 预留新名字 -> 扣费 -> 提交 -> 释放旧名字 -> 记录历史
+func Rename(userid int32, old, name string, now time.Time) (*Record, error) {
+	name, err := Validate(name)
+	if err != nil {
+		return nil, err
+	}
+	key := Normalize(name)
+	if old != "" && key == Normalize(old) {
+		return nil, ERROR_SAME_NAME
+	}
+
+	cfg := config()
+	var cost mail.Attachment
+	if old != "" {
+		if next, err := NextRename(userid); err != nil {
+			return nil, err
+		} else if now.Before(next) {
+			return nil, ERROR_COOLDOWN
+		}
+		cost = cfg.Cost
+	}
+
+	n := &Name{Key: key, Name: name, UserId: userid, State: STATE_RESERVED, ExpireAt: now.Add(cfg.ReserveTTL).Unix(), UpdatedAt: now.Unix()}
+	if err := _store.reserve(n, now.Unix()); err != nil {
+		return nil, err
+	}
+	if cost.Count > 0 {
+		if Pay == nil {
+			_store.release(key, userid)
+			return nil, ERROR_PAY_UNAVAILABLE
+		}
+		if err := Pay(userid, cost); err != nil {
+			_store.release(key, userid)
+			return nil, err
+		}
+	}
+
+	if err := _store.commit(key, userid, now.Unix()); err != nil {
+		if cost.Count > 0 && Refund != nil {
+			if err := Refund(userid, cost); err != nil {
+				log.Errorf("names: refund failed, userid:%v cost:%+v err:%v", userid, cost, err)
+			}
+		}
+		return nil, err
+	}
+	n.State = STATE_COMMITTED
+	kafka.CommitUpdate(key, n, COLLECTION_NAMES)
+
+	keys := []string{key}
+	if old != "" {
+		old_key := Normalize(old)
+		_store.free(old_key, userid)
+		kafka.CommitUpdate(old_key, bson.M{"op": "free", "userid": userid}, COLLECTION_NAMES)
+		keys = append(keys, old_key)
+	}
+
+	r := &Record{Id: bson.NewObjectId(), UserId: userid, Old: old, New: name, Keys: keys, Cost: cost, CreatedAt: now.Unix()}
+	if err := _store.record(r); err != nil {
+		log.Error("names: save history failed:", userid, err)
+	}
+	kafka.TraceEvent("rename", userid, map[string]interface{}{"old": old, "new": name, "cost": cost})
+	return r, nil
+}
@@ -0,0 +1,165 @@
+package names
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"game/db"
+	"game/kafka"
+	"game/mail"
+)
+
+func init() {
+	kafka.InitDiscard()
+}
+
+// 重新打开dir上的本地存储, 相当于standalone实例重启
+func reopen(dir string) {
+	var database db.Database
+	database.InitLocal(dir)
+	_store = new_memory_store(&database)
+}
+
+func setup(t *testing.T) (map[int32]int32, string) {
+	dir, err := ioutil.TempDir("", "names")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gold := map[int32]int32{1: 100, 2: 100}
+	reopen(dir)
+	SetConfig(Config{
+		MinLen:     2,
+		MaxLen:     6,
+		Words:      []string{"GM"},
+		Cooldown:   time.Hour,
+		Cost:       mail.Attachment{Type: mail.ATTACH_CURRENCY, Id: 1, Count: 50},
+		ReserveTTL: time.Minute,
+	})
+	Pay = func(userid int32, cost mail.Attachment) error {
+		if gold[userid] < cost.Count {
+			return errors.New("not enough")
+		}
+		gold[userid] -= cost.Count
+		return nil
+	}
+	Refund = func(userid int32, cost mail.Attachment) error {
+		gold[userid] += cost.Count
+		return nil
+	}
+	return gold, dir
+}
+
+func TestValidate(t *testing.T) {
+	_, dir := setup(t)
+	defer os.RemoveAll(dir)
+	for name, expect := range map[string]error{
+		" 玩家_1 ":  nil,
+		"a":       ERROR_NAME_INVALID,
+		"abcdefg": ERROR_NAME_INVALID,
+		"a b":     ERROR_NAME_INVALID,
+		"a-b":     ERROR_NAME_INVALID,
+		"xgmx":    ERROR_NAME_FORBIDDEN,
+	} {
+		if _, err := Validate(name); err != expect {
+			t.Fatalf("%q: expect %v, got %v", name, expect, err)
+		}
+	}
+}
+
+func TestRename(t *testing.T) {
+	gold, dir := setup(t)
+	defer os.RemoveAll(dir)
+	now := time.Now()
+
+	// 首次取名免费
+	if _, err := Rename(1, "", "Alice", now); err != nil || gold[1] != 100 {
+		t.Fatal("first name failed:", err, gold)
+	}
+	if _, err := Rename(2, "", "alice", now); err != ERROR_NAME_TAKEN {
+		t.Fatal("name taken twice:", err)
+	}
+	if _, err := Rename(1, "Alice", "ALICE", now); err != ERROR_SAME_NAME {
+		t.Fatal("renamed to same name:", err)
+	}
+
+	if _, err := Rename(1, "Alice", "Bob", now); err != nil || gold[1] != 50 {
+		t.Fatal("rename failed:", err, gold)
+	}
+	if _, err := Rename(1, "Bob", "Carol", now.Add(time.Minute)); err != ERROR_COOLDOWN {
+		t.Fatal("cooldown ignored:", err)
+	}
+	if owner, _ := Owner("bob"); owner != 1 {
+		t.Fatal("unexpected owner:", owner)
+	}
+	// 旧名字已释放
+	if _, err := Rename(2, "", "Alice", now); err != nil {
+		t.Fatal("old name not freed:", err)
+	}
+
+	// 扣费失败时释放预留
+	gold[1] = 0
+	if _, err := Rename(1, "Bob", "Carol", now.Add(time.Hour)); err == nil {
+		t.Fatal("renamed without payment")
+	}
+	if _, err := Rename(2, "Alice", "Carol", now.Add(time.Hour)); err != nil {
+		t.Fatal("reservation not released:", err)
+	}
+
+	if records, _ := Owners("alice"); len(records) != 4 || records[0].UserId != 2 {
+		t.Fatal("unexpected history:", records)
+	}
+	if records, _ := History(1); len(records) != 2 || records[0].New != "Bob" {
+		t.Fatal("unexpected history:", records)
+	}
+}
+
+func TestReservation(t *testing.T) {
+	gold, dir := setup(t)
+	defer os.RemoveAll(dir)
+	now := time.Now().Unix()
+	_store.reserve(&Name{Key: "dave", Name: "Dave", UserId: 1, State: STATE_RESERVED, ExpireAt: now + 60}, now)
+	if err := _store.reserve(&Name{Key: "dave", UserId: 2, State: STATE_RESERVED, ExpireAt: now + 60}, now); err != ERROR_NAME_TAKEN {
+		t.Fatal("reservation stolen:", err)
+	}
+
+	// 过期的预留可以被抢占, 原预留者提交失败
+	if err := _store.reserve(&Name{Key: "dave", UserId: 2, State: STATE_RESERVED, ExpireAt: now + 120}, now+60); err != nil {
+		t.Fatal(err)
+	}
+	if err := _store.commit("dave", 1, now+60); err != ERROR_RESERVATION {
+		t.Fatal("committed lost reservation:", err)
+	}
+	if _, err := Rename(2, "", "Dave", time.Unix(now+60, 0)); err != nil || gold[2] != 100 {
+		t.Fatal("own reservation not refreshed:", err)
+	}
+}
+
+func TestRestart(t *testing.T) {
+	_, dir := setup(t)
+	defer os.RemoveAll(dir)
+	now := time.Now()
+	Rename(1, "", "Alice", now)
+	Rename(1, "Alice", "Bob", now)
+	_store.reserve(&Name{Key: "carol", Name: "Carol", UserId: 1, State: STATE_RESERVED, ExpireAt: now.Unix() + 60}, now.Unix())
+
+	// 重启后已使用的名字和未过期的预留仍然有效
+	reopen(dir)
+	if owner, _ := Owner("bob"); owner != 1 {
+		t.Fatal("name lost after restart:", owner)
+	}
+	if _, err := Rename(2, "", "Bob", now); err != ERROR_NAME_TAKEN {
+		t.Fatal("name taken twice after restart:", err)
+	}
+	if _, err := Rename(2, "", "Carol", now); err != ERROR_NAME_TAKEN {
+		t.Fatal("reservation lost after restart:", err)
+	}
+	if _, err := Rename(2, "", "Alice", now); err != nil {
+		t.Fatal("freed name not persisted:", err)
+	}
+	if records, _ := History(1); len(records) != 2 || records[0].New != "Bob" {
+		t.Fatal("history lost after restart:", records)
+	}
+}
@@ -0,0 +1,231 @@
+package names
+
+import (
+	"sort"
+
+	"game/db"
+
+	log "github.com/Sirupsen/logrus"
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// 名字和改名记录的存储, reserve/commit/release/free都以主人和状态为条件
+type store interface {
+	get(key string) (*Name, error)                    // 不存在返回nil
+	reserve(n *Name, now int64) error                 // 名字空闲, 预留已过期或是自己的预留时成功, 否则返回ERROR_NAME_TAKEN
+	commit(key string, userid int32, now int64) error // 自己的预留改为已使用, 预留已被抢占时返回ERROR_RESERVATION
+	release(key string, userid int32)                 // 删除自己的预留
+	free(key string, userid int32)                    // 删除自己已使用的名字
+	record(r *Record) error
+	history(userid int32, limit int) ([]Record, error)
+	by_name(key string, limit int) ([]Record, error)
+}
+
+// mongodb存储
+type mongo_store struct {
+	db *db.Database
+}
+
+func new_mongo_store(database *db.Database) *mongo_store {
+	err := database.Execute(func(sess *mgo.Session) error {
+		c := sess.DB("").C(COLLECTION_HISTORY)
+		for _, key := range [][]string{{"userid", "-created_at"}, {"keys", "-created_at"}} {
+			if err := c.EnsureIndex(mgo.Index{Key: key}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Error(err)
+	}
+	return &mongo_store{db: database}
+}
+
+func (s *mongo_store) get(key string) (*Name, error) {
+	n := &Name{}
+	if err := s.db.Load(COLLECTION_NAMES, key, n); err == db.ERROR_NOT_FOUND {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+func (s *mongo_store) reserve(n *Name, now int64) error {
+	err := s.db.Execute(func(sess *mgo.Session) error {
+		return sess.DB("").C(COLLECTION_NAMES).Insert(n)
+	})
+	if !mgo.IsDup(err) {
+		return err
+	}
+
+	// 名字已存在, 只能抢占过期的预留或刷新自己的预留
+	err = s.db.Execute(func(sess *mgo.Session) error {
+		return sess.DB("").C(COLLECTION_NAMES).Update(bson.M{
+			"_id":   n.Key,
+			"state": STATE_RESERVED,
+			"$or":   []bson.M{{"expire_at": bson.M{"$lte": now}}, {"userid": n.UserId}},
+		}, n)
+	})
+	if err == mgo.ErrNotFound {
+		return ERROR_NAME_TAKEN
+	}
+	return err
+}
+
+func (s *mongo_store) commit(key string, userid int32, now int64) error {
+	err := s.db.Execute(func(sess *mgo.Session) error {
+		return sess.DB("").C(COLLECTION_NAMES).Update(
+			bson.M{"_id": key, "userid": userid, "state": STATE_RESERVED},
+			bson.M{"$set": bson.M{"state": STATE_COMMITTED, "updated_at": now}})
+	})
+	if err == mgo.ErrNotFound {
+		return ERROR_RESERVATION
+	}
+	return err
+}
+
+func (s *mongo_store) remove(key string, userid int32, state int32) {
+	err := s.db.Execute(func(sess *mgo.Session) error {
+		return sess.DB("").C(COLLECTION_NAMES).Remove(bson.M{"_id": key, "userid": userid, "state": state})
+	})
+	if err != nil && err != mgo.ErrNotFound {
+		log.Error(err)
+	}
+}
+
+func (s *mongo_store) release(key string, userid int32) {
+	s.remove(key, userid, STATE_RESERVED)
+}
+
+func (s *mongo_store) free(key string, userid int32) {
+	s.remove(key, userid, STATE_COMMITTED)
+}
+
+func (s *mongo_store) record(r *Record) error {
+	return s.db.Execute(func(sess *mgo.Session) error {
+		return sess.DB("").C(COLLECTION_HISTORY).Insert(r)
+	})
+}
+
+func (s *mongo_store) find(q bson.M, limit int) (records []Record, err error) {
+	err = s.db.Execute(func(sess *mgo.Session) error {
+		return sess.DB("").C(COLLECTION_HISTORY).Find(q).Sort("-created_at").Limit(limit).All(&records)
+	})
+	return
+}
+
+func (s *mongo_store) history(userid int32, limit int) ([]Record, error) {
+	return s.find(bson.M{"userid": userid}, limit)
+}
+
+func (s *mongo_store) by_name(key string, limit int) ([]Record, error) {
+	return s.find(bson.M{"keys": key}, limit)
+}
+
+// 基于db.Table的存储, standalone模式下写入data-dir
+// 名字以规范化后的key为_id, 预留和提交在表锁内比较主人和状态; 改名记录的查询遍历全表
+type memory_store struct {
+	names   *db.Table
+	records *db.Table
+}
+
+func new_memory_store(database *db.Database) *memory_store {
+	return &memory_store{
+		names:   database.Table(COLLECTION_NAMES, func() interface{} { return &Name{} }),
+		records: database.Table(COLLECTION_HISTORY, func() interface{} { return &Record{} }),
+	}
+}
+
+func (s *memory_store) get(key string) (*Name, error) {
+	doc := s.names.Get(key)
+	if doc == nil {
+		return nil, nil
+	}
+	n := doc.(Name)
+	return &n, nil
+}
+
+func (s *memory_store) reserve(n *Name, now int64) error {
+	return s.names.Modify(n.Key, func(cur interface{}) (interface{}, error) {
+		if cur != nil {
+			old := cur.(Name)
+			if old.State != STATE_RESERVED || (old.ExpireAt > now && old.UserId != n.UserId) {
+				return nil, ERROR_NAME_TAKEN
+			}
+		}
+		return *n, nil
+	})
+}
+
+func (s *memory_store) commit(key string, userid int32, now int64) error {
+	return s.names.Modify(key, func(cur interface{}) (interface{}, error) {
+		if cur == nil {
+			return nil, ERROR_RESERVATION
+		}
+		n := cur.(Name)
+		if n.UserId != userid || n.State != STATE_RESERVED {
+			return nil, ERROR_RESERVATION
+		}
+		n.State = STATE_COMMITTED
+		n.UpdatedAt = now
+		return n, nil
+	})
+}
+
+func (s *memory_store) remove(key string, userid int32, state int32) {
+	s.names.Modify(key, func(cur interface{}) (interface{}, error) {
+		if cur != nil && cur.(Name).UserId == userid && cur.(Name).State == state {
+			return nil, nil
+		}
+		return cur, nil
+	})
+}
+
+func (s *memory_store) release(key string, userid int32) {
+	s.remove(key, userid, STATE_RESERVED)
+}
+
+func (s *memory_store) free(key string, userid int32) {
+	s.remove(key, userid, STATE_COMMITTED)
+}
+
+func (s *memory_store) record(r *Record) error {
+	return s.records.Insert(r.Id, *r)
+}
+
+// 按时间倒序, 时间相同时按ObjectId倒序(即插入顺序)
+func (s *memory_store) filter(limit int, match func(r *Record) bool) []Record {
+	var ret []Record
+	s.records.Scan(func(doc interface{}) {
+		if r := doc.(Record); match(&r) {
+			ret = append(ret, r)
+		}
+	})
+	sort.Slice(ret, func(i, k int) bool {
+		if ret[i].CreatedAt != ret[k].CreatedAt {
+			return ret[i].CreatedAt > ret[k].CreatedAt
+		}
+		return ret[i].Id > ret[k].Id
+	})
+	if limit > 0 && len(ret) > limit {
+		ret = ret[:limit]
+	}
+	return ret
+}
+func (s *memory_store) history(userid int32, limit int) ([]Record, error) {
+	return s.filter(limit, func(r *Record) bool { return r.UserId == userid }), nil
+}
+
+func (s *memory_store) by_name(key string, limit int) ([]Record, error) {
+	return s.filter(limit, func(r *Record) bool {
+		for _, k := range r.Keys {
+			if k == key {
+				return true
+			}
+		}
+		return false
+	}), nil
+}
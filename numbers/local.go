@@ -0,0 +1,69 @@
+package numbers
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/tealeg/xlsx"
+)
+
+const (
+	LOCAL_SCAN_INTERVAL = 5 * time.Second // 本地目录变更扫描间隔
+	XLSX_EXT            = ".xlsx"
+)
+
+// InitLocal 从本地目录载入所有xlsx, 用于standalone模式
+// 文件名(去掉扩展名)即数值表名, 如: TaskConfig.xlsx -> Numbers("TaskConfig")
+func InitLocal(dir string) {
+	mtimes := make(map[string]time.Time)
+	scan_local(dir, mtimes)
+	go local_watcher(dir, mtimes)
+}
+
+// 扫描目录, 载入新增或修改过的xlsx
+func scan_local(dir string, mtimes map[string]time.Time) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	for _, fi := range files {
+		if fi.IsDir() || !is_xlsx(fi) {
+			continue
+		}
+
+		if t, ok := mtimes[fi.Name()]; ok && t.Equal(fi.ModTime()) {
+			continue
+		}
+		mtimes[fi.Name()] = fi.ModTime()
+
+		filename := filepath.Join(dir, fi.Name())
+		xlsx_reader, err := xlsx.OpenFile(filename)
+		if err != nil {
+			log.Error(err, filename)
+			continue
+		}
+		name := strings.TrimSuffix(fi.Name(), XLSX_EXT)
+		ns := &numbers{tables: make(map[string]*table), name: name}
+		ns.parse(name, xlsx_reader.Sheets)
+		SetNumbers(ns)
+		log.Info("numbers loaded:", filename)
+	}
+}
+
+// 忽略office生成的临时文件, 如: ~$TaskConfig.xlsx
+func is_xlsx(fi os.FileInfo) bool {
+	return strings.HasSuffix(fi.Name(), XLSX_EXT) && !strings.HasPrefix(fi.Name(), "~$")
+}
+
+// 定期扫描本地目录, 实现和etcd watcher一致的热更新
+func local_watcher(dir string, mtimes map[string]time.Time) {
+	for range time.Tick(LOCAL_SCAN_INTERVAL) {
+		scan_local(dir, mtimes)
+	}
+}
@@ -60,7 +60,8 @@ type numbers struct {
 }
 
 type configs struct {
-	numbers map[string]*numbers
+	numbers   map[string]*numbers
+	callbacks []chan string // 数值表更新通知
 	sync.RWMutex
 }
 
@@ -82,6 +83,27 @@ func SetNumbers(ns *numbers) {
 		_dataConfig.numbers = make(map[string]*numbers)
 	}
 	_dataConfig.numbers[ns.name] = ns
+	for k := range _dataConfig.callbacks {
+		select {
+		case _dataConfig.callbacks[k] <- ns.name:
+		default:
+		}
+	}
+}
+
+// IsExists 数值表是否已载入
+func IsExists(name string) bool {
+	_dataConfig.RLock()
+	defer _dataConfig.RUnlock()
+	_, ok := _dataConfig.numbers[name]
+	return ok
+}
+
+// RegisterCallback 注册数值表更新通知, 载入或热更新后发送表名
+func RegisterCallback(callback chan string) {
+	_dataConfig.Lock()
+	defer _dataConfig.Unlock()
+	_dataConfig.callbacks = append(_dataConfig.callbacks, callback)
 }
 
 func (c *configs) init(path string) {
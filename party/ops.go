@@ -0,0 +1,279 @@
+package party
+
+import (
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Create 创建队伍, 创建者成为队长
+func Create(userid int32, now time.Time) (*Party, error) {
+	id := bson.NewObjectId().Hex()
+	if err := bind(userid, id); err != nil {
+		return nil, err
+	}
+
+	p := &Party{
+		Id:        id,
+		Leader:    userid,
+		Members:   []Member{{UserId: userid, JoinedAt: now}},
+		Invites:   []Invitation{},
+		CreatedAt: now,
+	}
+	if err := _store.insert(p); err != nil {
+		_store.unbind(userid, id)
+		return nil, err
+	}
+	commit(p, "create", userid, nil)
+	notify(p, EVENT_JOIN, userid)
+	return p, nil
+}
+
+// 玩家所在队伍的id, 不在队伍中返回ERROR_NOT_IN_PARTY
+func mine_id(userid int32) (string, error) {
+	id, err := Of(userid)
+	if err != nil {
+		return "", err
+	}
+	if id == "" {
+		return "", ERROR_NOT_IN_PARTY
+	}
+	return id, nil
+}
+
+// 检查操作者是队长
+func check_leader(p *Party, userid int32) error {
+	if p.Member(userid) == nil {
+		return ERROR_NOT_IN_PARTY
+	}
+	if p.Leader != userid {
+		return ERROR_NOT_LEADER
+	}
+	return nil
+}
+
+// Invite 成员邀请玩家加入, 已有的邀请会被刷新
+func Invite(userid, target int32, now time.Time) (*Party, error) {
+	if cur, err := Of(target); err != nil {
+		return nil, err
+	} else if cur != "" {
+		return nil, ERROR_IN_PARTY
+	}
+	id, err := mine_id(userid)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := config()
+	p, err := update(id, func(p *Party) error {
+		if p.Member(userid) == nil {
+			return ERROR_NOT_IN_PARTY
+		}
+		if len(p.Members) >= cfg.MaxMembers {
+			return ERROR_PARTY_FULL
+		}
+		p.take_invite(target, now)
+		p.Invites = append(p.Invites, Invitation{UserId: target, From: userid, ExpireAt: now.Add(cfg.InviteTTL)})
+		if len(p.Invites) > MAX_INVITES {
+			p.Invites = p.Invites[len(p.Invites)-MAX_INVITES:]
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	commit(p, "invite", userid, bson.M{"target": target})
+	notify(p, EVENT_INVITE, target)
+	return p, nil
+}
+
+// Accept 接受邀请: 先占用玩家的队伍归属, 再写入成员, 失败时释放
+func Accept(userid int32, id string, now time.Time) (*Party, error) {
+	if err := bind(userid, id); err != nil {
+		return nil, err
+	}
+
+	p, err := update(id, func(p *Party) error {
+		if p.Member(userid) != nil {
+			return nil
+		}
+		if !p.take_invite(userid, now) {
+			return ERROR_INVITE_NOT_FOUND
+		}
+		if len(p.Members) >= config().MaxMembers {
+			return ERROR_PARTY_FULL
+		}
+		p.Members = append(p.Members, Member{UserId: userid, JoinedAt: now})
+		return nil
+	})
+	if err != nil {
+		_store.unbind(userid, id)
+		if err == ERROR_PARTY_NOT_FOUND {
+			err = ERROR_INVITE_NOT_FOUND
+		}
+		return nil, err
+	}
+	commit(p, "join", userid, nil)
+	notify(p, EVENT_JOIN, userid)
+	return p, nil
+}
+
+// Leave 离开队伍, 队长离开时由最早加入的成员接任, 最后一个成员离开时解散
+func Leave(userid int32) error {
+	id, err := mine_id(userid)
+	if err != nil {
+		return err
+	}
+
+	var leader int32
+	p, err := update(id, func(p *Party) error {
+		if p.Member(userid) == nil {
+			return ERROR_NOT_IN_PARTY
+		}
+		p.remove_member(userid)
+		leader = p.Leader
+		if p.Leader == userid && len(p.Members) > 0 {
+			p.Leader = p.Members[0].UserId
+		}
+		return nil
+	})
+	if err == ERROR_PARTY_NOT_FOUND || err == ERROR_NOT_IN_PARTY {
+		// 归属已失效
+		_store.unbind(userid, id)
+		return ERROR_NOT_IN_PARTY
+	} else if err != nil {
+		return err
+	}
+	_store.unbind(userid, id)
+
+	if len(p.Members) == 0 {
+		commit(p, "disband", userid, nil)
+		notify(p, EVENT_DISBAND, userid)
+		return nil
+	}
+	commit(p, "leave", userid, bson.M{"leader": p.Leader})
+	notify(p, EVENT_LEAVE, userid)
+	if p.Leader != leader {
+		notify(p, EVENT_LEADER, p.Leader)
+	}
+	return nil
+}
+
+// Kick 队长踢出成员
+func Kick(userid, target int32) error {
+	id, err := mine_id(userid)
+	if err != nil {
+		return err
+	}
+
+	p, err := update(id, func(p *Party) error {
+		if err := check_leader(p, userid); err != nil {
+			return err
+		}
+		if target == userid || p.Member(target) == nil {
+			return ERROR_NOT_MEMBER
+		}
+		p.remove_member(target)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	_store.unbind(target, id)
+	commit(p, "kick", userid, bson.M{"target": target})
+	notify(p, EVENT_KICK, target)
+	return nil
+}
+
+// Transfer 队长转让给其他成员
+func Transfer(userid, target int32) error {
+	id, err := mine_id(userid)
+	if err != nil {
+		return err
+	}
+
+	p, err := update(id, func(p *Party) error {
+		if err := check_leader(p, userid); err != nil {
+			return err
+		}
+		if target == userid || p.Member(target) == nil {
+			return ERROR_NOT_MEMBER
+		}
+		p.Leader = target
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	commit(p, "transfer", userid, bson.M{"target": target})
+	notify(p, EVENT_LEADER, target)
+	return nil
+}
+
+// SetTarget 队长设置活动目标, 全部成员的准备状态重置
+func SetTarget(userid, target int32) error {
+	id, err := mine_id(userid)
+	if err != nil {
+		return err
+	}
+
+	p, err := update(id, func(p *Party) error {
+		if err := check_leader(p, userid); err != nil {
+			return err
+		}
+		p.Target = target
+		p.reset_ready()
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	commit(p, "target", userid, bson.M{"target": target})
+	notify(p, EVENT_STATE, userid)
+	return nil
+}
+
+// SetReady 成员设置准备状态
+func SetReady(userid int32, ready bool) error {
+	id, err := mine_id(userid)
+	if err != nil {
+		return err
+	}
+
+	p, err := update(id, func(p *Party) error {
+		m := p.Member(userid)
+		if m == nil {
+			return ERROR_NOT_IN_PARTY
+		}
+		m.Ready = ready
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	commit(p, "ready", userid, bson.M{"ready": ready})
+	notify(p, EVENT_STATE, userid)
+	return nil
+}
+
+// ResetReady 队长重置全部成员的准备状态, 队伍进入匹配或房间后调用, 下次开始前需要重新准备
+func ResetReady(userid int32) error {
+	id, err := mine_id(userid)
+	if err != nil {
+		return err
+	}
+
+	p, err := update(id, func(p *Party) error {
+		if err := check_leader(p, userid); err != nil {
+			return err
+		}
+		p.reset_ready()
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	commit(p, "unready", userid, nil)
+	notify(p, EVENT_STATE, userid)
+	return nil
+}
@@ -0,0 +1,283 @@
+package party
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"game/db"
+	"game/kafka"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// 队伍:
+// 轻量的组队, 成员和邀请都内嵌在队伍文档里, 保存在mongodb中(standalone模式下保存在内存中).
+// 成员可能在不同的实例上, 所有修改都通过update完成: 读出文档, 在内存中修改, 再以version为条件写回,
+// 冲突时重新读取并重试; 最后一个成员离开时以version为条件删除文档, 即解散.
+// 玩家所在的队伍单独保存在COLLECTION_MEMBERS中, 以userid为_id, 保证一个玩家只在一个队伍中.
+// 队长离开时由最早加入的成员接任. 每次修改都写入WAL, 并通过Notify通知上层推送给全部成员.
+const (
+	COLLECTION_PARTIES = "parties"
+	COLLECTION_MEMBERS = "party_members"
+
+	MAX_RETRY   = 5  // 并发修改冲突时的最大重试次数
+	MAX_INVITES = 20 // 邀请上限, 超过后丢弃最早的邀请
+)
+
+// 事件, 通过Notify通知上层
+const (
+	EVENT_JOIN    = int32(1)
+	EVENT_LEAVE   = int32(2)
+	EVENT_KICK    = int32(3)
+	EVENT_LEADER  = int32(4) // 队长变更
+	EVENT_DISBAND = int32(5) // 最后一个成员离开
+	EVENT_INVITE  = int32(6)
+	EVENT_STATE   = int32(7) // 目标或准备状态变更
+)
+
+var (
+	ERROR_PARTY_NOT_FOUND  = errors.New("party not found")
+	ERROR_IN_PARTY         = errors.New("already in a party")
+	ERROR_NOT_IN_PARTY     = errors.New("not in party")
+	ERROR_NOT_LEADER       = errors.New("not the party leader")
+	ERROR_NOT_MEMBER       = errors.New("target not in party")
+	ERROR_PARTY_FULL       = errors.New("party full")
+	ERROR_INVITE_NOT_FOUND = errors.New("party invite not found or expired")
+	ERROR_CONFLICT         = errors.New("party modified concurrently, try again")
+	ERROR_NOT_READY        = errors.New("party members not ready")
+)
+
+type Member struct {
+	UserId   int32     `bson:"userid"`
+	Ready    bool      `bson:"ready"`
+	JoinedAt time.Time `bson:"joined_at"`
+}
+
+type Invitation struct {
+	UserId   int32     `bson:"userid"`
+	From     int32     `bson:"from"`
+	ExpireAt time.Time `bson:"expire_at"`
+}
+
+type Party struct {
+	Id        string       `bson:"_id"`
+	Leader    int32        `bson:"leader"`
+	Target    int32        `bson:"target"` // 队长设置的活动目标, 含义由上层定义
+	Members   []Member     `bson:"members"`
+	Invites   []Invitation `bson:"invites"`
+	Version   int64        `bson:"version"` // 乐观锁
+	CreatedAt time.Time    `bson:"created_at"`
+}
+
+// 玩家所在的队伍
+type membership struct {
+	UserId  int32  `bson:"_id"`
+	PartyId string `bson:"party"`
+}
+
+// 队伍参数, 来自数值表
+type Config struct {
+	MaxMembers int
+	InviteTTL  time.Duration // 邀请有效期
+}
+
+func DefaultConfig() Config {
+	return Config{MaxMembers: 4, InviteTTL: time.Minute}
+}
+
+var (
+	_store  store
+	_config = DefaultConfig()
+	_mu     sync.RWMutex
+
+	// Notify 队伍事件, 由上层设置, 用于推送和维护队伍频道
+	Notify func(p *Party, event int32, userid int32)
+)
+
+func Init(database *db.Database) {
+	if database.IsLocal() {
+		_store = new_memory_store(database)
+	} else {
+		_store = new_mongo_store(database)
+	}
+}
+
+// SetConfig 设置参数, 数值表热更新时调用
+func SetConfig(cfg Config) {
+	_mu.Lock()
+	_config = cfg
+	_mu.Unlock()
+}
+
+func config() Config {
+	_mu.RLock()
+	defer _mu.RUnlock()
+	return _config
+}
+
+// MaxMembers 队伍人数上限
+func MaxMembers() int {
+	return config().MaxMembers
+}
+
+// Member 查找成员, 不存在返回nil
+func (p *Party) Member(userid int32) *Member {
+	for k := range p.Members {
+		if p.Members[k].UserId == userid {
+			return &p.Members[k]
+		}
+	}
+	return nil
+}
+
+// MemberIds 全部成员id, 按加入顺序
+func (p *Party) MemberIds() []int32 {
+	ids := make([]int32, 0, len(p.Members))
+	for k := range p.Members {
+		ids = append(ids, p.Members[k].UserId)
+	}
+	return ids
+}
+
+// AllReady 全部成员(包括队长)都已准备
+func (p *Party) AllReady() bool {
+	for k := range p.Members {
+		if !p.Members[k].Ready {
+			return false
+		}
+	}
+	return true
+}
+
+func (p *Party) reset_ready() {
+	for k := range p.Members {
+		p.Members[k].Ready = false
+	}
+}
+
+func (p *Party) remove_member(userid int32) {
+	for k := range p.Members {
+		if p.Members[k].UserId == userid {
+			p.Members = append(p.Members[:k], p.Members[k+1:]...)
+			return
+		}
+	}
+}
+
+// Inviter 邀请玩家的成员, 没有邀请时返回0
+func (p *Party) Inviter(userid int32) int32 {
+	for k := len(p.Invites) - 1; k >= 0; k-- {
+		if p.Invites[k].UserId == userid {
+			return p.Invites[k].From
+		}
+	}
+	return 0
+}
+
+// 查找未过期的邀请并移除, 同时清理过期的邀请
+func (p *Party) take_invite(userid int32, now time.Time) bool {
+	found := false
+	invites := p.Invites[:0]
+	for _, inv := range p.Invites {
+		if !inv.ExpireAt.After(now) {
+			continue
+		}
+		if inv.UserId == userid {
+			found = true
+			continue
+		}
+		invites = append(invites, inv)
+	}
+	p.Invites = invites
+	return found
+}
+
+// 深拷贝, 内存存储中的文档不能和调用者共享切片
+func (p *Party) clone() *Party {
+	c := *p
+	c.Members = append([]Member{}, p.Members...)
+	c.Invites = append([]Invitation{}, p.Invites...)
+	return &c
+}
+
+func notify(p *Party, event int32, userid int32) {
+	if Notify != nil {
+		Notify(p, event, userid)
+	}
+}
+
+func commit(p *Party, op string, userid int32, fields bson.M) {
+	record := bson.M{"op": op, "userid": userid, "version": p.Version}
+	for k, v := range fields {
+		record[k] = v
+	}
+	kafka.CommitUpdate(p.Id, record, COLLECTION_PARTIES)
+}
+
+// 乐观锁更新: fn在内存中修改队伍, 写回时version不一致则重试; 修改后没有成员时删除队伍
+func update(id string, fn func(p *Party) error) (*Party, error) {
+	for i := 0; i < MAX_RETRY; i++ {
+		p, err := _store.get(id)
+		if err != nil {
+			return nil, err
+		}
+		if err := fn(p); err != nil {
+			return nil, err
+		}
+
+		version := p.Version
+		p.Version++
+		var ok bool
+		if len(p.Members) == 0 {
+			ok, err = _store.remove(id, version)
+		} else {
+			ok, err = _store.replace(p, version)
+		}
+		if err != nil {
+			return nil, err
+		} else if ok {
+			return p, nil
+		}
+	}
+	return nil, ERROR_CONFLICT
+}
+
+// Get 读取队伍
+func Get(id string) (*Party, error) {
+	return _store.get(id)
+}
+
+// Of 玩家所在队伍的id, 不在队伍中返回空
+func Of(userid int32) (string, error) {
+	return _store.of(userid)
+}
+
+// Mine 玩家所在的队伍
+// 修改队伍后释放归属前崩溃时, 归属会指向已解散或已不含该玩家的队伍, 此时清理归属
+func Mine(userid int32) (*Party, error) {
+	id, err := Of(userid)
+	if err != nil {
+		return nil, err
+	}
+	if id == "" {
+		return nil, ERROR_NOT_IN_PARTY
+	}
+	p, err := Get(id)
+	if err == ERROR_PARTY_NOT_FOUND || (err == nil && p.Member(userid) == nil) {
+		_store.unbind(userid, id)
+		return nil, ERROR_NOT_IN_PARTY
+	}
+	return p, err
+}
+
+// 占用玩家的队伍归属, 已有的归属失效时清理后重试
+func bind(userid int32, id string) error {
+	err := _store.bind(userid, id)
+	if err == ERROR_IN_PARTY {
+		if _, e := Mine(userid); e == ERROR_NOT_IN_PARTY {
+			err = _store.bind(userid, id)
+		}
+	}
+	return err
+}
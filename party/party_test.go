@@ -0,0 +1,203 @@
+package party
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"game/db"
+	"game/kafka"
+)
+
+func init() {
+	kafka.InitDiscard()
+}
+
+type event struct {
+	event  int32
+	userid int32
+}
+
+// 重新打开dir上的本地存储, 相当于standalone实例重启
+func reopen(dir string) {
+	var database db.Database
+	database.InitLocal(dir)
+	_store = new_memory_store(&database)
+}
+
+func setup(t *testing.T) (*[]event, string) {
+	dir, err := ioutil.TempDir("", "party")
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := &[]event{}
+	reopen(dir)
+	SetConfig(Config{MaxMembers: 3, InviteTTL: time.Minute})
+	Notify = func(p *Party, e int32, userid int32) {
+		*events = append(*events, event{e, userid})
+	}
+	return events, dir
+}
+
+func TestInvite(t *testing.T) {
+	_, dir := setup(t)
+	defer os.RemoveAll(dir)
+	now := time.Now()
+	p, err := Create(1, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Create(1, now); err != ERROR_IN_PARTY {
+		t.Fatal("created twice:", err)
+	}
+	if _, err := Accept(2, p.Id, now); err != ERROR_INVITE_NOT_FOUND {
+		t.Fatal("joined without invite:", err)
+	}
+	if id, _ := Of(2); id != "" {
+		t.Fatal("binding not released:", id)
+	}
+
+	Invite(1, 2, now)
+	if _, err := Accept(2, p.Id, now.Add(2*time.Minute)); err != ERROR_INVITE_NOT_FOUND {
+		t.Fatal("accepted expired invite:", err)
+	}
+	Invite(1, 2, now)
+	if _, err := Invite(2, 1, now); err != ERROR_IN_PARTY {
+		t.Fatal("invited member of a party:", err)
+	}
+	Invite(1, 3, now)
+	Invite(1, 4, now)
+	Accept(2, p.Id, now)
+	Accept(3, p.Id, now)
+	if _, err := Accept(4, p.Id, now); err != ERROR_PARTY_FULL {
+		t.Fatal("party over limit:", err)
+	}
+
+	p, _ = Mine(3)
+	if len(p.Members) != 3 || len(p.Invites) != 1 || p.Leader != 1 {
+		t.Fatal("unexpected party:", p)
+	}
+}
+
+func TestLeave(t *testing.T) {
+	events, dir := setup(t)
+	defer os.RemoveAll(dir)
+	now := time.Now()
+	p, _ := Create(1, now)
+	for _, id := range []int32{2, 3} {
+		Invite(1, id, now)
+		Accept(id, p.Id, now)
+	}
+
+	if err := Kick(2, 3); err != ERROR_NOT_LEADER {
+		t.Fatal("kicked by member:", err)
+	}
+	if err := Transfer(1, 4); err != ERROR_NOT_MEMBER {
+		t.Fatal("transferred to non-member:", err)
+	}
+	if err := Kick(1, 3); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Mine(3); err != ERROR_NOT_IN_PARTY {
+		t.Fatal("kicked member still bound:", err)
+	}
+
+	// 队长离开, 最早加入的成员接任
+	*events = nil
+	if err := Leave(1); err != nil {
+		t.Fatal(err)
+	}
+	if p, _ = Mine(2); p.Leader != 2 {
+		t.Fatal("leader not transferred:", p.Leader)
+	}
+	if len(*events) != 2 || (*events)[1] != (event{EVENT_LEADER, 2}) {
+		t.Fatal("unexpected events:", *events)
+	}
+
+	// 最后一个成员离开时解散
+	if err := Leave(2); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Get(p.Id); err != ERROR_PARTY_NOT_FOUND {
+		t.Fatal("party not disbanded:", err)
+	}
+	if last := (*events)[len(*events)-1]; last != (event{EVENT_DISBAND, 2}) {
+		t.Fatal("unexpected event:", last)
+	}
+}
+
+func TestState(t *testing.T) {
+	_, dir := setup(t)
+	defer os.RemoveAll(dir)
+	now := time.Now()
+	p, _ := Create(1, now)
+	Invite(1, 2, now)
+	Accept(2, p.Id, now)
+
+	SetReady(2, true)
+	if err := SetTarget(2, 10); err != ERROR_NOT_LEADER {
+		t.Fatal("target set by member:", err)
+	}
+	if p, _ = Get(p.Id); !p.Member(2).Ready {
+		t.Fatal("not ready")
+	}
+	SetTarget(1, 10)
+	if p, _ = Get(p.Id); p.Target != 10 || p.Member(2).Ready {
+		t.Fatal("unexpected state:", p.Target, p.Member(2))
+	}
+
+	// 解散后残留的归属在下次操作时清理
+	_store.bind(3, "stale")
+	if _, err := Create(3, now); err != nil {
+		t.Fatal("stale binding not cleaned:", err)
+	}
+}
+
+func TestReady(t *testing.T) {
+	_, dir := setup(t)
+	defer os.RemoveAll(dir)
+	now := time.Now()
+	p, _ := Create(1, now)
+	Invite(1, 2, now)
+	Accept(2, p.Id, now)
+
+	SetReady(2, true)
+	if p, _ = Get(p.Id); p.AllReady() {
+		t.Fatal("leader not ready")
+	}
+	SetReady(1, true)
+	if p, _ = Get(p.Id); !p.AllReady() {
+		t.Fatal("all members ready:", p.Members)
+	}
+
+	// 进入匹配或房间后重置, 只有队长可以重置
+	if err := ResetReady(2); err != ERROR_NOT_LEADER {
+		t.Fatal("reset by member:", err)
+	}
+	if err := ResetReady(1); err != nil {
+		t.Fatal(err)
+	}
+	if p, _ = Get(p.Id); p.Member(1).Ready || p.Member(2).Ready {
+		t.Fatal("ready not reset:", p.Members)
+	}
+}
+
+func TestRestart(t *testing.T) {
+	_, dir := setup(t)
+	defer os.RemoveAll(dir)
+	now := time.Now()
+	p, _ := Create(1, now)
+	Invite(1, 2, now)
+	Accept(2, p.Id, now)
+	SetReady(2, true)
+
+	reopen(dir)
+	got, err := Mine(2)
+	if err != nil || got.Id != p.Id || len(got.Members) != 2 || !got.Member(2).Ready {
+		t.Fatal("party lost after restart:", got, err)
+	}
+	if _, err := Create(2, now); err != ERROR_IN_PARTY {
+		t.Fatal("membership lost after restart:", err)
+	}
+}
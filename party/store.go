@@ -0,0 +1,178 @@
+package party
+
+import (
+	"game/db"
+
+	log "github.com/Sirupsen/logrus"
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// 队伍和成员归属的存储, replace和remove是以version为条件的比较并交换
+type store interface {
+	insert(p *Party) error
+	get(id string) (*Party, error)
+	replace(p *Party, version int64) (bool, error) // 只在当前version一致时替换, 返回是否成功
+	remove(id string, version int64) (bool, error)
+	bind(userid int32, id string) error // 已在队伍中返回ERROR_IN_PARTY
+	unbind(userid int32, id string)
+	of(userid int32) (string, error)
+}
+
+// mongodb存储
+type mongo_store struct {
+	db *db.Database
+}
+
+func new_mongo_store(database *db.Database) *mongo_store {
+	err := database.Execute(func(sess *mgo.Session) error {
+		return sess.DB("").C(COLLECTION_MEMBERS).EnsureIndex(mgo.Index{Key: []string{"party"}})
+	})
+	if err != nil {
+		log.Error(err)
+	}
+	return &mongo_store{db: database}
+}
+
+func (s *mongo_store) insert(p *Party) error {
+	return s.db.Execute(func(sess *mgo.Session) error {
+		return sess.DB("").C(COLLECTION_PARTIES).Insert(p)
+	})
+}
+
+func (s *mongo_store) get(id string) (*Party, error) {
+	p := &Party{}
+	err := s.db.Execute(func(sess *mgo.Session) error {
+		return sess.DB("").C(COLLECTION_PARTIES).FindId(id).One(p)
+	})
+	if err == mgo.ErrNotFound {
+		return nil, ERROR_PARTY_NOT_FOUND
+	} else if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (s *mongo_store) replace(p *Party, version int64) (bool, error) {
+	err := s.db.Execute(func(sess *mgo.Session) error {
+		return sess.DB("").C(COLLECTION_PARTIES).Update(bson.M{"_id": p.Id, "version": version}, p)
+	})
+	if err == mgo.ErrNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (s *mongo_store) remove(id string, version int64) (bool, error) {
+	err := s.db.Execute(func(sess *mgo.Session) error {
+		return sess.DB("").C(COLLECTION_PARTIES).Remove(bson.M{"_id": id, "version": version})
+	})
+	if err == mgo.ErrNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (s *mongo_store) bind(userid int32, id string) error {
+	err := s.db.Execute(func(sess *mgo.Session) error {
+		return sess.DB("").C(COLLECTION_MEMBERS).Insert(&membership{UserId: userid, PartyId: id})
+	})
+	if mgo.IsDup(err) {
+		return ERROR_IN_PARTY
+	}
+	return err
+}
+
+func (s *mongo_store) unbind(userid int32, id string) {
+	err := s.db.Execute(func(sess *mgo.Session) error {
+		return sess.DB("").C(COLLECTION_MEMBERS).Remove(bson.M{"_id": userid, "party": id})
+	})
+	if err != nil && err != mgo.ErrNotFound {
+		log.Error(err)
+	}
+}
+
+func (s *mongo_store) of(userid int32) (string, error) {
+	m := &membership{}
+	err := s.db.Execute(func(sess *mgo.Session) error {
+		return sess.DB("").C(COLLECTION_MEMBERS).FindId(userid).One(m)
+	})
+	if err == mgo.ErrNotFound {
+		return "", nil
+	}
+	return m.PartyId, err
+}
+
+// 基于db.Table的存储, standalone模式下写入data-dir
+// 成员归属单独一张表, 以_id唯一保证一个玩家只在一个队伍中
+type memory_store struct {
+	parties *db.Table
+	members *db.Table
+}
+
+func new_memory_store(database *db.Database) *memory_store {
+	return &memory_store{
+		parties: database.Table(COLLECTION_PARTIES, func() interface{} { return &Party{} }),
+		members: database.Table(COLLECTION_MEMBERS, func() interface{} { return &membership{} }),
+	}
+}
+
+func (s *memory_store) insert(p *Party) error {
+	return s.parties.Insert(p.Id, *p.clone())
+}
+
+func (s *memory_store) get(id string) (*Party, error) {
+	doc := s.parties.Get(id)
+	if doc == nil {
+		return nil, ERROR_PARTY_NOT_FOUND
+	}
+	p := doc.(Party)
+	return p.clone(), nil
+}
+
+// 以version为条件修改, p为nil时删除
+func (s *memory_store) cas(id string, p *Party, version int64) (ok bool, err error) {
+	err = s.parties.Modify(id, func(cur interface{}) (interface{}, error) {
+		if cur == nil || cur.(Party).Version != version {
+			return cur, nil
+		}
+		ok = true
+		if p == nil {
+			return nil, nil
+		}
+		return *p.clone(), nil
+	})
+	return
+}
+
+func (s *memory_store) replace(p *Party, version int64) (bool, error) {
+	return s.cas(p.Id, p, version)
+}
+
+func (s *memory_store) remove(id string, version int64) (bool, error) {
+	return s.cas(id, nil, version)
+}
+
+func (s *memory_store) bind(userid int32, id string) error {
+	err := s.members.Insert(userid, membership{UserId: userid, PartyId: id})
+	if err == db.ERROR_DUPLICATED {
+		return ERROR_IN_PARTY
+	}
+	return err
+}
+
+func (s *memory_store) unbind(userid int32, id string) {
+	s.members.Modify(userid, func(cur interface{}) (interface{}, error) {
+		if cur != nil && cur.(membership).PartyId == id {
+			return nil, nil
+		}
+		return cur, nil
+	})
+}
+
+func (s *memory_store) of(userid int32) (string, error) {
+	if doc := s.members.Get(userid); doc != nil {
+		return doc.(membership).PartyId, nil
+	}
+	return "", nil
+}
@@ -0,0 +1,457 @@
+package presence
+
+import (
+	"encoding/json"
+	"fmt"
+	gopkg "path"
+	"strconv"
+	"sync"
+	"time"
+
+	"game/etcdclient"
+
+	log "github.com/Sirupsen/logrus"
+	etcd "github.com/coreos/etcd/client"
+	"golang.org/x/net/context"
+)
+
+// 在线状态索引:
+// 记录全集群在线玩家 userid -> 所在game实例, 登陆时间, 状态
+//
+// etcd结构:
+//
+//	<root>/users/<userid>       玩家在线记录, 带TTL, 由所在实例定期续期
+//	<root>/instances/<id>       实例心跳, 带TTL, 过期即认为实例已死亡
+//
+// 实例异常退出时, 其余实例监听到心跳过期, 清理该实例遗留的在线记录;
+// 即使无人清理, 在线记录也会随TTL自然过期.
+const (
+	DEFAULT_TTL        = 60 * time.Second // 记录存活时间
+	REFRESH_INTERVAL   = 20 * time.Second // 续期间隔
+	CACHE_TTL          = 5 * time.Second  // 本地缓存时间
+	QUERY_CONCURRENCY  = 16               // 批量查询的并发数
+	REQUEST_TIMEOUT    = 5 * time.Second  // 单次etcd请求超时
+	USERS_DIR          = "users"
+	INSTANCES_DIR      = "instances"
+	STATUS_ONLINE      = int32(0) // 在线
+	STATUS_BUSY        = int32(1) // 忙碌(战斗, 匹配中等)
+	STATUS_NOT_DISTURB = int32(2) // 勿扰
+)
+
+// 在线记录
+type Info struct {
+	UserId     int32  `json:"userid"`
+	InstanceId string `json:"instance"`
+	LoginTime  int64  `json:"login_time"`
+	Status     int32  `json:"status"`
+}
+
+type cache_entry struct {
+	info   *Info // nil代表离线
+	expire time.Time
+}
+
+type presence struct {
+	root       string
+	instanceId string
+	standalone bool
+	local      map[int32]string // 本实例在线玩家 -> 写入etcd的值, 用于续期和比较删除
+	cache      map[int32]cache_entry
+	sync.Mutex
+}
+
+var (
+	_default_presence presence
+)
+
+// Init 使用etcd存储在线记录
+func Init(root, instanceId string) {
+	_default_presence.init(root, instanceId, false)
+	go _default_presence.keepalive()
+	go _default_presence.watcher()
+}
+
+// InitLocal 单机模式, 在线记录仅保存在本进程
+func InitLocal(instanceId string) {
+	_default_presence.init("", instanceId, true)
+}
+
+func (p *presence) init(root, instanceId string, standalone bool) {
+	p.root = root
+	p.instanceId = instanceId
+	p.standalone = standalone
+	p.local = make(map[int32]string)
+	p.cache = make(map[int32]cache_entry)
+}
+
+func (p *presence) user_key(userid int32) string {
+	return fmt.Sprintf("%v/%v/%v", p.root, USERS_DIR, userid)
+}
+
+func (p *presence) instance_key(id string) string {
+	return fmt.Sprintf("%v/%v/%v", p.root, INSTANCES_DIR, id)
+}
+
+// 写入在线记录
+func (p *presence) login(userid int32, status int32) {
+	info := &Info{UserId: userid, InstanceId: p.instanceId, LoginTime: time.Now().Unix(), Status: status}
+	bts, err := json.Marshal(info)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	p.Lock()
+	p.local[userid] = string(bts)
+	p.cache[userid] = cache_entry{info: info, expire: time.Now().Add(CACHE_TTL)}
+	p.Unlock()
+
+	if p.standalone {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), REQUEST_TIMEOUT)
+	defer cancel()
+	if _, err := etcdclient.KeysAPI().Set(ctx, p.user_key(userid), string(bts), &etcd.SetOptions{TTL: DEFAULT_TTL}); err != nil {
+		log.Error(err)
+	}
+}
+
+// 删除在线记录, 仅当记录仍属于本次登陆时删除, 避免误删其他实例上的新登陆
+func (p *presence) logout(userid int32) {
+	p.Lock()
+	value, ok := p.local[userid]
+	delete(p.local, userid)
+	delete(p.cache, userid)
+	p.Unlock()
+
+	if !ok || p.standalone {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), REQUEST_TIMEOUT)
+	defer cancel()
+	if _, err := etcdclient.KeysAPI().Delete(ctx, p.user_key(userid), &etcd.DeleteOptions{PrevValue: value}); err != nil {
+		if !is_error(err, etcd.ErrorCodeKeyNotFound) && !is_error(err, etcd.ErrorCodeTestFailed) {
+			log.Error(err)
+		}
+	}
+}
+
+// 修改在线状态
+func (p *presence) set_status(userid int32, status int32) {
+	p.Lock()
+	value, ok := p.local[userid]
+	p.Unlock()
+	if !ok {
+		return
+	}
+
+	info := &Info{}
+	if err := json.Unmarshal([]byte(value), info); err != nil {
+		log.Error(err)
+		return
+	}
+	info.Status = status
+	bts, err := json.Marshal(info)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	if !p.standalone {
+		ctx, cancel := context.WithTimeout(context.Background(), REQUEST_TIMEOUT)
+		defer cancel()
+		opts := &etcd.SetOptions{TTL: DEFAULT_TTL, PrevValue: value}
+		if _, err := etcdclient.KeysAPI().Set(ctx, p.user_key(userid), string(bts), opts); err != nil {
+			log.Error(err)
+			return
+		}
+	}
+
+	p.Lock()
+	if _, ok := p.local[userid]; ok {
+		p.local[userid] = string(bts)
+		p.cache[userid] = cache_entry{info: info, expire: time.Now().Add(CACHE_TTL)}
+	}
+	p.Unlock()
+}
+
+// 是否在本实例上在线
+func (p *presence) is_local(userid int32) bool {
+	p.Lock()
+	defer p.Unlock()
+	_, ok := p.local[userid]
+	return ok
+}
+
+// 批量查询, 优先使用本地缓存, 未命中的并发从etcd读取
+func (p *presence) query(ids []int32) map[int32]*Info {
+	result := make(map[int32]*Info)
+	var missing []int32
+	now := time.Now()
+	p.Lock()
+	for _, id := range ids {
+		if e, ok := p.cache[id]; ok && (p.standalone || now.Before(e.expire)) {
+			if e.info != nil {
+				result[id] = e.info
+			}
+		} else if !p.standalone {
+			missing = append(missing, id)
+		}
+	}
+	p.Unlock()
+
+	if len(missing) == 0 {
+		return result
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, QUERY_CONCURRENCY)
+	for _, id := range missing {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(id int32) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			info, err := p.fetch(id)
+			if err != nil {
+				log.Error(err)
+				return
+			}
+			mu.Lock()
+			if info != nil {
+				result[id] = info
+			}
+			mu.Unlock()
+
+			p.Lock()
+			p.cache[id] = cache_entry{info: info, expire: time.Now().Add(CACHE_TTL)}
+			p.Unlock()
+		}(id)
+	}
+	wg.Wait()
+	return result
+}
+
+// 从etcd读取一个在线记录, 不存在返回nil
+func (p *presence) fetch(userid int32) (*Info, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), REQUEST_TIMEOUT)
+	defer cancel()
+	resp, err := etcdclient.KeysAPI().Get(ctx, p.user_key(userid), nil)
+	if err != nil {
+		if is_error(err, etcd.ErrorCodeKeyNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	info := &Info{}
+	if err := json.Unmarshal([]byte(resp.Node.Value), info); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// 定期续期实例心跳和本实例所有在线记录
+func (p *presence) keepalive() {
+	kapi := etcdclient.KeysAPI()
+	p.heartbeat(kapi, false)
+	for range time.Tick(REFRESH_INTERVAL) {
+		p.heartbeat(kapi, true)
+
+		p.Lock()
+		values := make(map[int32]string, len(p.local))
+		for k, v := range p.local {
+			values[k] = v
+		}
+		p.Unlock()
+
+		for userid, value := range values {
+			ctx, cancel := context.WithTimeout(context.Background(), REQUEST_TIMEOUT)
+			opts := &etcd.SetOptions{TTL: DEFAULT_TTL, Refresh: true, PrevValue: value}
+			_, err := kapi.Set(ctx, p.user_key(userid), "", opts)
+			cancel()
+			if err == nil {
+				continue
+			}
+
+			switch {
+			case is_error(err, etcd.ErrorCodeKeyNotFound): // 记录丢失(如etcd重启或已过期), 重新写入
+				ctx, cancel := context.WithTimeout(context.Background(), REQUEST_TIMEOUT)
+				_, err = kapi.Set(ctx, p.user_key(userid), value, &etcd.SetOptions{TTL: DEFAULT_TTL, PrevExist: etcd.PrevNoExist})
+				cancel()
+				if err != nil {
+					log.Error(err)
+				}
+			case is_error(err, etcd.ErrorCodeTestFailed): // 玩家已在其他实例登陆, 放弃该记录
+				p.Lock()
+				if p.local[userid] == value {
+					delete(p.local, userid)
+				}
+				delete(p.cache, userid)
+				p.Unlock()
+			default:
+				log.Error(err)
+			}
+		}
+	}
+}
+
+func (p *presence) heartbeat(kapi etcd.KeysAPI, refresh bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), REQUEST_TIMEOUT)
+	defer cancel()
+	key := p.instance_key(p.instanceId)
+	if refresh {
+		if _, err := kapi.Set(ctx, key, "", &etcd.SetOptions{TTL: DEFAULT_TTL, Refresh: true}); err == nil {
+			return
+		}
+	}
+	if _, err := kapi.Set(ctx, key, strconv.FormatInt(time.Now().Unix(), 10), &etcd.SetOptions{TTL: DEFAULT_TTL}); err != nil {
+		log.Error(err)
+	}
+}
+
+// 监听实例心跳, 清理已死亡实例的在线记录
+func (p *presence) watcher() {
+	kapi := etcdclient.KeysAPI()
+	var w etcd.Watcher
+	for {
+		w = p.watch(kapi, w)
+	}
+}
+
+// 处理一个事件, 返回之后继续使用的监听
+// 监听出错(如etcd的事件历史已被清理)时返回nil, 下次重新读取实例列表并从读取时的index继续监听
+func (p *presence) watch(kapi etcd.KeysAPI, w etcd.Watcher) etcd.Watcher {
+	if w == nil {
+		var err error
+		if w, err = p.rewatch(kapi); err != nil {
+			log.Error(err)
+			time.Sleep(time.Second)
+			return nil
+		}
+	}
+
+	resp, err := w.Next(context.Background())
+	if err != nil {
+		log.Error(err)
+		time.Sleep(time.Second)
+		return nil
+	}
+
+	switch resp.Action {
+	case "expire", "delete":
+		dead := gopkg.Base(resp.Node.Key)
+		if dead != p.instanceId {
+			log.Info("presence: instance dead:", dead)
+			p.purge(kapi, func(id string) bool { return id == dead })
+		}
+	}
+	return w
+}
+
+// 建立监听: 清理不在实例列表中的实例(监听中断期间死亡)的在线记录, 从读取时的index之后开始监听
+func (p *presence) rewatch(kapi etcd.KeysAPI) (etcd.Watcher, error) {
+	dir := p.root + "/" + INSTANCES_DIR
+	ctx, cancel := context.WithTimeout(context.Background(), REQUEST_TIMEOUT)
+	resp, err := kapi.Get(ctx, dir, &etcd.GetOptions{Recursive: true})
+	cancel()
+
+	var index uint64
+	alive := map[string]bool{p.instanceId: true}
+	if e, ok := err.(etcd.Error); ok && e.Code == etcd.ErrorCodeKeyNotFound {
+		index = e.Index
+	} else if err != nil {
+		return nil, err
+	} else {
+		index = resp.Index
+		for _, node := range resp.Node.Nodes {
+			alive[gopkg.Base(node.Key)] = true
+		}
+	}
+
+	p.purge(kapi, func(id string) bool { return !alive[id] })
+	opts := etcdclient.NewWatcherOptions(true)
+	opts.AfterIndex = index
+	return kapi.Watcher(dir, opts), nil
+}
+
+// 删除属于死亡实例的全部在线记录
+func (p *presence) purge(kapi etcd.KeysAPI, dead func(instanceId string) bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), REQUEST_TIMEOUT)
+	defer cancel()
+	resp, err := kapi.Get(ctx, p.root+"/"+USERS_DIR, &etcd.GetOptions{Recursive: true})
+	if err != nil {
+		if !is_error(err, etcd.ErrorCodeKeyNotFound) {
+			log.Error(err)
+		}
+		return
+	}
+
+	for _, node := range resp.Node.Nodes {
+		info := &Info{}
+		if err := json.Unmarshal([]byte(node.Value), info); err != nil || !dead(info.InstanceId) {
+			continue
+		}
+		if _, err := kapi.Delete(ctx, node.Key, &etcd.DeleteOptions{PrevValue: node.Value}); err != nil {
+			if !is_error(err, etcd.ErrorCodeKeyNotFound) && !is_error(err, etcd.ErrorCodeTestFailed) {
+				log.Error(err)
+			}
+		}
+	}
+
+	// 丢弃死亡实例相关的缓存
+	p.Lock()
+	for k, e := range p.cache {
+		if e.info != nil && dead(e.info.InstanceId) {
+			delete(p.cache, k)
+		}
+	}
+	p.Unlock()
+}
+
+func is_error(err error, code int) bool {
+	if e, ok := err.(etcd.Error); ok {
+		return e.Code == code
+	}
+	return false
+}
+
+// Login 玩家上线
+func Login(userid int32) {
+	_default_presence.login(userid, STATUS_ONLINE)
+}
+
+// Logout 玩家下线
+func Logout(userid int32) {
+	_default_presence.logout(userid)
+}
+
+// SetStatus 修改本实例上玩家的在线状态
+func SetStatus(userid int32, status int32) {
+	_default_presence.set_status(userid, status)
+}
+
+// Query 查询单个玩家, 离线返回nil
+func Query(userid int32) *Info {
+	return _default_presence.query([]int32{userid})[userid]
+}
+
+// QueryMulti 批量查询, 返回结果中只包含在线玩家
+func QueryMulti(ids []int32) map[int32]*Info {
+	return _default_presence.query(ids)
+}
+
+// IsLocal 玩家是否在本实例上在线
+func IsLocal(userid int32) bool {
+	return _default_presence.is_local(userid)
+}
+
+// IsOnline 玩家是否在线
+func IsOnline(userid int32) bool {
+	return Query(userid) != nil
+}
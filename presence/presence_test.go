@@ -0,0 +1,143 @@
+package presence
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	etcd "github.com/coreos/etcd/client"
+	"golang.org/x/net/context"
+)
+
+func TestLocal(t *testing.T) {
+	p := &presence{}
+	p.init("", "game1", true)
+
+	p.login(1, STATUS_ONLINE)
+	info := p.query([]int32{1})[1]
+	if info == nil || info.InstanceId != "game1" || info.Status != STATUS_ONLINE {
+		t.Fatal("unexpected info:", info)
+	}
+	if !p.is_local(1) || p.is_local(2) {
+		t.Fatal("unexpected local")
+	}
+
+	p.set_status(1, STATUS_BUSY)
+	if info := p.query([]int32{1})[1]; info == nil || info.Status != STATUS_BUSY {
+		t.Fatal("status not updated:", info)
+	}
+
+	// 离线玩家不出现在结果中
+	p.set_status(2, STATUS_BUSY)
+	if ret := p.query([]int32{1, 2}); len(ret) != 1 || ret[2] != nil {
+		t.Fatal("unexpected query:", ret)
+	}
+
+	p.logout(1)
+	if ret := p.query([]int32{1}); len(ret) != 0 {
+		t.Fatal("still online after logout:", ret)
+	}
+	if p.is_local(1) {
+		t.Fatal("still local after logout")
+	}
+	// 重复下线不影响
+	p.logout(1)
+}
+
+// 内存中的etcd, 只实现presence用到的接口
+type fake_kapi struct {
+	etcd.KeysAPI
+	nodes    map[string]string
+	index    uint64
+	events   []interface{} // *etcd.Response或error, 由Next依次返回
+	watchers []*etcd.WatcherOptions
+}
+
+func (k *fake_kapi) Get(ctx context.Context, key string, opts *etcd.GetOptions) (*etcd.Response, error) {
+	dir := &etcd.Node{Key: key, Dir: true}
+	for path, value := range k.nodes {
+		if strings.HasPrefix(path, key+"/") {
+			dir.Nodes = append(dir.Nodes, &etcd.Node{Key: path, Value: value})
+		}
+	}
+	if len(dir.Nodes) == 0 {
+		return nil, etcd.Error{Code: etcd.ErrorCodeKeyNotFound, Index: k.index}
+	}
+	return &etcd.Response{Action: "get", Node: dir, Index: k.index}, nil
+}
+
+func (k *fake_kapi) Delete(ctx context.Context, key string, opts *etcd.DeleteOptions) (*etcd.Response, error) {
+	if value, ok := k.nodes[key]; !ok {
+		return nil, etcd.Error{Code: etcd.ErrorCodeKeyNotFound}
+	} else if opts != nil && opts.PrevValue != "" && opts.PrevValue != value {
+		return nil, etcd.Error{Code: etcd.ErrorCodeTestFailed}
+	}
+	delete(k.nodes, key)
+	return &etcd.Response{Action: "delete"}, nil
+}
+
+func (k *fake_kapi) Watcher(key string, opts *etcd.WatcherOptions) etcd.Watcher {
+	k.watchers = append(k.watchers, opts)
+	return k
+}
+
+func (k *fake_kapi) Next(ctx context.Context) (*etcd.Response, error) {
+	if len(k.events) == 0 {
+		return nil, errors.New("no more events")
+	}
+	e := k.events[0]
+	k.events = k.events[1:]
+	if err, ok := e.(error); ok {
+		return nil, err
+	}
+	return e.(*etcd.Response), nil
+}
+
+func (k *fake_kapi) online(p *presence, userid int32, instance string) {
+	bts, _ := json.Marshal(&Info{UserId: userid, InstanceId: instance})
+	k.nodes[p.user_key(userid)] = string(bts)
+}
+
+func TestWatch(t *testing.T) {
+	p := &presence{}
+	p.init("/test", "game1", false)
+	k := &fake_kapi{nodes: map[string]string{p.instance_key("game1"): "", p.instance_key("game2"): ""}, index: 10}
+	k.online(p, 1, "game1")
+	k.online(p, 2, "game2")
+	k.online(p, 3, "game3") // 启动前已死亡
+
+	// 建立监听时清理已不在实例列表中的实例, 从读取时的index之后监听
+	delete(k.nodes, p.instance_key("game2"))
+	k.events = []interface{}{
+		&etcd.Response{Action: "expire", Node: &etcd.Node{Key: p.instance_key("game2")}},
+		errors.New("event index cleared"),
+		&etcd.Response{Action: "set", Node: &etcd.Node{Key: p.instance_key("game1")}},
+	}
+	w := p.watch(k, nil)
+	if w == nil || len(k.watchers) != 1 || k.watchers[0].AfterIndex != 10 || !k.watchers[0].Recursive {
+		t.Fatal("unexpected watcher:", k.watchers)
+	}
+	if _, ok := k.nodes[p.user_key(3)]; ok {
+		t.Fatal("dead instance not purged on watch")
+	}
+	if _, ok := k.nodes[p.user_key(2)]; ok {
+		t.Fatal("expired instance not purged")
+	}
+
+	// 监听出错后重新建立, 中断期间死亡的实例也被清理
+	if w = p.watch(k, w); w != nil {
+		t.Fatal("broken watcher reused")
+	}
+	k.index = 20
+	k.online(p, 4, "game4")
+	if w = p.watch(k, w); w == nil || len(k.watchers) != 2 || k.watchers[1].AfterIndex != 20 {
+		t.Fatal("watcher not recreated:", k.watchers)
+	}
+	if _, ok := k.nodes[p.user_key(4)]; ok {
+		t.Fatal("instance dead during the gap not purged")
+	}
+	if _, ok := k.nodes[p.user_key(1)]; !ok {
+		t.Fatal("own record purged")
+	}
+}
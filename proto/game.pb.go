@@ -66,8 +66,9 @@ func (*Game) ProtoMessage()               {}
 func (*Game) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{0} }
 
 type Game_Frame struct {
-	Type    Game_FrameType `protobuf:"varint,1,opt,name=Type,enum=proto.Game_FrameType" json:"Type,omitempty"`
-	Message []byte         `protobuf:"bytes,2,opt,name=Message,proto3" json:"Message,omitempty"`
+	Type     Game_FrameType    `protobuf:"varint,1,opt,name=Type,enum=proto.Game_FrameType" json:"Type,omitempty"`
+	Message  []byte            `protobuf:"bytes,2,opt,name=Message,proto3" json:"Message,omitempty"`
+	Metadata map[string]string `protobuf:"bytes,3,rep,name=Metadata" json:"Metadata,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
 }
 
 func (m *Game_Frame) Reset()                    { *m = Game_Frame{} }
@@ -75,6 +76,13 @@ func (m *Game_Frame) String() string            { return proto1.CompactTextStrin
 func (*Game_Frame) ProtoMessage()               {}
 func (*Game_Frame) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{0, 0} }
 
+func (m *Game_Frame) GetMetadata() map[string]string {
+	if m != nil {
+		return m.Metadata
+	}
+	return nil
+}
+
 func init() {
 	proto1.RegisterType((*Game)(nil), "proto.Game")
 	proto1.RegisterType((*Game_Frame)(nil), "proto.Game.Frame")
@@ -188,16 +196,20 @@ var _GameService_serviceDesc = grpc.ServiceDesc{
 func init() { proto1.RegisterFile("game.proto", fileDescriptor0) }
 
 var fileDescriptor0 = []byte{
-	// 167 bytes of a gzipped FileDescriptorProto
+	// 229 bytes of a gzipped FileDescriptorProto
 	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x09, 0x6e, 0x88, 0x02, 0xff, 0xe2, 0xe2, 0x4a, 0x4f, 0xcc, 0x4d,
-	0xd5, 0x2b, 0x28, 0xca, 0x2f, 0xc9, 0x17, 0x62, 0x05, 0x53, 0x4a, 0xc5, 0x5c, 0x2c, 0xee, 0x89,
-	0xb9, 0xa9, 0x52, 0xb6, 0x5c, 0xac, 0x6e, 0x45, 0x89, 0xb9, 0xa9, 0x42, 0xca, 0x5c, 0x2c, 0x21,
-	0x95, 0x05, 0xa9, 0x12, 0x8c, 0x0a, 0x8c, 0x1a, 0x7c, 0x46, 0xa2, 0x10, 0xd5, 0x7a, 0x20, 0x35,
-	0x7a, 0x60, 0x05, 0x20, 0x49, 0x21, 0x7e, 0x2e, 0x76, 0xdf, 0xd4, 0xe2, 0xe2, 0xc4, 0xf4, 0x54,
-	0x09, 0x26, 0x05, 0x46, 0x0d, 0x1e, 0x25, 0x1d, 0x2e, 0x4e, 0x84, 0x2c, 0x37, 0x5c, 0x56, 0x80,
-	0x41, 0x88, 0x83, 0x8b, 0xc5, 0x3b, 0x33, 0x39, 0x5b, 0x80, 0x11, 0xc4, 0x0a, 0xc8, 0xcc, 0x4b,
-	0x17, 0x60, 0x32, 0x72, 0xe4, 0xe2, 0x06, 0x19, 0x18, 0x9c, 0x5a, 0x54, 0x96, 0x99, 0x9c, 0x2a,
-	0x64, 0xc4, 0xc5, 0x16, 0x5c, 0x52, 0x94, 0x9a, 0x98, 0x2b, 0x24, 0x88, 0x61, 0x9d, 0x14, 0xa6,
-	0x90, 0x06, 0xa3, 0x01, 0x63, 0x12, 0x1b, 0x58, 0xd4, 0x18, 0x10, 0x00, 0x00, 0xff, 0xff, 0x92,
-	0x87, 0xcf, 0xaa, 0xd3, 0x00, 0x00, 0x00,
+	0xd5, 0x2b, 0x28, 0xca, 0x2f, 0xc9, 0x17, 0x62, 0x05, 0x53, 0x4a, 0x37, 0x18, 0xb9, 0x58, 0xdc,
+	0x13, 0x73, 0x53, 0xa5, 0x16, 0x32, 0x72, 0xb1, 0xba, 0x15, 0x25, 0xe6, 0xa6, 0x0a, 0x29, 0x73,
+	0xb1, 0x84, 0x54, 0x16, 0xa4, 0x4a, 0x30, 0x2a, 0x30, 0x6a, 0xf0, 0x19, 0x89, 0x42, 0xd4, 0xeb,
+	0x81, 0x14, 0xe9, 0x81, 0x15, 0x80, 0x24, 0x85, 0xf8, 0xb9, 0xd8, 0x7d, 0x53, 0x8b, 0x8b, 0x13,
+	0xd3, 0x53, 0x25, 0x98, 0x14, 0x18, 0x35, 0x78, 0x84, 0x0c, 0xb9, 0x38, 0x7c, 0x53, 0x4b, 0x12,
+	0x53, 0x12, 0x4b, 0x12, 0x25, 0x98, 0x15, 0x98, 0x35, 0xb8, 0x8d, 0xe4, 0x31, 0x74, 0xea, 0xc1,
+	0x54, 0xb8, 0xe6, 0x95, 0x14, 0x55, 0x4a, 0xe9, 0x73, 0xf1, 0xa2, 0x08, 0x08, 0x71, 0x73, 0x31,
+	0x67, 0xa7, 0x56, 0x82, 0x2d, 0xe6, 0x14, 0xe2, 0xe5, 0x62, 0x2d, 0x4b, 0xcc, 0x29, 0x85, 0x98,
+	0xcf, 0x69, 0xc5, 0x64, 0xc1, 0xa8, 0xa4, 0xc3, 0xc5, 0x89, 0x70, 0x01, 0x37, 0xdc, 0x05, 0x02,
+	0x0c, 0x42, 0x1c, 0x5c, 0x2c, 0xde, 0x99, 0xc9, 0xd9, 0x02, 0x8c, 0x20, 0x56, 0x40, 0x66, 0x5e,
+	0xba, 0x00, 0x93, 0x91, 0x23, 0x17, 0x37, 0xc8, 0xea, 0xe0, 0xd4, 0xa2, 0xb2, 0xcc, 0xe4, 0x54,
+	0x21, 0x23, 0x2e, 0xb6, 0xe0, 0x92, 0xa2, 0xd4, 0xc4, 0x5c, 0x21, 0x41, 0x0c, 0x87, 0x49, 0x61,
+	0x0a, 0x69, 0x30, 0x1a, 0x30, 0x26, 0xb1, 0x81, 0x45, 0x8d, 0x01, 0x03, 0x00, 0x1a, 0xb5, 0x2c,
+	0xd2, 0x39, 0x01, 0x00, 0x00,
 }
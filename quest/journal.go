@@ -0,0 +1,204 @@
+package quest
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"game/events"
+	"game/kafka"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// 一个任务的进度
+type Progress struct {
+	Id      int32 `bson:"id"`
+	Count   int64 `bson:"count"`
+	Period  int64 `bson:"period"` // 所属周期, 见period
+	Claimed bool  `bson:"claimed"`
+}
+
+// Done 是否达到目标
+func (p *Progress) Done(def *Def) bool {
+	return p.Count >= def.Count
+}
+
+// 玩家的全部任务进度, 持久化的文档
+type Journal struct {
+	UserId   int32       `bson:"_id"`
+	Progress []*Progress `bson:"progress"`
+	mu       sync.Mutex
+}
+
+// 当前周期的进度, create为false时只读, 不存在或周期已过时返回nil;
+// create为true时创建或重置过期的进度, 调用者负责commit
+func (j *Journal) progress(def *Def, now time.Time, create bool) *Progress {
+	p := period(def.Kind, now)
+	for _, pg := range j.Progress {
+		if pg.Id == def.Id {
+			if pg.Period == p {
+				return pg
+			} else if !create {
+				return nil
+			}
+			*pg = Progress{Id: def.Id, Period: p}
+			return pg
+		}
+	}
+	if !create {
+		return nil
+	}
+	pg := &Progress{Id: def.Id, Period: p}
+	j.Progress = append(j.Progress, pg)
+	return pg
+}
+
+// 前置任务已领奖
+func (j *Journal) unlocked(def *Def, now time.Time) bool {
+	if def.Prereq == 0 {
+		return true
+	}
+	prereq := Quest(def.Prereq)
+	if prereq == nil {
+		return false
+	}
+	pg := j.progress(prereq, now, false)
+	return pg != nil && pg.Claimed
+}
+
+// Advance 用事件推进任务进度
+func (j *Journal) Advance(e *events.Event, now time.Time) {
+	var changed []Progress
+	j.mu.Lock()
+	for _, def := range current().by_event[e.Type] {
+		if def.Target != 0 && def.Target != e.Target {
+			continue
+		}
+		if !j.unlocked(def, now) {
+			continue
+		}
+		pg := j.progress(def, now, true)
+		if pg.Claimed || pg.Done(def) {
+			continue
+		}
+
+		switch def.Mode {
+		case MODE_MAX:
+			if e.Count <= pg.Count {
+				continue
+			}
+			pg.Count = e.Count
+		default:
+			pg.Count += e.Count
+		}
+		if pg.Count > def.Count {
+			pg.Count = def.Count
+		}
+		changed = append(changed, *pg)
+		if pg.Done(def) {
+			kafka.TraceEvent("quest_done", j.UserId, map[string]interface{}{"quest": def.Id, "period": pg.Period})
+		}
+	}
+	j.mu.Unlock()
+	j.commit(changed)
+}
+
+// List 已解锁任务的当前进度, 按任务id排序
+func (j *Journal) List(now time.Time) []Progress {
+	d := current()
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	ret := make([]Progress, 0, len(d.quests))
+	for _, def := range d.quests {
+		if !j.unlocked(def, now) {
+			continue
+		}
+		if pg := j.progress(def, now, false); pg != nil {
+			ret = append(ret, *pg)
+		} else {
+			ret = append(ret, Progress{Id: def.Id, Period: period(def.Kind, now)})
+		}
+	}
+	sort.Slice(ret, func(i, k int) bool { return ret[i].Id < ret[k].Id })
+	return ret
+}
+
+// Claim 领取奖励
+func (j *Journal) Claim(id int32, now time.Time) (*Def, error) {
+	def := Quest(id)
+	if def == nil {
+		return nil, ERROR_QUEST_NOT_FOUND
+	}
+
+	// 先标记已领取并保存再发放, 发放期间可能触发新的事件; 保存失败时不发放
+	j.mu.Lock()
+	pg := j.progress(def, now, false)
+	if pg == nil || !pg.Done(def) {
+		j.mu.Unlock()
+		return nil, ERROR_NOT_DONE
+	} else if pg.Claimed {
+		j.mu.Unlock()
+		return nil, ERROR_CLAIMED
+	}
+	pg.Claimed = true
+	key := fmt.Sprintf("quest:%v:%v", def.Id, pg.Period)
+	j.mu.Unlock()
+
+	revert := func() {
+		j.mu.Lock()
+		pg.Claimed = false
+		j.mu.Unlock()
+	}
+	if err := j.save(); err != nil {
+		revert()
+		return nil, err
+	}
+	if Grant != nil {
+		if err := Grant(j.UserId, def, key); err != nil {
+			revert()
+			if err := j.save(); err != nil {
+				log.Error("quest: revert claim failed:", j.UserId, def.Id, err)
+			}
+			return nil, err
+		}
+	}
+
+	kafka.TraceEvent("quest_claim", j.UserId, map[string]interface{}{"quest": def.Id, "period": pg.Period, "rewards": def.Rewards})
+	j.mu.Lock()
+	ret := *pg
+	j.mu.Unlock()
+	j.publish([]Progress{ret})
+	return def, nil
+}
+
+func (j *Journal) save() error {
+	if _db == nil {
+		return nil
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return _db.Save(COLLECTION_QUESTS, j.UserId, j)
+}
+
+// 保存并写入WAL, 再通知上层
+func (j *Journal) commit(changed []Progress) {
+	if len(changed) == 0 {
+		return
+	}
+	if err := j.save(); err != nil {
+		log.Error("quest: save failed:", j.UserId, err)
+	}
+	j.publish(changed)
+}
+
+// 写入WAL并通知上层
+func (j *Journal) publish(changed []Progress) {
+	for _, pg := range changed {
+		kafka.CommitUpdate(j.UserId, pg, COLLECTION_QUESTS)
+	}
+	if OnProgress != nil {
+		OnProgress(j.UserId, changed)
+	}
+}
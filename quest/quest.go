@@ -0,0 +1,171 @@
+package quest
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"game/db"
+	"game/events"
+	"game/mail"
+)
+
+// 任务和成就:
+// 定义来自数值表, 每个任务监听一种事件(events), 事件的Target匹配时推进进度, 达到目标后可以领取奖励.
+// 日常和周常任务按周期懒惰重置: 进度记录所属周期, 周期变化后视为新的进度.
+// 成就和普通任务不重置. 有前置任务的, 前置任务领奖后才开始计数.
+// 在线玩家的进度缓存在内存中, 每次变化后保存并写入WAL.
+const (
+	COLLECTION_QUESTS = "quests"
+)
+
+// 任务类型
+const (
+	KIND_ONCE        = int32(1) // 普通任务
+	KIND_DAILY       = int32(2) // 日常
+	KIND_WEEKLY      = int32(3) // 周常
+	KIND_ACHIEVEMENT = int32(4) // 成就
+)
+
+// 计数方式
+const (
+	MODE_SUM = int32(0) // 累加事件的Count
+	MODE_MAX = int32(1) // 取事件Count的最大值, 如达到等级
+)
+
+var (
+	ERROR_QUEST_NOT_FOUND = errors.New("quest not found")
+	ERROR_NOT_DONE        = errors.New("quest not done")
+	ERROR_CLAIMED         = errors.New("quest reward claimed")
+)
+
+// EVENTS 任务可以监听的事件, 都有发布者
+var EVENTS = []int32{
+	events.EVENT_LOGIN,
+	events.EVENT_SPEND,
+	events.EVENT_LEVEL_UP,
+	events.EVENT_ITEM,
+}
+
+// 任务定义
+type Def struct {
+	Id      int32
+	Kind    int32
+	Event   int32 // 监听的事件
+	Target  int32 // 事件对象, 0为任意
+	Mode    int32
+	Count   int64 // 目标数量
+	Prereq  int32 // 前置任务, 0为无
+	Rewards []mail.Attachment
+}
+
+type defs struct {
+	quests   map[int32]*Def
+	by_event map[int32][]*Def
+}
+
+var (
+	_db   *db.Database
+	_defs = &defs{quests: make(map[int32]*Def), by_event: make(map[int32][]*Def)}
+	_mu   sync.RWMutex
+
+	// ResetHour 日常和周常的重置时间(本地时间), 周常在周一重置
+	ResetHour = 0
+
+	// Grant 发放奖励, 由上层设置, 返回错误时领取被撤销; key为"quest:<id>:<period>", 用作发放的幂等键
+	Grant func(userid int32, def *Def, key string) error
+
+	// OnProgress 进度变化, 由上层设置, 用于推送给客户端
+	OnProgress func(userid int32, progress []Progress)
+)
+
+var _default_journals journals
+
+// 在线玩家的任务进度缓存
+type journals struct {
+	journals map[int32]*Journal
+	sync.Mutex
+}
+
+func Init(database *db.Database) {
+	_db = database
+	_default_journals.journals = make(map[int32]*Journal)
+	for _, e := range EVENTS {
+		events.Subscribe(e, on_event)
+	}
+}
+
+// SetDefs 替换全部任务定义, 数值表热更新时调用.
+// 已删除任务的进度保留但不再推进, 也不能领取
+func SetDefs(quests []*Def) {
+	d := &defs{quests: make(map[int32]*Def), by_event: make(map[int32][]*Def)}
+	for _, q := range quests {
+		d.quests[q.Id] = q
+		d.by_event[q.Event] = append(d.by_event[q.Event], q)
+	}
+	_mu.Lock()
+	_defs = d
+	_mu.Unlock()
+}
+
+func current() *defs {
+	_mu.RLock()
+	defer _mu.RUnlock()
+	return _defs
+}
+
+// Quest 任务定义, 不存在时返回nil
+func Quest(id int32) *Def {
+	return current().quests[id]
+}
+
+// 任务所属的周期, 用周期开始的unix时间表示, 不重置的任务为0
+func period(kind int32, now time.Time) int64 {
+	now = now.Add(-time.Duration(ResetHour) * time.Hour)
+	day := time.Date(now.Year(), now.Month(), now.Day(), ResetHour, 0, 0, 0, now.Location())
+	switch kind {
+	case KIND_DAILY:
+		return day.Unix()
+	case KIND_WEEKLY:
+		offset := (int(day.Weekday()) + 6) % 7 // 周一为0
+		return day.AddDate(0, 0, -offset).Unix()
+	}
+	return 0
+}
+
+// Get 读取玩家的任务进度, 不存在时创建
+func Get(userid int32) (*Journal, error) {
+	return _default_journals.get(userid)
+}
+
+// Release 玩家下线时释放缓存
+func Release(userid int32) {
+	_default_journals.Lock()
+	delete(_default_journals.journals, userid)
+	_default_journals.Unlock()
+}
+
+func (s *journals) get(userid int32) (*Journal, error) {
+	s.Lock()
+	defer s.Unlock()
+	if j, ok := s.journals[userid]; ok {
+		return j, nil
+	}
+
+	j := &Journal{UserId: userid, Progress: []*Progress{}}
+	if err := _db.Load(COLLECTION_QUESTS, userid, j); err != nil && err != db.ERROR_NOT_FOUND {
+		return nil, err
+	}
+	s.journals[userid] = j
+	return j, nil
+}
+
+// 只推进在线玩家的任务, 事件总是在玩家所在的实例上发生
+func on_event(e *events.Event) {
+	_default_journals.Lock()
+	j := _default_journals.journals[e.UserId]
+	_default_journals.Unlock()
+	if j != nil {
+		j.Advance(e, time.Now())
+	}
+}
@@ -0,0 +1,148 @@
+package quest
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"game/db"
+	"game/events"
+	"game/kafka"
+)
+
+func init() {
+	kafka.InitDiscard()
+}
+
+func TestPeriod(t *testing.T) {
+	// 2024-01-03为周三
+	now := time.Date(2024, 1, 3, 10, 0, 0, 0, time.Local)
+	if period(KIND_DAILY, now) != time.Date(2024, 1, 3, 0, 0, 0, 0, time.Local).Unix() {
+		t.Fatal("unexpected daily period")
+	}
+	if period(KIND_WEEKLY, now) != time.Date(2024, 1, 1, 0, 0, 0, 0, time.Local).Unix() {
+		t.Fatal("unexpected weekly period")
+	}
+	if period(KIND_ACHIEVEMENT, now) != 0 {
+		t.Fatal("achievement should not reset")
+	}
+
+	ResetHour = 5
+	defer func() { ResetHour = 0 }()
+	early := time.Date(2024, 1, 3, 4, 0, 0, 0, time.Local)
+	if period(KIND_DAILY, early) != time.Date(2024, 1, 2, 5, 0, 0, 0, time.Local).Unix() {
+		t.Fatal("unexpected daily period before reset hour")
+	}
+}
+
+func TestAdvance(t *testing.T) {
+	SetDefs([]*Def{
+		{Id: 1, Kind: KIND_DAILY, Event: events.EVENT_ITEM, Target: 7, Count: 3},
+		{Id: 2, Kind: KIND_ONCE, Event: events.EVENT_ITEM, Count: 1, Prereq: 1},
+		{Id: 3, Kind: KIND_ACHIEVEMENT, Event: events.EVENT_LEVEL_UP, Mode: MODE_MAX, Count: 10},
+	})
+	defer SetDefs(nil)
+
+	j := &Journal{UserId: 1}
+	now := time.Date(2024, 1, 3, 10, 0, 0, 0, time.Local)
+	j.Advance(&events.Event{Type: events.EVENT_ITEM, Target: 8, Count: 1}, now)
+	j.Advance(&events.Event{Type: events.EVENT_ITEM, Target: 7, Count: 5}, now)
+	j.Advance(&events.Event{Type: events.EVENT_LEVEL_UP, Count: 4}, now)
+	j.Advance(&events.Event{Type: events.EVENT_LEVEL_UP, Count: 2}, now)
+
+	list := j.List(now)
+	if len(list) != 2 || list[0].Count != 3 || list[1].Count != 4 {
+		t.Fatal("unexpected progress:", list)
+	}
+
+	// 前置任务领奖前不计数
+	if _, err := j.Claim(2, now); err != ERROR_NOT_DONE {
+		t.Fatal("expect not done, got:", err)
+	}
+	if _, err := j.Claim(1, now); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := j.Claim(1, now); err != ERROR_CLAIMED {
+		t.Fatal("expect claimed, got:", err)
+	}
+	j.Advance(&events.Event{Type: events.EVENT_ITEM, Target: 8, Count: 1}, now)
+	if _, err := j.Claim(2, now); err != nil {
+		t.Fatal(err)
+	}
+
+	// 第二天日常任务重置
+	list = j.List(now.AddDate(0, 0, 1))
+	if list[0].Id != 1 || list[0].Count != 0 || list[0].Claimed {
+		t.Fatal("daily quest not reset:", list[0])
+	}
+	// 只读, 不修改已保存的进度
+	if pg := j.Progress[0]; pg.Id != 1 || pg.Count != 3 || !pg.Claimed {
+		t.Fatal("progress modified by list:", pg)
+	}
+}
+
+func TestClaimRevert(t *testing.T) {
+	SetDefs([]*Def{{Id: 1, Kind: KIND_ONCE, Event: events.EVENT_LOGIN, Count: 1}})
+	defer SetDefs(nil)
+	defer func() { Grant = nil }()
+
+	j := &Journal{UserId: 1}
+	now := time.Now()
+	j.Advance(&events.Event{Type: events.EVENT_LOGIN, Count: 1}, now)
+
+	Grant = func(userid int32, def *Def, key string) error { return errors.New("full") }
+	if _, err := j.Claim(1, now); err == nil {
+		t.Fatal("expect error")
+	}
+	Grant = nil
+	if _, err := j.Claim(1, now); err != nil {
+		t.Fatal("claim not reverted:", err)
+	}
+}
+
+func TestClaimSaveError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "quest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	var database db.Database
+	database.InitLocal(dir)
+	_db = &database
+	defer func() { _db = nil }()
+
+	SetDefs([]*Def{{Id: 1, Kind: KIND_ONCE, Event: events.EVENT_LOGIN, Count: 1}})
+	defer SetDefs(nil)
+	defer func() { Grant = nil }()
+	var keys []string
+	Grant = func(userid int32, def *Def, key string) error {
+		keys = append(keys, key)
+		return nil
+	}
+
+	j := &Journal{UserId: 1}
+	now := time.Now()
+	j.Advance(&events.Event{Type: events.EVENT_LOGIN, Count: 1}, now)
+
+	// 领取状态无法保存时不发放
+	path := filepath.Join(dir, COLLECTION_QUESTS, fmt.Sprint(1)+db.LOCAL_DOC_EXT)
+	os.Remove(path)
+	if err := os.MkdirAll(filepath.Join(path, "x"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := j.Claim(1, now); err == nil || len(keys) != 0 {
+		t.Fatal("expect save error, got:", err, keys)
+	}
+
+	os.RemoveAll(path)
+	if _, err := j.Claim(1, now); err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 1 || keys[0] != "quest:1:0" {
+		t.Fatal("unexpected keys:", keys)
+	}
+}
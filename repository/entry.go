@@ -0,0 +1,148 @@
+package repository
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+
+	"gopkg.in/mgo.v2/bson"
+
+	"game/types"
+)
+
+// 一个在线玩家的全部文档, 玩家数据在COLLECTION_USERS中, 扩展文档在各自的集合中, 都以userid为_id
+type Entry struct {
+	UserId int32
+	docs   map[string]interface{}     // 集合 -> 文档(指针)
+	dirty  map[string]map[string]bool // 集合 -> 修改过的字段(Go字段名)
+	mu     sync.Mutex
+	saving sync.Mutex // 保证同一玩家的flush串行, 旧的$set不会覆盖新的
+
+	released bool // 已下线但修改尚未全部写入, 由repository的锁保护
+}
+
+func new_entry(userid int32) *Entry {
+	return &Entry{UserId: userid, docs: make(map[string]interface{}), dirty: make(map[string]map[string]bool)}
+}
+
+// User 玩家数据的拷贝; 修改需要通过UpdateUser
+func (e *Entry) User() *types.User {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	u := *e.docs[COLLECTION_USERS].(*types.User)
+	return &u
+}
+
+// Doc 扩展文档的拷贝(指针), 不存在时返回nil; 修改需要通过Update
+func (e *Entry) Doc(collection string) interface{} {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	doc, ok := e.docs[collection]
+	if !ok {
+		return nil
+	}
+	v := reflect.New(reflect.TypeOf(doc).Elem())
+	v.Elem().Set(reflect.ValueOf(doc).Elem())
+	return v.Interface()
+}
+
+// Update 在锁内修改文档, f返回修改过的字段(Go字段名), 在下一次flush时保存
+func (e *Entry) Update(collection string, f func(doc interface{}) []string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	doc, ok := e.docs[collection]
+	if !ok {
+		return
+	}
+	e.mark(collection, f(doc))
+}
+
+// UpdateUser 修改玩家数据
+func (e *Entry) UpdateUser(f func(u *types.User) []string) {
+	e.Update(COLLECTION_USERS, func(doc interface{}) []string {
+		return f(doc.(*types.User))
+	})
+}
+
+func (e *Entry) mark(collection string, fields []string) {
+	if len(fields) == 0 {
+		return
+	}
+	d := e.dirty[collection]
+	if d == nil {
+		d = make(map[string]bool)
+		e.dirty[collection] = d
+	}
+	for _, f := range fields {
+		d[f] = true
+	}
+}
+
+// 一个集合待保存的字段
+type change struct {
+	collection string
+	set        bson.M // bson字段名 -> 值
+	fields     []string
+}
+
+// 取出全部修改过的字段的当前值, 并清除修改标记
+func (e *Entry) take() []change {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	var changes []change
+	for collection, fields := range e.dirty {
+		c := change{collection: collection, set: bson.M{}}
+		v := reflect.ValueOf(e.docs[collection]).Elem()
+		for f := range fields {
+			key, ok := bson_key(v.Type(), f)
+			if !ok {
+				continue
+			}
+			c.set[key] = v.FieldByName(f).Interface()
+			c.fields = append(c.fields, f)
+		}
+		if len(c.set) == 0 {
+			continue
+		}
+		// 在锁内复制一份, 避免保存时文档中的slice和map被修改
+		copied := bson.M{}
+		if bts, err := bson.Marshal(c.set); err == nil {
+			if err := bson.Unmarshal(bts, &copied); err == nil {
+				c.set = copied
+			}
+		}
+		changes = append(changes, c)
+	}
+	e.dirty = make(map[string]map[string]bool)
+	return changes
+}
+
+// 保存失败时恢复修改标记, 下次重试
+func (e *Entry) restore(c change) {
+	e.mu.Lock()
+	e.mark(c.collection, c.fields)
+	e.mu.Unlock()
+}
+
+// Dirty 是否有未保存的修改
+func (e *Entry) Dirty() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return len(e.dirty) > 0
+}
+
+// Go字段名对应的bson字段名, 规则同mgo: 有tag时用tag, 否则为小写的字段名
+func bson_key(t reflect.Type, name string) (string, bool) {
+	f, ok := t.FieldByName(name)
+	if !ok || f.PkgPath != "" {
+		return "", false
+	}
+	tag := f.Tag.Get("bson")
+	if tag == "-" {
+		return "", false
+	}
+	if key := strings.Split(tag, ",")[0]; key != "" {
+		return key, true
+	}
+	return strings.ToLower(name), true
+}
@@ -0,0 +1,225 @@
+package repository
+
+import (
+	"sync"
+	"time"
+
+	"game/db"
+	"game/kafka"
+	"game/types"
+
+	log "github.com/Sirupsen/logrus"
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// 玩家数据仓库:
+// 登陆时读取玩家数据(types.User)和注册过的扩展文档, 缓存到下线.
+// 修改通过Entry.Update完成并标记修改过的字段, 后台每隔interval把修改过的字段以$set写入mongodb,
+// 同时写入WAL, 下线时立即写入, 写入失败时保留缓存由后台重试. 进程崩溃时最多丢失一个interval的修改, 可以从WAL恢复.
+// standalone模式下没有$set, 保存整个文档.
+const (
+	COLLECTION_USERS = "users"
+
+	DEFAULT_INTERVAL = 10 * time.Second
+)
+
+var (
+	_db        *db.Database
+	_factories = make(map[string]func(userid int32) interface{})
+)
+
+var _default_repository repository
+
+type repository struct {
+	entries map[int32]*Entry
+	sync.Mutex
+}
+
+// Init 启动后台写入, interval为写入间隔
+func Init(database *db.Database, interval time.Duration) {
+	_db = database
+	_default_repository.entries = make(map[int32]*Entry)
+	if interval <= 0 {
+		interval = DEFAULT_INTERVAL
+	}
+	go flush_loop(interval)
+}
+
+// Register 注册扩展文档, factory创建新玩家的默认文档(指针), 需要在Init之前调用
+func Register(collection string, factory func(userid int32) interface{}) {
+	_factories[collection] = factory
+}
+
+// Load 登陆时读取玩家的全部文档, 不存在时创建, created为true表示新玩家
+// 下线后尚未写入成功的缓存直接复用; 读取数据库时不持有全局锁, 并发读取同一玩家时以先放入缓存的为准
+func Load(userid int32) (e *Entry, created bool, err error) {
+	if e := revive(userid); e != nil {
+		return e, false, nil
+	}
+
+	if e, created, err = load_entry(userid); err != nil {
+		return nil, false, err
+	}
+
+	_default_repository.Lock()
+	defer _default_repository.Unlock()
+	if cur, ok := _default_repository.entries[userid]; ok {
+		cur.released = false
+		return cur, false, nil
+	}
+	_default_repository.entries[userid] = e
+	return e, created, nil
+}
+
+// 缓存中的玩家重新上线
+func revive(userid int32) *Entry {
+	_default_repository.Lock()
+	defer _default_repository.Unlock()
+	e, ok := _default_repository.entries[userid]
+	if ok {
+		e.released = false
+	}
+	return e
+}
+
+// 从数据库读取全部文档, 新玩家以插入的方式创建, 并发创建时只有一个成功
+func load_entry(userid int32) (e *Entry, created bool, err error) {
+	e = new_entry(userid)
+	user := &types.User{}
+	if created, err = load(COLLECTION_USERS, userid, user); err != nil {
+		return nil, false, err
+	}
+	if created {
+		user = &types.User{Id: userid, Level: 1, CreateTime: time.Now().Unix()}
+		err = _db.Insert(COLLECTION_USERS, userid, user)
+		if err == db.ERROR_DUPLICATED {
+			user, created = &types.User{}, false
+			err = _db.Load(COLLECTION_USERS, userid, user)
+		}
+		if err != nil {
+			return nil, false, err
+		}
+	}
+	e.docs[COLLECTION_USERS] = user
+
+	for collection, factory := range _factories {
+		doc := factory(userid)
+		if _, err = load(collection, userid, doc); err != nil {
+			return nil, false, err
+		}
+		e.docs[collection] = doc
+	}
+	return e, created, nil
+}
+
+// 读取文档, 不存在时返回true
+func load(collection string, userid int32, doc interface{}) (bool, error) {
+	err := _db.Load(collection, userid, doc)
+	if err == db.ERROR_NOT_FOUND {
+		return true, nil
+	}
+	return false, err
+}
+
+// Get 在线玩家的文档, 不在线时返回nil
+func Get(userid int32) *Entry {
+	_default_repository.Lock()
+	defer _default_repository.Unlock()
+	if e := _default_repository.entries[userid]; e != nil && !e.released {
+		return e
+	}
+	return nil
+}
+
+// Peek 读取玩家数据的拷贝, 不加载到缓存, 不存在时返回nil
+func Peek(userid int32) (*types.User, error) {
+	_default_repository.Lock()
+	e := _default_repository.entries[userid]
+	_default_repository.Unlock()
+	if e != nil {
+		return e.User(), nil
+	}
+	user := &types.User{}
+	err := _db.Load(COLLECTION_USERS, userid, user)
+	if err == db.ERROR_NOT_FOUND {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// Release 下线时写入全部修改并释放缓存; 写入失败时保留缓存, 由后台继续重试, 成功后释放
+func Release(userid int32) {
+	_default_repository.Lock()
+	e := _default_repository.entries[userid]
+	if e != nil {
+		e.released = true
+	}
+	_default_repository.Unlock()
+	if e != nil {
+		flush(e)
+		evict(e)
+	}
+}
+
+// 已下线且全部修改写入成功时释放缓存; 等待进行中的flush, 写入失败恢复的修改标记不会丢失
+func evict(e *Entry) {
+	e.saving.Lock()
+	defer e.saving.Unlock()
+	_default_repository.Lock()
+	defer _default_repository.Unlock()
+	if e.released && !e.Dirty() && _default_repository.entries[e.UserId] == e {
+		delete(_default_repository.entries, e.UserId)
+	}
+}
+
+// FlushAll 立即写入全部缓存中玩家的修改, 用于停服
+func FlushAll() {
+	_default_repository.Lock()
+	entries := make([]*Entry, 0, len(_default_repository.entries))
+	for _, e := range _default_repository.entries {
+		entries = append(entries, e)
+	}
+	_default_repository.Unlock()
+
+	for _, e := range entries {
+		if e.Dirty() {
+			flush(e)
+		}
+		evict(e)
+	}
+}
+
+func flush_loop(interval time.Duration) {
+	for range time.Tick(interval) {
+		FlushAll()
+	}
+}
+
+// 写入一个玩家的修改, 失败的集合保留修改标记等待下次写入
+func flush(e *Entry) {
+	e.saving.Lock()
+	defer e.saving.Unlock()
+	for _, c := range e.take() {
+		if err := save(e, c); err != nil {
+			log.Errorf("repository: flush failed, userid:%v collection:%v err:%v", e.UserId, c.collection, err)
+			e.restore(c)
+			continue
+		}
+		kafka.CommitUpdate(e.UserId, c.set, c.collection)
+	}
+}
+
+func save(e *Entry, c change) error {
+	if _db.IsLocal() {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		return _db.Save(c.collection, e.UserId, e.docs[c.collection])
+	}
+	return _db.Execute(func(sess *mgo.Session) error {
+		_, err := sess.DB("").C(c.collection).UpsertId(e.UserId, bson.M{"$set": c.set})
+		return err
+	})
+}
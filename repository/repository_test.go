@@ -0,0 +1,162 @@
+package repository
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"game/db"
+	"game/kafka"
+	"game/types"
+)
+
+func init() {
+	kafka.InitDiscard()
+}
+
+type profile struct {
+	Id   int32    `bson:"_id"`
+	Sign string   `bson:"sign"`
+	Tags []string `bson:"tags,omitempty"`
+}
+
+func TestFlush(t *testing.T) {
+	dir, err := ioutil.TempDir("", "repository")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var database db.Database
+	database.InitLocal(dir)
+	Register("profiles", func(userid int32) interface{} { return &profile{Id: userid} })
+	defer delete(_factories, "profiles")
+	Init(&database, time.Hour)
+
+	e, created, err := Load(1)
+	if err != nil || !created || e.User().Level != 1 {
+		t.Fatal("unexpected load:", err, created)
+	}
+
+	e.UpdateUser(func(u *types.User) []string {
+		u.Score = 100
+		u.Name = "alice"
+		return []string{"Score", "Name"}
+	})
+	e.Update("profiles", func(doc interface{}) []string {
+		p := doc.(*profile)
+		p.Sign = "hello"
+		p.Tags = []string{"a"}
+		return []string{"Sign", "Tags"}
+	})
+
+	changes := e.take()
+	if len(changes) != 2 || e.Dirty() {
+		t.Fatal("unexpected changes:", changes)
+	}
+	for _, c := range changes {
+		switch c.collection {
+		case COLLECTION_USERS:
+			if c.set["score"] != 100 || c.set["name"] != "alice" || len(c.set) != 2 {
+				t.Fatal("unexpected user set:", c.set)
+			}
+		case "profiles":
+			if c.set["sign"] != "hello" || len(c.set) != 2 {
+				t.Fatal("unexpected profile set:", c.set)
+			}
+		}
+		e.restore(c)
+	}
+
+	// 下线时写入, 重新登陆时读出
+	Release(1)
+	e, created, err = Load(1)
+	if err != nil || created {
+		t.Fatal("unexpected reload:", err, created)
+	}
+	if u := e.User(); u.Score != 100 || u.Name != "alice" {
+		t.Fatal("user not flushed:", u)
+	}
+	if p := e.Doc("profiles").(*profile); p.Sign != "hello" || len(p.Tags) != 1 {
+		t.Fatal("profile not flushed:", p)
+	}
+
+	// 读取的是拷贝, 直接修改不影响缓存
+	e.User().Name = "bob"
+	e.Doc("profiles").(*profile).Sign = "bye"
+	if e.User().Name != "alice" || e.Doc("profiles").(*profile).Sign != "hello" {
+		t.Fatal("cached docs modified")
+	}
+}
+
+func TestBsonKey(t *testing.T) {
+	for name, expect := range map[string]string{"Id": "_id", "Sign": "sign", "Tags": "tags"} {
+		if key, ok := bson_key(reflect.TypeOf(profile{}), name); !ok || key != expect {
+			t.Fatal("unexpected key:", name, key)
+		}
+	}
+	if _, ok := bson_key(reflect.TypeOf(types.User{}), "Item"); ok {
+		t.Fatal("ignored field should not be saved")
+	}
+	if key, _ := bson_key(reflect.TypeOf(types.User{}), "LastLoginTime"); key != "lastlogintime" {
+		t.Fatal("unexpected default key:", key)
+	}
+}
+
+func TestReleaseRetry(t *testing.T) {
+	dir, err := ioutil.TempDir("", "repository")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var database db.Database
+	database.InitLocal(dir)
+	Init(&database, time.Hour)
+
+	e, _, err := Load(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.UpdateUser(func(u *types.User) []string {
+		u.Name = "carol"
+		return []string{"Name"}
+	})
+
+	// 写入失败时保留缓存, 不再视为在线
+	path := filepath.Join(dir, COLLECTION_USERS, fmt.Sprint(2)+db.LOCAL_DOC_EXT)
+	os.Remove(path)
+	if err := os.MkdirAll(filepath.Join(path, "x"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	Release(2)
+	if Get(2) != nil {
+		t.Fatal("released entry still online")
+	}
+	if u, _ := Peek(2); u == nil || u.Name != "carol" {
+		t.Fatal("pending entry lost:", u)
+	}
+
+	// 重新登陆时复用未写入的缓存
+	if e2, created, err := Load(2); err != nil || created || e2 != e {
+		t.Fatal("pending entry not reused:", err, created)
+	}
+	Release(2)
+
+	// 恢复后由后台写入并释放
+	os.RemoveAll(path)
+	FlushAll()
+	_default_repository.Lock()
+	_, ok := _default_repository.entries[2]
+	_default_repository.Unlock()
+	if ok {
+		t.Fatal("entry not evicted")
+	}
+	if u, _ := Peek(2); u == nil || u.Name != "carol" {
+		t.Fatal("user not flushed:", u)
+	}
+}
@@ -0,0 +1,308 @@
+package rooms
+
+import (
+	"errors"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"game/ipc"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+var (
+	ERROR_ROOM_CLOSED = errors.New("room closed")
+	ERROR_ROOM_FULL   = errors.New("room full")
+	ERROR_ROOM_BUSY   = errors.New("room inbox full")
+	ERROR_NOT_MEMBER  = errors.New("not a member of room")
+	ERROR_ROOM_PANIC  = errors.New("room logic panic")
+)
+
+// 关闭原因
+const (
+	CLOSE_NORMAL   = iota // 逻辑或外部主动关闭
+	CLOSE_IDLE            // 长时间没有成员
+	CLOSE_LIFETIME        // 超过最长存活时间
+	CLOSE_CRASH           // 逻辑多次panic
+)
+
+// 房间逻辑, 所有回调都在房间自己的goroutine中执行, 无需加锁
+type Logic interface {
+	OnJoin(r *Room, userid int32) error // 返回错误则拒绝加入
+	OnLeave(r *Room, userid int32)
+	OnInput(r *Room, userid int32, data []byte)
+	OnTick(r *Room, frame uint32)
+	OnClose(r *Room, reason int)
+}
+
+// 房间参数
+type Config struct {
+	MaxMembers  int           // 0为不限
+	TickRate    int           // 每秒tick次数
+	IdleTimeout time.Duration // 没有成员超过该时间后关闭, 0为不关闭
+	MaxLifetime time.Duration // 最长存活时间, 0为不限
+	MaxPanics   int           // 逻辑panic超过该次数后关闭房间
+	InboxSize   int           // 输入队列长度
+}
+
+func DefaultConfig() Config {
+	return Config{
+		MaxMembers:  10,
+		TickRate:    20,
+		IdleTimeout: 30 * time.Second,
+		MaxLifetime: time.Hour,
+		MaxPanics:   3,
+		InboxSize:   1024,
+	}
+}
+
+const (
+	msg_join = iota
+	msg_leave
+	msg_input
+	msg_call
+)
+
+// 发给房间的消息
+type message struct {
+	kind   int
+	userid int32
+	data   []byte
+	fn     func()
+	reply  chan error
+}
+
+// 房间是一个独立的actor: 一个goroutine按固定频率tick, 并串行处理成员的加入, 离开和输入.
+// 成员必须是本实例上的在线会话, 房间通过ipc推送消息给成员.
+type Room struct {
+	Id      int64
+	cfg     Config
+	logic   Logic
+	inbox   chan message
+	members map[int32]bool // 只在房间goroutine中访问
+	frame   uint32
+	panics  int
+	created time.Time
+	emptied time.Time // 最后一次变为空房间的时间
+	die     chan struct{}
+	quit    chan struct{} // Close关闭, 不经过inbox, 队列满时也能关闭房间
+	once    sync.Once
+	closed  bool
+}
+
+func new_room(id int64, cfg Config, logic Logic) *Room {
+	now := time.Now()
+	return &Room{
+		Id:      id,
+		cfg:     cfg,
+		logic:   logic,
+		inbox:   make(chan message, cfg.InboxSize),
+		members: make(map[int32]bool),
+		created: now,
+		emptied: now,
+		die:     make(chan struct{}),
+		quit:    make(chan struct{}),
+	}
+}
+
+// 投递消息, 不阻塞
+func (r *Room) post(msg message) error {
+	select {
+	case <-r.die:
+		return ERROR_ROOM_CLOSED
+	default:
+	}
+	select {
+	case r.inbox <- msg:
+		return nil
+	case <-r.die:
+		return ERROR_ROOM_CLOSED
+	default:
+		return ERROR_ROOM_BUSY
+	}
+}
+
+// 投递消息并等待房间处理完毕
+func (r *Room) call(msg message) error {
+	msg.reply = make(chan error, 1)
+	if err := r.post(msg); err != nil {
+		return err
+	}
+	select {
+	case err := <-msg.reply:
+		return err
+	case <-r.die:
+		return ERROR_ROOM_CLOSED
+	}
+}
+
+func (r *Room) loop() {
+	ticker := time.NewTicker(time.Second / time.Duration(r.cfg.TickRate))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case msg := <-r.inbox:
+			err := r.handle(msg)
+			if msg.reply != nil {
+				msg.reply <- err
+			}
+		case <-ticker.C:
+			r.frame++
+			r.safe_call(func() { r.logic.OnTick(r, r.frame) })
+			r.check_timeout()
+		case <-r.quit:
+			r.close(CLOSE_NORMAL)
+		case <-r.die:
+			return
+		}
+		if r.closed {
+			return
+		}
+	}
+}
+
+func (r *Room) handle(msg message) (err error) {
+	switch msg.kind {
+	case msg_join:
+		if r.members[msg.userid] {
+			return nil
+		}
+		if r.cfg.MaxMembers > 0 && len(r.members) >= r.cfg.MaxMembers {
+			return ERROR_ROOM_FULL
+		}
+		// 先占用玩家的房间归属, 同时加入两个房间时只有一个成功
+		if !_default_rooms.bind(msg.userid, r) {
+			return ERROR_IN_OTHER_ROOM
+		}
+		err = ERROR_ROOM_PANIC
+		r.safe_call(func() { err = r.logic.OnJoin(r, msg.userid) })
+		if err == nil && !r.closed {
+			r.members[msg.userid] = true
+		} else {
+			_default_rooms.unbind(msg.userid, r)
+		}
+	case msg_leave:
+		if !r.members[msg.userid] {
+			return ERROR_NOT_MEMBER
+		}
+		delete(r.members, msg.userid)
+		_default_rooms.unbind(msg.userid, r)
+		if len(r.members) == 0 {
+			r.emptied = time.Now()
+		}
+		r.safe_call(func() { r.logic.OnLeave(r, msg.userid) })
+	case msg_input:
+		if !r.members[msg.userid] {
+			return ERROR_NOT_MEMBER
+		}
+		r.safe_call(func() { r.logic.OnInput(r, msg.userid, msg.data) })
+	case msg_call:
+		r.safe_call(msg.fn)
+	}
+	return
+}
+
+// 执行逻辑回调, panic不会扩散到房间外, 超过上限后关闭房间
+func (r *Room) safe_call(fn func()) {
+	defer func() {
+		if x := recover(); x != nil {
+			r.panics++
+			log.Errorf("room %v panic(%v/%v): %v\n%s", r.Id, r.panics, r.cfg.MaxPanics, x, debug.Stack())
+			if r.panics >= r.cfg.MaxPanics {
+				r.close(CLOSE_CRASH)
+			}
+		}
+	}()
+	fn()
+}
+
+func (r *Room) check_timeout() {
+	now := time.Now()
+	if r.cfg.MaxLifetime > 0 && now.Sub(r.created) >= r.cfg.MaxLifetime {
+		r.close(CLOSE_LIFETIME)
+	} else if r.cfg.IdleTimeout > 0 && len(r.members) == 0 && now.Sub(r.emptied) >= r.cfg.IdleTimeout {
+		r.close(CLOSE_IDLE)
+	}
+}
+
+// 在房间goroutine中关闭, 逻辑的OnClose只会被调用一次
+func (r *Room) close(reason int) {
+	if r.closed {
+		return
+	}
+	r.closed = true
+
+	members := r.Members()
+	func() {
+		defer func() {
+			if x := recover(); x != nil {
+				log.Errorf("room %v panic on close: %v\n%s", r.Id, x, debug.Stack())
+			}
+		}()
+		r.logic.OnClose(r, reason)
+		if OnClosed != nil {
+			OnClosed(r, members, reason)
+		}
+	}()
+	close(r.die)
+	_default_rooms.remove(r, members)
+	log.Debugf("room %v closed, reason:%v frame:%v", r.Id, reason, r.frame)
+}
+
+// Members 当前成员, 只能在逻辑回调中调用
+func (r *Room) Members() []int32 {
+	ids := make([]int32, 0, len(r.members))
+	for id := range r.members {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// IsMember 是否为成员, 只能在逻辑回调中调用
+func (r *Room) IsMember(userid int32) bool {
+	return r.members[userid]
+}
+
+// Frame 当前帧号
+func (r *Room) Frame() uint32 {
+	return r.frame
+}
+
+// TickRate 每秒tick次数
+func (r *Room) TickRate() int {
+	return r.cfg.TickRate
+}
+
+// Logic 房间逻辑, 用于类型断言后通过Do访问
+func (r *Room) Logic() Logic {
+	return r.logic
+}
+
+// Broadcast 推送消息给全部成员, 成员队列满时丢弃, 只能在逻辑回调中调用
+func (r *Room) Broadcast(msg []byte) {
+	for id := range r.members {
+		ipc.SendMessage(id, msg)
+	}
+}
+
+// Send 推送消息给一个成员
+func (r *Room) Send(userid int32, msg []byte) bool {
+	return ipc.SendMessage(userid, msg)
+}
+
+// Close 关闭房间, 可以在任意goroutine中调用, 不阻塞; 已经排队的消息可能先于关闭处理
+func (r *Room) Close() {
+	r.once.Do(func() { close(r.quit) })
+}
+
+// Do 在房间goroutine中执行fn并等待完成, 用于外部读取或修改房间状态
+func (r *Room) Do(fn func()) error {
+	return r.call(message{kind: msg_call, fn: fn})
+}
+
+// Done 房间关闭时关闭的channel
+func (r *Room) Done() <-chan struct{} {
+	return r.die
+}
@@ -0,0 +1,159 @@
+package rooms
+
+import (
+	"errors"
+	"sync"
+)
+
+// 房间:
+// 房间/战斗实例, 每个房间是一个独立的goroutine, 拥有多个玩家共享的状态.
+// 会话处理函数把玩家的输入作为消息投递给房间, 房间按固定频率tick并推送状态给成员.
+// 逻辑中的panic只影响所在房间, 不会扩散到成员的会话; 次数超过上限后房间关闭.
+// 一个玩家同时只能在一个房间中.
+var (
+	ERROR_ROOM_NOT_FOUND = errors.New("room not found")
+	ERROR_IN_OTHER_ROOM  = errors.New("already in another room")
+	ERROR_NOT_IN_ROOM    = errors.New("not in any room")
+
+	OnClosed func(r *Room, members []int32, reason int) // 房间关闭, 用于通知成员
+)
+
+type rooms struct {
+	rooms  map[int64]*Room
+	users  map[int32]*Room // userid -> 所在房间
+	nextId int64
+	sync.RWMutex
+}
+
+var (
+	_default_rooms rooms
+)
+
+func init() {
+	_default_rooms.init()
+}
+
+func (rs *rooms) init() {
+	rs.rooms = make(map[int64]*Room)
+	rs.users = make(map[int32]*Room)
+}
+
+func (rs *rooms) create(cfg Config, logic Logic) *Room {
+	if cfg.TickRate <= 0 {
+		cfg.TickRate = DefaultConfig().TickRate
+	}
+	if cfg.MaxPanics <= 0 {
+		cfg.MaxPanics = 1
+	}
+
+	rs.Lock()
+	rs.nextId++
+	r := new_room(rs.nextId, cfg, logic)
+	rs.rooms[r.Id] = r
+	rs.Unlock()
+
+	go r.loop()
+	return r
+}
+
+// 由房间goroutine在关闭时调用
+func (rs *rooms) remove(r *Room, members []int32) {
+	rs.Lock()
+	defer rs.Unlock()
+	delete(rs.rooms, r.Id)
+	for _, id := range members {
+		if rs.users[id] == r {
+			delete(rs.users, id)
+		}
+	}
+}
+
+// 玩家不在其他房间中时绑定到r, 返回是否成功
+func (rs *rooms) bind(userid int32, r *Room) bool {
+	rs.Lock()
+	defer rs.Unlock()
+	if cur := rs.users[userid]; cur != nil && cur != r {
+		return false
+	}
+	rs.users[userid] = r
+	return true
+}
+
+func (rs *rooms) unbind(userid int32, r *Room) {
+	rs.Lock()
+	if rs.users[userid] == r {
+		delete(rs.users, userid)
+	}
+	rs.Unlock()
+}
+
+func (rs *rooms) get(id int64) *Room {
+	rs.RLock()
+	defer rs.RUnlock()
+	return rs.rooms[id]
+}
+
+func (rs *rooms) of(userid int32) *Room {
+	rs.RLock()
+	defer rs.RUnlock()
+	return rs.users[userid]
+}
+
+// Create 创建房间并开始tick
+func Create(cfg Config, logic Logic) *Room {
+	return _default_rooms.create(cfg, logic)
+}
+
+// Get 按id查找房间
+func Get(id int64) *Room {
+	return _default_rooms.get(id)
+}
+
+// Of 玩家所在的房间, 不在房间中返回nil
+func Of(userid int32) *Room {
+	return _default_rooms.of(userid)
+}
+
+// Count 房间数
+func Count() int {
+	_default_rooms.RLock()
+	defer _default_rooms.RUnlock()
+	return len(_default_rooms.rooms)
+}
+
+// Join 加入房间, 等待房间处理完毕; 已在其他房间中返回ERROR_IN_OTHER_ROOM
+func Join(id int64, userid int32) error {
+	r := Get(id)
+	if r == nil {
+		return ERROR_ROOM_NOT_FOUND
+	}
+	return r.call(message{kind: msg_join, userid: userid})
+}
+
+// Leave 离开所在的房间
+func Leave(userid int32) error {
+	r := Of(userid)
+	if r == nil {
+		return ERROR_NOT_IN_ROOM
+	}
+	return r.call(message{kind: msg_leave, userid: userid})
+}
+
+// Input 投递玩家输入到所在房间, 不等待处理
+func Input(userid int32, data []byte) error {
+	r := Of(userid)
+	if r == nil {
+		return ERROR_NOT_IN_ROOM
+	}
+	return r.post(message{kind: msg_input, userid: userid, data: data})
+}
+
+// Close 关闭房间
+func Close(id int64) error {
+	r := Get(id)
+	if r == nil {
+		return ERROR_ROOM_NOT_FOUND
+	}
+	r.Close()
+	return nil
+}
@@ -0,0 +1,160 @@
+package rooms
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+type test_logic struct {
+	inputs []string
+	ticks  uint32
+	closed chan int
+}
+
+func (l *test_logic) OnJoin(r *Room, userid int32) error {
+	if userid < 0 {
+		return errors.New("rejected")
+	}
+	return nil
+}
+func (l *test_logic) OnLeave(r *Room, userid int32) {}
+func (l *test_logic) OnInput(r *Room, userid int32, data []byte) {
+	if string(data) == "panic" {
+		panic("bad input")
+	}
+	l.inputs = append(l.inputs, string(data))
+}
+func (l *test_logic) OnTick(r *Room, frame uint32) { l.ticks = frame }
+func (l *test_logic) OnClose(r *Room, reason int)  { l.closed <- reason }
+
+func TestRoom(t *testing.T) {
+	l := &test_logic{closed: make(chan int, 1)}
+	cfg := DefaultConfig()
+	cfg.TickRate = 100
+	cfg.MaxMembers = 2
+	cfg.MaxPanics = 2
+	r := Create(cfg, l)
+
+	if err := Join(r.Id, -1); err == nil {
+		t.Fatal("expect rejected")
+	}
+	if err := Join(r.Id, 1); err != nil {
+		t.Fatal(err)
+	}
+	Join(r.Id, 2)
+	if err := Join(r.Id, 3); err != ERROR_ROOM_FULL {
+		t.Fatal("expect full, got:", err)
+	}
+	other := Create(cfg, &test_logic{closed: make(chan int, 1)})
+	defer other.Close()
+	if err := Join(other.Id, 1); err != ERROR_IN_OTHER_ROOM {
+		t.Fatal("expect in other room, got:", err)
+	}
+
+	Input(1, []byte("a"))
+	Input(2, []byte("b"))
+	Input(1, []byte("panic"))
+	time.Sleep(50 * time.Millisecond)
+
+	var inputs []string
+	var ticks uint32
+	r.Do(func() { inputs, ticks = l.inputs, l.ticks })
+	if len(inputs) != 2 || ticks == 0 {
+		t.Fatal("unexpected state:", inputs, ticks)
+	}
+
+	if err := Leave(2); err != nil {
+		t.Fatal(err)
+	}
+	if Of(2) != nil {
+		t.Fatal("user 2 should leave room")
+	}
+
+	// 第二次panic后房间关闭, 成员被移出
+	Input(1, []byte("panic"))
+	select {
+	case reason := <-l.closed:
+		if reason != CLOSE_CRASH {
+			t.Fatal("expect crash, got:", reason)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("room not closed")
+	}
+	<-r.Done()
+	if Of(1) != nil || Get(r.Id) != nil {
+		t.Fatal("room not removed")
+	}
+	if err := Input(1, []byte("a")); err != ERROR_NOT_IN_ROOM {
+		t.Fatal("expect not in room, got:", err)
+	}
+}
+
+func TestRoomIdle(t *testing.T) {
+	l := &test_logic{closed: make(chan int, 1)}
+	cfg := DefaultConfig()
+	cfg.TickRate = 100
+	cfg.IdleTimeout = 30 * time.Millisecond
+	Create(cfg, l)
+
+	select {
+	case reason := <-l.closed:
+		if reason != CLOSE_IDLE {
+			t.Fatal("expect idle, got:", reason)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("room not closed")
+	}
+}
+
+func TestJoinRace(t *testing.T) {
+	cfg := DefaultConfig()
+	a := Create(cfg, &test_logic{closed: make(chan int, 1)})
+	b := Create(cfg, &test_logic{closed: make(chan int, 1)})
+	defer a.Close()
+	defer b.Close()
+
+	// 同时加入两个房间, 只有一个成功
+	var wg sync.WaitGroup
+	errs := make([]error, 2)
+	for k, r := range []*Room{a, b} {
+		wg.Add(1)
+		go func(k int, r *Room) {
+			defer wg.Done()
+			errs[k] = Join(r.Id, 10)
+		}(k, r)
+	}
+	wg.Wait()
+	if (errs[0] == nil) == (errs[1] == nil) {
+		t.Fatal("unexpected results:", errs)
+	}
+	Leave(10)
+}
+
+func TestCloseBusy(t *testing.T) {
+	l := &test_logic{closed: make(chan int, 1)}
+	cfg := DefaultConfig()
+	cfg.InboxSize = 1
+	r := Create(cfg, l)
+
+	// 房间goroutine阻塞且队列已满时, Close仍然生效
+	block := make(chan struct{})
+	go r.Do(func() { <-block })
+	time.Sleep(20 * time.Millisecond)
+	r.post(message{kind: msg_input})
+	if err := r.post(message{kind: msg_input}); err != ERROR_ROOM_BUSY {
+		t.Fatal("expect busy, got:", err)
+	}
+	r.Close()
+	r.Close()
+	close(block)
+	select {
+	case reason := <-l.closed:
+		if reason != CLOSE_NORMAL {
+			t.Fatal("expect normal, got:", reason)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("room not closed")
+	}
+}
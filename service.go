@@ -63,6 +63,9 @@ func (s *server) Stream(stream GameService_StreamServer) error {
 	ch_ipc := make(chan *Game_Frame, DEFAULT_CH_IPC_SIZE)
 
 	defer func() {
+		if sess.Flag&SESS_REGISTERED != 0 {
+			client_handler.OnSessionEnd(&sess)
+		}
 		registry.Unregister(sess.UserId, ch_ipc)
 		close(sess_die)
 		log.Debug("stream end:", sess.UserId)
@@ -89,6 +92,8 @@ func (s *server) Stream(stream GameService_StreamServer) error {
 	// register user
 	sess.UserId = int32(userid)
 	registry.Register(sess.UserId, ch_ipc)
+	sess.Flag |= SESS_REGISTERED
+	client_handler.OnSessionStart(&sess)
 	log.Debug("userid", sess.UserId, "logged in")
 
 	// >> main message loop <<
@@ -119,7 +124,12 @@ func (s *server) Stream(stream GameService_StreamServer) error {
 
 				// construct frame & return message from logic
 				if ret != nil {
-					if err := stream.Send(&Game_Frame{Type: Game_Message, Message: ret}); err != nil {
+					frame := &Game_Frame{Type: Game_Message, Message: ret}
+					if sess.Metadata != nil {
+						frame.Metadata = sess.Metadata
+						sess.Metadata = nil
+					}
+					if err := stream.Send(frame); err != nil {
 						log.Error(err)
 						return err
 					}
@@ -78,6 +78,32 @@ func (p *service_pool) init(root string, hosts, services []string) {
 	p.connect_all(p.root)
 }
 
+// InitStatic init services from a static list, without etcd, eg:
+// snowflake-10000/snowflake1=127.0.0.1:50003
+//
+// each entry is service/id=address, the cannonical path becomes:
+// 			<root>/snowflake-10000/snowflake1
+func InitStatic(root string, services []string) {
+	once.Do(func() { _default_pool.init_static(root, services) })
+}
+
+func (p *service_pool) init_static(root string, services []string) {
+	p.root = root
+	p.services = make(map[string]*service)
+	p.names = make(map[string]bool)
+
+	for _, v := range services {
+		kv := strings.SplitN(strings.TrimSpace(v), "=", 2)
+		if len(kv) != 2 || !strings.Contains(kv[0], "/") {
+			log.Println("invalid static service:", v)
+			continue
+		}
+		// dial with block in background, as etcd watcher does
+		go p.add_service(p.root+"/"+kv[0], kv[1])
+	}
+	log.Println("static services:", services)
+}
+
 // connect to all services
 func (p *service_pool) connect_all(directory string) {
 	kAPI := etcdclient.NewKeysAPI(p.client)
@@ -0,0 +1,171 @@
+package shop
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"game/db"
+	"game/kafka"
+	"game/misc/locks"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+var _locks locks.UserLocks // 保证同一玩家的购买串行执行
+
+// 一个商品在当前刷新周期的购买数量
+type Bought struct {
+	Id    int32 `bson:"id"`
+	Count int32 `bson:"count"`
+	Reset int64 `bson:"reset"` // 下一次重置时间, 0为不重置
+}
+
+// 玩家的限购计数, 持久化的文档
+type record struct {
+	UserId int32    `bson:"_id"`
+	Goods  []Bought `bson:"goods"`
+}
+
+// 商品和玩家在当前周期的购买数量
+type Item struct {
+	*Goods
+	Bought int32
+}
+
+func lock(userid int32) *sync.Mutex {
+	return _locks.Of(userid)
+}
+
+func load(userid int32) (*record, error) {
+	r := &record{}
+	if err := _db.Load(COLLECTION_SHOP, userid, r); err == db.ERROR_NOT_FOUND {
+		return &record{UserId: userid}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// 商品在当前周期的计数, 已过重置时间的清零; create为false时不存在返回nil
+func (r *record) find(s *Shop, id int32, now time.Time, create bool) *Bought {
+	var b *Bought
+	for k := range r.Goods {
+		if r.Goods[k].Id == id {
+			b = &r.Goods[k]
+			break
+		}
+	}
+	if b == nil {
+		if !create {
+			return nil
+		}
+		r.Goods = append(r.Goods, Bought{Id: id})
+		b = &r.Goods[len(r.Goods)-1]
+		b.Reset = next_reset(s, now)
+	} else if b.Reset > 0 && now.Unix() >= b.Reset {
+		b.Count = 0
+		b.Reset = next_reset(s, now)
+	}
+	return b
+}
+
+func next_reset(s *Shop, now time.Time) int64 {
+	if s == nil || s.Schedule == nil {
+		return 0
+	}
+	if t := s.Schedule.Next(now); !t.IsZero() {
+		return t.Unix()
+	}
+	return 0
+}
+
+// List 商店中在售的商品和玩家的购买数量, refresh为下一次限购刷新时间(0为不刷新)
+func List(userid, shopid int32, now time.Time) (items []Item, refresh int64, err error) {
+	s := Get(shopid)
+	if s == nil {
+		return nil, 0, ERROR_GOODS_NOT_FOUND
+	}
+	m := lock(userid)
+	m.Lock()
+	r, err := load(userid)
+	m.Unlock()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	for _, g := range s.Goods {
+		if !g.OnSale(now) {
+			continue
+		}
+		item := Item{Goods: g}
+		if b := r.find(s, g.Id, now, false); b != nil {
+			item.Bought = b.Count
+		}
+		items = append(items, item)
+	}
+	sort.Slice(items, func(i, k int) bool { return items[i].Id < items[k].Id })
+	return items, next_reset(s, now), nil
+}
+
+// Buy 购买count个商品: 扣除价格, 发放商品, 发放失败时退还价格
+func Buy(userid, goodsid, count int32, now time.Time) (*Item, error) {
+	// 热更新不影响进行中的购买, 使用此时的定义完成
+	g, s := goods(goodsid)
+	if g == nil {
+		return nil, ERROR_GOODS_NOT_FOUND
+	}
+	if count <= 0 || count > MAX_BUY_COUNT {
+		return nil, ERROR_INVALID_COUNT
+	}
+	if !g.OnSale(now) {
+		return nil, ERROR_CLOSED
+	}
+	if Pay == nil || Grant == nil {
+		return nil, ERROR_PAY
+	}
+
+	m := lock(userid)
+	m.Lock()
+	defer m.Unlock()
+	r, err := load(userid)
+	if err != nil {
+		return nil, err
+	}
+	b := r.find(s, g.Id, now, true)
+	if g.Limit > 0 && b.Count+count > g.Limit {
+		return nil, ERROR_LIMIT
+	}
+
+	price, item := g.Price, g.Item
+	price.Count *= count
+	item.Count *= count
+	if err := Pay(userid, price); err != nil {
+		return nil, err
+	}
+	if err := Grant(userid, item); err != nil {
+		if Refund != nil {
+			if err := Refund(userid, price); err != nil {
+				log.Errorf("shop: refund failed, userid:%v goods:%v err:%v", userid, g.Id, err)
+			}
+		}
+		return nil, err
+	}
+
+	b.Count += count
+	bought := b.Count
+	if err := _db.Save(COLLECTION_SHOP, userid, r); err != nil {
+		// 商品已发放, 只丢失限购计数
+		log.Errorf("shop: save record failed, userid:%v goods:%v err:%v", userid, g.Id, err)
+	}
+	kafka.CommitUpdate(userid, r, COLLECTION_SHOP)
+	kafka.TraceEvent("shop_buy", userid, map[string]interface{}{
+		"shop":   g.Shop,
+		"goods":  g.Id,
+		"count":  count,
+		"price":  price,
+		"item":   item,
+		"bought": bought,
+	})
+	return &Item{Goods: g, Bought: bought}, nil
+}
@@ -0,0 +1,114 @@
+package shop
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"game/cron"
+	"game/db"
+	"game/mail"
+)
+
+// 商店:
+// 商店和商品定义来自数值表, 热更新时整体替换定义, 进行中的购买使用开始时取得的定义完成.
+// 商品可以有每个玩家的限购数量, 限购计数在商店的刷新时间(cron表达式)重置;
+// 重置是懒惰的: 计数记录下一次重置时间, 读取时已过期则视为0.
+// 设置了开始和结束时间的商品为限时商品, 只在时间段内可以购买.
+const (
+	COLLECTION_SHOP = "shop"
+	MAX_BUY_COUNT   = 99 // 单次购买的最大数量
+)
+
+var (
+	ERROR_GOODS_NOT_FOUND = errors.New("goods not found")
+	ERROR_INVALID_COUNT   = errors.New("invalid buy count")
+	ERROR_LIMIT           = errors.New("purchase limit reached")
+	ERROR_CLOSED          = errors.New("goods not on sale")
+	ERROR_PAY             = errors.New("shop price not paid")
+)
+
+// 商店定义
+type Shop struct {
+	Id       int32
+	Schedule *cron.Schedule // 限购刷新时间, nil为不刷新
+	Goods    []*Goods
+}
+
+// 商品定义, 购买count个时价格和物品都乘以count
+type Goods struct {
+	Id    int32
+	Shop  int32
+	Item  mail.Attachment
+	Price mail.Attachment
+	Limit int32     // 每个玩家每个刷新周期的限购数量, 0为不限
+	Start time.Time // 限时商品的开始时间, 零值为不限
+	End   time.Time // 限时商品的结束时间, 零值为不限
+}
+
+// OnSale 商品在t时是否在售
+func (g *Goods) OnSale(t time.Time) bool {
+	if !g.Start.IsZero() && t.Before(g.Start) {
+		return false
+	}
+	if !g.End.IsZero() && !t.Before(g.End) {
+		return false
+	}
+	return true
+}
+
+type defs struct {
+	shops map[int32]*Shop
+	goods map[int32]*Goods
+}
+
+var (
+	_db   *db.Database
+	_defs = &defs{shops: make(map[int32]*Shop), goods: make(map[int32]*Goods)}
+	_mu   sync.RWMutex
+
+	// Pay 扣除价格, 由上层设置
+	Pay func(userid int32, price mail.Attachment) error
+
+	// Grant 发放商品, 由上层设置, 返回错误时退还价格
+	Grant func(userid int32, item mail.Attachment) error
+
+	// Refund 发放失败时退还价格, 由上层设置
+	Refund func(userid int32, price mail.Attachment) error
+)
+
+func Init(database *db.Database) {
+	_db = database
+}
+
+// SetDefs 替换全部商店定义, 数值表热更新时调用
+func SetDefs(shops []*Shop) {
+	d := &defs{shops: make(map[int32]*Shop), goods: make(map[int32]*Goods)}
+	for _, s := range shops {
+		d.shops[s.Id] = s
+		for _, g := range s.Goods {
+			d.goods[g.Id] = g
+		}
+	}
+	_mu.Lock()
+	_defs = d
+	_mu.Unlock()
+}
+
+// Get 商店定义, 不存在时返回nil
+func Get(id int32) *Shop {
+	_mu.RLock()
+	defer _mu.RUnlock()
+	return _defs.shops[id]
+}
+
+// 商品和所属商店的定义
+func goods(id int32) (*Goods, *Shop) {
+	_mu.RLock()
+	defer _mu.RUnlock()
+	g := _defs.goods[id]
+	if g == nil {
+		return nil, nil
+	}
+	return g, _defs.shops[g.Shop]
+}
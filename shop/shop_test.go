@@ -0,0 +1,98 @@
+package shop
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"game/cron"
+	"game/db"
+	"game/kafka"
+	"game/mail"
+)
+
+func init() {
+	kafka.InitDiscard()
+}
+
+func TestBuy(t *testing.T) {
+	dir, err := ioutil.TempDir("", "shop")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	var database db.Database
+	database.InitLocal(dir)
+	Init(&database)
+
+	daily, _ := cron.Parse("0 5 * * *", time.UTC)
+	now := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	SetDefs([]*Shop{{
+		Id:       1,
+		Schedule: daily,
+		Goods: []*Goods{
+			{Id: 10, Shop: 1, Item: mail.Attachment{Type: mail.ATTACH_ITEM, Id: 100, Count: 2}, Price: mail.Attachment{Type: mail.ATTACH_CURRENCY, Id: 1, Count: 10}, Limit: 3},
+			{Id: 11, Shop: 1, Item: mail.Attachment{Type: mail.ATTACH_ITEM, Id: 101, Count: 1}, Price: mail.Attachment{Type: mail.ATTACH_CURRENCY, Id: 1, Count: 50}, Start: now.Add(time.Hour), End: now.Add(2 * time.Hour)},
+		},
+	}})
+
+	gold := int32(100)
+	bag := make(map[int32]int32)
+	full := false
+	Pay = func(userid int32, price mail.Attachment) error {
+		if gold < price.Count {
+			return ERROR_PAY
+		}
+		gold -= price.Count
+		return nil
+	}
+	Grant = func(userid int32, item mail.Attachment) error {
+		if full {
+			return errors.New("full")
+		}
+		bag[item.Id] += item.Count
+		return nil
+	}
+	Refund = func(userid int32, price mail.Attachment) error {
+		gold += price.Count
+		return nil
+	}
+
+	item, err := Buy(1, 10, 2, now)
+	if err != nil || item.Bought != 2 || gold != 80 || bag[100] != 4 {
+		t.Fatal("buy failed:", err, gold, bag)
+	}
+	if _, err := Buy(1, 10, 2, now); err != ERROR_LIMIT {
+		t.Fatal("limit not checked:", err)
+	}
+	full = true
+	if _, err := Buy(1, 10, 1, now); err == nil || gold != 80 {
+		t.Fatal("price not refunded:", err, gold)
+	}
+	full = false
+
+	// 限时商品
+	if _, err := Buy(1, 11, 1, now); err != ERROR_CLOSED {
+		t.Fatal("offer not started:", err)
+	}
+	if _, err := Buy(1, 11, 1, now.Add(90*time.Minute)); err != nil || gold != 30 {
+		t.Fatal("offer buy failed:", err, gold)
+	}
+	items, refresh, err := List(1, 1, now)
+	if err != nil || len(items) != 1 || items[0].Bought != 2 || refresh != now.Add(17*time.Hour).Unix() {
+		t.Fatal("unexpected list:", items, refresh, err)
+	}
+
+	// 第二天5点后限购重置
+	if item, err := Buy(1, 10, 3, now.Add(17*time.Hour)); err != nil || item.Bought != 3 {
+		t.Fatal("limit not reset:", item, err)
+	}
+
+	// 热更新后商品下架
+	SetDefs(nil)
+	if _, err := Buy(1, 10, 1, now); err != ERROR_GOODS_NOT_FOUND {
+		t.Fatal("removed goods:", err)
+	}
+}
@@ -2,6 +2,8 @@ package types
 
 const (
 	SESS_KICKED_OUT = 0x1 // 踢掉
+	SESS_REGISTERED = 0x2 // 已注册到registry
+	SESS_ENCRYPTED  = 0x4 // 已协商通信加密
 )
 
 // 会话:
@@ -10,4 +12,10 @@ const (
 type Session struct {
 	Flag   int32 // 会话标记
 	UserId int32
+	Token  int64 // 会话标识, 同一玩家在本实例上重连时区分新旧会话
+	User   *User // 登陆后的玩家数据
+
+	EncryptKey []byte            // 发往客户端方向的流加密密钥
+	DecryptKey []byte            // 客户端发来方向的流加密密钥
+	Metadata   map[string]string // 随下一个回复帧发给agent的附加信息
 }
@@ -1,12 +1,18 @@
 package types
 
+import (
+	"game/inventory"
+)
+
 // 一个DEMO的User定义
 type User struct {
-	Id            int32
+	Id            int32 `bson:"_id"`
 	Name          string
 	Level         uint8
+	Exp           int64 // 当前等级的经验
 	Score         int32
+	ScoreSeason   int32 // Score所属的赛季, 新赛季第一次修改时清零
 	LastLoginTime int64
 	CreateTime    int64
-	//Item          *ItemManager
+	Item          *inventory.ItemManager `bson:"-"` // 单独保存在背包集合中
 }